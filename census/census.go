@@ -0,0 +1,140 @@
+// Package census counts what is in the saved chunks of a world.
+package census
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+// Bounds is a box of voxels, including both corners.
+type Bounds struct {
+	Min chunk.VoxelCoordinate `json:"min"`
+	Max chunk.VoxelCoordinate `json:"max"`
+}
+
+// Report is what a census found.
+type Report struct {
+	// Chunks is the number of saved chunks.
+	Chunks int `json:"chunks"`
+	// Regions is the number of regions with saved chunks.
+	Regions int `json:"regions"`
+	// ModifiedChunks is the number of saved chunks whose blocks differ from
+	// what the generator generates.
+	ModifiedChunks int `json:"modifiedChunks"`
+	// Blocks is the number of voxels of each block type in saved chunks, by
+	// the name of the block type.
+	Blocks map[string]int `json:"blocks"`
+	// Files is the size of every file of the world in bytes, by path.
+	Files map[string]int64 `json:"files"`
+	// Explored is the box around all saved chunks, or nil if there are none.
+	Explored *Bounds `json:"explored,omitempty"`
+}
+
+// Take counts the blocks in the saved chunks of cacheMod, and compares every
+// chunk with what generator generates in its place. Chunks that fail to load
+// are left out with a warning.
+func Take(cacheMod cache.Interface, generator world.Generator, settingsRepo settings.Interface) (Report, error) {
+	report := Report{
+		Blocks: map[string]int{},
+		Files:  map[string]int64{},
+	}
+	chunkSize := int32(settingsRepo.GetChunkSize())
+	regionSize := settingsRepo.GetRegionSize()
+	positions, err := cacheMod.Chunks()
+	if err != nil {
+		return Report{}, err
+	}
+	regions := map[chunk.ChunkCoordinate]struct{}{}
+	for _, pos := range positions {
+		ch, err := cacheMod.Load(pos)
+		if err != nil {
+			log.Warnf("failed to load chunk %v: %v", pos, err)
+			continue
+		}
+		report.Chunks++
+		// regions hold chunks the way chunks hold voxels
+		regions[chunk.VoxelCoordToChunkCoord(chunk.VoxelCoordinate(pos), regionSize)] = struct{}{}
+		ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+			report.Blocks[ch.BlockType(vc).String()]++
+		})
+		if !world.IsUnchanged(generator, ch) {
+			report.ModifiedChunks++
+		}
+		from := chunk.VoxelCoordinate{X: pos.X * chunkSize, Y: pos.Y * chunkSize, Z: pos.Z * chunkSize}
+		to := chunk.VoxelCoordinate{X: from.X + chunkSize - 1, Y: from.Y + chunkSize - 1, Z: from.Z + chunkSize - 1}
+		if report.Explored == nil {
+			report.Explored = &Bounds{Min: from, Max: to}
+		}
+		report.Explored.Min, _ = chunk.BoxCorners(report.Explored.Min, from)
+		_, report.Explored.Max = chunk.BoxCorners(report.Explored.Max, to)
+	}
+	report.Regions = len(regions)
+	return report, nil
+}
+
+// AddFiles adds the sizes of all files in fs to the report.
+func (report *Report) AddFiles(fs afero.Fs) error {
+	return afero.Walk(fs, ".", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			report.Files[path.Clean(p)] = info.Size()
+		}
+		return nil
+	})
+}
+
+// WriteText writes the report in a form for people to read.
+func (report Report) WriteText(w io.Writer) error {
+	var err error
+	printf := func(format string, v ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, v...)
+		}
+	}
+	printf("chunks: %v\n", report.Chunks)
+	printf("regions: %v\n", report.Regions)
+	printf("modified chunks: %v\n", report.ModifiedChunks)
+	if report.Explored != nil {
+		printf("explored: %v to %v\n", report.Explored.Min, report.Explored.Max)
+	} else {
+		printf("explored: nothing\n")
+	}
+	printf("blocks:\n")
+	for _, name := range sortedKeys(report.Blocks) {
+		printf("  %v: %v\n", name, report.Blocks[name])
+	}
+	printf("files:\n")
+	total := int64(0)
+	names := make([]string, 0, len(report.Files))
+	for name, size := range report.Files {
+		names = append(names, name)
+		total += size
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printf("  %v: %v bytes\n", name, report.Files[name])
+	}
+	printf("  total: %v bytes\n", total)
+	return err
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
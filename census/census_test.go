@@ -0,0 +1,109 @@
+package census_test
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kroppt/voxels/census"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+var testSettings = settings.FnRepository{
+	FnGetChunkSize:  func() uint32 { return 2 },
+	FnGetRegionSize: func() uint32 { return 2 },
+}
+
+var airGenerator = &world.FnGenerator{
+	FnGenerateChunk: func(pos chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+		return chunk.NewChunkEmpty(pos, 2), list.New()
+	},
+}
+
+func TestTakeCountsSavedChunks(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.New(fs, testSettings)
+	modified := chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: -1}, 2)
+	modified.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: 1, Z: 1}, chunk.BlockTypeStone)
+	cacheMod.Save(modified)
+	cacheMod.Save(chunk.NewChunkEmpty(chunk.ChunkCoordinate{}, 2))
+	cacheMod.Save(chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: 1, Y: 1, Z: 1}, 2))
+
+	report, err := census.Take(cacheMod, airGenerator, testSettings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := census.Report{
+		Chunks:         3,
+		Regions:        2,
+		ModifiedChunks: 1,
+		Blocks: map[string]int{
+			"air":   23,
+			"stone": 1,
+		},
+		Files: map[string]int64{},
+		Explored: &census.Bounds{
+			Min: chunk.VoxelCoordinate{X: -2},
+			Max: chunk.VoxelCoordinate{X: 3, Y: 3, Z: 3},
+		},
+	}
+	if !reflect.DeepEqual(report, expect) {
+		t.Fatalf("expected %+v but got %+v", expect, report)
+	}
+	cacheMod.Close()
+	if err := report.AddFiles(fs); err != nil {
+		t.Fatal(err)
+	}
+	// a sector for the header of each region file and one for each chunk
+	expectFiles := map[string]int64{
+		"data/region/r.-1.0.0.vxr": 2 * 4096,
+		"data/region/r.0.0.0.vxr":  3 * 4096,
+		"data/format.data":         20,
+		"data/journal.data":        0,
+		"data/scheduled.data":      0,
+		"data/pending.data":        0,
+	}
+	if !reflect.DeepEqual(report.Files, expectFiles) {
+		t.Fatalf("expected files %v but got %v", expectFiles, report.Files)
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	t.Parallel()
+	report := census.Report{
+		Chunks:  1,
+		Regions: 1,
+		Blocks:  map[string]int{"stone": 2, "air": 6},
+		Files:   map[string]int64{"/a": 3, "/b": 4},
+	}
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"chunks: 1\n", "explored: nothing\n", "  air: 6\n  stone: 2\n", "  total: 7 bytes\n"} {
+		if !strings.Contains(text.String(), line) {
+			t.Fatalf("expected %q in\n%v", line, text.String())
+		}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded census.Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Fatalf("expected %+v after JSON round trip but got %+v", report, decoded)
+	}
+}
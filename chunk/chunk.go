@@ -2,6 +2,12 @@ package chunk
 
 import (
 	"container/list"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kroppt/voxels/log"
 )
 
 type Chunk struct {
@@ -17,6 +23,13 @@ type PendingAction struct {
 	Face     AdjacentMask
 }
 
+// ScheduledUpdate is an update of the voxel at VoxPos that is due Delay ticks
+// after its chunk is loaded.
+type ScheduledUpdate struct {
+	VoxPos VoxelCoordinate
+	Delay  int32
+}
+
 type ChunkCoordinate struct {
 	X int32
 	Y int32
@@ -48,6 +61,68 @@ const (
 	BlockTypeClay
 	BlockTypeLeaf
 )
+
+var blockTypeNames = [...]string{
+	BlockTypeAir:        "air",
+	BlockTypeDirt:       "dirt",
+	BlockTypeGrass:      "grass",
+	BlockTypeGrassSides: "grassSides",
+	BlockTypeLabeled:    "labeled",
+	BlockTypeCorrupted:  "corrupted",
+	BlockTypeStone:      "stone",
+	BlockTypeLight:      "light",
+	BlockTypeSnow:       "snow",
+	BlockTypeSnowSides:  "snowSides",
+	BlockTypeSand:       "sand",
+	BlockTypeLog:        "log",
+	BlockTypeLogDark:    "logDark",
+	BlockTypeClay:       "clay",
+	BlockTypeLeaf:       "leaf",
+}
+
+func (bt BlockType) String() string {
+	if int(bt) < len(blockTypeNames) {
+		return blockTypeNames[bt]
+	}
+	return "invalid"
+}
+
+// ParseBlockType returns the block type with the given name, as returned by
+// String, and whether there is one.
+func ParseBlockType(name string) (BlockType, bool) {
+	for bt, btName := range blockTypeNames {
+		if btName == name {
+			return BlockType(bt), true
+		}
+	}
+	return BlockTypeAir, false
+}
+
+// ParseVoxelCoordinate parses a voxel coordinate written as x,y,z.
+func ParseVoxelCoordinate(s string) (VoxelCoordinate, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 {
+		return VoxelCoordinate{}, fmt.Errorf("expected x,y,z but got %q", s)
+	}
+	var coords [3]int32
+	for i, field := range fields {
+		v, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return VoxelCoordinate{}, fmt.Errorf("invalid coordinate %q", field)
+		}
+		coords[i] = int32(v)
+	}
+	return VoxelCoordinate{X: coords[0], Y: coords[1], Z: coords[2]}, nil
+}
+
+// BoxCorners returns the lowest and the highest corner of the box of voxels
+// that has a and b as opposite corners.
+func BoxCorners(a, b VoxelCoordinate) (VoxelCoordinate, VoxelCoordinate) {
+	low := VoxelCoordinate{X: min(a.X, b.X), Y: min(a.Y, b.Y), Z: min(a.Z, b.Z)}
+	high := VoxelCoordinate{X: max(a.X, b.X), Y: max(a.Y, b.Y), Z: max(a.Z, b.Z)}
+	return low, high
+}
+
 const LargestVbits = uint32(BlockTypeLeaf)<<6 | uint32(AdjacentAll)
 
 const VertSize = 5
@@ -113,9 +188,25 @@ func NewChunkEmpty(chPos ChunkCoordinate, chSize uint32) Chunk {
 	return chunk
 }
 
+// ErrInvalidData indicates that the flat data of a chunk is not valid.
+const ErrInvalidData log.ConstErr = "invalid chunk data"
+
+// NewChunkFromData returns the chunk at chPos with the given flat data, and
+// panics if the data is not valid.
 func NewChunkFromData(data []float32, chSize uint32, chPos ChunkCoordinate) Chunk {
+	ch, err := ParseChunkData(data, chSize, chPos)
+	if err != nil {
+		panic(err)
+	}
+	return ch
+}
+
+// ParseChunkData returns the chunk at chPos with the given flat data. The error
+// wraps ErrInvalidData if the data has the wrong size, or a voxel with the
+// wrong coordinate or with vbits or lighting that no chunk could have.
+func ParseChunkData(data []float32, chSize uint32, chPos ChunkCoordinate) (Chunk, error) {
 	if len(data) != int(VertSize*chSize*chSize*chSize) {
-		panic("new chunk data has wrong size")
+		return Chunk{}, fmt.Errorf("%w: expected %v values but got %v", ErrInvalidData, VertSize*chSize*chSize*chSize, len(data))
 	}
 	size := int32(chSize)
 	ch := Chunk{
@@ -125,27 +216,82 @@ func NewChunkFromData(data []float32, chSize uint32, chPos ChunkCoordinate) Chun
 	for x := chPos.X * size; x < chPos.X*size+size; x++ {
 		for y := chPos.Y * size; y < chPos.Y*size+size; y++ {
 			for z := chPos.Z * size; z < chPos.Z*size+size; z++ {
-				off := ch.voxelPosToDataOffset(VoxelCoordinate{x, y, z})
-				if data[off] != float32(x) {
-					panic("invalid X coordinate in chunk data")
-				}
-				if data[off+1] != float32(y) {
-					panic("invalid Y coordinate in chunk data")
-				}
-				if data[off+2] != float32(z) {
-					panic("invalid Z coordinate in chunk data")
+				vc := VoxelCoordinate{x, y, z}
+				off := ch.voxelPosToDataOffset(vc)
+				if data[off] != float32(x) || data[off+1] != float32(y) || data[off+2] != float32(z) {
+					return Chunk{}, fmt.Errorf("%w: voxel %v has coordinate %v,%v,%v", ErrInvalidData, vc, data[off], data[off+1], data[off+2])
 				}
-				if data[off+3] > float32(LargestVbits) {
-					panic("invalid vbits in chunk data")
+				if !isWholeUpTo(data[off+3], LargestVbits) {
+					return Chunk{}, fmt.Errorf("%w: voxel %v has vbits %v", ErrInvalidData, vc, data[off+3])
 				}
-				if data[off+4] > float32(LightAll) {
-					panic("invalid lighting bits in chunk data")
+				if !isWholeUpTo(data[off+4], LightAll) {
+					return Chunk{}, fmt.Errorf("%w: voxel %v has lighting %v", ErrInvalidData, vc, data[off+4])
 				}
 			}
 		}
 	}
 	ch.flatData = data
-	return ch
+	return ch, nil
+}
+
+// BlockTypes returns the block type of every voxel, in the order of the voxels
+// in the flat data.
+func (c Chunk) BlockTypes() []BlockType {
+	blocks := make([]BlockType, len(c.flatData)/VertSize)
+	for i := range blocks {
+		blocks[i] = BlockType(uint32(c.flatData[i*VertSize+3]) >> 6)
+	}
+	return blocks
+}
+
+// ParseBlockTypes returns the chunk at chPos whose voxels have the given block
+// types, in the order of BlockTypes. The faces of every voxel are adjacent to
+// the voxels next to it within the chunk that aren't air, and the lighting is
+// 0. The error wraps ErrInvalidData if the number of block types is wrong, or
+// a block type is unknown.
+func ParseBlockTypes(blocks []BlockType, chSize uint32, chPos ChunkCoordinate) (Chunk, error) {
+	if len(blocks) != int(chSize*chSize*chSize) {
+		return Chunk{}, fmt.Errorf("%w: expected %v block types but got %v", ErrInvalidData, chSize*chSize*chSize, len(blocks))
+	}
+	for i, bt := range blocks {
+		if uint32(bt) > LargestVbits>>6 {
+			return Chunk{}, fmt.Errorf("%w: voxel %v has block type %v", ErrInvalidData, i, uint32(bt))
+		}
+	}
+	ch := NewChunkEmpty(chPos, chSize)
+	size := int(chSize)
+	solid := func(i int) bool {
+		return blocks[i] != BlockTypeAir
+	}
+	for i, bt := range blocks {
+		x, y, z := i%size, i/size%size, i/(size*size)
+		var adj AdjacentMask
+		if z > 0 && solid(i-size*size) {
+			adj |= AdjacentFront
+		}
+		if z < size-1 && solid(i+size*size) {
+			adj |= AdjacentBack
+		}
+		if y > 0 && solid(i-size) {
+			adj |= AdjacentBottom
+		}
+		if y < size-1 && solid(i+size) {
+			adj |= AdjacentTop
+		}
+		if x > 0 && solid(i-1) {
+			adj |= AdjacentLeft
+		}
+		if x < size-1 && solid(i+1) {
+			adj |= AdjacentRight
+		}
+		ch.flatData[i*VertSize+3] = float32(uint32(bt)<<6 | uint32(adj))
+	}
+	return ch, nil
+}
+
+// isWholeUpTo returns whether v is a whole number from 0 to max.
+func isWholeUpTo(v float32, max uint32) bool {
+	return v >= 0 && v <= float32(max) && v == float32(math.Trunc(float64(v)))
 }
 
 func (c Chunk) ForEachVoxel(f func(VoxelCoordinate)) {
@@ -171,6 +317,13 @@ func (c Chunk) GetFlatData() []float32 {
 	return c.flatData
 }
 
+// Copy returns a chunk with the same position, size and data that doesn't
+// share its data with c.
+func (c Chunk) Copy() Chunk {
+	c.flatData = append([]float32(nil), c.flatData...)
+	return c
+}
+
 func (c Chunk) isOutOfBounds(vpos VoxelCoordinate) bool {
 	return VoxelCoordToChunkCoord(vpos, c.size) != c.pos
 }
@@ -339,6 +492,93 @@ func (c Chunk) Vbits(vpos VoxelCoordinate) uint32 {
 	return uint32(c.BlockType(vpos))<<6 | uint32(c.Adjacency(vpos))
 }
 
+// CopyVoxel copies the block type, adjacency and lighting of the voxel at vpos
+// from another chunk. Both chunks must contain vpos, but they can have
+// different sizes.
+func (c Chunk) CopyVoxel(from Chunk, vpos VoxelCoordinate) {
+	off := c.voxelPosToDataOffset(vpos)
+	fromOff := from.voxelPosToDataOffset(vpos)
+	c.flatData[off+3] = from.flatData[fromOff+3]
+	c.flatData[off+4] = from.flatData[fromOff+4]
+}
+
+// MatchAdjacency sets the adjacency of the faces between c and other, which
+// must be next to each other and of the same size, from the block types on
+// either side. It returns whether the adjacency of c and of other changed.
+func (c Chunk) MatchAdjacency(other Chunk) (bool, bool) {
+	if c.size != other.size {
+		panic("tried to match the adjacency of chunks of different sizes")
+	}
+	d := ChunkCoordinate{X: other.pos.X - c.pos.X, Y: other.pos.Y - c.pos.Y, Z: other.pos.Z - c.pos.Z}
+	sides := []struct {
+		d           ChunkCoordinate
+		face, other AdjacentMask
+	}{
+		{ChunkCoordinate{Z: -1}, AdjacentFront, AdjacentBack},
+		{ChunkCoordinate{Z: 1}, AdjacentBack, AdjacentFront},
+		{ChunkCoordinate{Y: -1}, AdjacentBottom, AdjacentTop},
+		{ChunkCoordinate{Y: 1}, AdjacentTop, AdjacentBottom},
+		{ChunkCoordinate{X: -1}, AdjacentLeft, AdjacentRight},
+		{ChunkCoordinate{X: 1}, AdjacentRight, AdjacentLeft},
+	}
+	i := 0
+	for i < len(sides) && sides[i].d != d {
+		i++
+	}
+	if i == len(sides) {
+		panic("tried to match the adjacency of chunks that aren't next to each other")
+	}
+	side := sides[i]
+	// the voxels of c on the side next to other
+	size := int32(c.size)
+	from := VoxelCoordinate{X: c.pos.X * size, Y: c.pos.Y * size, Z: c.pos.Z * size}
+	to := VoxelCoordinate{X: from.X + size - 1, Y: from.Y + size - 1, Z: from.Z + size - 1}
+	switch {
+	case d.X > 0:
+		from.X = to.X
+	case d.X < 0:
+		to.X = from.X
+	case d.Y > 0:
+		from.Y = to.Y
+	case d.Y < 0:
+		to.Y = from.Y
+	case d.Z > 0:
+		from.Z = to.Z
+	case d.Z < 0:
+		to.Z = from.Z
+	}
+	changedC, changedOther := false, false
+	for x := from.X; x <= to.X; x++ {
+		for y := from.Y; y <= to.Y; y++ {
+			for z := from.Z; z <= to.Z; z++ {
+				vc := VoxelCoordinate{X: x, Y: y, Z: z}
+				next := VoxelCoordinate{X: x + d.X, Y: y + d.Y, Z: z + d.Z}
+				if c.matchFace(vc, side.face, other.BlockType(next) != BlockTypeAir) {
+					changedC = true
+				}
+				if other.matchFace(next, side.other, c.BlockType(vc) != BlockTypeAir) {
+					changedOther = true
+				}
+			}
+		}
+	}
+	return changedC, changedOther
+}
+
+// matchFace makes the face of the voxel at vpos adjacent if adjacent is true,
+// and not adjacent otherwise, and returns whether that changed it.
+func (c Chunk) matchFace(vpos VoxelCoordinate, face AdjacentMask, adjacent bool) bool {
+	if (c.Adjacency(vpos)&face != 0) == adjacent {
+		return false
+	}
+	if adjacent {
+		c.AddAdjacency(vpos, face)
+	} else {
+		c.RemoveAdjacency(vpos, face)
+	}
+	return true
+}
+
 func VoxelCoordToChunkCoord(pos VoxelCoordinate, chunkSize uint32) ChunkCoordinate {
 	if chunkSize == 0 {
 		panic("chunk size 0 is invalid")
@@ -2,7 +2,9 @@ package chunk_test
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
 
@@ -514,6 +516,66 @@ func TestLoadChunkFromFlatDataDetectsError(t *testing.T) {
 	}
 }
 
+func TestParseChunkData(t *testing.T) {
+	t.Parallel()
+	vbits, light := float32(chunk.LargestVbits), float32(chunk.LightAll)
+	testCases := []struct {
+		desc string
+		data []float32
+	}{
+		{
+			desc: "wrong size",
+			data: []float32{0, 0, 0, vbits},
+		},
+		{
+			desc: "wrong coordinate",
+			data: []float32{0, 1, 0, vbits, light},
+		},
+		{
+			desc: "vbits too large",
+			data: []float32{0, 0, 0, vbits + 1, light},
+		},
+		{
+			desc: "negative vbits",
+			data: []float32{0, 0, 0, -1, light},
+		},
+		{
+			desc: "fractional lighting",
+			data: []float32{0, 0, 0, vbits, 0.5},
+		},
+		{
+			desc: "lighting not a number",
+			data: []float32{0, 0, 0, vbits, float32(math.NaN())},
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := chunk.ParseChunkData(tC.data, 1, chunk.ChunkCoordinate{})
+
+			if !errors.Is(err, chunk.ErrInvalidData) {
+				t.Fatalf("expected %v but got %v", chunk.ErrInvalidData, err)
+			}
+		})
+	}
+	t.Run("valid data", func(t *testing.T) {
+		t.Parallel()
+		expected := chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: -1, Y: 2, Z: 0}, 2)
+		expected.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: 4, Z: 0}, chunk.BlockTypeDirt)
+
+		actual, err := chunk.ParseChunkData(expected.GetFlatData(), 2, expected.Position())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+}
+
 func TestValidChunkDataScenario(t *testing.T) {
 	t.Parallel()
 	ch := chunk.NewChunkEmpty(chunk.ChunkCoordinate{1, 1, 1}, 3)
@@ -799,3 +861,145 @@ func TestChunkAppliesActions(t *testing.T) {
 		t.Fatalf("(2) expected adjacency %v but got %v", expect2, actual2)
 	}
 }
+
+func TestCopyDoesNotShareData(t *testing.T) {
+	t.Parallel()
+	ch := chunk.NewChunkEmpty(chunk.ChunkCoordinate{1, 2, 3}, 2)
+	vc := chunk.VoxelCoordinate{2, 4, 6}
+
+	copied := ch.Copy()
+	ch.SetBlockType(vc, chunk.BlockTypeDirt)
+
+	if copied.Position() != ch.Position() || copied.Size() != ch.Size() {
+		t.Fatalf("expected chunk %v of size %v but got %v of size %v", ch.Position(), ch.Size(), copied.Position(), copied.Size())
+	}
+	if copied.BlockType(vc) != chunk.BlockTypeAir {
+		t.Fatal("expected the copy not to change with the chunk")
+	}
+}
+
+func TestCopyVoxelBetweenChunkSizes(t *testing.T) {
+	t.Parallel()
+	from := chunk.NewChunkEmpty(chunk.ChunkCoordinate{1, 0, 0}, 2)
+	vc := chunk.VoxelCoordinate{3, 1, 0}
+	from.SetBlockType(vc, chunk.BlockTypeDirt)
+	from.SetAdjacency(vc, chunk.AdjacentTop|chunk.AdjacentLeft)
+	from.SetLighting(vc, chunk.LightTop, 7)
+	to := chunk.NewChunkEmpty(chunk.ChunkCoordinate{0, 0, 0}, 4)
+
+	to.CopyVoxel(from, vc)
+
+	if to.Vbits(vc) != from.Vbits(vc) {
+		t.Fatalf("expected vbits %v but got %v", from.Vbits(vc), to.Vbits(vc))
+	}
+	if to.Lighting(vc, chunk.LightTop) != 7 {
+		t.Fatalf("expected lighting 7 but got %v", to.Lighting(vc, chunk.LightTop))
+	}
+	if to.BlockType(chunk.VoxelCoordinate{2, 1, 0}) != chunk.BlockTypeAir {
+		t.Fatal("expected the other voxels not to change")
+	}
+}
+
+func TestParseBlockTypesRebuildsChunk(t *testing.T) {
+	t.Parallel()
+	expect := chunk.NewChunkEmpty(chunk.ChunkCoordinate{-1, 0, 2}, 3)
+	expect.SetBlockType(chunk.VoxelCoordinate{-3, 0, 6}, chunk.BlockTypeStone)
+	expect.SetBlockType(chunk.VoxelCoordinate{-2, 1, 7}, chunk.BlockTypeDirt)
+	expect.SetBlockType(chunk.VoxelCoordinate{-2, 2, 7}, chunk.BlockTypeGrass)
+
+	actual, err := chunk.ParseBlockTypes(expect.BlockTypes(), 3, chunk.ChunkCoordinate{-1, 0, 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual.GetFlatData(), expect.GetFlatData()) {
+		t.Fatalf("expected flat data %v but got %v", expect.GetFlatData(), actual.GetFlatData())
+	}
+}
+
+func TestParseBlockTypesRejectsInvalidBlockTypes(t *testing.T) {
+	t.Parallel()
+	for _, blocks := range [][]chunk.BlockType{
+		make([]chunk.BlockType, 7),
+		{chunk.BlockTypeAir, chunk.BlockTypeDirt, chunk.BlockTypeLeaf + 1, 0, 0, 0, 0, 0},
+	} {
+		if _, err := chunk.ParseBlockTypes(blocks, 2, chunk.ChunkCoordinate{}); !errors.Is(err, chunk.ErrInvalidData) {
+			t.Fatalf("expected block types %v to fail with %v but got %v", blocks, chunk.ErrInvalidData, err)
+		}
+	}
+}
+
+func TestMatchAdjacency(t *testing.T) {
+	t.Parallel()
+	ch := chunk.NewChunkEmpty(chunk.ChunkCoordinate{0, 0, 0}, 2)
+	other := chunk.NewChunkEmpty(chunk.ChunkCoordinate{1, 0, 0}, 2)
+	ch.SetBlockType(chunk.VoxelCoordinate{1, 0, 0}, chunk.BlockTypeDirt)
+	other.SetBlockType(chunk.VoxelCoordinate{2, 1, 1}, chunk.BlockTypeDirt)
+	// a face that nothing covers anymore
+	ch.AddAdjacency(chunk.VoxelCoordinate{1, 1, 0}, chunk.AdjacentRight)
+
+	changedCh, changedOther := ch.MatchAdjacency(other)
+
+	if !changedCh || !changedOther {
+		t.Fatalf("expected both chunks to change, but got %v and %v", changedCh, changedOther)
+	}
+	if adj := other.Adjacency(chunk.VoxelCoordinate{2, 0, 0}); adj != chunk.AdjacentLeft {
+		t.Fatalf("expected adjacency %v but got %v", chunk.AdjacentLeft, adj)
+	}
+	if adj := ch.Adjacency(chunk.VoxelCoordinate{1, 1, 1}); adj != chunk.AdjacentRight {
+		t.Fatalf("expected adjacency %v but got %v", chunk.AdjacentRight, adj)
+	}
+	if adj := ch.Adjacency(chunk.VoxelCoordinate{1, 1, 0}); adj&chunk.AdjacentRight != 0 {
+		t.Fatalf("expected the uncovered face not to be adjacent, but got %v", adj)
+	}
+	if changedCh, changedOther := ch.MatchAdjacency(other); changedCh || changedOther {
+		t.Fatal("expected matching again to change nothing")
+	}
+}
+
+func TestParseBlockTypeRoundTrip(t *testing.T) {
+	t.Parallel()
+	for bt := chunk.BlockTypeAir; bt <= chunk.BlockTypeLeaf; bt++ {
+		actual, ok := chunk.ParseBlockType(bt.String())
+		if !ok {
+			t.Fatalf("expected %q to parse, but it did not", bt.String())
+		}
+		if actual != bt {
+			t.Fatalf("expected %v but got %v", bt, actual)
+		}
+	}
+	if _, ok := chunk.ParseBlockType("bedrock"); ok {
+		t.Fatal("expected unknown name not to parse, but it did")
+	}
+}
+
+func TestParseVoxelCoordinate(t *testing.T) {
+	t.Parallel()
+	actual, err := chunk.ParseVoxelCoordinate("1, -2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := chunk.VoxelCoordinate{X: 1, Y: -2, Z: 3}
+	if actual != expect {
+		t.Fatalf("expected %v but got %v", expect, actual)
+	}
+	for _, s := range []string{"", "1,2", "1,2,3,4", "1,x,3", "1,2,99999999999"} {
+		if _, err := chunk.ParseVoxelCoordinate(s); err == nil {
+			t.Fatalf("expected %q not to parse, but it did", s)
+		}
+	}
+}
+
+func TestBoxCorners(t *testing.T) {
+	t.Parallel()
+	a := chunk.VoxelCoordinate{X: 3, Y: -1, Z: 0}
+	b := chunk.VoxelCoordinate{X: -2, Y: 4, Z: 0}
+
+	low, high := chunk.BoxCorners(a, b)
+
+	expectLow := chunk.VoxelCoordinate{X: -2, Y: -1, Z: 0}
+	expectHigh := chunk.VoxelCoordinate{X: 3, Y: 4, Z: 0}
+	if low != expectLow || high != expectHigh {
+		t.Fatalf("expected corners %v and %v but got %v and %v", expectLow, expectHigh, low, high)
+	}
+}
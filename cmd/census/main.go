@@ -0,0 +1,77 @@
+// Command census reports what is in the saved chunks of a world, such as how
+// many voxels there are of each block type and how large its files are.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/census"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to count")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	asJSON := flag.Bool("json", false, "write the report as JSON instead of text")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cacheMod, err := cache.OpenReadOnly(worldsRepo.GetSelectedFs(), settingsRepo, meta.ChunkSize, meta.RegionSize)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	report, err := census.Take(cacheMod, generator, settingsRepo)
+	if closeErr := cacheMod.Close(); closeErr != nil {
+		log.Warn(closeErr)
+	}
+	if err != nil {
+		log.Fatalf("cannot count the chunks of world %v: %v", meta.Name, err)
+	}
+	if err := report.AddFiles(worldsRepo.GetSelectedFs()); err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
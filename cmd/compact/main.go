@@ -0,0 +1,55 @@
+// Command compact moves the saved chunks of a world into the space that
+// chunks left behind when they were moved or removed, and shrinks the save
+// files.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to compact")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	stats, err := cache.Compact(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot compact world %v: %v", meta.Name, err)
+	}
+	log.Infof("moved %v chunks of %v, reclaiming %v of %v bytes", stats.Moved, meta.Name,
+		stats.BytesBefore-stats.BytesAfter, stats.BytesBefore)
+}
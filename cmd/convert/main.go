@@ -0,0 +1,59 @@
+// Command convert moves the chunks of a world saved in three files into a file
+// per region.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to convert")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if meta.ChunkSize != settingsRepo.GetChunkSize() || meta.RegionSize != settingsRepo.GetRegionSize() {
+		log.Fatalf("world %v was created with chunk size %v and region size %v", meta.Name, meta.ChunkSize, meta.RegionSize)
+	}
+
+	converted, err := cache.ConvertToRegionFiles(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if meta.FormatVersion < 2 {
+		meta.FormatVersion = 2
+		if err := worldsRepo.SaveMetadata(id, meta); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Infof("moved %v chunks of %v into region files", converted, meta.Name)
+}
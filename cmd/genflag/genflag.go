@@ -0,0 +1,52 @@
+// Package genflag is the flag that commands which create worlds take the
+// settings of the world generator with.
+package genflag
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kroppt/voxels/modules/world"
+)
+
+// Settings is a flag that collects key=value generator settings, for the
+// generator of a world that a command creates.
+type Settings map[string]string
+
+func (gs Settings) String() string {
+	pairs := make([]string, 0, len(gs))
+	for key, value := range gs {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (gs Settings) Set(s string) error {
+	elements := strings.SplitN(s, "=", 2)
+	if len(elements) != 2 || strings.TrimSpace(elements[0]) == "" {
+		return fmt.Errorf("expected key=value but got %q", s)
+	}
+	gs[strings.TrimSpace(elements[0])] = strings.TrimSpace(elements[1])
+	return nil
+}
+
+// ForWorld returns the settings to store in the metadata of a new world. The
+// heightmap image is stored as an absolute path, so the world can be opened
+// from another working directory.
+func (gs Settings) ForWorld() (map[string]string, error) {
+	stored := make(map[string]string, len(gs))
+	for key, value := range gs {
+		stored[key] = value
+	}
+	if path, ok := stored[world.HeightmapImageSetting]; ok {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		stored[world.HeightmapImageSetting] = abs
+	}
+	return stored, nil
+}
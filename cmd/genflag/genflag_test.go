@@ -0,0 +1,59 @@
+package genflag_test
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kroppt/voxels/cmd/genflag"
+)
+
+func TestSettingsFlag(t *testing.T) {
+	t.Parallel()
+	genSettings := genflag.Settings{}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(genSettings, "generatorSetting", "")
+
+	err := flags.Parse([]string{"-generatorSetting", "image=terrain.png", "-generatorSetting", " scale = 2 "})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := genflag.Settings{"image": "terrain.png", "scale": "2"}
+	if !reflect.DeepEqual(genSettings, expect) {
+		t.Fatalf("expected %v but got %v", expect, genSettings)
+	}
+	if s := genSettings.String(); s != "image=terrain.png,scale=2" {
+		t.Fatalf("expected image=terrain.png,scale=2 but got %v", s)
+	}
+	for _, invalid := range []string{"image", "=terrain.png"} {
+		if err := genSettings.Set(invalid); err == nil {
+			t.Fatalf("expected setting %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestSettingsForWorldStoresAbsoluteImagePath(t *testing.T) {
+	t.Parallel()
+	genSettings := genflag.Settings{"image": "maps/terrain.png", "scale": "2"}
+
+	stored, err := genSettings.ForWorld()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := filepath.Abs("maps/terrain.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"image": image, "scale": "2"}
+	if !reflect.DeepEqual(stored, expect) {
+		t.Fatalf("expected %v but got %v", expect, stored)
+	}
+	if genSettings["image"] != "maps/terrain.png" {
+		t.Fatalf("expected the flag to keep the path it was given, but got %v", genSettings["image"])
+	}
+}
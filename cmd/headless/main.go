@@ -0,0 +1,190 @@
+// Command headless runs the game without a window or GPU. It plays back a
+// script of movement and edits for a number of ticks and reports how long it
+// took, for benchmarks, soak tests and servers.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/cmd/genflag"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/script"
+	"github.com/kroppt/voxels/modules/tick"
+	"github.com/kroppt/voxels/modules/view"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/kroppt/voxels/util"
+	"github.com/spf13/afero"
+)
+
+// saveQueueSize is how many changed chunks can wait to be written to the cache,
+// the same as in the game.
+const saveQueueSize = 256
+
+func main() {
+	worldName := flag.String("world", "", "name of the world to simulate, created if it doesn't exist; a throwaway in-memory world is used if empty")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	scriptPath := flag.String("script", "", "script of movement and edits to play back, such as an input recording of the game")
+	ticks := flag.Int("ticks", 0, "number of ticks to simulate; if 0, runs until the end of the script")
+	realtime := flag.Bool("realtime", false, "run ticks at the game's tick rate instead of as fast as possible")
+	seed := flag.Int64("seed", 0, "seed of a newly created world, unless the script says which world it was recorded in")
+	generatorName := flag.String("generator", "alex", "generator of a newly created world, unless the script says which world it was recorded in")
+	genSettings := genflag.Settings{}
+	flag.Var(genSettings, "generatorSetting", "key=value setting of the generator of a newly created world, such as image=terrain.png for the heightmap generator; may be repeated")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetPerfOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+	util.SetMetricsEnabled(true)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+
+	fs := afero.NewOsFs()
+	if *worldName == "" {
+		fs = afero.NewMemMapFs()
+		*worldName = "headless"
+	}
+	var scriptData []byte
+	var start script.Start
+	hasStart := false
+	if *scriptPath != "" {
+		readCloser, err := fileMod.GetReadCloser(*scriptPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scriptData, err = io.ReadAll(readCloser)
+		readCloser.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		start, hasStart, err = script.ReadStart(bytes.NewReader(scriptData))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if hasStart {
+			// a recording only plays back the same way in the world it was
+			// recorded in
+			*seed = start.Seed
+			*generatorName = start.Generator
+		}
+	}
+
+	worldsRepo := worlds.New(fs)
+	id, err := worldsRepo.Find(*worldName)
+	if errors.Is(err, worlds.ErrWorldNotFound) {
+		log.Infof("creating world %v", *worldName)
+		var generatorSettings map[string]string
+		generatorSettings, err = genSettings.ForWorld()
+		if err == nil {
+			id, err = worldsRepo.Create(worlds.Metadata{
+				Name:              *worldName,
+				Seed:              *seed,
+				Generator:         *generatorName,
+				GeneratorSettings: generatorSettings,
+				ChunkSize:         settingsRepo.GetChunkSize(),
+				RegionSize:        settingsRepo.GetRegionSize(),
+				Spawn:             worlds.Position{X: 0.5, Y: 20, Z: 0.5},
+				FormatVersion:     worlds.FormatVersion,
+			})
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hasStart && (meta.Seed != start.Seed || meta.Generator != start.Generator) {
+		log.Warnf("script was recorded in a world with seed %v and generator %v, but world %v has seed %v and generator %v",
+			start.Seed, start.Generator, meta.Name, meta.Seed, meta.Generator)
+	}
+
+	graphicsMod := graphics.NewRecorder()
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	savedMod, err := cache.Open(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	cacheMod := cache.NewWriteBehind(savedMod, saveQueueSize)
+	go cacheMod.Run()
+	if !hasStart {
+		spawn := chunk.VoxelCoordinate{
+			X: int32(math.Floor(meta.Spawn.X)),
+			Y: int32(math.Floor(meta.Spawn.Y)),
+			Z: int32(math.Floor(meta.Spawn.Z)),
+		}
+		safe := world.FindSafeSpawn(generator, cacheMod, settingsRepo, spawn)
+		start.Position = player.PositionEvent{
+			X: meta.Spawn.X,
+			Y: meta.Spawn.Y + float64(safe.Y-spawn.Y),
+			Z: meta.Spawn.Z,
+		}
+		start.Rotation = mgl.QuatIdent()
+	}
+	viewMod := view.New(graphicsMod, settingsRepo)
+	worldMod := world.New(graphicsMod, generator, settingsRepo, cacheMod, viewMod)
+	worldMod.SetRandomTickSeed(meta.Seed)
+	playerMod := player.New(worldMod, settingsRepo, viewMod)
+	cameraMod := camera.NewWithDirection(playerMod, start.Position, player.DirectionEvent{Rotation: start.Rotation})
+	scriptMod := script.New(cameraMod, playerMod, worldMod)
+	if err := scriptMod.Load(bytes.NewReader(scriptData)); err != nil {
+		log.Fatal(err)
+	}
+	total := *ticks
+	if total == 0 {
+		total = scriptMod.GetLastTick() + 1
+	}
+	if total == 0 {
+		log.Fatal("nothing to simulate, give a number of ticks or a script")
+	}
+	tickRateNano := int64(1 * 1e6)
+	tickMod := tick.New(cameraMod, worldMod, tick.FnTime{}, tickRateNano)
+
+	before := time.Now()
+	for tickMod.GetTick() < total {
+		if *realtime && !tickMod.IsNextTickReady() {
+			time.Sleep(time.Duration(tickRateNano / 10))
+			continue
+		}
+		scriptMod.RunTick(tickMod.GetTick())
+		tickMod.AdvanceTick()
+	}
+	duration := time.Since(before)
+	rec := graphicsMod.GetRecording()
+	log.Perff("ticks: %v, duration: %v, ticks per second: %v", total, duration, float64(total)/duration.Seconds())
+	log.Perff("chunk loads: %v, unloads: %v, updates: %v, loaded: %v, in view: %v",
+		rec.ChunkLoads, rec.ChunkUnloads, rec.ChunkUpdates, rec.LoadedChunks, rec.ViewableChunks)
+	worldMod.Quit()
+	util.LogMetrics()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// sdlFree are the commands that have to build on machines without SDL2 or
+// OpenGL, such as servers and CI.
+var sdlFree = []string{
+	"github.com/kroppt/voxels/cmd/census",
+	"github.com/kroppt/voxels/cmd/compact",
+	"github.com/kroppt/voxels/cmd/convert",
+	"github.com/kroppt/voxels/cmd/headless",
+	"github.com/kroppt/voxels/cmd/migrate",
+	"github.com/kroppt/voxels/cmd/server",
+	"github.com/kroppt/voxels/cmd/trim",
+	"github.com/kroppt/voxels/cmd/voxexport",
+	"github.com/kroppt/voxels/cmd/voximport",
+	"github.com/kroppt/voxels/cmd/worldmap",
+}
+
+func TestCommandsDoNotDependOnSDL(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is needed to list dependencies")
+	}
+	for _, cmd := range sdlFree {
+		out, err := exec.Command(goTool, "list", "-deps", cmd).Output()
+		if err != nil {
+			t.Fatalf("failed to list the dependencies of %v: %v", cmd, err)
+		}
+		for _, dep := range strings.Fields(string(out)) {
+			if strings.HasPrefix(dep, "github.com/veandco/go-sdl2/") || strings.HasPrefix(dep, "github.com/go-gl/gl/") {
+				t.Fatalf("expected %v not to depend on SDL or OpenGL, but it depends on %v", cmd, dep)
+			}
+		}
+	}
+}
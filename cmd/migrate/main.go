@@ -0,0 +1,70 @@
+// Command migrate upgrades the save files of a world to the current format,
+// and re-chunks them if the chunk size or region size in the settings changed
+// since the world was saved.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to migrate")
+	settingsPath := flag.String("settings", "settings.conf", "settings file with the chunk size and region size to migrate to")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fs := worldsRepo.GetSelectedFs()
+	if _, err := cache.RecordFormat(fs, meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	format, err := cache.Migrate(fs, settingsRepo, func(pos chunk.ChunkCoordinate) chunk.Chunk {
+		ch, _ := generator.GenerateChunk(pos)
+		return ch
+	})
+	if err != nil {
+		log.Fatalf("cannot migrate world %v: %v", meta.Name, err)
+	}
+	meta.FormatVersion = format.Version
+	meta.ChunkSize = format.ChunkSize
+	meta.RegionSize = format.RegionSize
+	if err := worldsRepo.SaveMetadata(id, meta); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("world %v has format version %v, chunk size %v and region size %v", meta.Name, format.Version, format.ChunkSize, format.RegionSize)
+}
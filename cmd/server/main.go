@@ -0,0 +1,140 @@
+// Command server runs a world that players can join over the network.
+package main
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/cmd/genflag"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/server"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/protocol"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+// tickRate is how often the world ticks, the same as in the game.
+const tickRate = time.Millisecond
+
+// saveQueueSize is how many changed chunks can wait to be written to the cache,
+// the same as in the game.
+const saveQueueSize = 256
+
+func main() {
+	addr := flag.String("addr", ":7777", "address to accept players on")
+	worldName := flag.String("world", "server", "name of the world to serve, created if it doesn't exist")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	seed := flag.Int64("seed", 0, "seed of a newly created world")
+	generatorName := flag.String("generator", "alex", "generator of a newly created world")
+	genSettings := genflag.Settings{}
+	flag.Var(genSettings, "generatorSetting", "key=value setting of the generator of a newly created world, such as image=terrain.png for the heightmap generator; may be repeated")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if errors.Is(err, worlds.ErrWorldNotFound) {
+		log.Infof("creating world %v", *worldName)
+		var generatorSettings map[string]string
+		generatorSettings, err = genSettings.ForWorld()
+		if err == nil {
+			id, err = worldsRepo.Create(worlds.Metadata{
+				Name:              *worldName,
+				Seed:              *seed,
+				Generator:         *generatorName,
+				GeneratorSettings: generatorSettings,
+				ChunkSize:         settingsRepo.GetChunkSize(),
+				RegionSize:        settingsRepo.GetRegionSize(),
+				Spawn:             worlds.Position{X: 0.5, Y: 20, Z: 0.5},
+				FormatVersion:     worlds.FormatVersion,
+			})
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	savedMod, err := cache.Open(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	cacheMod := cache.NewWriteBehind(savedMod, saveQueueSize)
+	go cacheMod.Run()
+	go func() {
+		// reclaims the space that chunks left behind in earlier sessions,
+		// without holding up loading chunks
+		if err := cacheMod.Compact(); err != nil {
+			log.Warnf("failed to compact world %v: %v", meta.Name, err)
+		}
+	}()
+	spawn := chunk.VoxelCoordinate{
+		X: int32(math.Floor(meta.Spawn.X)),
+		Y: int32(math.Floor(meta.Spawn.Y)),
+		Z: int32(math.Floor(meta.Spawn.Z)),
+	}
+	safe := world.FindSafeSpawn(generator, cacheMod, settingsRepo, spawn)
+	serverMod := server.New(generator, settingsRepo, cacheMod, protocol.Position{
+		X: meta.Spawn.X,
+		Y: meta.Spawn.Y + float64(safe.Y-spawn.Y),
+		Z: meta.Spawn.Z,
+	}, tickRate)
+	serverMod.SetRandomTickSeed(meta.Seed)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("serving world %v on %v", meta.Name, listener.Addr())
+
+	stopped := make(chan struct{})
+	go func() {
+		serverMod.Run()
+		close(stopped)
+	}()
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		log.Info("shutting down")
+		serverMod.Close()
+	}()
+	if err := serverMod.Serve(listener); err != nil {
+		log.Warn(err)
+		serverMod.Close()
+	}
+	<-stopped
+}
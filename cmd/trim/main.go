@@ -0,0 +1,132 @@
+// Command trim removes saved chunks of a world that are far away or that are
+// the same as what the generator generates, and shrinks the save files.
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to trim")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	radius := flag.Float64("radius", 0, "remove chunks entirely farther than this many voxels from -center along X and Z; 0 keeps chunks at any distance")
+	center := flag.String("center", "", "center of -radius as x,y,z; the world spawn if empty")
+	from := flag.String("from", "", "one corner of a box as x,y,z, to remove chunks entirely outside of; requires -to")
+	to := flag.String("to", "", "the other corner of the box of -from")
+	unchanged := flag.Bool("unchanged", false, "remove chunks whose blocks are the same as what the generator generates")
+	dryRun := flag.Bool("dryrun", false, "report what would be removed without changing anything")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	if *radius < 0 {
+		log.Fatal("-radius can't be negative")
+	}
+	if (*from == "") != (*to == "") {
+		log.Fatal("-from and -to must be given together")
+	}
+	if *radius == 0 && *from == "" && !*unchanged {
+		log.Fatal("nothing to trim; give -radius, -from and -to, or -unchanged")
+	}
+	var boxMin, boxMax chunk.VoxelCoordinate
+	if *from != "" {
+		a, err := chunk.ParseVoxelCoordinate(*from)
+		if err != nil {
+			log.Fatalf("invalid -from: %v", err)
+		}
+		b, err := chunk.ParseVoxelCoordinate(*to)
+		if err != nil {
+			log.Fatalf("invalid -to: %v", err)
+		}
+		boxMin, boxMax = chunk.BoxCorners(a, b)
+	}
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if meta.ChunkSize != settingsRepo.GetChunkSize() || meta.RegionSize != settingsRepo.GetRegionSize() {
+		log.Fatalf("world %v was created with chunk size %v and region size %v", meta.Name, meta.ChunkSize, meta.RegionSize)
+	}
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	centerX, centerZ := meta.Spawn.X, meta.Spawn.Z
+	if *center != "" {
+		vc, err := chunk.ParseVoxelCoordinate(*center)
+		if err != nil {
+			log.Fatalf("invalid -center: %v", err)
+		}
+		centerX, centerZ = float64(vc.X), float64(vc.Z)
+	}
+
+	size := int32(settingsRepo.GetChunkSize())
+	remove := func(ch chunk.Chunk) bool {
+		pos := ch.Position()
+		low := chunk.VoxelCoordinate{X: pos.X * size, Y: pos.Y * size, Z: pos.Z * size}
+		high := chunk.VoxelCoordinate{X: low.X + size - 1, Y: low.Y + size - 1, Z: low.Z + size - 1}
+		if *radius > 0 {
+			dx := math.Max(0, math.Max(float64(low.X)-centerX, centerX-float64(high.X)))
+			dz := math.Max(0, math.Max(float64(low.Z)-centerZ, centerZ-float64(high.Z)))
+			if math.Hypot(dx, dz) > *radius {
+				return true
+			}
+		}
+		if *from != "" {
+			if high.X < boxMin.X || high.Y < boxMin.Y || high.Z < boxMin.Z ||
+				low.X > boxMax.X || low.Y > boxMax.Y || low.Z > boxMax.Z {
+				return true
+			}
+		}
+		return *unchanged && world.IsUnchanged(generator, ch)
+	}
+
+	if !*dryRun {
+		if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+			log.Fatal(err)
+		}
+	}
+	stats, err := cache.Trim(worldsRepo.GetSelectedFs(), settingsRepo, remove, *dryRun)
+	if err != nil {
+		log.Fatalf("cannot trim world %v: %v", meta.Name, err)
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	log.Infof("%v %v of %v chunks of %v, reclaiming %v of %v bytes", verb, stats.Removed, stats.Chunks, meta.Name,
+		stats.BytesBefore-stats.BytesAfter, stats.BytesBefore)
+	if stats.Corrupt > 0 && *dryRun {
+		log.Warnf("would quarantine %v corrupt chunks", stats.Corrupt)
+	} else if stats.Corrupt > 0 {
+		log.Warnf("quarantined %v corrupt chunks in data/quarantine.data", stats.Corrupt)
+	}
+}
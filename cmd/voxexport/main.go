@@ -0,0 +1,89 @@
+// Command voxexport writes a box of a world to a MagicaVoxel .vox file.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/modules/view"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/kroppt/voxels/vox"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to export from")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	from := flag.String("from", "", "corner of the box to export, as x,y,z")
+	to := flag.String("to", "", "opposite corner of the box to export, as x,y,z")
+	outPath := flag.String("out", "export.vox", "file to write")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	a, err := chunk.ParseVoxelCoordinate(*from)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	b, err := chunk.ParseVoxelCoordinate(*to)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+
+	fileMod := file.New()
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	cacheMod, err := cache.Open(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	worldMod := world.New(&graphics.FnModule{}, generator, settingsRepo, cacheMod, &view.FnModule{})
+	defer worldMod.Quit()
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var box vox.Box
+	box.Min, box.Max = chunk.BoxCorners(a, b)
+	err = vox.Export(out, worldMod, settingsRepo, box, vox.DefaultBlockColors())
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+	log.Infof("exported %v to %v from %v to %v", meta.Name, *outPath, box.Min, box.Max)
+}
@@ -0,0 +1,96 @@
+// Command voximport places the voxels of a MagicaVoxel .vox file in a world.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/modules/view"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/kroppt/voxels/vox"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to import into")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	inPath := flag.String("in", "", "file to import")
+	at := flag.String("at", "0,0,0", "where the lowest corner of the import goes, as x,y,z")
+	colorsPath := flag.String("colors", "", "table of block colors to match the palette against; the default colors are used if empty")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	origin, err := chunk.ParseVoxelCoordinate(*at)
+	if err != nil {
+		log.Fatalf("invalid -at: %v", err)
+	}
+	fileMod := file.New()
+	colors := vox.DefaultBlockColors()
+	if *colorsPath != "" {
+		readCloser, err := fileMod.GetReadCloser(*colorsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		colors, err = vox.ReadBlockColors(readCloser)
+		readCloser.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	readCloser, err := fileMod.GetReadCloser(*inPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := vox.Read(readCloser)
+	readCloser.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	cacheMod, err := cache.Open(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	worldMod := world.New(&graphics.FnModule{}, generator, settingsRepo, cacheMod, &view.FnModule{})
+	defer worldMod.Quit()
+
+	if err := vox.Import(f, worldMod, settingsRepo, origin, colors); err != nil {
+		log.Warn(err)
+		return
+	}
+	log.Infof("imported %v into %v at %v", *inPath, meta.Name, origin)
+}
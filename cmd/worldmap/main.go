@@ -0,0 +1,95 @@
+// Command worldmap draws a map of the saved chunks of a world as seen from
+// above, without running the game.
+package main
+
+import (
+	"flag"
+	"image/png"
+	"os"
+
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/file"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/kroppt/voxels/topdown"
+	"github.com/kroppt/voxels/vox"
+	"github.com/spf13/afero"
+)
+
+func main() {
+	worldName := flag.String("world", "world", "name of the world to draw")
+	settingsPath := flag.String("settings", "settings.conf", "settings file to read")
+	outPath := flag.String("out", "map.png", "PNG file to write")
+	colorsPath := flag.String("colors", "", "table of block colors; the default colors are used if empty")
+	shade := flag.Bool("shade", false, "make higher columns lighter and lower columns darker")
+	grid := flag.Bool("grid", false, "draw the borders of chunks")
+	flag.Parse()
+
+	log.SetInfoOutput(os.Stderr)
+	log.SetWarnOutput(os.Stderr)
+	log.SetFatalOutput(os.Stderr)
+	log.SetColorized(false)
+
+	fileMod := file.New()
+	colors := vox.DefaultBlockColors()
+	if *colorsPath != "" {
+		readCloser, err := fileMod.GetReadCloser(*colorsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		colors, err = vox.ReadBlockColors(readCloser)
+		readCloser.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	settingsRepo := settings.New()
+	if readCloser, err := fileMod.GetReadCloser(*settingsPath); err != nil {
+		log.Warn(err)
+	} else {
+		settingsRepo.SetFromReader(readCloser)
+		readCloser.Close()
+	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	id, err := worldsRepo.Find(*worldName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cacheMod, err := cache.OpenReadOnly(worldsRepo.GetSelectedFs(), settingsRepo, meta.ChunkSize, meta.RegionSize)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+
+	img, corner, err := topdown.Render(cacheMod, settingsRepo, topdown.Options{
+		Colors: colors,
+		Shade:  *shade,
+		Grid:   *grid,
+	})
+	if closeErr := cacheMod.Close(); closeErr != nil {
+		log.Warn(closeErr)
+	}
+	if err != nil {
+		log.Fatalf("cannot draw world %v: %v", meta.Name, err)
+	}
+	if img.Bounds().Empty() {
+		log.Warnf("world %v has no saved chunks", meta.Name)
+		return
+	}
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = png.Encode(out, img)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("cannot write %v: %v", *outPath, err)
+	}
+	log.Infof("drew %v to %v with its top left corner at X %v, Z %v", meta.Name, *outPath, corner.X, corner.Z)
+}
@@ -1,26 +1,48 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"math"
 	"os"
 	"sync"
 	"time"
 
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/cmd/genflag"
 	"github.com/kroppt/voxels/log"
 	"github.com/kroppt/voxels/modules/cache"
 	"github.com/kroppt/voxels/modules/camera"
 	"github.com/kroppt/voxels/modules/file"
-	"github.com/kroppt/voxels/modules/graphics"
 	"github.com/kroppt/voxels/modules/input"
 	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/renderer"
+	"github.com/kroppt/voxels/modules/script"
 	"github.com/kroppt/voxels/modules/tick"
 	"github.com/kroppt/voxels/modules/view"
 	"github.com/kroppt/voxels/modules/world"
 	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/repositories/worlds"
 	"github.com/kroppt/voxels/util"
 	"github.com/spf13/afero"
 )
 
+// playerSaveInterval is how many ticks pass between saves of the player state.
+const playerSaveInterval = 30000
+
+// saveQueueSize is how many changed chunks can wait to be written to the cache
+// before saving more waits for them.
+const saveQueueSize = 256
+
 func main() {
+	worldName := flag.String("world", "world", "name of the world to play, created if it doesn't exist")
+	recordPath := flag.String("record", "", "file to record input to, for replaying with the headless command")
+	generatorName := flag.String("generator", "alex", "generator of a newly created world")
+	genSettings := genflag.Settings{}
+	flag.Var(genSettings, "generatorSetting", "key=value setting of the generator of a newly created world, such as image=terrain.png for the heightmap generator; may be repeated")
+	flag.Parse()
+
 	log.SetInfoOutput(os.Stderr)
 	log.SetWarnOutput(os.Stderr)
 	log.SetDebugOutput(os.Stderr)
@@ -37,8 +59,10 @@ func main() {
 		settingsRepo.SetFromReader(readCloser)
 		readCloser.Close()
 	}
+	worldsRepo := worlds.New(afero.NewOsFs())
+	meta := openWorld(worldsRepo, settingsRepo, *worldName, *generatorName, genSettings)
 
-	graphicsMod := graphics.NewParallel(settingsRepo)
+	graphicsMod := renderer.NewParallel(settingsRepo)
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -50,9 +74,31 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	generator := world.NewAlexWorldGenerator(settingsRepo)
-	// generator := world.NewFlatWorldGenerator(settingsRepo)
-	cacheMod := cache.New(afero.NewOsFs(), settingsRepo)
+	generator, err := world.NewGenerator(meta.Generator, meta.GeneratorSettings, settingsRepo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := cache.RecordFormat(worldsRepo.GetSelectedFs(), meta.ChunkSize, meta.RegionSize); err != nil {
+		log.Fatal(err)
+	}
+	savedMod, err := cache.Open(worldsRepo.GetSelectedFs(), settingsRepo)
+	if err != nil {
+		log.Fatalf("cannot open world %v: %v", meta.Name, err)
+	}
+	cacheMod := cache.NewWriteBehind(savedMod, saveQueueSize)
+	wg.Add(1)
+	go func() {
+		cacheMod.Run()
+		wg.Done()
+	}()
+	go func() {
+		// reclaims the space that chunks left behind in earlier sessions,
+		// without holding up loading chunks
+		if err := cacheMod.Compact(); err != nil {
+			log.Warnf("failed to compact world %v: %v", meta.Name, err)
+		}
+	}()
+	initialState := loadPlayerState(worldsRepo, meta, generator, cacheMod, settingsRepo)
 	viewMod := view.NewParallel(graphicsMod, settingsRepo)
 	wg.Add(1)
 	go func() {
@@ -60,16 +106,36 @@ func main() {
 		wg.Done()
 	}()
 	worldMod := world.NewParallel(graphicsMod, generator, settingsRepo, cacheMod, viewMod)
+	worldMod.SetRandomTickSeed(meta.Seed)
 	wg.Add(1)
 	go func() {
 		worldMod.Run()
 		wg.Done()
 	}()
 	playerMod := player.New(worldMod, settingsRepo, viewMod)
-	cameraMod := camera.New(playerMod, player.PositionEvent{X: 0.5, Y: 20, Z: 0.5})
+	cameraMod := camera.NewWithDirection(playerMod, player.PositionEvent{
+		X: initialState.Position.X,
+		Y: initialState.Position.Y,
+		Z: initialState.Position.Z,
+	}, player.DirectionEvent{Rotation: initialState.Rotation})
 	inputMod := input.New(graphicsMod, cameraMod, settingsRepo, playerMod)
 	tickRateNano := int64(1 * 1e6)
-	tickMod := tick.New(cameraMod, tick.FnTime{}, tickRateNano)
+	tickMod := tick.New(cameraMod, worldMod, tick.FnTime{}, tickRateNano)
+	var recordFile *os.File
+	var recorder *input.Recorder
+	if *recordPath != "" {
+		recordFile, err = os.Create(*recordPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorder = input.NewRecorder(recordFile, tickMod, script.Start{
+			Position:  cameraMod.GetPosition(),
+			Rotation:  cameraMod.GetRotation(),
+			Seed:      meta.Seed,
+			Generator: meta.Generator,
+		})
+		inputMod.SetRecorder(recorder)
+	}
 	graphicsMod.ShowWindow()
 
 	keepRunning := true
@@ -78,6 +144,9 @@ func main() {
 	for keepRunning {
 		if tickMod.IsNextTickReady() {
 			tickMod.AdvanceTick()
+			if tickMod.GetTick()%playerSaveInterval == 0 {
+				savePlayerState(worldsRepo, cameraMod)
+			}
 		}
 		graphicsMod.Render()
 		frames++
@@ -85,7 +154,127 @@ func main() {
 	}
 	duration := time.Since(before)
 	log.Perff("frames: %v, duration: %v, fps: %v", frames, duration, float64(frames)/duration.Seconds())
+	savePlayerState(worldsRepo, cameraMod)
+	if recordFile != nil {
+		if err := recorder.Err(); err != nil {
+			log.Warn(err)
+		}
+		if err := recordFile.Close(); err != nil {
+			log.Warn(err)
+		}
+	}
 	worldMod.Close()
 	wg.Wait()
 	util.LogMetrics()
 }
+
+// legacyDataDirectory is where the game saved its only world before it kept
+// worlds apart.
+const legacyDataDirectory = "data"
+
+// openWorld opens the world with the given name, creating it first with the
+// given generator if there is no such world. If there are no worlds at all and
+// the game saved a world in legacyDataDirectory, that world is imported
+// instead of creating a new one.
+func openWorld(worldsRepo worlds.Interface, settingsRepo settings.Interface, name, generatorName string, genSettings genflag.Settings) worlds.Metadata {
+	legacy := hasLegacyWorld(worldsRepo)
+	id, err := worldsRepo.Find(name)
+	if errors.Is(err, worlds.ErrWorldNotFound) && legacy {
+		log.Infof("importing the world in %v as world %v", legacyDataDirectory, name)
+		// older versions only had this generator, and saved chunks the way
+		// format version 1 does
+		id, err = worldsRepo.Import(worlds.Metadata{
+			Name:          name,
+			Seed:          time.Now().UnixNano(),
+			Generator:     "alex",
+			ChunkSize:     settingsRepo.GetChunkSize(),
+			RegionSize:    settingsRepo.GetRegionSize(),
+			Spawn:         worlds.Position{X: 0.5, Y: 20, Z: 0.5},
+			FormatVersion: 1,
+		}, legacyDataDirectory)
+	} else if errors.Is(err, worlds.ErrWorldNotFound) {
+		generatorSettings, settingsErr := genSettings.ForWorld()
+		if settingsErr != nil {
+			log.Fatalf("cannot create world %v: %v", name, settingsErr)
+		}
+		// a world that its generator can't be made for couldn't be played
+		if _, err := world.NewGenerator(generatorName, generatorSettings, settingsRepo); err != nil {
+			log.Fatalf("cannot create world %v: %v", name, err)
+		}
+		log.Infof("creating world %v", name)
+		id, err = worldsRepo.Create(worlds.Metadata{
+			Name:              name,
+			Seed:              time.Now().UnixNano(),
+			Generator:         generatorName,
+			GeneratorSettings: generatorSettings,
+			ChunkSize:         settingsRepo.GetChunkSize(),
+			RegionSize:        settingsRepo.GetRegionSize(),
+			Spawn:             worlds.Position{X: 0.5, Y: 20, Z: 0.5},
+			FormatVersion:     worlds.FormatVersion,
+		})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return meta
+}
+
+// hasLegacyWorld returns whether the game saved a world in
+// legacyDataDirectory that is to be imported, which it is only while there are
+// no worlds.
+func hasLegacyWorld(worldsRepo worlds.Interface) bool {
+	if !worldsRepo.HasLegacyData(legacyDataDirectory) {
+		return false
+	}
+	if list, err := worldsRepo.List(); err == nil && len(list) == 0 {
+		return true
+	}
+	log.Warnf("%v holds a world saved by an older version of the game, which is only imported while there are no worlds", legacyDataDirectory)
+	return false
+}
+
+// loadPlayerState returns the saved player state of the open world. If there is
+// none, or it can't be read, the player looks straight ahead from the first
+// place at or above the world spawn that isn't inside the terrain.
+func loadPlayerState(worldsRepo worlds.Interface, meta worlds.Metadata, generator world.Generator, cacheMod cache.Interface, settingsRepo settings.Interface) worlds.PlayerState {
+	id, _ := worldsRepo.GetSelected()
+	state, err := worldsRepo.LoadPlayerState(id)
+	if err == nil {
+		return state
+	}
+	if !errors.Is(err, worlds.ErrNoPlayerState) {
+		log.Warnf("spawning at world spawn: %v", err)
+	}
+	spawn := chunk.VoxelCoordinate{
+		X: int32(math.Floor(meta.Spawn.X)),
+		Y: int32(math.Floor(meta.Spawn.Y)),
+		Z: int32(math.Floor(meta.Spawn.Z)),
+	}
+	safe := world.FindSafeSpawn(generator, cacheMod, settingsRepo, spawn)
+	return worlds.PlayerState{
+		Position: worlds.Position{
+			X: meta.Spawn.X,
+			Y: meta.Spawn.Y + float64(safe.Y-spawn.Y),
+			Z: meta.Spawn.Z,
+		},
+		Rotation: mgl.QuatIdent(),
+	}
+}
+
+// savePlayerState saves where the camera is and which way it is looking to the
+// open world.
+func savePlayerState(worldsRepo worlds.Interface, cameraMod camera.Interface) {
+	id, _ := worldsRepo.GetSelected()
+	pos := cameraMod.GetPosition()
+	err := worldsRepo.SavePlayerState(id, worlds.PlayerState{
+		Position: worlds.Position{X: pos.X, Y: pos.Y, Z: pos.Z},
+		Rotation: cameraMod.GetRotation(),
+	})
+	if err != nil {
+		log.Warnf("failed to save player state: %v", err)
+	}
+}
@@ -1,47 +1,171 @@
 package cache
 
-import "github.com/kroppt/voxels/chunk"
+import (
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+)
+
+// ErrNotFound indicates that a chunk isn't saved.
+const ErrNotFound log.ConstErr = "chunk is not saved"
+
+// ErrCorrupt indicates that a chunk is saved, but its data is invalid.
+const ErrCorrupt log.ConstErr = "saved chunk is corrupt"
+
+// ErrReadOnly indicates that a cache opened with OpenReadOnly was asked to
+// change its files.
+const ErrReadOnly log.ConstErr = "cache is open read-only"
 
 type Interface interface {
-	Save(chunk.Chunk)
-	Load(chunk.ChunkCoordinate) (chunk.Chunk, bool)
-	Close()
+	// Save saves a chunk, replacing the chunk saved at its position.
+	Save(chunk.Chunk) error
+	// Load returns the chunk saved at a position. The error wraps ErrNotFound
+	// if no chunk is saved there, or ErrCorrupt if the saved chunk is invalid.
+	// Any other error is a failure to read the cache files.
+	Load(chunk.ChunkCoordinate) (chunk.Chunk, error)
+	SaveScheduled(chunk.ChunkCoordinate, []chunk.ScheduledUpdate)
+	LoadScheduled(chunk.ChunkCoordinate) []chunk.ScheduledUpdate
+	SavePending(chunk.ChunkCoordinate, []chunk.PendingAction)
+	LoadPending(chunk.ChunkCoordinate) []chunk.PendingAction
+	// Quarantine moves the data of a saved chunk out of the way into a
+	// quarantine file, so that the chunk counts as not saved. It is meant for
+	// corrupt chunks, whose data might still help someone fix the world.
+	Quarantine(chunk.ChunkCoordinate) error
+	Chunks() ([]chunk.ChunkCoordinate, error)
+	// CompactStep moves one saved chunk into free space nearer the start of
+	// the cache files, and shrinks the files by the free space they end in.
+	// It returns false once there is nothing left to move, so that compacting
+	// the cache files is calling it until it returns false. Each step is
+	// short, so other calls don't wait long for compaction.
+	CompactStep() (bool, error)
+	// Close writes what is left to the cache files and closes them.
+	Close() error
 }
 
-func (m *Module) Save(chunk chunk.Chunk) {
-	m.c.save(chunk)
+func (m *Module) Save(chunk chunk.Chunk) error {
+	return m.c.save(chunk)
 }
 
-func (m *Module) Load(key chunk.ChunkCoordinate) (chunk.Chunk, bool) {
+func (m *Module) Load(key chunk.ChunkCoordinate) (chunk.Chunk, error) {
 	return m.c.load(key)
 }
 
-func (m *Module) Close() {
-	m.c.close()
+// SaveScheduled replaces the scheduled updates stored for a chunk.
+func (m *Module) SaveScheduled(key chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+	m.c.saveScheduled(key, updates)
+}
+
+// LoadScheduled returns the scheduled updates stored for a chunk.
+func (m *Module) LoadScheduled(key chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+	return m.c.loadScheduled(key)
+}
+
+// SavePending replaces the pending actions stored for a chunk.
+func (m *Module) SavePending(key chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+	m.c.savePending(key, actions)
+}
+
+// LoadPending returns the pending actions stored for a chunk.
+func (m *Module) LoadPending(key chunk.ChunkCoordinate) []chunk.PendingAction {
+	return m.c.loadPending(key)
+}
+
+// Quarantine moves the data of a saved chunk into the quarantine file.
+func (m *Module) Quarantine(key chunk.ChunkCoordinate) error {
+	return m.c.quarantine(key)
+}
+
+// Chunks returns the positions of all saved chunks.
+func (m *Module) Chunks() ([]chunk.ChunkCoordinate, error) {
+	return m.c.chunks()
+}
+
+// CompactStep moves one saved chunk into free space nearer the start of the
+// cache files.
+func (m *Module) CompactStep() (bool, error) {
+	return m.c.compactStep()
+}
+
+func (m *Module) Close() error {
+	return m.c.close()
 }
 
 type FnModule struct {
-	FnSave  func(chunk.Chunk)
-	FnLoad  func(chunk.ChunkCoordinate) (chunk.Chunk, bool)
-	FnClose func()
+	FnSave          func(chunk.Chunk) error
+	FnLoad          func(chunk.ChunkCoordinate) (chunk.Chunk, error)
+	FnSaveScheduled func(chunk.ChunkCoordinate, []chunk.ScheduledUpdate)
+	FnLoadScheduled func(chunk.ChunkCoordinate) []chunk.ScheduledUpdate
+	FnSavePending   func(chunk.ChunkCoordinate, []chunk.PendingAction)
+	FnLoadPending   func(chunk.ChunkCoordinate) []chunk.PendingAction
+	FnQuarantine    func(chunk.ChunkCoordinate) error
+	FnChunks        func() ([]chunk.ChunkCoordinate, error)
+	FnCompactStep   func() (bool, error)
+	FnClose         func() error
 }
 
-func (fn *FnModule) Save(chunk chunk.Chunk) {
+func (fn *FnModule) Save(chunk chunk.Chunk) error {
 	if fn.FnSave != nil {
-		fn.FnSave(chunk)
+		return fn.FnSave(chunk)
 	}
-
+	return nil
 }
 
-func (fn *FnModule) Load(pos chunk.ChunkCoordinate) (chunk.Chunk, bool) {
+func (fn *FnModule) Load(pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
 	if fn.FnLoad != nil {
 		return fn.FnLoad(pos)
 	}
-	return chunk.Chunk{}, false
+	return chunk.Chunk{}, ErrNotFound
+}
+
+func (fn *FnModule) SaveScheduled(pos chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+	if fn.FnSaveScheduled != nil {
+		fn.FnSaveScheduled(pos, updates)
+	}
+}
+
+func (fn *FnModule) LoadScheduled(pos chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+	if fn.FnLoadScheduled != nil {
+		return fn.FnLoadScheduled(pos)
+	}
+	return nil
+}
+
+func (fn *FnModule) SavePending(pos chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+	if fn.FnSavePending != nil {
+		fn.FnSavePending(pos, actions)
+	}
+}
+
+func (fn *FnModule) LoadPending(pos chunk.ChunkCoordinate) []chunk.PendingAction {
+	if fn.FnLoadPending != nil {
+		return fn.FnLoadPending(pos)
+	}
+	return nil
+}
+
+func (fn *FnModule) Quarantine(pos chunk.ChunkCoordinate) error {
+	if fn.FnQuarantine != nil {
+		return fn.FnQuarantine(pos)
+	}
+	return nil
+}
+
+func (fn *FnModule) Chunks() ([]chunk.ChunkCoordinate, error) {
+	if fn.FnChunks != nil {
+		return fn.FnChunks()
+	}
+	return nil, nil
+}
+
+func (fn *FnModule) CompactStep() (bool, error) {
+	if fn.FnCompactStep != nil {
+		return fn.FnCompactStep()
+	}
+	return false, nil
 }
 
-func (fn *FnModule) Close() {
+func (fn *FnModule) Close() error {
 	if fn.FnClose != nil {
-		fn.FnClose()
+		return fn.FnClose()
 	}
+	return nil
 }
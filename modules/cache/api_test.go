@@ -1,8 +1,15 @@
 package cache_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/kroppt/voxels/chunk"
 	"github.com/kroppt/voxels/modules/cache"
@@ -45,13 +52,12 @@ func TestCacheReadAndWriteSimpleChunk(t *testing.T) {
 	chPos := chunk.ChunkCoordinate{X: 1, Y: 2, Z: 3}
 	vPos := chunk.VoxelCoordinate{X: 1, Y: 2, Z: 3}
 	testChunk := chunk.NewChunkEmpty(chPos, settingsRepo.GetChunkSize())
-	testChunk.SetAdjacency(vPos, chunk.AdjacentAll)
-	testChunk.SetLighting(vPos, chunk.LightFront, 5)
-	expectedData := testChunk.GetFlatData()
+	testChunk.SetBlockType(vPos, chunk.BlockTypeDirt)
+	expectedData := blockData(testChunk)
 	cacheMod.Save(testChunk)
-	loadedChunk, loaded := cacheMod.Load(chPos)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk, err := cacheMod.Load(chPos)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData := loadedChunk.GetFlatData()
 	if !reflect.DeepEqual(actualData, expectedData) {
@@ -69,18 +75,17 @@ func TestCacheReadAndWriteComplexChunk(t *testing.T) {
 	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
 	chPos := chunk.ChunkCoordinate{X: -1, Y: -1, Z: -1}
 	testChunk := chunk.NewChunkEmpty(chPos, settingsRepo.GetChunkSize())
-	testChunk.SetAdjacency(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.AdjacentAll)
-	testChunk.SetLighting(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.LightFront, 5)
+	testChunk.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.BlockTypeDirt)
 	testChunk.SetBlockType(chunk.VoxelCoordinate{X: -2, Y: -2, Z: -2}, chunk.BlockTypeAir)
 	testChunk.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: -2, Z: -2}, chunk.BlockTypeDirt)
 	testChunk.SetBlockType(chunk.VoxelCoordinate{X: -2, Y: -2, Z: -1}, chunk.BlockTypeDirt)
 	testChunk.SetBlockType(chunk.VoxelCoordinate{X: -10, Y: -10, Z: -10}, chunk.BlockTypeDirt)
 
-	expectedData := testChunk.GetFlatData()
+	expectedData := blockData(testChunk)
 	cacheMod.Save(testChunk)
-	loadedChunk, loaded := cacheMod.Load(chPos)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk, err := cacheMod.Load(chPos)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData := loadedChunk.GetFlatData()
 	if !reflect.DeepEqual(actualData, expectedData) {
@@ -98,25 +103,23 @@ func TestCacheReadAndWriteTwoChunks(t *testing.T) {
 	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
 	chPos1 := chunk.ChunkCoordinate{X: -1, Y: -1, Z: -1}
 	testChunk1 := chunk.NewChunkEmpty(chPos1, settingsRepo.GetChunkSize())
-	testChunk1.SetAdjacency(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.AdjacentAll)
-	testChunk1.SetLighting(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.LightFront, 5)
+	testChunk1.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.BlockTypeDirt)
 	chPos2 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
 	testChunk2 := chunk.NewChunkEmpty(chPos2, settingsRepo.GetChunkSize())
-	testChunk2.SetAdjacency(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.AdjacentBottom)
-	testChunk2.SetLighting(chunk.VoxelCoordinate{X: 5, Y: 6, Z: 7}, chunk.LightLeft, 3)
+	testChunk2.SetBlockType(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.BlockTypeStone)
 
-	expectedData1 := testChunk1.GetFlatData()
-	expectedData2 := testChunk2.GetFlatData()
+	expectedData1 := blockData(testChunk1)
+	expectedData2 := blockData(testChunk2)
 	cacheMod.Save(testChunk1)
 	cacheMod.Save(testChunk2)
-	loadedChunk1, loaded := cacheMod.Load(chPos1)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk1, err := cacheMod.Load(chPos1)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData1 := loadedChunk1.GetFlatData()
-	loadedChunk2, loaded := cacheMod.Load(chPos2)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk2, err := cacheMod.Load(chPos2)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData2 := loadedChunk2.GetFlatData()
 	if !reflect.DeepEqual(actualData1, expectedData1) {
@@ -137,39 +140,35 @@ func TestCacheReadWriteAndOverwriteThreeChunks(t *testing.T) {
 	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
 	chPos1 := chunk.ChunkCoordinate{X: -1, Y: -1, Z: -1}
 	testChunk1 := chunk.NewChunkEmpty(chPos1, settingsRepo.GetChunkSize())
-	testChunk1.SetAdjacency(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.AdjacentAll)
-	testChunk1.SetLighting(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.LightFront, 5)
+	testChunk1.SetBlockType(chunk.VoxelCoordinate{X: -1, Y: -1, Z: -1}, chunk.BlockTypeDirt)
 	chPos2 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
 	testChunk2 := chunk.NewChunkEmpty(chPos2, settingsRepo.GetChunkSize())
-	testChunk2.SetAdjacency(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.AdjacentBottom)
-	testChunk2.SetLighting(chunk.VoxelCoordinate{X: 5, Y: 6, Z: 7}, chunk.LightLeft, 3)
+	testChunk2.SetBlockType(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.BlockTypeStone)
 	chPos3 := chunk.ChunkCoordinate{X: 5, Y: 5, Z: 5}
 	testChunk3 := chunk.NewChunkEmpty(chPos3, settingsRepo.GetChunkSize())
-	testChunk3.SetAdjacency(chunk.VoxelCoordinate{X: 51, Y: 51, Z: 51}, chunk.AdjacentTop)
-	testChunk3.SetLighting(chunk.VoxelCoordinate{X: 55, Y: 55, Z: 52}, chunk.LightRight, 1)
+	testChunk3.SetBlockType(chunk.VoxelCoordinate{X: 51, Y: 51, Z: 51}, chunk.BlockTypeSand)
 
 	cacheMod.Save(testChunk1)
 	cacheMod.Save(testChunk2)
 	cacheMod.Save(testChunk3)
-	testChunk2.SetAdjacency(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.AdjacentX)
-	testChunk2.SetLighting(chunk.VoxelCoordinate{X: 7, Y: 7, Z: 7}, chunk.LightBottom, 0)
+	testChunk2.SetBlockType(chunk.VoxelCoordinate{X: 2, Y: 3, Z: 4}, chunk.BlockTypeClay)
 	cacheMod.Save(testChunk2)
-	expectedData1 := testChunk1.GetFlatData()
-	expectedData2 := testChunk2.GetFlatData()
-	expectedData3 := testChunk3.GetFlatData()
-	loadedChunk1, loaded := cacheMod.Load(chPos1)
-	if !loaded {
-		t.Fatal("failed to load")
+	expectedData1 := blockData(testChunk1)
+	expectedData2 := blockData(testChunk2)
+	expectedData3 := blockData(testChunk3)
+	loadedChunk1, err := cacheMod.Load(chPos1)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData1 := loadedChunk1.GetFlatData()
-	loadedChunk2, loaded := cacheMod.Load(chPos2)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk2, err := cacheMod.Load(chPos2)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData2 := loadedChunk2.GetFlatData()
-	loadedChunk3, loaded := cacheMod.Load(chPos3)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk3, err := cacheMod.Load(chPos3)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData3 := loadedChunk3.GetFlatData()
 	if !reflect.DeepEqual(actualData1, expectedData1) {
@@ -196,25 +195,23 @@ func TestCacheReadAndWriteChunksInDifferentRegions(t *testing.T) {
 	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
 	chPos1 := chunk.ChunkCoordinate{X: -100, Y: -100, Z: 345}
 	testChunk1 := chunk.NewChunkEmpty(chPos1, settingsRepo.GetChunkSize())
-	testChunk1.SetAdjacency(chunk.VoxelCoordinate{X: -200, Y: -200, Z: 690}, chunk.AdjacentAll)
-	testChunk1.SetLighting(chunk.VoxelCoordinate{X: -200, Y: -200, Z: 690}, chunk.LightFront, 5)
+	testChunk1.SetBlockType(chunk.VoxelCoordinate{X: -200, Y: -200, Z: 690}, chunk.BlockTypeDirt)
 	chPos2 := chunk.ChunkCoordinate{X: 66, Y: -70, Z: 0}
 	testChunk2 := chunk.NewChunkEmpty(chPos2, settingsRepo.GetChunkSize())
-	testChunk2.SetAdjacency(chunk.VoxelCoordinate{X: 132, Y: -140, Z: 0}, chunk.AdjacentBottom)
-	testChunk2.SetLighting(chunk.VoxelCoordinate{X: 133, Y: -139, Z: 1}, chunk.LightLeft, 3)
+	testChunk2.SetBlockType(chunk.VoxelCoordinate{X: 132, Y: -140, Z: 0}, chunk.BlockTypeStone)
 
-	expectedData1 := testChunk1.GetFlatData()
-	expectedData2 := testChunk2.GetFlatData()
+	expectedData1 := blockData(testChunk1)
+	expectedData2 := blockData(testChunk2)
 	cacheMod.Save(testChunk1)
 	cacheMod.Save(testChunk2)
-	loadedChunk1, loaded := cacheMod.Load(chPos1)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk1, err := cacheMod.Load(chPos1)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData1 := loadedChunk1.GetFlatData()
-	loadedChunk2, loaded := cacheMod.Load(chPos2)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk2, err := cacheMod.Load(chPos2)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData2 := loadedChunk2.GetFlatData()
 	if !reflect.DeepEqual(actualData1, expectedData1) {
@@ -238,25 +235,23 @@ func TestCacheReadAndWriteChunksInSameRegion(t *testing.T) {
 	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
 	chPos1 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
 	testChunk1 := chunk.NewChunkEmpty(chPos1, settingsRepo.GetChunkSize())
-	testChunk1.SetAdjacency(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 3}, chunk.AdjacentAll)
-	testChunk1.SetLighting(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 3}, chunk.LightFront, 5)
+	testChunk1.SetBlockType(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 3}, chunk.BlockTypeDirt)
 	chPos2 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 1}
 	testChunk2 := chunk.NewChunkEmpty(chPos2, settingsRepo.GetChunkSize())
-	testChunk2.SetAdjacency(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 5}, chunk.AdjacentBottom)
-	testChunk2.SetLighting(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 5}, chunk.LightLeft, 3)
+	testChunk2.SetBlockType(chunk.VoxelCoordinate{X: 3, Y: 3, Z: 5}, chunk.BlockTypeStone)
 
-	expectedData1 := testChunk1.GetFlatData()
-	expectedData2 := testChunk2.GetFlatData()
+	expectedData1 := blockData(testChunk1)
+	expectedData2 := blockData(testChunk2)
 	cacheMod.Save(testChunk1)
 	cacheMod.Save(testChunk2)
-	loadedChunk1, loaded := cacheMod.Load(chPos1)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk1, err := cacheMod.Load(chPos1)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData1 := loadedChunk1.GetFlatData()
-	loadedChunk2, loaded := cacheMod.Load(chPos2)
-	if !loaded {
-		t.Fatal("failed to load")
+	loadedChunk2, err := cacheMod.Load(chPos2)
+	if err != nil {
+		t.Fatal(err)
 	}
 	actualData2 := loadedChunk2.GetFlatData()
 	if !reflect.DeepEqual(actualData1, expectedData1) {
@@ -291,8 +286,6 @@ func TestCacheReadAndWriteAllInRenderDistance(t *testing.T) {
 					Z: int32(z * int(settingsRepo.GetChunkSize())),
 				}
 				c.SetBlockType(v, chunk.BlockTypeDirt)
-				c.SetAdjacency(v, chunk.AdjacentBottom)
-				c.SetLighting(v, chunk.LightTop, 3)
 				loadedChunks[key] = &c
 				cacheMod.Save(c)
 			}
@@ -302,11 +295,11 @@ func TestCacheReadAndWriteAllInRenderDistance(t *testing.T) {
 		for y := -1; y <= 1; y++ {
 			for z := -1; z <= 1; z++ {
 				key := chunk.ChunkCoordinate{X: int32(x), Y: int32(y), Z: int32(z)}
-				c, loaded := cacheMod.Load(key)
-				if !loaded {
-					t.Fatal("failed to load")
+				c, err := cacheMod.Load(key)
+				if err != nil {
+					t.Fatal(err)
 				}
-				expectedData := loadedChunks[key].GetFlatData()
+				expectedData := blockData(*loadedChunks[key])
 				actualData := c.GetFlatData()
 				if !reflect.DeepEqual(actualData, expectedData) {
 					t.Fatalf("expected chunk at %v to have data: %v, but had data: %v", key, expectedData, actualData)
@@ -315,3 +308,1547 @@ func TestCacheReadAndWriteAllInRenderDistance(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheScheduledUpdatesPersistAfterClose(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 5
+		},
+	}
+	chPos1 := chunk.ChunkCoordinate{X: -1, Y: 2, Z: 0}
+	chPos2 := chunk.ChunkCoordinate{X: 3, Y: 0, Z: 0}
+	chPos3 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	expected1 := []chunk.ScheduledUpdate{
+		{VoxPos: chunk.VoxelCoordinate{X: -3, Y: 11, Z: 4}, Delay: 7},
+		{VoxPos: chunk.VoxelCoordinate{X: -1, Y: 10, Z: 0}, Delay: 1},
+	}
+	expected2 := []chunk.ScheduledUpdate{
+		{VoxPos: chunk.VoxelCoordinate{X: 15, Y: 2, Z: 3}, Delay: 20},
+	}
+	cacheMod := cache.New(fs, settingsRepo)
+	cacheMod.SaveScheduled(chPos1, expected1)
+	cacheMod.SaveScheduled(chPos2, expected2)
+	cacheMod.SaveScheduled(chPos3, []chunk.ScheduledUpdate{
+		{VoxPos: chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}, Delay: 3},
+	})
+	cacheMod.SaveScheduled(chPos3, nil)
+	cacheMod.Close()
+
+	cacheMod = cache.New(fs, settingsRepo)
+	actual1 := cacheMod.LoadScheduled(chPos1)
+	actual2 := cacheMod.LoadScheduled(chPos2)
+	actual3 := cacheMod.LoadScheduled(chPos3)
+
+	if !reflect.DeepEqual(actual1, expected1) {
+		t.Fatalf("expected scheduled updates %v for chunk %v but got %v", expected1, chPos1, actual1)
+	}
+	if !reflect.DeepEqual(actual2, expected2) {
+		t.Fatalf("expected scheduled updates %v for chunk %v but got %v", expected2, chPos2, actual2)
+	}
+	if len(actual3) != 0 {
+		t.Fatalf("expected no scheduled updates for chunk %v but got %v", chPos3, actual3)
+	}
+}
+
+func TestCachePendingActionsPersistAfterClose(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 5
+		},
+	}
+	chPos1 := chunk.ChunkCoordinate{X: -1, Y: 2, Z: 0}
+	chPos2 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	expected := []chunk.PendingAction{
+		{ChPos: chPos1, VoxPos: chunk.VoxelCoordinate{X: -1, Y: 10, Z: 4}, HideFace: true, Face: chunk.AdjacentFront},
+		{ChPos: chPos1, VoxPos: chunk.VoxelCoordinate{X: -5, Y: 14, Z: 0}, HideFace: false, Face: chunk.AdjacentLeft},
+	}
+	cacheMod := cache.New(fs, settingsRepo)
+	cacheMod.SavePending(chPos1, expected)
+	cacheMod.SavePending(chPos2, []chunk.PendingAction{
+		{ChPos: chPos2, VoxPos: chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}, HideFace: true, Face: chunk.AdjacentTop},
+	})
+	cacheMod.SavePending(chPos2, nil)
+	cacheMod.Close()
+
+	cacheMod = cache.New(fs, settingsRepo)
+	actual1 := cacheMod.LoadPending(chPos1)
+	actual2 := cacheMod.LoadPending(chPos2)
+
+	if !reflect.DeepEqual(actual1, expected) {
+		t.Fatalf("expected pending actions %v for chunk %v but got %v", expected, chPos1, actual1)
+	}
+	if len(actual2) != 0 {
+		t.Fatalf("expected no pending actions for chunk %v but got %v", chPos2, actual2)
+	}
+}
+
+func TestCacheChunksListsSavedChunks(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 1
+		},
+		FnGetRegionSize: func() uint32 {
+			return 2
+		},
+	}
+	cacheMod := cache.New(afero.NewMemMapFs(), settingsRepo)
+	saved := []chunk.ChunkCoordinate{
+		{X: 0, Y: 0, Z: 0},
+		{X: -1, Y: 3, Z: 1},
+		{X: 1, Y: 1, Z: 1},
+		{X: 5, Y: -2, Z: 0},
+	}
+	for _, pos := range saved {
+		cacheMod.Save(chunk.NewChunkEmpty(pos, settingsRepo.GetChunkSize()))
+	}
+	// saved again, so listed once
+	cacheMod.Save(chunk.NewChunkEmpty(saved[0], settingsRepo.GetChunkSize()))
+
+	actual, err := cacheMod.Chunks()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[chunk.ChunkCoordinate]bool{}
+	for _, pos := range saved {
+		expect[pos] = true
+	}
+	listed := map[chunk.ChunkCoordinate]bool{}
+	for _, pos := range actual {
+		listed[pos] = true
+	}
+	if len(actual) != len(saved) || !reflect.DeepEqual(listed, expect) {
+		t.Fatalf("expected chunks %v but got %v", saved, actual)
+	}
+}
+
+func TestCacheTrimRemovesChunks(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 2
+		},
+		FnGetRegionSize: func() uint32 {
+			return 2
+		},
+	}
+	kept := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	removed := chunk.ChunkCoordinate{X: 5, Y: 0, Z: 0}
+	keptChunk := chunk.NewChunkEmpty(kept, settingsRepo.GetChunkSize())
+	keptChunk.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}, chunk.BlockTypeStone)
+	expectData := keptChunk.GetFlatData()
+	keptUpdates := []chunk.ScheduledUpdate{{VoxPos: chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}, Delay: 2}}
+	cacheMod := cache.New(fs, settingsRepo)
+	cacheMod.Save(chunk.NewChunkEmpty(removed, settingsRepo.GetChunkSize()))
+	cacheMod.Save(keptChunk)
+	cacheMod.SaveScheduled(kept, keptUpdates)
+	cacheMod.SaveScheduled(removed, []chunk.ScheduledUpdate{{VoxPos: chunk.VoxelCoordinate{X: 10}, Delay: 1}})
+	cacheMod.Close()
+	removeFn := func(ch chunk.Chunk) bool {
+		return ch.Position() == removed
+	}
+
+	dryStats, err := cache.Trim(fs, settingsRepo, removeFn, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := cache.Trim(fs, settingsRepo, removeFn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dryStats != stats {
+		t.Fatalf("expected dry run to report %+v but got %+v", stats, dryStats)
+	}
+	if stats.Chunks != 2 || stats.Removed != 1 || stats.BytesAfter >= stats.BytesBefore {
+		t.Fatalf("expected 1 of 2 chunks to be removed and fewer bytes, but got %+v", stats)
+	}
+	cacheMod = cache.New(fs, settingsRepo)
+	defer cacheMod.Close()
+	if actual, err := cacheMod.Chunks(); err != nil || !reflect.DeepEqual(actual, []chunk.ChunkCoordinate{kept}) {
+		t.Fatalf("expected only chunk %v to be saved but got %v", kept, actual)
+	}
+	loaded, err := cacheMod.Load(kept)
+	if err != nil || !reflect.DeepEqual(loaded.GetFlatData(), expectData) {
+		t.Fatalf("expected chunk %v to keep its data", kept)
+	}
+	if actual := cacheMod.LoadScheduled(kept); !reflect.DeepEqual(actual, keptUpdates) {
+		t.Fatalf("expected scheduled updates %v but got %v", keptUpdates, actual)
+	}
+	if actual := cacheMod.LoadScheduled(removed); len(actual) != 0 {
+		t.Fatalf("expected no scheduled updates for removed chunk but got %v", actual)
+	}
+	if exists, _ := afero.DirExists(fs, "trim"); exists {
+		t.Fatal("expected trim directory to be removed")
+	}
+}
+
+func TestCacheTrimRecoversFromTrimsThatStopPartway(t *testing.T) {
+	t.Parallel()
+	kept, removed := twoRegionPositions[0], twoRegionPositions[1]
+	removeFn := func(ch chunk.Chunk) bool {
+		return ch.Position() == removed
+	}
+	for writes := 0; ; writes++ {
+		fs := afero.NewMemMapFs()
+		cacheMod := cache.New(fs, twoRegionSettings)
+		saved := saveTestChunks(cacheMod, 2, []chunk.ChunkCoordinate{kept, removed})
+		cacheMod.Close()
+		remaining := writes
+
+		_, err := cache.Trim(failingFs{Fs: fs, writes: &remaining}, twoRegionSettings, removeFn, false)
+
+		if err == nil {
+			break
+		}
+		cacheMod = cache.New(fs, twoRegionSettings)
+		if ch, err := cacheMod.Load(kept); err != nil || !reflect.DeepEqual(ch.GetFlatData(), saved[kept]) {
+			t.Fatalf("expected chunk %v to keep its data after a trim that stopped after %v writes, but got %v", kept, writes, err)
+		}
+		cacheMod.Close()
+		if _, err := cache.Trim(fs, twoRegionSettings, removeFn, false); err != nil {
+			t.Fatalf("expected to trim again after a trim that stopped after %v writes, but got %v", writes, err)
+		}
+		delete(saved, removed)
+		cacheMod = cache.New(fs, twoRegionSettings)
+		expectChunks(t, cacheMod, saved)
+		cacheMod.Close()
+	}
+}
+
+func TestCacheTrimDryRunLeavesFilesAsTheyAre(t *testing.T) {
+	t.Parallel()
+	for layout := range layoutDataFiles {
+		layout := layout
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+			saveTestChunks(cacheMod, 2, twoRegionPositions[:2])
+			cacheMod.Close()
+			// a save that stops once it is in the journal
+			remaining := 3
+			cacheMod = cache.NewWithLayout(failingFs{Fs: fs, writes: &remaining}, twoRegionSettings, layout)
+			cacheMod.Save(chunk.NewChunkEmpty(twoRegionPositions[2], 2))
+			before := readFiles(t, fs)
+
+			stats, err := cache.Trim(fs, twoRegionSettings, func(chunk.Chunk) bool {
+				return true
+			}, true)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Chunks != 3 || stats.Removed != 3 {
+				t.Fatalf("expected all 3 chunks to be removed but got %+v", stats)
+			}
+			if after := readFiles(t, fs); !reflect.DeepEqual(after, before) {
+				t.Fatal("expected the cache files to be left as they were")
+			}
+		})
+	}
+}
+
+func TestCacheLoadsChunksInRegionsAfterReopen(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 2
+		},
+		FnGetRegionSize: func() uint32 {
+			return 2
+		},
+	}
+	positions := []chunk.ChunkCoordinate{
+		{X: 0, Y: 0, Z: 0},
+		{X: -3, Y: 1, Z: 7},
+		{X: 1, Y: 1, Z: 1},
+	}
+	expected := map[chunk.ChunkCoordinate][]float32{}
+	cacheMod := cache.New(fs, settingsRepo)
+	for i, pos := range positions {
+		ch := chunk.NewChunkEmpty(pos, settingsRepo.GetChunkSize())
+		vc := chunk.VoxelCoordinate{X: pos.X * 2, Y: pos.Y * 2, Z: pos.Z * 2}
+		ch.SetBlockType(vc, chunk.BlockType(i+1))
+		cacheMod.Save(ch)
+		expected[pos] = blockData(ch)
+	}
+	cacheMod.Close()
+
+	cacheMod = cache.New(fs, settingsRepo)
+	defer cacheMod.Close()
+	// a new region after reopening goes after the ones that were read
+	added := chunk.ChunkCoordinate{X: 9, Y: 9, Z: 9}
+	addedChunk := chunk.NewChunkEmpty(added, settingsRepo.GetChunkSize())
+	cacheMod.Save(addedChunk)
+	expected[added] = addedChunk.GetFlatData()
+
+	for pos, data := range expected {
+		ch, err := cacheMod.Load(pos)
+		if err != nil {
+			t.Fatalf("failed to load chunk %v: %v", pos, err)
+		}
+		if !reflect.DeepEqual(ch.GetFlatData(), data) {
+			t.Fatalf("expected to retrieve data %v for chunk %v but instead got %v", data, pos, ch.GetFlatData())
+		}
+	}
+	if _, err := cacheMod.Load(chunk.ChunkCoordinate{X: 5}); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected a chunk that wasn't saved to fail with %v but got %v", cache.ErrNotFound, err)
+	}
+}
+
+// saveTestChunks saves a chunk with a distinct block at each position, and
+// returns the data of every chunk as it is loaded.
+func saveTestChunks(cacheMod *cache.Module, chunkSize uint32, positions []chunk.ChunkCoordinate) map[chunk.ChunkCoordinate][]float32 {
+	saved := map[chunk.ChunkCoordinate][]float32{}
+	for i, pos := range positions {
+		ch := chunk.NewChunkEmpty(pos, chunkSize)
+		size := int32(chunkSize)
+		ch.SetBlockType(chunk.VoxelCoordinate{X: pos.X * size, Y: pos.Y * size, Z: pos.Z * size}, chunk.BlockType(i%14+1))
+		cacheMod.Save(ch)
+		saved[pos] = blockData(ch)
+	}
+	return saved
+}
+
+// blockData returns the data of ch as it is loaded from a cache that saves
+// only block types.
+func blockData(ch chunk.Chunk) []float32 {
+	pos := ch.Position()
+	loaded, err := chunk.ParseBlockTypes(ch.BlockTypes(), ch.Size(), pos)
+	if err != nil {
+		panic(err)
+	}
+	return loaded.GetFlatData()
+}
+
+func expectChunks(t *testing.T, cacheMod *cache.Module, expected map[chunk.ChunkCoordinate][]float32) {
+	t.Helper()
+	for pos, data := range expected {
+		ch, err := cacheMod.Load(pos)
+		if err != nil {
+			t.Fatalf("failed to load chunk %v: %v", pos, err)
+		}
+		if !reflect.DeepEqual(ch.GetFlatData(), data) {
+			t.Fatalf("expected to retrieve data %v for chunk %v but instead got %v", data, pos, ch.GetFlatData())
+		}
+	}
+	positions, err := cacheMod.Chunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != len(expected) {
+		t.Fatalf("expected %v saved chunks but got %v", len(expected), positions)
+	}
+}
+
+var twoRegionSettings = settings.FnRepository{
+	FnGetChunkSize: func() uint32 {
+		return 2
+	},
+	FnGetRegionSize: func() uint32 {
+		return 2
+	},
+}
+
+var twoRegionPositions = []chunk.ChunkCoordinate{
+	{X: 0, Y: 0, Z: 0},
+	{X: 1, Y: 0, Z: 1},
+	{X: -1, Y: 0, Z: 0},
+}
+
+func TestCacheFlatLayoutIsDetected(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	if layout := cache.DetectLayout(fs); layout != cache.LayoutRegionFiles {
+		t.Fatalf("expected a new cache to use region files, but got layout %v", layout)
+	}
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+	cacheMod.Close()
+
+	if layout := cache.DetectLayout(fs); layout != cache.LayoutFlat {
+		t.Fatalf("expected layout %v but got %v", cache.LayoutFlat, layout)
+	}
+	cacheMod = cache.New(fs, twoRegionSettings)
+	defer cacheMod.Close()
+	expectChunks(t, cacheMod, saved)
+}
+
+func TestCacheOpenFailsOnCutShortChunkTable(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saveTestChunks(cacheMod, 2, twoRegionPositions)
+	cacheMod.Close()
+	bs, err := afero.ReadFile(fs, "data/chunk.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "data/chunk.data", bs[:len(bs)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cache.Open(fs, twoRegionSettings)
+
+	if err == nil {
+		t.Fatal("expected opening the cache to fail")
+	}
+}
+
+func TestCacheRegionFiles(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.New(fs, twoRegionSettings)
+	saveTestChunks(cacheMod, 2, twoRegionPositions)
+	// saving again overwrites the chunks where they are
+	reversed := []chunk.ChunkCoordinate{twoRegionPositions[2], twoRegionPositions[1], twoRegionPositions[0]}
+	saved := saveTestChunks(cacheMod, 2, reversed)
+	cacheMod.Close()
+
+	// a sector for the header and one for each chunk
+	expectSizes := map[string]int64{
+		"data/region/r.0.0.0.vxr":  3 * 4096,
+		"data/region/r.-1.0.0.vxr": 2 * 4096,
+	}
+	for name, size := range expectSizes {
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != size {
+			t.Fatalf("expected %v to be %v bytes but it was %v", name, size, info.Size())
+		}
+	}
+	cacheMod = cache.New(fs, twoRegionSettings)
+	defer cacheMod.Close()
+	expectChunks(t, cacheMod, saved)
+}
+
+func TestCacheRegionFileReportsEntriesOutsideOfFile(t *testing.T) {
+	t.Parallel()
+	// header entries of chunk 0, 0, 0 that point past the end of the file
+	entries := map[string][]byte{
+		"sector past the end":            {100, 0, 0, 0},
+		"length past the end":            {1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff},
+		"sector at the limit":            {0xff, 0xff, 0xff, 0xff},
+		"sector and length at the limit": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, entry := range entries {
+		entry := entry
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.New(fs, twoRegionSettings)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions[:2])
+			cacheMod.Close()
+			file, err := fs.OpenFile("data/region/r.0.0.0.vxr", os.O_RDWR, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.WriteAt(entry, 0)
+			file.Close()
+			delete(saved, twoRegionPositions[0])
+
+			cacheMod = cache.New(fs, twoRegionSettings)
+			defer cacheMod.Close()
+
+			if _, err := cacheMod.Load(twoRegionPositions[0]); !errors.Is(err, cache.ErrCorrupt) {
+				t.Fatalf("expected chunk with a broken entry to fail with %v but got %v", cache.ErrCorrupt, err)
+			}
+			// the chunk is still listed, so that it can be quarantined
+			saved[twoRegionPositions[0]] = nil
+			positions, err := cacheMod.Chunks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(positions) != len(saved) {
+				t.Fatalf("expected %v saved chunks but got %v", len(saved), positions)
+			}
+			for _, pos := range positions {
+				if _, ok := saved[pos]; !ok {
+					t.Fatalf("expected chunks %v but got %v", saved, positions)
+				}
+			}
+			delete(saved, twoRegionPositions[0])
+			if err := cacheMod.Quarantine(twoRegionPositions[0]); err != nil {
+				t.Fatal(err)
+			}
+			expectChunks(t, cacheMod, saved)
+		})
+	}
+}
+
+// openCountingFs is a filesystem that counts how many times each file is
+// opened.
+type openCountingFs struct {
+	afero.Fs
+	opened map[string]int
+}
+
+func (fs openCountingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	fs.opened[name]++
+	return fs.Fs.OpenFile(name, flag, perm)
+}
+
+func TestCacheRegionFilesCloseLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+	fs := openCountingFs{Fs: afero.NewMemMapFs(), opened: map[string]int{}}
+	cacheMod := cache.New(fs, twoRegionSettings)
+	defer cacheMod.Close()
+	// a chunk in each of one more region than the cache keeps open
+	var positions []chunk.ChunkCoordinate
+	for i := int32(0); i <= 64; i++ {
+		positions = append(positions, chunk.ChunkCoordinate{X: 2 * i})
+	}
+	saved := map[chunk.ChunkCoordinate][]float32{}
+	for _, pos := range positions {
+		for key, data := range saveTestChunks(cacheMod, 2, []chunk.ChunkCoordinate{pos}) {
+			saved[key] = data
+		}
+		// keeps the first region the most recently used
+		if _, err := cacheMod.Load(positions[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pos := range positions[:2] {
+		if _, err := cacheMod.Load(pos); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if opened := fs.opened["data/region/r.0.0.0.vxr"]; opened != 1 {
+		t.Fatalf("expected the most recently used region file to stay open, but it was opened %v times", opened)
+	}
+	if opened := fs.opened["data/region/r.1.0.0.vxr"]; opened != 2 {
+		t.Fatalf("expected the least recently used region file to be closed and opened again, but it was opened %v times", opened)
+	}
+	expectChunks(t, cacheMod, saved)
+}
+
+func TestConvertToRegionFiles(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+	updates := []chunk.ScheduledUpdate{{VoxPos: chunk.VoxelCoordinate{X: 1}, Delay: 4}}
+	cacheMod.SaveScheduled(twoRegionPositions[0], updates)
+	cacheMod.Close()
+
+	converted, err := cache.ConvertToRegionFiles(fs, twoRegionSettings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted != len(saved) {
+		t.Fatalf("expected %v chunks to be converted but got %v", len(saved), converted)
+	}
+	if layout := cache.DetectLayout(fs); layout != cache.LayoutRegionFiles {
+		t.Fatalf("expected layout %v but got %v", cache.LayoutRegionFiles, layout)
+	}
+	for _, name := range []string{"data/voxel.data", "data/chunk.data", "data/region.data"} {
+		if exists, _ := afero.Exists(fs, name); exists {
+			t.Fatalf("expected %v to be removed", name)
+		}
+	}
+	if converted, err := cache.ConvertToRegionFiles(fs, twoRegionSettings); converted != 0 || err != nil {
+		t.Fatalf("expected converting again to do nothing, but got %v, %v", converted, err)
+	}
+	cacheMod = cache.New(fs, twoRegionSettings)
+	defer cacheMod.Close()
+	expectChunks(t, cacheMod, saved)
+	if actual := cacheMod.LoadScheduled(twoRegionPositions[0]); !reflect.DeepEqual(actual, updates) {
+		t.Fatalf("expected scheduled updates %v but got %v", updates, actual)
+	}
+}
+
+func withChunkSize(settingsRepo settings.FnRepository, chunkSize uint32) settings.FnRepository {
+	settingsRepo.FnGetChunkSize = func() uint32 {
+		return chunkSize
+	}
+	return settingsRepo
+}
+
+func TestCacheRecordsItsFormat(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		layout  cache.Layout
+		version uint32
+	}{
+		{cache.LayoutFlat, 1},
+		{cache.LayoutRegionFiles, cache.FormatVersion},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(fmt.Sprintf("layout %v", tC.layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cache.NewWithLayout(fs, twoRegionSettings, tC.layout).Close()
+
+			format, err := cache.ReadFormat(fs)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := cache.Format{Version: tC.version, ChunkSize: 2, RegionSize: 2}
+			if format != expect {
+				t.Fatalf("expected format %v but got %v", expect, format)
+			}
+		})
+	}
+}
+
+func TestCacheOpenRefusesOtherFormats(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.New(fs, twoRegionSettings)
+	saveTestChunks(cacheMod, 2, twoRegionPositions)
+	cacheMod.Close()
+
+	_, err := cache.Open(fs, withChunkSize(twoRegionSettings, 3))
+
+	if !errors.Is(err, cache.ErrFormatMismatch) {
+		t.Fatalf("expected %v but got %v", cache.ErrFormatMismatch, err)
+	}
+}
+
+func TestCacheOpenRefusesNewerFormats(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cache.New(fs, twoRegionSettings).Close()
+	bs, err := afero.ReadFile(fs, "data/format.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(bs[4:], cache.FormatVersion+1)
+	binary.LittleEndian.PutUint32(bs[16:], crc32.ChecksumIEEE(bs[:16]))
+	if err := afero.WriteFile(fs, "data/format.data", bs, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cache.Open(fs, twoRegionSettings)
+
+	if !errors.Is(err, cache.ErrUnknownFormat) {
+		t.Fatalf("expected %v but got %v", cache.ErrUnknownFormat, err)
+	}
+}
+
+// readFiles returns the contents of every file in fs.
+func readFiles(t *testing.T, fs afero.Fs) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := afero.Walk(fs, "", func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files[p], err = afero.ReadFile(fs, p)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCacheOpenReadOnlyLeavesFilesAsTheyAre(t *testing.T) {
+	t.Parallel()
+	for layout := range layoutDataFiles {
+		layout := layout
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions[:2])
+			cacheMod.SaveScheduled(twoRegionPositions[0], []chunk.ScheduledUpdate{{Delay: 1}})
+			cacheMod.Close()
+			// a save that stops once it is in the journal
+			remaining := 3
+			cacheMod = cache.NewWithLayout(failingFs{Fs: fs, writes: &remaining}, twoRegionSettings, layout)
+			pos := twoRegionPositions[2]
+			unfinished := chunk.NewChunkEmpty(pos, 2)
+			unfinished.SetBlockType(chunk.VoxelCoordinate{X: pos.X * 2, Y: pos.Y * 2, Z: pos.Z * 2}, chunk.BlockTypeStone)
+			if err := cacheMod.Save(unfinished); err == nil {
+				t.Fatal("expected the save to stop partway")
+			}
+			saved[unfinished.Position()] = blockData(unfinished)
+			before := readFiles(t, fs)
+
+			cacheMod, err := cache.OpenReadOnly(fs, twoRegionSettings, 2, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectChunks(t, cacheMod, saved)
+			if err := cacheMod.Save(unfinished); !errors.Is(err, cache.ErrReadOnly) {
+				t.Fatalf("expected saving to fail with %v but got %v", cache.ErrReadOnly, err)
+			}
+			if err := cacheMod.Quarantine(twoRegionPositions[0]); !errors.Is(err, cache.ErrReadOnly) {
+				t.Fatalf("expected quarantining to fail with %v but got %v", cache.ErrReadOnly, err)
+			}
+			if _, err := cacheMod.CompactStep(); !errors.Is(err, cache.ErrReadOnly) {
+				t.Fatalf("expected compacting to fail with %v but got %v", cache.ErrReadOnly, err)
+			}
+			cacheMod.SaveScheduled(twoRegionPositions[0], nil)
+			if err := cacheMod.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if after := readFiles(t, fs); !reflect.DeepEqual(after, before) {
+				t.Fatal("expected the cache files to be left as they were")
+			}
+		})
+	}
+}
+
+func TestCacheOpenReadOnlyWithoutFormat(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+
+	cacheMod, err := cache.OpenReadOnly(fs, twoRegionSettings, 2, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks, err := cacheMod.Chunks(); err != nil || len(chunks) != 0 {
+		t.Fatalf("expected no chunks but got %v", chunks)
+	}
+	if err := cacheMod.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := readFiles(t, fs); len(files) != 0 {
+		t.Fatalf("expected no files to be written but got %v", files)
+	}
+}
+
+func TestCacheRecordFormatOfOlderCaches(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+	cacheMod.Close()
+	if err := fs.Remove("data/format.data"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.ReadFormat(fs); !errors.Is(err, cache.ErrNoFormat) {
+		t.Fatalf("expected %v but got %v", cache.ErrNoFormat, err)
+	}
+
+	format, err := cache.RecordFormat(fs, 2, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := cache.Format{Version: 1, ChunkSize: 2, RegionSize: 2}
+	if format != expect {
+		t.Fatalf("expected format %v but got %v", expect, format)
+	}
+	if format, _ := cache.RecordFormat(fs, 3, 3); format != expect {
+		t.Fatalf("expected the recorded format %v not to change but got %v", expect, format)
+	}
+	cacheMod, err = cache.Open(fs, twoRegionSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cacheMod.Close()
+	expectChunks(t, cacheMod, saved)
+}
+
+func TestMigrateUpgradesFlatCaches(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+	cacheMod.Close()
+
+	format, err := cache.Migrate(fs, twoRegionSettings, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := cache.Format{Version: cache.FormatVersion, ChunkSize: 2, RegionSize: 2}
+	if format != expect {
+		t.Fatalf("expected format %v but got %v", expect, format)
+	}
+	if recorded, _ := cache.ReadFormat(fs); recorded != expect {
+		t.Fatalf("expected recorded format %v but got %v", expect, recorded)
+	}
+	cacheMod = cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutRegionFiles)
+	defer cacheMod.Close()
+	expectChunks(t, cacheMod, saved)
+}
+
+func TestMigrateRechunks(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.New(fs, twoRegionSettings)
+	// two chunks of size 2 with a floor of dirt and a block on top
+	var saved []chunk.Chunk
+	for _, pos := range []chunk.ChunkCoordinate{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}} {
+		ch := chunk.NewChunkEmpty(pos, 2)
+		ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+			if vc.Y == 0 {
+				ch.SetBlockType(vc, chunk.BlockTypeDirt)
+			}
+		})
+		saved = append(saved, ch)
+	}
+	block := chunk.VoxelCoordinate{X: 3, Y: 1, Z: 1}
+	saved[1].SetBlockType(block, chunk.BlockTypeStone)
+	saved[1].SetLighting(block, chunk.LightTop, 9)
+	for _, ch := range saved {
+		cacheMod.Save(ch)
+	}
+	update := chunk.ScheduledUpdate{VoxPos: chunk.VoxelCoordinate{X: 2, Y: 0, Z: 0}, Delay: 5}
+	cacheMod.SaveScheduled(chunk.ChunkCoordinate{X: 1, Y: 0, Z: 0}, []chunk.ScheduledUpdate{update})
+	action := chunk.PendingAction{
+		ChPos:    chunk.ChunkCoordinate{X: 0, Y: 0, Z: 1},
+		VoxPos:   chunk.VoxelCoordinate{X: 1, Y: 0, Z: 2},
+		HideFace: true,
+		Face:     chunk.AdjacentBack,
+	}
+	cacheMod.SavePending(action.ChPos, []chunk.PendingAction{action})
+	cacheMod.Close()
+	// the generator fills everything with sand
+	fill := func(pos chunk.ChunkCoordinate) chunk.Chunk {
+		ch := chunk.NewChunkEmpty(pos, 3)
+		ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+			ch.SetBlockType(vc, chunk.BlockTypeSand)
+		})
+		return ch
+	}
+	rechunkedSettings := withChunkSize(twoRegionSettings, 3)
+
+	format, err := cache.Migrate(fs, rechunkedSettings, fill)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := cache.Format{Version: cache.FormatVersion, ChunkSize: 3, RegionSize: 2}
+	if format != expect {
+		t.Fatalf("expected format %v but got %v", expect, format)
+	}
+	if _, err := cache.Open(fs, twoRegionSettings); !errors.Is(err, cache.ErrFormatMismatch) {
+		t.Fatalf("expected %v with the old chunk size but got %v", cache.ErrFormatMismatch, err)
+	}
+	cacheMod = cache.New(fs, rechunkedSettings)
+	defer cacheMod.Close()
+	expectPositions := []chunk.ChunkCoordinate{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}}
+	if positions, err := cacheMod.Chunks(); err != nil || !reflect.DeepEqual(positions, expectPositions) {
+		t.Fatalf("expected chunks %v but got %v", expectPositions, positions)
+	}
+	for _, pos := range expectPositions {
+		ch, err := cacheMod.Load(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+			expect := chunk.BlockTypeSand
+			if old := chunk.VoxelCoordToChunkCoord(vc, 2); old.Y == 0 && old.Z == 0 && old.X >= 0 && old.X <= 1 {
+				expect = saved[old.X].BlockType(vc)
+			}
+			if actual := ch.BlockType(vc); actual != expect {
+				t.Fatalf("expected voxel %v to be %v but got %v", vc, expect, actual)
+			}
+		})
+		// only block types are saved, so the lighting isn't kept
+		if pos.X == 1 && ch.Lighting(block, chunk.LightTop) != 0 {
+			t.Fatalf("expected voxel %v to have no lighting but got %v", block, ch.Lighting(block, chunk.LightTop))
+		}
+		// sand that was on top of sand is now on top of air
+		if pos.X == 0 && ch.Adjacency(chunk.VoxelCoordinate{X: 0, Y: 2, Z: 0})&chunk.AdjacentBottom != 0 {
+			t.Fatal("expected the bottom face of the sand above air to show")
+		}
+	}
+	newPos := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	if updates := cacheMod.LoadScheduled(newPos); !reflect.DeepEqual(updates, []chunk.ScheduledUpdate{update}) {
+		t.Fatalf("expected scheduled updates %v but got %v", []chunk.ScheduledUpdate{update}, updates)
+	}
+	action.ChPos = newPos
+	if actions := cacheMod.LoadPending(newPos); !reflect.DeepEqual(actions, []chunk.PendingAction{action}) {
+		t.Fatalf("expected pending actions %v but got %v", []chunk.PendingAction{action}, actions)
+	}
+}
+
+func withCompressionLevel(settingsRepo settings.FnRepository, level uint32) settings.FnRepository {
+	settingsRepo.FnGetCompressionLevel = func() uint32 {
+		return level
+	}
+	return settingsRepo
+}
+
+func TestCacheCompressedChunks(t *testing.T) {
+	t.Parallel()
+	for _, layout := range []cache.Layout{cache.LayoutFlat, cache.LayoutRegionFiles} {
+		layout := layout
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			uncompressedFs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(uncompressedFs, twoRegionSettings, layout)
+			saveTestChunks(cacheMod, 2, twoRegionPositions)
+			cacheMod.Close()
+			compressedFs := afero.NewMemMapFs()
+			compressed := withCompressionLevel(twoRegionSettings, 6)
+			cacheMod = cache.NewWithLayout(compressedFs, compressed, layout)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+			cacheMod.Close()
+
+			name := "data/voxel.data"
+			if layout == cache.LayoutRegionFiles {
+				name = "data/region/r.0.0.0.vxr"
+			}
+			uncompressedSize, compressedSize := fileSize(t, uncompressedFs, name), fileSize(t, compressedFs, name)
+			if layout == cache.LayoutFlat && compressedSize >= uncompressedSize {
+				t.Fatalf("expected compressed %v of %v bytes to be smaller than %v bytes", name, compressedSize, uncompressedSize)
+			}
+			// chunks are padded to whole sectors in region files
+			if layout == cache.LayoutRegionFiles && compressedSize != uncompressedSize {
+				t.Fatalf("expected compressed %v of %v bytes to be %v bytes", name, compressedSize, uncompressedSize)
+			}
+			cacheMod = cache.NewWithLayout(compressedFs, twoRegionSettings, layout)
+			defer cacheMod.Close()
+			expectChunks(t, cacheMod, saved)
+			// uncompressed chunks are bigger, so don't fit where they were
+			saved = saveTestChunks(cacheMod, 2, twoRegionPositions)
+			expectChunks(t, cacheMod, saved)
+		})
+	}
+}
+
+func TestCacheRecordsCodecOfChunks(t *testing.T) {
+	t.Parallel()
+	for level, expect := range map[uint32]string{0: "VXC\x00", 9: "VXC\x01"} {
+		fs := afero.NewMemMapFs()
+		cacheMod := cache.NewWithLayout(fs, withCompressionLevel(twoRegionSettings, level), cache.LayoutFlat)
+		saveTestChunks(cacheMod, 2, twoRegionPositions[:1])
+		cacheMod.Close()
+		data, err := afero.ReadFile(fs, "data/voxel.data")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data[:4]) != expect {
+			t.Fatalf("expected level %v to start the payload with %q but got %q", level, expect, data[:4])
+		}
+	}
+}
+
+func TestCacheLoadsChunksSavedWithoutHeader(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions[:1])
+	cacheMod.Close()
+	// older caches saved the raw data of chunks without the header
+	headerSize := 12
+	data, err := afero.ReadFile(fs, "data/voxel.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "data/voxel.data", data[headerSize:], 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheMod = cache.NewWithLayout(fs, withCompressionLevel(twoRegionSettings, 6), cache.LayoutFlat)
+	defer cacheMod.Close()
+
+	expectChunks(t, cacheMod, saved)
+	saved = saveTestChunks(cacheMod, 2, twoRegionPositions[:1])
+	expectChunks(t, cacheMod, saved)
+	if size := fileSize(t, fs, "data/voxel.data"); size != int64(len(data)-headerSize) {
+		t.Fatalf("expected the compressed chunk to be saved in place of %v bytes, but the file is %v bytes", len(data)-headerSize, size)
+	}
+}
+
+func TestCacheQuarantine(t *testing.T) {
+	t.Parallel()
+	// where the data of the first chunk saved starts in each layout, and its
+	// length, which is the flat data of every voxel or only its block type
+	dataOffsets := map[cache.Layout]struct {
+		name string
+		off  int64
+		size int
+	}{
+		cache.LayoutFlat:        {"data/voxel.data", 0, 12 + 4*5*8},
+		cache.LayoutRegionFiles: {"data/region/r.0.0.0.vxr", 4096, 12 + 4*8},
+	}
+	for layout, data := range dataOffsets {
+		layout, data := layout, data
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+			cacheMod.Close()
+			corrupt := twoRegionPositions[0]
+			file, err := fs.OpenFile(data.name, os.O_RDWR, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := make([]byte, data.size)
+			file.ReadAt(stored, data.off)
+			stored[20] ^= 0xff
+			file.WriteAt(stored[20:21], data.off+20)
+			file.Close()
+			delete(saved, corrupt)
+			cacheMod = cache.NewWithLayout(fs, twoRegionSettings, layout)
+			defer cacheMod.Close()
+			if _, err := cacheMod.Load(corrupt); !errors.Is(err, cache.ErrCorrupt) {
+				t.Fatalf("expected %v but got %v", cache.ErrCorrupt, err)
+			}
+
+			err = cacheMod.Quarantine(corrupt)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cacheMod.Load(corrupt); !errors.Is(err, cache.ErrNotFound) {
+				t.Fatalf("expected %v but got %v", cache.ErrNotFound, err)
+			}
+			expectChunks(t, cacheMod, saved)
+			quarantined, err := afero.ReadFile(fs, "data/quarantine.data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the chunk coordinate and length come before the data
+			expect := append([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(stored)), 0, 0, 0}, stored...)
+			if !reflect.DeepEqual(quarantined, expect) {
+				t.Fatalf("expected quarantine file %v but got %v", expect, quarantined)
+			}
+			saved[corrupt] = saveTestChunks(cacheMod, 2, twoRegionPositions[:1])[corrupt]
+			expectChunks(t, cacheMod, saved)
+		})
+	}
+}
+
+func TestCacheLoadsInvalidChunkDataAsCorrupt(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	saveTestChunks(cacheMod, 2, twoRegionPositions[:1])
+	cacheMod.Close()
+	// a payload without a header whose first voxel has the X coordinate 1
+	data, err := afero.ReadFile(fs, "data/voxel.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := data[12:]
+	copy(raw, []byte{0, 0, 0x80, 0x3f})
+	if err := afero.WriteFile(fs, "data/voxel.data", raw, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cacheMod = cache.NewWithLayout(fs, twoRegionSettings, cache.LayoutFlat)
+	defer cacheMod.Close()
+
+	_, err = cacheMod.Load(twoRegionPositions[0])
+
+	if !errors.Is(err, cache.ErrCorrupt) {
+		t.Fatalf("expected %v but got %v", cache.ErrCorrupt, err)
+	}
+}
+
+// layoutDataFiles is the file that the first chunks of twoRegionPositions are
+// saved in, in each layout.
+var layoutDataFiles = map[cache.Layout]string{
+	cache.LayoutFlat:        "data/voxel.data",
+	cache.LayoutRegionFiles: "data/region/r.0.0.0.vxr",
+}
+
+func TestCacheReusesFreeSpace(t *testing.T) {
+	t.Parallel()
+	for layout, name := range layoutDataFiles {
+		layout, name := layout, name
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+			// the first chunk leaves free space before the others
+			if err := cacheMod.Quarantine(twoRegionPositions[0]); err != nil {
+				t.Fatal(err)
+			}
+			cacheMod.Close()
+			size := fileSize(t, fs, name)
+			cacheMod = cache.NewWithLayout(fs, twoRegionSettings, layout)
+			defer cacheMod.Close()
+
+			saveTestChunks(cacheMod, 2, twoRegionPositions[:1])
+
+			expectChunks(t, cacheMod, saved)
+			if after := fileSize(t, fs, name); after != size {
+				t.Fatalf("expected the chunk to be saved in free space of %v, but it grew from %v to %v bytes", name, size, after)
+			}
+		})
+	}
+}
+
+func TestCacheCompact(t *testing.T) {
+	t.Parallel()
+	for layout, name := range layoutDataFiles {
+		layout, name := layout, name
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+			saved := saveTestChunks(cacheMod, 2, twoRegionPositions)
+			if err := cacheMod.Quarantine(twoRegionPositions[0]); err != nil {
+				t.Fatal(err)
+			}
+			delete(saved, twoRegionPositions[0])
+			cacheMod.Close()
+			// a cache that never had the first chunk
+			compactFs := afero.NewMemMapFs()
+			cacheMod = cache.NewWithLayout(compactFs, twoRegionSettings, layout)
+			saveTestChunks(cacheMod, 2, twoRegionPositions[1:])
+			cacheMod.Close()
+
+			stats, err := cache.Compact(fs, twoRegionSettings)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Moved != 1 {
+				t.Fatalf("expected 1 chunk to be moved but got %v", stats.Moved)
+			}
+			if stats.BytesAfter >= stats.BytesBefore {
+				t.Fatalf("expected compacting to shrink %v bytes, but got %v bytes", stats.BytesBefore, stats.BytesAfter)
+			}
+			if size, expect := fileSize(t, fs, name), fileSize(t, compactFs, name); size != expect {
+				t.Fatalf("expected %v to shrink to %v bytes but got %v bytes", name, expect, size)
+			}
+			cacheMod = cache.NewWithLayout(fs, twoRegionSettings, layout)
+			defer cacheMod.Close()
+			expectChunks(t, cacheMod, saved)
+			if moved, err := cacheMod.CompactStep(); moved || err != nil {
+				t.Fatalf("expected nothing left to compact, but moved %v with error %v", moved, err)
+			}
+		})
+	}
+}
+
+// oneRegionPositions are chunks that are all in the same region file with
+// twoRegionSettings.
+var oneRegionPositions = []chunk.ChunkCoordinate{
+	{X: 0, Y: 0, Z: 0},
+	{X: 1, Y: 0, Z: 0},
+	{X: 0, Y: 1, Z: 0},
+	{X: 1, Y: 1, Z: 0},
+	{X: 0, Y: 0, Z: 1},
+	{X: 1, Y: 1, Z: 1},
+}
+
+func TestCacheCompactStepMovesLastChunk(t *testing.T) {
+	t.Parallel()
+	for layout, name := range layoutDataFiles {
+		layout, name := layout, name
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			var files [][]byte
+			for run := 0; run < 2; run++ {
+				fs := afero.NewMemMapFs()
+				cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+				saved := saveTestChunks(cacheMod, 2, oneRegionPositions)
+				for _, pos := range oneRegionPositions[:2] {
+					if err := cacheMod.Quarantine(pos); err != nil {
+						t.Fatal(err)
+					}
+					delete(saved, pos)
+				}
+				size := fileSize(t, fs, name)
+
+				moved, err := cacheMod.CompactStep()
+
+				if err != nil || !moved {
+					t.Fatalf("expected a chunk to be moved, but moved %v with error %v", moved, err)
+				}
+				if after := fileSize(t, fs, name); after >= size {
+					t.Fatalf("expected moving the last chunk to shrink %v from %v bytes, but got %v bytes", name, size, after)
+				}
+				expectChunks(t, cacheMod, saved)
+				cacheMod.Close()
+				data, err := afero.ReadFile(fs, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, data)
+			}
+			if !bytes.Equal(files[0], files[1]) {
+				t.Fatalf("expected compacting the same cache to give the same %v", name)
+			}
+		})
+	}
+}
+
+func TestWriteBehindLoadReturnsQueuedCopy(t *testing.T) {
+	t.Parallel()
+	cacheMod := cache.NewWriteBehind(&cache.FnModule{
+		FnLoad: func(chunk.ChunkCoordinate) (chunk.Chunk, error) {
+			t.Fatal("expected the queued chunk to be loaded")
+			return chunk.Chunk{}, nil
+		},
+	}, 4)
+	ch := chunk.NewChunkEmpty(twoRegionPositions[0], 2)
+	vc := chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}
+	ch.SetBlockType(vc, chunk.BlockTypeDirt)
+	cacheMod.Save(ch)
+	ch.SetBlockType(vc, chunk.BlockTypeStone)
+
+	loaded, err := cacheMod.Load(twoRegionPositions[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bt := loaded.BlockType(vc); bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected the block type when the chunk was saved, %v, but got %v", chunk.BlockTypeDirt, bt)
+	}
+	if positions, err := cacheMod.Chunks(); err != nil || !reflect.DeepEqual(positions, twoRegionPositions[:1]) {
+		t.Fatalf("expected chunks %v but got %v", twoRegionPositions[:1], positions)
+	}
+}
+
+func TestWriteBehindCloseFlushesQueue(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.NewWriteBehind(cache.New(fs, twoRegionSettings), len(twoRegionPositions))
+	saved := map[chunk.ChunkCoordinate][]float32{}
+	for _, pos := range twoRegionPositions {
+		ch := chunk.NewChunkEmpty(pos, 2)
+		ch.SetBlockType(chunk.VoxelCoordinate{X: pos.X * 2, Y: pos.Y * 2, Z: pos.Z * 2}, chunk.BlockTypeDirt)
+		cacheMod.Save(ch)
+		saved[pos] = ch.GetFlatData()
+	}
+
+	err := cacheMod.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened := cache.New(fs, twoRegionSettings)
+	defer reopened.Close()
+	expectChunks(t, reopened, saved)
+}
+
+func TestWriteBehindWaitsWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+	written := make(chan chunk.ChunkCoordinate)
+	cacheMod := cache.NewWriteBehind(&cache.FnModule{
+		FnSave: func(ch chunk.Chunk) error {
+			written <- ch.Position()
+			return nil
+		},
+	}, 1)
+	go cacheMod.Run()
+	// the chunk that is being written stays in the queue until it is written
+	cacheMod.Save(chunk.NewChunkEmpty(twoRegionPositions[0], 2))
+	saved := make(chan struct{})
+	go func() {
+		cacheMod.Save(chunk.NewChunkEmpty(twoRegionPositions[1], 2))
+		close(saved)
+	}()
+
+	select {
+	case <-saved:
+		t.Fatal("expected saving to wait for the queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	for _, pos := range twoRegionPositions[:2] {
+		if actual := <-written; actual != pos {
+			t.Fatalf("expected chunk %v to be written but got %v", pos, actual)
+		}
+	}
+	<-saved
+	cacheMod.Close()
+}
+
+func TestWriteBehindCloseReturnsWriteErrors(t *testing.T) {
+	t.Parallel()
+	writes := 0
+	cacheMod := cache.NewWriteBehind(&cache.FnModule{
+		FnSave: func(chunk.Chunk) error {
+			writes++
+			return errInjected
+		},
+	}, 1)
+	cacheMod.Save(chunk.NewChunkEmpty(twoRegionPositions[0], 2))
+
+	err := cacheMod.Close()
+
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("expected %v but got %v", errInjected, err)
+	}
+	if writes != 3 {
+		t.Fatalf("expected 3 attempts to write the chunk but got %v", writes)
+	}
+}
+
+func TestWriteBehindCompactStepsUntilDoneOrClosed(t *testing.T) {
+	t.Parallel()
+	steps := 0
+	cacheMod := cache.NewWriteBehind(&cache.FnModule{
+		FnCompactStep: func() (bool, error) {
+			steps++
+			return steps < 3, nil
+		},
+	}, 1)
+
+	err := cacheMod.Compact()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps != 3 {
+		t.Fatalf("expected 3 compaction steps but got %v", steps)
+	}
+	cacheMod.Close()
+	if err := cacheMod.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if steps != 3 {
+		t.Fatalf("expected no compaction steps after closing, but got %v", steps-3)
+	}
+}
+
+func fileSize(t *testing.T, fs afero.Fs, name string) int64 {
+	t.Helper()
+	info, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// errInjected is returned by failingFs once it runs out of writes.
+var errInjected = errors.New("injected failure")
+
+// failingFs is a filesystem that stops writing after a number of writes, like
+// a game that stops partway through saving. The write that runs out writes
+// half of its bytes, and every write after it fails.
+type failingFs struct {
+	afero.Fs
+	writes *int
+}
+
+// write returns how many bytes of n a write may write, or false if it fails.
+func (fs failingFs) write(n int) (int, bool) {
+	switch {
+	case *fs.writes > 0:
+		*fs.writes--
+		return n, true
+	case *fs.writes == 0:
+		*fs.writes--
+		return n / 2, false
+	}
+	return 0, false
+}
+
+func (fs failingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return failingFile{File: file, fs: fs}, nil
+}
+
+func (fs failingFs) Rename(oldname, newname string) error {
+	if _, ok := fs.write(0); !ok {
+		return errInjected
+	}
+	return fs.Fs.Rename(oldname, newname)
+}
+
+type failingFile struct {
+	afero.File
+	fs failingFs
+}
+
+func (f failingFile) Write(bs []byte) (int, error) {
+	n, ok := f.fs.write(len(bs))
+	written, err := f.File.Write(bs[:n])
+	if !ok {
+		return written, errInjected
+	}
+	return written, err
+}
+
+func (f failingFile) WriteAt(bs []byte, off int64) (int, error) {
+	n, ok := f.fs.write(len(bs))
+	written, err := f.File.WriteAt(bs[:n], off)
+	if !ok {
+		return written, errInjected
+	}
+	return written, err
+}
+
+func (f failingFile) Truncate(size int64) error {
+	if _, ok := f.fs.write(0); !ok {
+		return errInjected
+	}
+	return f.File.Truncate(size)
+}
+
+func (f failingFile) Sync() error {
+	if _, ok := f.fs.write(0); !ok {
+		return errInjected
+	}
+	return f.File.Sync()
+}
+
+func TestCacheRecoversFromSavesThatStopPartway(t *testing.T) {
+	t.Parallel()
+	for _, layout := range []cache.Layout{cache.LayoutFlat, cache.LayoutRegionFiles} {
+		layout := layout
+		t.Run(fmt.Sprintf("layout %v", layout), func(t *testing.T) {
+			t.Parallel()
+			for writes := 0; ; writes++ {
+				fs := afero.NewMemMapFs()
+				cacheMod := cache.NewWithLayout(fs, twoRegionSettings, layout)
+				before := saveTestChunks(cacheMod, 2, twoRegionPositions[:2])
+				cacheMod.Close()
+				remaining := writes
+				cacheMod = cache.NewWithLayout(failingFs{Fs: fs, writes: &remaining}, withCompressionLevel(twoRegionSettings, 9), layout)
+				after := map[chunk.ChunkCoordinate][]float32{}
+				for _, pos := range twoRegionPositions {
+					ch := chunk.NewChunkEmpty(pos, 2)
+					ch.SetBlockType(chunk.VoxelCoordinate{X: pos.X * 2, Y: pos.Y * 2, Z: pos.Z * 2}, chunk.BlockTypeDirt)
+					cacheMod.Save(ch)
+					after[pos] = ch.GetFlatData()
+				}
+				// the game stops without closing the cache
+
+				cacheMod = cache.NewWithLayout(fs, twoRegionSettings, layout)
+
+				for _, pos := range twoRegionPositions {
+					ch, err := cacheMod.Load(pos)
+					switch {
+					case err == nil && reflect.DeepEqual(ch.GetFlatData(), after[pos]):
+					case err == nil && before[pos] != nil && reflect.DeepEqual(ch.GetFlatData(), before[pos]):
+						if remaining >= 0 {
+							t.Fatalf("expected chunk %v to be saved after %v writes", pos, writes)
+						}
+					case errors.Is(err, cache.ErrNotFound) && before[pos] == nil:
+					default:
+						t.Fatalf("expected chunk %v to be saved or as it was after %v writes, but got %v, %v", pos, writes, err, ch.GetFlatData())
+					}
+				}
+				cacheMod.Close()
+				if remaining >= 0 {
+					// every save finished
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCacheSaveReturnsWriteErrors(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cache.New(fs, twoRegionSettings).Close()
+	writes := 0
+	cacheMod := cache.New(failingFs{Fs: fs, writes: &writes}, twoRegionSettings)
+
+	err := cacheMod.Save(chunk.NewChunkEmpty(twoRegionPositions[0], 2))
+
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("expected %v but got %v", errInjected, err)
+	}
+	if _, err := cacheMod.Load(twoRegionPositions[0]); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected %v but got %v", cache.ErrNotFound, err)
+	}
+}
+
+func TestCacheDoesNotLoadChunksWithWrongChecksum(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	cacheMod := cache.New(fs, twoRegionSettings)
+	saved := saveTestChunks(cacheMod, 2, twoRegionPositions[:2])
+	cacheMod.Close()
+	file, err := fs.OpenFile("data/region/r.0.0.0.vxr", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a byte of the data of chunk 0, 0, 0, after the header of the file and
+	// of the payload
+	file.WriteAt([]byte{0xff}, 4096+20)
+	file.Close()
+	delete(saved, twoRegionPositions[0])
+
+	cacheMod = cache.New(fs, twoRegionSettings)
+	defer cacheMod.Close()
+
+	if _, err := cacheMod.Load(twoRegionPositions[0]); !errors.Is(err, cache.ErrCorrupt) {
+		t.Fatalf("expected chunk with a wrong checksum to fail with %v but got %v", cache.ErrCorrupt, err)
+	}
+	for pos, data := range saved {
+		ch, err := cacheMod.Load(pos)
+		if err != nil || !reflect.DeepEqual(ch.GetFlatData(), data) {
+			t.Fatalf("expected chunk %v to load", pos)
+		}
+	}
+}
+
+var benchmarkLayouts = map[string]cache.Layout{
+	"flat":         cache.LayoutFlat,
+	"region files": cache.LayoutRegionFiles,
+}
+
+// newBenchmarkCache returns a cache with the given layout and a chunk saved in
+// each of regions regions, and the positions of the chunks. In the flat
+// layout, each region is an entry of the region index.
+func newBenchmarkCache(b *testing.B, fs afero.Fs, layout cache.Layout, regions int) (*cache.Module, []chunk.ChunkCoordinate) {
+	b.Helper()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 1
+		},
+		FnGetRegionSize: func() uint32 {
+			return 1
+		},
+	}
+	cacheMod := cache.NewWithLayout(fs, settingsRepo, layout)
+	positions := make([]chunk.ChunkCoordinate, 0, regions)
+	for i := 0; i < regions; i++ {
+		pos := chunk.ChunkCoordinate{X: int32(i % 100), Y: int32(i / 100), Z: int32(i % 7)}
+		cacheMod.Save(chunk.NewChunkEmpty(pos, 1))
+		positions = append(positions, pos)
+	}
+	return cacheMod, positions
+}
+
+func BenchmarkCacheLoad(b *testing.B) {
+	for name, layout := range benchmarkLayouts {
+		for _, regions := range []int{10, 1000, 5000} {
+			layout, regions := layout, regions
+			b.Run(fmt.Sprintf("%v/%v regions", name, regions), func(b *testing.B) {
+				cacheMod, positions := newBenchmarkCache(b, afero.NewMemMapFs(), layout, regions)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := cacheMod.Load(positions[i%len(positions)]); err != nil {
+						b.Fatal("failed to load")
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCacheSave(b *testing.B) {
+	for name, layout := range benchmarkLayouts {
+		for _, regions := range []int{10, 1000, 5000} {
+			layout, regions := layout, regions
+			b.Run(fmt.Sprintf("%v/%v regions", name, regions), func(b *testing.B) {
+				cacheMod, positions := newBenchmarkCache(b, afero.NewMemMapFs(), layout, regions)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					cacheMod.Save(chunk.NewChunkEmpty(positions[i%len(positions)], 1))
+				}
+			})
+		}
+	}
+}
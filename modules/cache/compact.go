@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+// CompactStats describes what Compact did.
+type CompactStats struct {
+	// Moved is the number of saved chunks that were moved.
+	Moved int
+	// BytesBefore is the size of the cache files before compacting.
+	BytesBefore int64
+	// BytesAfter is the size of the cache files after compacting.
+	BytesAfter int64
+}
+
+// Compact moves the saved chunks of the cache in fs into the free space
+// between them, and shrinks the cache files by the free space that gathers at
+// their ends. Unlike Trim, it rewrites the cache files in place. The cache
+// must not be open; an open cache is compacted with CompactStep instead.
+func Compact(fs afero.Fs, settingsRepo settings.Interface) (CompactStats, error) {
+	if settingsRepo == nil {
+		panic("compact received nil settings repo")
+	}
+	var stats CompactStats
+	var err error
+	stats.BytesBefore, err = dataSize(fs)
+	if err != nil {
+		return CompactStats{}, err
+	}
+	cacheMod, err := Open(fs, settingsRepo)
+	if err != nil {
+		return CompactStats{}, err
+	}
+	for {
+		moved, err := cacheMod.CompactStep()
+		if err != nil {
+			cacheMod.Close()
+			return stats, err
+		}
+		if !moved {
+			break
+		}
+		stats.Moved++
+	}
+	if err := cacheMod.Close(); err != nil {
+		return stats, err
+	}
+	stats.BytesAfter, err = dataSize(fs)
+	return stats, err
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"errors"
+	"os"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+// ConvertToRegionFiles moves the chunks of a cache with LayoutFlat into region
+// files, and returns how many chunks were moved. A cache that already uses
+// region files is left as it is. The cache must not be open.
+//
+// The three files of the flat layout are only removed once every chunk is in
+// a region file, so a conversion that stops partway can be run again.
+func ConvertToRegionFiles(fs afero.Fs, settingsRepo settings.Interface) (int, error) {
+	if settingsRepo == nil {
+		panic("convert received nil settings repo")
+	}
+	format, err := RecordFormat(fs, settingsRepo.GetChunkSize(), settingsRepo.GetRegionSize())
+	if err != nil {
+		return 0, err
+	}
+	if err := checkFormat(format, settingsRepo.GetChunkSize(), settingsRepo.GetRegionSize()); err != nil {
+		return 0, err
+	}
+	if format.layout() != LayoutFlat {
+		return 0, nil
+	}
+	return convertToRegionFiles(fs, format, settingsRepo)
+}
+
+// convertToRegionFiles upgrades a cache of format version 1 to version 2.
+func convertToRegionFiles(fs afero.Fs, format Format, settingsRepo settings.Interface) (int, error) {
+	from, err := newFlatStore(fs, format, false)
+	if err != nil {
+		return 0, err
+	}
+	journal, err := openJournal(fs, false)
+	if err != nil {
+		from.close()
+		return 0, err
+	}
+	err = journal.replay(from)
+	journal.close()
+	if err != nil {
+		from.close()
+		return 0, err
+	}
+	format.Version = 2
+	to, err := newRegionStore(fs, format, false)
+	if err != nil {
+		from.close()
+		return 0, err
+	}
+	level := int(settingsRepo.GetCompressionLevel())
+	positions, err := from.chunks()
+	if err != nil {
+		from.close()
+		to.close()
+		return 0, err
+	}
+	converted := 0
+	for _, pos := range positions {
+		var ch chunk.Chunk
+		ch, err = from.load(pos)
+		var payload []byte
+		if err == nil {
+			payload, err = encodePayload(ch, level, format.storesBlockTypes())
+		}
+		if err == nil {
+			err = to.save(pos, payload)
+		}
+		if err != nil {
+			from.close()
+			to.close()
+			return converted, err
+		}
+		converted++
+	}
+	err = to.sync()
+	from.close()
+	to.close()
+	if err != nil {
+		return converted, err
+	}
+	// the format decides the layout, so it is only written once every chunk
+	// is in a region file, and the flat files are only removed after that
+	if err := writeFormat(fs, format); err != nil {
+		return converted, err
+	}
+	for _, name := range []string{"voxel.data", "chunk.data", "region.data"} {
+		if err := fs.Remove("data/" + name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return converted, err
+		}
+	}
+	return converted, nil
+}
@@ -4,19 +4,49 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"io"
-	"log"
+	"fmt"
+	"os"
 
 	"github.com/kroppt/voxels/chunk"
 	"github.com/kroppt/voxels/repositories/settings"
 	"github.com/spf13/afero"
 )
 
+// chunkStore keeps the data of saved chunks in one of the layouts of the
+// cache files.
+type chunkStore interface {
+	// save stores the payload of the chunk at pos.
+	save(pos chunk.ChunkCoordinate, payload []byte) error
+	// load returns the chunk at pos, with the same errors as Interface.Load.
+	load(pos chunk.ChunkCoordinate) (chunk.Chunk, error)
+	// stored returns the bytes that the chunk at pos is stored as, as many as
+	// can be read if the chunk is corrupt.
+	stored(pos chunk.ChunkCoordinate) ([]byte, error)
+	// remove removes the chunk at pos, so that it counts as not saved.
+	remove(pos chunk.ChunkCoordinate) error
+	// chunks returns the positions of all saved chunks.
+	chunks() ([]chunk.ChunkCoordinate, error)
+	// compactStep moves the payload of one chunk into free space nearer the
+	// start of its file, and returns false if there is none left to move.
+	compactStep() (bool, error)
+	// sync commits the saved payloads to stable storage.
+	sync() error
+	close() error
+}
+
 type core struct {
-	voxelFile    afero.File
-	chunkFile    afero.File
-	regionFile   afero.File
+	format       Format
+	store        chunkStore
+	journal      *journal
+	fs           afero.Fs
 	settingsRepo settings.Interface
+	scheduled    map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate
+	pending      map[chunk.ChunkCoordinate][]chunk.PendingAction
+	// readOnly is whether the cache was opened with OpenReadOnly.
+	readOnly bool
+	// unreplayed is the save in the journal of a read-only cache, which is
+	// read in place of what the chunk store has for its chunk.
+	unreplayed map[chunk.ChunkCoordinate][]byte
 }
 
 type regionPosition struct {
@@ -56,258 +86,171 @@ func chunkPosToRegionPos(pos chunk.ChunkCoordinate, regionSize uint32) regionPos
 
 }
 
-func (c *core) save(ch chunk.Chunk) {
-	regionPos := chunkPosToRegionPos(ch.Position(), c.settingsRepo.GetRegionSize())
-	regionIdx, ok := c.getRegionIdx(regionPos)
-	if !ok {
-		// region wasn't registered
-		info, err := c.regionFile.Stat()
-		if err != nil {
-			log.Print(err)
-		}
-		regionOff := info.Size()
-		info, err = c.chunkFile.Stat()
-		if err != nil {
-			log.Print(err)
-		}
-		regionIdx := info.Size()
-		c.writeRegionFileAt(regionPos.x, regionPos.y, regionPos.z, int32(regionIdx), regionOff)
-		c.writeRegionAt(regionPos, regionIdx)
-		// chunk couldn't have been registered because the region wasn't
-		info, err = c.voxelFile.Stat()
-		if err != nil {
-			log.Print(err)
-		}
-		chunkIdx := int32(info.Size())
-		c.writeChunkFileAt(chunkIdx, int64(int32(regionIdx)+4*chunkPosToDataOffset(ch.Position(), regionPos, int32(c.settingsRepo.GetRegionSize()))))
-		c.writeChunkAt(ch, int64(chunkIdx))
-
-	} else {
-		// region was registered, but maybe chunk wasnt
-		chunkIdx := c.getChunkIdx(regionIdx + 4*chunkPosToDataOffset(ch.Position(), regionPos, int32(c.settingsRepo.GetRegionSize())))
-		if chunkIdx == -1 {
-			// chunk was not registered
-			info, err := c.voxelFile.Stat()
-			if err != nil {
-				log.Print(err)
-			}
-			chunkIdx = int32(info.Size())
-			c.writeChunkFileAt(chunkIdx,
-				int64(regionIdx+4*chunkPosToDataOffset(ch.Position(), regionPos, int32(c.settingsRepo.GetRegionSize()))))
-			c.writeChunkAt(ch, int64(chunkIdx))
-		} else {
-			// both region and chunk were registered
-			c.writeChunkAt(ch, int64(chunkIdx))
-		}
-	}
+func chunkPosToDataOffset(chunkPos chunk.ChunkCoordinate, regionPos regionPosition, size int32) int32 {
+	i := chunkPos.X - regionPos.x*size
+	j := chunkPos.Y - regionPos.y*size
+	k := chunkPos.Z - regionPos.z*size
+	return i + j*size + k*size*size
 }
 
-func (c *core) load(pos chunk.ChunkCoordinate) (chunk.Chunk, bool) {
-	regionPos := chunkPosToRegionPos(pos, c.settingsRepo.GetRegionSize())
-	regionIdx, ok := c.getRegionIdx(regionPos)
-	if !ok {
-		return chunk.Chunk{}, false
-	} else {
-		// region existed, chunk registered?
-		chunkIdx := c.getChunkIdx(regionIdx + 4*chunkPosToDataOffset(pos, regionPos, int32(c.settingsRepo.GetRegionSize())))
-		if chunkIdx == -1 {
-			return chunk.Chunk{}, false
-		}
-
-		chunkSize := c.settingsRepo.GetChunkSize()
-		numElems := chunk.VertSize * chunkSize * chunkSize * chunkSize
-		byteSize := chunk.BytesPerElement * numElems
-		bs := make([]byte, byteSize)
-
-		n, err := c.voxelFile.ReadAt(bs, int64(chunkIdx))
-		if uint32(n) != byteSize {
-			log.Printf("(load) expected %v bytes to be read, but only %v were read", byteSize, n)
-			return chunk.Chunk{}, false
-		}
-		if !errors.Is(err, io.EOF) && err != nil {
-			log.Print(err)
-			return chunk.Chunk{}, false
-		}
-		buf := bytes.NewBuffer(bs)
-		flatData := make([]float32, numElems)
-		err = binary.Read(buf, binary.LittleEndian, flatData)
-		if err != nil {
-			log.Print(err)
-			return chunk.Chunk{}, false
-		}
-		return chunk.NewChunkFromData(flatData, chunkSize, pos), true
+func (c *core) save(ch chunk.Chunk) error {
+	if c.readOnly {
+		return fmt.Errorf("%w: cannot save chunk %v", ErrReadOnly, ch.Position())
 	}
-
-}
-
-func (c *core) writeChunkAt(ch chunk.Chunk, off int64) {
-	var buf bytes.Buffer
-	err := binary.Write(&buf, binary.LittleEndian, ch.GetFlatData())
+	// a save that failed partway has to be finished before the journal is
+	// reused
+	if err := c.journal.replay(c.store); err != nil {
+		return fmt.Errorf("failed to finish an earlier save: %w", err)
+	}
+	payload, err := encodePayload(ch, int(c.settingsRepo.GetCompressionLevel()), c.format.storesBlockTypes())
 	if err != nil {
-		log.Print(err)
-		return
+		return fmt.Errorf("failed to encode chunk %v: %w", ch.Position(), err)
 	}
-	n, err := c.voxelFile.WriteAt(buf.Bytes(), off)
-	expectSize := buf.Len()
-	if n != expectSize {
-		log.Printf("(write) expected to write %v bytes, but only wrote %v bytes", expectSize, n)
-		return
+	if err := c.journal.write(ch.Position(), payload); err != nil {
+		return fmt.Errorf("failed to write chunk %v to the journal: %w", ch.Position(), err)
 	}
-	if err != nil {
-		log.Print(err)
-		return
+	// the journal has the save from here on, so it is finished either now or
+	// by the next save or when the cache is opened again
+	if err := c.journal.commit(c.store, ch.Position(), payload); err != nil {
+		return fmt.Errorf("failed to save chunk %v: %w", ch.Position(), err)
 	}
+	return nil
 }
 
-func chunkPosToDataOffset(chunkPos chunk.ChunkCoordinate, regionPos regionPosition, size int32) int32 {
-	i := chunkPos.X - regionPos.x*size
-	j := chunkPos.Y - regionPos.y*size
-	k := chunkPos.Z - regionPos.z*size
-	return i + j*size + k*size*size
-}
-
-func (c *core) getEmptyRegionData(regionPos regionPosition) []int32 {
-	size := int32(c.settingsRepo.GetRegionSize())
-	data := make([]int32, size*size*size)
-	for x := regionPos.x * size; x < regionPos.x*size+size; x++ {
-		for y := regionPos.y * size; y < regionPos.y*size+size; y++ {
-			for z := regionPos.z * size; z < regionPos.z*size+size; z++ {
-				off := chunkPosToDataOffset(chunk.ChunkCoordinate{X: x, Y: y, Z: z}, regionPos, size)
-				data[off] = -1.0
-			}
-		}
+func (c *core) load(pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
+	if payload, ok := c.unreplayed[pos]; ok {
+		return decodePayload(payload, c.format.ChunkSize, pos)
 	}
-	return data
+	return c.store.load(pos)
 }
 
-func (c *core) writeRegionAt(regionPos regionPosition, off int64) {
-	var buf bytes.Buffer
-	emptyData := c.getEmptyRegionData(regionPos)
-	err := binary.Write(&buf, binary.LittleEndian, emptyData)
-	if err != nil {
-		log.Print(err)
-		return
+// quarantinePath is the file that the data of quarantined chunks is moved to.
+const quarantinePath = "data/quarantine.data"
+
+// quarantine moves the data of the chunk at pos from the chunk store to the
+// end of the quarantine file. The data is written to the quarantine file
+// before the chunk is removed, so it isn't lost if the game stops in between.
+//
+// Each entry of the quarantine file is the chunk coordinate as int32 and the
+// length of the data as uint32, followed by the data as it was stored.
+func (c *core) quarantine(pos chunk.ChunkCoordinate) error {
+	if c.readOnly {
+		return fmt.Errorf("%w: cannot quarantine chunk %v", ErrReadOnly, pos)
 	}
-	n, err := c.chunkFile.WriteAt(buf.Bytes(), off)
-	expectSize := buf.Len()
-	if n != expectSize {
-		log.Printf("(writeRegionAt) expected to write %v bytes, but only wrote %v bytes", expectSize, n)
-		return
+	if err := c.journal.replay(c.store); err != nil {
+		return fmt.Errorf("failed to finish an earlier save: %w", err)
 	}
+	data, err := c.store.stored(pos)
 	if err != nil {
-		log.Print(err)
-		return
+		return err
 	}
-}
-
-func (c *core) writeRegionFileAt(x, y, z, metaIdx int32, off int64) {
 	var buf bytes.Buffer
-	err := binary.Write(&buf, binary.LittleEndian, []int32{x, y, z, metaIdx})
+	binary.Write(&buf, binary.LittleEndian, []int32{pos.X, pos.Y, pos.Z})
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	file, err := c.fs.OpenFile(quarantinePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0755)
 	if err != nil {
-		log.Print(err)
-		return
+		return err
+	}
+	_, err = file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
 	}
-	n, err := c.regionFile.WriteAt(buf.Bytes(), off)
-	expectSize := buf.Len()
-	if n != expectSize {
-		log.Printf("(writeFileAt) expected to write %v bytes, but only wrote %v bytes", expectSize, n)
-		return
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
 	if err != nil {
-		log.Print(err)
-		return
+		return err
 	}
+	if err := c.store.remove(pos); err != nil {
+		return err
+	}
+	return c.store.sync()
 }
 
-func (c *core) writeChunkFileAt(metaIdx int32, off int64) {
-	var buf bytes.Buffer
-	err := binary.Write(&buf, binary.LittleEndian, metaIdx)
-	if err != nil {
-		log.Print(err)
-		return
+func (c *core) compactStep() (bool, error) {
+	if c.readOnly {
+		return false, fmt.Errorf("%w: cannot compact", ErrReadOnly)
 	}
-	n, err := c.chunkFile.WriteAt(buf.Bytes(), off)
-	expectSize := buf.Len()
-	if n != expectSize {
-		log.Printf("(writeFileAt) expected to write %v bytes, but only wrote %v bytes", expectSize, n)
-		return
+	if err := c.journal.replay(c.store); err != nil {
+		return false, fmt.Errorf("failed to finish an earlier save: %w", err)
 	}
+	moved, err := c.store.compactStep()
 	if err != nil {
-		log.Print(err)
-		return
+		return false, fmt.Errorf("failed to compact: %w", err)
 	}
+	return moved, nil
 }
 
-func (c *core) getChunkIdx(off int32) int32 {
-	byteSize := 4
-	bs := make([]byte, byteSize)
-	n, err := c.chunkFile.ReadAt(bs, int64(off))
-	if n != byteSize {
-		log.Printf("(getChunkIdx) expected %v bytes to be read, but only %v were read", byteSize, n)
-		return -1
-	}
-	if !errors.Is(err, io.EOF) && err != nil {
-		log.Print(err)
-		return -1
-	}
-	buf := bytes.NewBuffer(bs)
-	var chunkIdx int32
-	err = binary.Read(buf, binary.LittleEndian, &chunkIdx)
+func (c *core) chunks() ([]chunk.ChunkCoordinate, error) {
+	positions, err := c.store.chunks()
 	if err != nil {
-		log.Print(err)
-		return -1
+		return nil, fmt.Errorf("failed to list the saved chunks: %w", err)
 	}
-	return chunkIdx
+	for pos := range c.unreplayed {
+		if !containsChunk(positions, pos) {
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
 }
 
-func (c *core) getRegionIdx(regionPos regionPosition) (int32, bool) {
-	curr := int64(0)
-	for {
-		numElems := 4
-		byteSize := 4 * numElems
-		bs := make([]byte, byteSize)
-		n, err := c.regionFile.ReadAt(bs, curr)
-		if n == 0 && errors.Is(err, io.EOF) {
-			return -1, false
-		}
-		if n != byteSize {
-			log.Printf("(getRegionIdx) expected %v bytes to be read, but only %v were read", byteSize, n)
-			return -1, false
+func containsChunk(positions []chunk.ChunkCoordinate, pos chunk.ChunkCoordinate) bool {
+	for _, p := range positions {
+		if p == pos {
+			return true
 		}
-		if !errors.Is(err, io.EOF) && err != nil {
-			log.Print(err)
-			return -1, false
-		}
-		buf := bytes.NewBuffer(bs)
-		regionEntry := make([]int32, numElems)
-		err = binary.Read(buf, binary.LittleEndian, regionEntry)
+	}
+	return false
+}
+
+// close closes every file even if one fails, and returns the first error.
+func (c *core) close() error {
+	var errs []error
+	if !c.readOnly {
+		errs = append(errs, c.writeScheduled(), c.writePending())
+	}
+	errs = append(errs, c.store.close(), c.journal.close())
+	for _, err := range errs {
 		if err != nil {
-			log.Print(err)
-			return -1, false
-		}
-		key := regionPosition{
-			x: regionEntry[0],
-			y: regionEntry[1],
-			z: regionEntry[2],
+			return err
 		}
-		if key == regionPos {
-			return regionEntry[3], true
-		}
-		curr += int64(byteSize)
 	}
+	return nil
 }
 
-func (c *core) close() {
-	err := c.voxelFile.Close()
-	if err != nil {
-		panic(err)
+// openDataFile opens a cache file for reading and writing, and creates it if
+// it doesn't exist. A read-only cache opens it only for reading, and a file
+// that doesn't exist reads as empty.
+func openDataFile(fs afero.Fs, name string, readOnly bool) (afero.File, error) {
+	if !readOnly {
+		return fs.OpenFile(name, os.O_CREATE|os.O_RDWR, 0755)
 	}
-	err = c.chunkFile.Close()
+	file, err := fs.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return afero.NewMemMapFs().Create(name)
+	}
+	return file, err
+}
+
+// replaceFile replaces the contents of the file at name with data. The data
+// is written to a new file that is then renamed, so the file has either its
+// old or its new contents if the game stops partway.
+func replaceFile(fs afero.Fs, name string, data []byte) error {
+	newName := name + ".new"
+	file, err := fs.OpenFile(newName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-	err = c.regionFile.Close()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return fs.Rename(newName, name)
 }
@@ -0,0 +1,534 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// flatStore keeps the chunks of all regions in three files. The region file
+// lists the regions, the chunk file has a table of chunk offsets for every
+// region, and the voxel file has the data of every chunk.
+type flatStore struct {
+	voxelFile  afero.File
+	chunkFile  afero.File
+	regionFile afero.File
+	format     Format
+	// regions is the region file, from region position to the offset of the
+	// region's chunk table in the chunk file.
+	regions map[regionPosition]int32
+	// slots is where the payload of every saved chunk is in the voxel file.
+	slots map[chunk.ChunkCoordinate]extent
+	// order is the slots that compaction can move, and owners the chunk of
+	// each of them by offset. A slot that overlaps another one, which only a
+	// corrupt file has, is left where it is.
+	order  slotOrder
+	owners map[int64]chunk.ChunkCoordinate
+	// free is the space in the voxel file that no payload uses.
+	free *freeSpace
+}
+
+func newFlatStore(fs afero.Fs, format Format, readOnly bool) (*flatStore, error) {
+	voxelFile, err := openDataFile(fs, "data/voxel.data", readOnly)
+	if err != nil {
+		return nil, err
+	}
+	chunkFile, err := openDataFile(fs, "data/chunk.data", readOnly)
+	if err != nil {
+		voxelFile.Close()
+		return nil, err
+	}
+	regionFile, err := openDataFile(fs, "data/region.data", readOnly)
+	if err != nil {
+		voxelFile.Close()
+		chunkFile.Close()
+		return nil, err
+	}
+	s := &flatStore{
+		voxelFile:  voxelFile,
+		chunkFile:  chunkFile,
+		regionFile: regionFile,
+		format:     format,
+	}
+	s.regions, err = readRegions(regionFile)
+	if err == nil {
+		err = s.readSlots()
+	}
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readSlots finds where the payload of every saved chunk is in the voxel file,
+// and takes the rest of the file as free space. A payload whose size can't be
+// read is taken to go up to the end of the file, so that nothing is written
+// over it before it is quarantined.
+func (s *flatStore) readSlots() error {
+	info, err := s.voxelFile.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	s.slots = map[chunk.ChunkCoordinate]extent{}
+	s.order = slotOrder{}
+	s.owners = map[int64]chunk.ChunkCoordinate{}
+	used := []extent{}
+	positions, err := s.chunks()
+	if err != nil {
+		return err
+	}
+	for _, pos := range positions {
+		chunkIdx, err := s.getChunkIdx(pos, s.tableOffset(pos))
+		if errors.Is(err, ErrCorrupt) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		slot := extent{off: int64(chunkIdx), size: end - int64(chunkIdx)}
+		size, err := s.slotSize(pos, chunkIdx)
+		if err == nil && int64(size) <= slot.size {
+			slot.size = int64(size)
+			s.setSlot(pos, slot)
+		} else if err != nil && !errors.Is(err, ErrCorrupt) {
+			return err
+		}
+		used = append(used, slot)
+	}
+	s.free = newFreeSpace(used, end)
+	return nil
+}
+
+// tableOffset returns the offset of the entry of the chunk at pos in the chunk
+// file. The region of the chunk has to be registered.
+func (s *flatStore) tableOffset(pos chunk.ChunkCoordinate) int32 {
+	regionPos := chunkPosToRegionPos(pos, s.format.RegionSize)
+	return s.regions[regionPos] + 4*chunkPosToDataOffset(pos, regionPos, int32(s.format.RegionSize))
+}
+
+// save stores a payload so that the files never point at data that isn't
+// written yet: a region's chunk table is written before the region, and a
+// chunk's payload before its entry in the table. A save that stops partway
+// can leave data that nothing points at, but saving again finishes it.
+func (s *flatStore) save(pos chunk.ChunkCoordinate, payload []byte) error {
+	regionPos := chunkPosToRegionPos(pos, s.format.RegionSize)
+	regionIdx, ok := s.getRegionIdx(regionPos)
+	if !ok {
+		// region wasn't registered
+		info, err := s.chunkFile.Stat()
+		if err != nil {
+			return err
+		}
+		regionIdx = int32(info.Size())
+		if err := s.writeRegionAt(regionPos, int64(regionIdx)); err != nil {
+			return err
+		}
+		// an entry cut short by an earlier save is overwritten
+		regionOff := int64(16 * len(s.regions))
+		if err := s.writeRegionFileAt(regionPos.x, regionPos.y, regionPos.z, regionIdx, regionOff); err != nil {
+			return err
+		}
+		s.regions[regionPos] = regionIdx
+	}
+	tableOff := regionIdx + 4*chunkPosToDataOffset(pos, regionPos, int32(s.format.RegionSize))
+	size := int64(len(payload))
+	if slot, ok := s.slots[pos]; ok && slot.size >= size {
+		// chunk still fits where it was
+		if err := s.writeChunkAt(payload, slot.off); err != nil {
+			return err
+		}
+		s.free.release(slot.off+size, slot.size-size)
+		s.setSlot(pos, extent{off: slot.off, size: size})
+		return nil
+	}
+	// chunk wasn't registered or doesn't fit anymore, so goes where it fits
+	// best
+	info, err := s.voxelFile.Stat()
+	if err != nil {
+		return err
+	}
+	// the space of a failed save stays allocated until the cache is opened
+	// again, because the file might have grown partway
+	off := s.free.allocate(size, info.Size())
+	if err := s.writeChunkAt(payload, off); err != nil {
+		return err
+	}
+	if err := s.writeChunkFileAt(int32(off), int64(tableOff)); err != nil {
+		return err
+	}
+	s.moveSlot(pos, extent{off: off, size: size})
+	return nil
+}
+
+// moveSlot records that the payload of the chunk at pos is at slot now, and
+// frees the space of where it was.
+func (s *flatStore) moveSlot(pos chunk.ChunkCoordinate, slot extent) {
+	if old, ok := s.slots[pos]; ok {
+		s.free.release(old.off, old.size)
+	}
+	s.setSlot(pos, slot)
+}
+
+// setSlot records that the payload of the chunk at pos is at slot.
+func (s *flatStore) setSlot(pos chunk.ChunkCoordinate, slot extent) {
+	s.deleteSlot(pos)
+	s.slots[pos] = slot
+	if slot.size > 0 && !s.order.overlaps(slot) {
+		s.order.add(slot)
+		s.owners[slot.off] = pos
+	}
+}
+
+// deleteSlot forgets where the payload of the chunk at pos is.
+func (s *flatStore) deleteSlot(pos chunk.ChunkCoordinate) {
+	old, ok := s.slots[pos]
+	if !ok {
+		return
+	}
+	delete(s.slots, pos)
+	if owner, ok := s.owners[old.off]; ok && owner == pos {
+		s.order.remove(old.off)
+		delete(s.owners, old.off)
+	}
+}
+
+// slotSize returns how many bytes the payload of the chunk at pos, saved at off
+// in the voxel file, takes up.
+func (s *flatStore) slotSize(pos chunk.ChunkCoordinate, off int32) (int, error) {
+	header := make([]byte, payloadHeaderSize)
+	if err := readAllAt(s.voxelFile, header, int64(off)); err != nil {
+		return 0, corruptIfShort(pos, err)
+	}
+	if header, ok := readPayloadHeader(header); ok {
+		return payloadHeaderSize + int(header.length), nil
+	}
+	return payloadSize(s.format.ChunkSize), nil
+}
+
+func (s *flatStore) load(pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
+	regionPos := chunkPosToRegionPos(pos, s.format.RegionSize)
+	regionIdx, ok := s.getRegionIdx(regionPos)
+	if !ok {
+		return chunk.Chunk{}, ErrNotFound
+	}
+	// region existed, chunk registered?
+	chunkIdx, err := s.getChunkIdx(pos, regionIdx+4*chunkPosToDataOffset(pos, regionPos, int32(s.format.RegionSize)))
+	if err != nil {
+		return chunk.Chunk{}, err
+	}
+	if chunkIdx == -1 {
+		return chunk.Chunk{}, ErrNotFound
+	}
+	byteSize, err := s.slotSize(pos, chunkIdx)
+	if err != nil {
+		return chunk.Chunk{}, err
+	}
+	bs := make([]byte, byteSize)
+	if err := readAllAt(s.voxelFile, bs, int64(chunkIdx)); err != nil {
+		return chunk.Chunk{}, corruptIfShort(pos, err)
+	}
+	return decodePayload(bs, s.format.ChunkSize, pos)
+}
+
+func (s *flatStore) stored(pos chunk.ChunkCoordinate) ([]byte, error) {
+	regionPos := chunkPosToRegionPos(pos, s.format.RegionSize)
+	regionIdx, ok := s.getRegionIdx(regionPos)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	chunkIdx, err := s.getChunkIdx(pos, regionIdx+4*chunkPosToDataOffset(pos, regionPos, int32(s.format.RegionSize)))
+	if errors.Is(err, ErrCorrupt) {
+		// there is nothing to read where it points
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if chunkIdx == -1 {
+		return nil, ErrNotFound
+	}
+	info, err := s.voxelFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	byteSize, err := s.slotSize(pos, chunkIdx)
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		return nil, err
+	}
+	if remaining := info.Size() - int64(chunkIdx); err != nil || int64(byteSize) > remaining {
+		byteSize = int(remaining)
+	}
+	bs := make([]byte, byteSize)
+	if err := readAllAt(s.voxelFile, bs, int64(chunkIdx)); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+func (s *flatStore) remove(pos chunk.ChunkCoordinate) error {
+	regionPos := chunkPosToRegionPos(pos, s.format.RegionSize)
+	regionIdx, ok := s.getRegionIdx(regionPos)
+	if !ok {
+		return ErrNotFound
+	}
+	err := s.writeChunkFileAt(-1, int64(regionIdx+4*chunkPosToDataOffset(pos, regionPos, int32(s.format.RegionSize))))
+	if err != nil {
+		return err
+	}
+	if slot, ok := s.slots[pos]; ok {
+		s.free.release(slot.off, slot.size)
+		s.deleteSlot(pos)
+	}
+	return nil
+}
+
+// compactStep moves the payload of one chunk into free space nearer the start
+// of the voxel file, and truncates the free space that the file ends in. It
+// returns false if no payload could be moved.
+//
+// The payload is synced at its new place before the chunk's entry points at
+// it, so the chunk is in one place or the other if the game stops partway.
+func (s *flatStore) compactStep() (bool, error) {
+	slot, to, ok := s.free.pickMove(&s.order)
+	if !ok {
+		return false, s.truncate()
+	}
+	pos := s.owners[slot.off]
+	payload := make([]byte, slot.size)
+	if err := readAllAt(s.voxelFile, payload, slot.off); err != nil {
+		return false, corruptIfShort(pos, err)
+	}
+	off := s.free.take(to, slot.size)
+	if err := s.writeChunkAt(payload, off); err != nil {
+		return false, err
+	}
+	if err := s.voxelFile.Sync(); err != nil {
+		return false, err
+	}
+	if err := s.writeChunkFileAt(int32(off), int64(s.tableOffset(pos))); err != nil {
+		return false, err
+	}
+	if err := s.chunkFile.Sync(); err != nil {
+		return false, err
+	}
+	s.moveSlot(pos, extent{off: off, size: slot.size})
+	return true, s.truncate()
+}
+
+// truncate shrinks the voxel file by the free space that it ends in.
+func (s *flatStore) truncate() error {
+	info, err := s.voxelFile.Stat()
+	if err != nil {
+		return err
+	}
+	end := s.free.trimEnd(info.Size())
+	if end == info.Size() {
+		return nil
+	}
+	return s.voxelFile.Truncate(end)
+}
+
+// readAllAt reads len(bs) bytes from file at off. It returns io.EOF if the
+// file ends first.
+func readAllAt(file afero.File, bs []byte, off int64) error {
+	n, err := file.ReadAt(bs, off)
+	if n == len(bs) {
+		return nil
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+// corruptIfShort returns an error wrapping ErrCorrupt for the chunk at pos if
+// err is io.EOF, because the cache files don't end in the middle of a chunk
+// unless they are corrupt, and err as it is otherwise.
+func corruptIfShort(pos chunk.ChunkCoordinate, err error) error {
+	if errors.Is(err, io.EOF) {
+		return corruptf(pos, "its data goes past the end of its file")
+	}
+	return err
+}
+
+// writeChunkAt writes a payload to the voxel file at off.
+func (s *flatStore) writeChunkAt(payload []byte, off int64) error {
+	return writeAllAt(s.voxelFile, payload, off)
+}
+
+// writeAllAt writes all of bs to file at off.
+func writeAllAt(file afero.File, bs []byte, off int64) error {
+	n, err := file.WriteAt(bs, off)
+	if err != nil {
+		return err
+	}
+	if n != len(bs) {
+		return fmt.Errorf("expected to write %v bytes to %v, but only wrote %v bytes", len(bs), file.Name(), n)
+	}
+	return nil
+}
+
+func (s *flatStore) getEmptyRegionData(regionPos regionPosition) []int32 {
+	size := int32(s.format.RegionSize)
+	data := make([]int32, size*size*size)
+	for x := regionPos.x * size; x < regionPos.x*size+size; x++ {
+		for y := regionPos.y * size; y < regionPos.y*size+size; y++ {
+			for z := regionPos.z * size; z < regionPos.z*size+size; z++ {
+				off := chunkPosToDataOffset(chunk.ChunkCoordinate{X: x, Y: y, Z: z}, regionPos, size)
+				data[off] = -1.0
+			}
+		}
+	}
+	return data
+}
+
+func (s *flatStore) writeRegionAt(regionPos regionPosition, off int64) error {
+	var buf bytes.Buffer
+	emptyData := s.getEmptyRegionData(regionPos)
+	err := binary.Write(&buf, binary.LittleEndian, emptyData)
+	if err != nil {
+		return err
+	}
+	return writeAllAt(s.chunkFile, buf.Bytes(), off)
+}
+
+func (s *flatStore) writeRegionFileAt(x, y, z, metaIdx int32, off int64) error {
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, []int32{x, y, z, metaIdx})
+	if err != nil {
+		return err
+	}
+	return writeAllAt(s.regionFile, buf.Bytes(), off)
+}
+
+func (s *flatStore) writeChunkFileAt(metaIdx int32, off int64) error {
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, metaIdx)
+	if err != nil {
+		return err
+	}
+	return writeAllAt(s.chunkFile, buf.Bytes(), off)
+}
+
+// getChunkIdx returns the offset in the voxel file of the chunk at pos, from
+// the entry at off in the chunk file, or -1 if the chunk isn't saved.
+func (s *flatStore) getChunkIdx(pos chunk.ChunkCoordinate, off int32) (int32, error) {
+	bs := make([]byte, 4)
+	if err := readAllAt(s.chunkFile, bs, int64(off)); err != nil {
+		return -1, corruptIfShort(pos, err)
+	}
+	chunkIdx := int32(binary.LittleEndian.Uint32(bs))
+	if chunkIdx == -1 {
+		return -1, nil
+	}
+	info, err := s.voxelFile.Stat()
+	if err != nil {
+		return -1, err
+	}
+	if chunkIdx < 0 || int64(chunkIdx) >= info.Size() {
+		return -1, corruptf(pos, "offset %v is outside of the voxel file", chunkIdx)
+	}
+	return chunkIdx, nil
+}
+
+func (s *flatStore) getRegionIdx(regionPos regionPosition) (int32, bool) {
+	regionIdx, ok := s.regions[regionPos]
+	if !ok {
+		return -1, false
+	}
+	return regionIdx, true
+}
+
+// readRegions reads the region file into a map from region position to the
+// offset of the region's chunk table in the chunk file.
+//
+// Each entry is the region position and the offset, all as int32.
+func readRegions(file afero.File) (map[regionPosition]int32, error) {
+	regions := map[regionPosition]int32{}
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the region file: %w", err)
+	}
+	if len(bs)%16 != 0 {
+		log.Warnf("(readRegions) expected a multiple of 16 bytes, but read %v", len(bs))
+	}
+	entries := make([]int32, len(bs)/16*4)
+	err = binary.Read(bytes.NewReader(bs[:len(entries)*4]), binary.LittleEndian, entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the region file: %w", err)
+	}
+	for i := 0; i < len(entries); i += 4 {
+		key := regionPosition{x: entries[i], y: entries[i+1], z: entries[i+2]}
+		regions[key] = entries[i+3]
+	}
+	return regions, nil
+}
+
+func (s *flatStore) chunks() ([]chunk.ChunkCoordinate, error) {
+	size := int32(s.format.RegionSize)
+	regionPositions := make([]regionPosition, 0, len(s.regions))
+	for regionPos := range s.regions {
+		regionPositions = append(regionPositions, regionPos)
+	}
+	// in the order the regions were saved
+	sort.Slice(regionPositions, func(i, j int) bool {
+		return s.regions[regionPositions[i]] < s.regions[regionPositions[j]]
+	})
+	var positions []chunk.ChunkCoordinate
+	table := make([]int32, size*size*size)
+	for _, regionPos := range regionPositions {
+		bs := make([]byte, 4*len(table))
+		n, err := s.chunkFile.ReadAt(bs, int64(s.regions[regionPos]))
+		if !errors.Is(err, io.EOF) && err != nil {
+			return nil, err
+		}
+		if n != len(bs) {
+			return nil, fmt.Errorf("expected %v bytes of the chunk table of region %v to be read, but only %v were read", len(bs), regionPos, n)
+		}
+		if err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, table); err != nil {
+			return nil, err
+		}
+		for off, chunkIdx := range table {
+			if chunkIdx == -1 {
+				continue
+			}
+			i := int32(off) % size
+			j := int32(off) / size % size
+			k := int32(off) / (size * size)
+			positions = append(positions, chunk.ChunkCoordinate{
+				X: regionPos.x*size + i,
+				Y: regionPos.y*size + j,
+				Z: regionPos.z*size + k,
+			})
+		}
+	}
+	return positions, nil
+}
+
+func (s *flatStore) sync() error {
+	for _, file := range []afero.File{s.voxelFile, s.chunkFile, s.regionFile} {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *flatStore) close() error {
+	var firstErr error
+	for _, file := range []afero.File{s.voxelFile, s.chunkFile, s.regionFile} {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
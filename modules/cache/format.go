@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// FormatVersion is the format version of new caches. Caches of version 1 use
+// LayoutFlat, and caches of version 2 and later use LayoutRegionFiles. Caches
+// of version 3 save only the block types of chunks.
+const FormatVersion = 3
+
+// ErrNoFormat indicates that a cache doesn't record its format, because it was
+// saved before formats were recorded or has no files yet.
+const ErrNoFormat log.ConstErr = "cache does not record its format"
+
+// ErrUnknownFormat indicates that the format header of a cache can't be read,
+// or is of a version newer than FormatVersion.
+const ErrUnknownFormat log.ConstErr = "cache format is unknown"
+
+// ErrFormatMismatch indicates that a cache was saved with a chunk size or
+// region size other than the ones in the settings, or with another layout than
+// the one it is opened with.
+const ErrFormatMismatch log.ConstErr = "cache format does not match"
+
+// formatPath is the file that records the format of the cache.
+const formatPath = "data/format.data"
+
+// formatSize is the size in bytes of the format file.
+const formatSize = 20
+
+var formatMagic = [4]byte{'V', 'X', 'F', 1}
+
+// Format is what the data in the cache files depends on, and is recorded in
+// the format file. The format file is the magic bytes 'V', 'X', 'F', 1, the
+// version, chunk size and region size as uint32, and the CRC-32 of everything
+// before it as uint32.
+type Format struct {
+	Version    uint32
+	ChunkSize  uint32
+	RegionSize uint32
+}
+
+func (f Format) layout() Layout {
+	if f.Version < 2 {
+		return LayoutFlat
+	}
+	return LayoutRegionFiles
+}
+
+// storesBlockTypes returns whether chunks are saved as only their block types
+// in caches of the format. Older versions save every voxel as it is in the
+// flat data, which older versions of the game can read.
+func (f Format) storesBlockTypes() bool {
+	return f.Version >= 3
+}
+
+// layoutVersion returns the format version of new caches with the given
+// layout.
+func layoutVersion(layout Layout) uint32 {
+	if layout == LayoutFlat {
+		return 1
+	}
+	return FormatVersion
+}
+
+// ReadFormat returns the format that the cache in fs records, or ErrNoFormat
+// if it records none.
+func ReadFormat(fs afero.Fs) (Format, error) {
+	bs, err := afero.ReadFile(fs, formatPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Format{}, ErrNoFormat
+	}
+	if err != nil {
+		return Format{}, err
+	}
+	if len(bs) != formatSize || !bytes.Equal(bs[:4], formatMagic[:]) ||
+		crc32.ChecksumIEEE(bs[:16]) != binary.LittleEndian.Uint32(bs[16:]) {
+		return Format{}, fmt.Errorf("%w: %v is invalid", ErrUnknownFormat, formatPath)
+	}
+	format := Format{
+		Version:    binary.LittleEndian.Uint32(bs[4:]),
+		ChunkSize:  binary.LittleEndian.Uint32(bs[8:]),
+		RegionSize: binary.LittleEndian.Uint32(bs[12:]),
+	}
+	if format.Version == 0 || format.Version > FormatVersion {
+		return Format{}, fmt.Errorf("%w: version %v", ErrUnknownFormat, format.Version)
+	}
+	if format.ChunkSize == 0 || format.RegionSize == 0 {
+		return Format{}, fmt.Errorf("%w: chunk size %v and region size %v", ErrUnknownFormat, format.ChunkSize, format.RegionSize)
+	}
+	return format, nil
+}
+
+func writeFormat(fs afero.Fs, format Format) error {
+	bs := make([]byte, formatSize)
+	copy(bs, formatMagic[:])
+	binary.LittleEndian.PutUint32(bs[4:], format.Version)
+	binary.LittleEndian.PutUint32(bs[8:], format.ChunkSize)
+	binary.LittleEndian.PutUint32(bs[12:], format.RegionSize)
+	binary.LittleEndian.PutUint32(bs[16:], crc32.ChecksumIEEE(bs[:16]))
+	return replaceFile(fs, formatPath, bs)
+}
+
+// RecordFormat records that the cache in fs was saved with the given chunk
+// size and region size, unless it records its format already, and returns the
+// format of the cache. The version is the one of the layout the cache has.
+//
+// Caches saved before formats were recorded don't know their chunk size and
+// region size, so they have to be told once before they are opened or migrated.
+func RecordFormat(fs afero.Fs, chunkSize, regionSize uint32) (Format, error) {
+	if err := finishReplace(fs); err != nil {
+		return Format{}, err
+	}
+	return recordFormat(fs, Format{
+		Version:    layoutVersion(DetectLayout(fs)),
+		ChunkSize:  chunkSize,
+		RegionSize: regionSize,
+	})
+}
+
+// recordFormat writes format to the format file of the cache in fs, unless the
+// cache records its format already, and returns the format of the cache.
+func recordFormat(fs afero.Fs, format Format) (Format, error) {
+	recorded, err := ReadFormat(fs)
+	if !errors.Is(err, ErrNoFormat) {
+		return recorded, err
+	}
+	if format.ChunkSize == 0 || format.RegionSize == 0 {
+		return Format{}, fmt.Errorf("%w: chunk size %v and region size %v", ErrUnknownFormat, format.ChunkSize, format.RegionSize)
+	}
+	err = fs.Mkdir("data", 0755)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return Format{}, err
+	}
+	if err := writeFormat(fs, format); err != nil {
+		return Format{}, err
+	}
+	return format, nil
+}
+
+// checkFormat returns an error wrapping ErrFormatMismatch if a cache of the
+// given format can't be read with the given chunk size and region size.
+func checkFormat(format Format, chunkSize, regionSize uint32) error {
+	if format.ChunkSize != chunkSize || format.RegionSize != regionSize {
+		return fmt.Errorf("%w: the cache was saved with chunk size %v and region size %v, but the settings have chunk size %v and region size %v",
+			ErrFormatMismatch, format.ChunkSize, format.RegionSize, chunkSize, regionSize)
+	}
+	return nil
+}
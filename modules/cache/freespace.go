@@ -0,0 +1,225 @@
+package cache
+
+import "sort"
+
+// extent is a run of size units of a file starting at off. The units are
+// bytes in the voxel file and sectors in region files.
+type extent struct {
+	off  int64
+	size int64
+}
+
+func (e extent) end() int64 {
+	return e.off + e.size
+}
+
+// freeSpace is the space in a file that no saved chunk uses, so that payloads
+// can be written there instead of at the end of the file. The extents are
+// sorted by offset, and extents next to each other are merged. bySize holds
+// the same extents sorted by size, and then by offset.
+type freeSpace struct {
+	extents []extent
+	bySize  []extent
+}
+
+// newFreeSpace returns the free space of a file of end units in which the
+// given extents are used. Used extents may overlap.
+func newFreeSpace(used []extent, end int64) *freeSpace {
+	sorted := append([]extent(nil), used...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].off < sorted[j].off
+	})
+	f := &freeSpace{}
+	off := int64(0)
+	for _, e := range sorted {
+		if e.off > off {
+			f.release(off, e.off-off)
+		}
+		if e.end() > off {
+			off = e.end()
+		}
+	}
+	if end > off {
+		f.release(off, end-off)
+	}
+	return f
+}
+
+// sizeIndex returns the index in bySize that e is at, or would be inserted at.
+func (f *freeSpace) sizeIndex(e extent) int {
+	return sort.Search(len(f.bySize), func(i int) bool {
+		s := f.bySize[i]
+		return s.size > e.size || s.size == e.size && s.off >= e.off
+	})
+}
+
+// insert adds e, which must not touch any other extent, at index i of
+// extents.
+func (f *freeSpace) insert(i int, e extent) {
+	f.extents = append(f.extents, extent{})
+	copy(f.extents[i+1:], f.extents[i:])
+	f.extents[i] = e
+	j := f.sizeIndex(e)
+	f.bySize = append(f.bySize, extent{})
+	copy(f.bySize[j+1:], f.bySize[j:])
+	f.bySize[j] = e
+}
+
+// remove removes the extent at index i of extents.
+func (f *freeSpace) remove(i int) {
+	j := f.sizeIndex(f.extents[i])
+	f.bySize = append(f.bySize[:j], f.bySize[j+1:]...)
+	f.extents = append(f.extents[:i], f.extents[i+1:]...)
+}
+
+// index returns the index in extents of the extent at off.
+func (f *freeSpace) index(off int64) int {
+	return sort.Search(len(f.extents), func(i int) bool {
+		return f.extents[i].off >= off
+	})
+}
+
+// release marks size units at off as free.
+func (f *freeSpace) release(off, size int64) {
+	if size <= 0 {
+		return
+	}
+	i := sort.Search(len(f.extents), func(i int) bool {
+		return f.extents[i].off > off
+	})
+	e := extent{off: off, size: size}
+	if i < len(f.extents) && f.extents[i].off <= e.end() {
+		// merges with the extent after it
+		if next := f.extents[i].end(); next > e.end() {
+			e.size = next - e.off
+		}
+		f.remove(i)
+	}
+	if i > 0 && f.extents[i-1].end() >= e.off {
+		// merges with the extent before it
+		prev := f.extents[i-1]
+		if e.end() > prev.end() {
+			prev.size = e.end() - prev.off
+		}
+		f.remove(i - 1)
+		f.insert(i-1, prev)
+		return
+	}
+	f.insert(i, e)
+}
+
+// bestFit returns the smallest extent that ends at or before limit and has
+// room for size units, or false if there is none. Of extents of the same size,
+// the first one is chosen. Since extents past limit are skipped, this is
+// quickest when there are few of them.
+func (f *freeSpace) bestFit(size, limit int64) (extent, bool) {
+	for j := f.sizeIndex(extent{size: size}); j < len(f.bySize); j++ {
+		if e := f.bySize[j]; e.end() <= limit {
+			return e, true
+		}
+	}
+	return extent{}, false
+}
+
+// take removes size units from the start of the free extent e, and returns
+// their offset.
+func (f *freeSpace) take(e extent, size int64) int64 {
+	i := f.index(e.off)
+	f.remove(i)
+	if e.size > size {
+		f.insert(i, extent{off: e.off + size, size: e.size - size})
+	}
+	return e.off
+}
+
+// last returns the extent that a file of end units ends in, or false if it
+// doesn't end in free space.
+func (f *freeSpace) last(end int64) (extent, bool) {
+	if n := len(f.extents); n > 0 && f.extents[n-1].end() == end {
+		return f.extents[n-1], true
+	}
+	return extent{}, false
+}
+
+// allocate returns an offset for size units in a file of end units, taking
+// them from the free space that fits them best. If no extent has room, the
+// units go at the end of the file, starting with the extent the file ends in
+// if it ends in free space. The file has to grow to the end of the returned
+// units if they go past end.
+func (f *freeSpace) allocate(size, end int64) int64 {
+	if e, ok := f.bestFit(size, end); ok {
+		return f.take(e, size)
+	}
+	if e, ok := f.last(end); ok {
+		f.remove(len(f.extents) - 1)
+		return e.off
+	}
+	return end
+}
+
+// trimEnd removes the extent that a file of end units ends in, if it ends in
+// free space, and returns what the end of the file can be truncated to.
+func (f *freeSpace) trimEnd(end int64) int64 {
+	if e, ok := f.last(end); ok {
+		f.remove(len(f.extents) - 1)
+		return e.off
+	}
+	return end
+}
+
+// pickMove returns the slot that compaction moves next and the free extent it
+// moves into, or false if no slot can be moved. That is the last slot in the
+// file that fits in free space before it, moved into the extent before it
+// that fits it best, so that free space gathers at the end of the file where
+// it can be truncated. Once the file is truncated, no free space is after the
+// last slot, so it usually takes one lookup by size.
+func (f *freeSpace) pickMove(slots *slotOrder) (extent, extent, bool) {
+	if len(f.bySize) == 0 {
+		return extent{}, extent{}, false
+	}
+	largest := f.bySize[len(f.bySize)-1].size
+	for i := len(slots.slots) - 1; i >= 0; i-- {
+		slot := slots.slots[i]
+		if slot.size > largest {
+			continue
+		}
+		if to, ok := f.bestFit(slot.size, slot.off); ok {
+			return slot, to, true
+		}
+	}
+	return extent{}, extent{}, false
+}
+
+// slotOrder is the slots that saved payloads take up in a file, sorted by
+// offset. Slots don't overlap.
+type slotOrder struct {
+	slots []extent
+}
+
+// add adds slot, which must not overlap another slot.
+func (o *slotOrder) add(slot extent) {
+	i := sort.Search(len(o.slots), func(i int) bool {
+		return o.slots[i].off >= slot.off
+	})
+	o.slots = append(o.slots, extent{})
+	copy(o.slots[i+1:], o.slots[i:])
+	o.slots[i] = slot
+}
+
+// remove removes the slot at off, if there is one.
+func (o *slotOrder) remove(off int64) {
+	i := sort.Search(len(o.slots), func(i int) bool {
+		return o.slots[i].off >= off
+	})
+	if i < len(o.slots) && o.slots[i].off == off {
+		o.slots = append(o.slots[:i], o.slots[i+1:]...)
+	}
+}
+
+// overlaps returns whether slot overlaps a slot that was added.
+func (o *slotOrder) overlaps(slot extent) bool {
+	i := sort.Search(len(o.slots), func(i int) bool {
+		return o.slots[i].end() > slot.off
+	})
+	return i < len(o.slots) && o.slots[i].off < slot.end()
+}
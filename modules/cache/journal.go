@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// journalPath is the file that a chunk's payload is written to before it is
+// saved in the chunk store.
+const journalPath = "data/journal.data"
+
+// journalHeaderSize is the size in bytes of a journal record before the
+// payload.
+const journalHeaderSize = 20
+
+var journalMagic = [4]byte{'V', 'X', 'J', 1}
+
+// journal makes saving a chunk atomic. A save is first written to the journal
+// as a record, and the journal is only cleared once the chunk store has the
+// chunk. If the game stops in between, the record is still in the journal the
+// next time the cache is opened, and the save is made again. If the game stops
+// while the record is being written, the chunk store was not changed yet and
+// the record is thrown away.
+//
+// A record is the magic bytes 'V', 'X', 'J', 1, the chunk coordinate as
+// int32, the length of the payload as uint32, the payload, and the CRC-32 of
+// everything before it as uint32.
+type journal struct {
+	file afero.File
+	// pending is whether the journal might have a record that isn't in the
+	// chunk store yet.
+	pending bool
+}
+
+func openJournal(fs afero.Fs, readOnly bool) (*journal, error) {
+	file, err := openDataFile(fs, journalPath, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &journal{
+		file:    file,
+		pending: info.Size() > 0,
+	}, nil
+}
+
+// write replaces the record in the journal with a save of payload at pos.
+func (j *journal) write(pos chunk.ChunkCoordinate, payload []byte) error {
+	var buf bytes.Buffer
+	buf.Write(journalMagic[:])
+	binary.Write(&buf, binary.LittleEndian, []int32{pos.X, pos.Y, pos.Z})
+	binary.Write(&buf, binary.LittleEndian, uint32(len(payload)))
+	buf.Write(payload)
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	j.pending = true
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.WriteAt(buf.Bytes(), 0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// read returns the save in the journal, or false if it has no complete record.
+func (j *journal) read() (chunk.ChunkCoordinate, []byte, bool) {
+	info, err := j.file.Stat()
+	if err != nil {
+		log.Warn(err)
+		return chunk.ChunkCoordinate{}, nil, false
+	}
+	bs := make([]byte, info.Size())
+	n, err := j.file.ReadAt(bs, 0)
+	if n != len(bs) {
+		log.Warnf("(read) expected %v bytes to be read, but only %v were read: %v", len(bs), n, err)
+		return chunk.ChunkCoordinate{}, nil, false
+	}
+	if len(bs) < journalHeaderSize+4 || !bytes.Equal(bs[:4], journalMagic[:]) {
+		return chunk.ChunkCoordinate{}, nil, false
+	}
+	length := binary.LittleEndian.Uint32(bs[16:])
+	if uint64(len(bs)) != journalHeaderSize+uint64(length)+4 {
+		return chunk.ChunkCoordinate{}, nil, false
+	}
+	end := journalHeaderSize + int(length)
+	if crc32.ChecksumIEEE(bs[:end]) != binary.LittleEndian.Uint32(bs[end:]) {
+		return chunk.ChunkCoordinate{}, nil, false
+	}
+	pos := chunk.ChunkCoordinate{
+		X: int32(binary.LittleEndian.Uint32(bs[4:])),
+		Y: int32(binary.LittleEndian.Uint32(bs[8:])),
+		Z: int32(binary.LittleEndian.Uint32(bs[12:])),
+	}
+	return pos, bs[journalHeaderSize:end], true
+}
+
+// clear removes the record from the journal once its save is in the chunk
+// store.
+func (j *journal) clear() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.pending = false
+	return nil
+}
+
+// replay makes the save in the journal again, if it has one, and clears it.
+func (j *journal) replay(store chunkStore) error {
+	if !j.pending {
+		return nil
+	}
+	pos, payload, ok := j.read()
+	if !ok {
+		log.Warn("(replay) throwing away an incomplete save")
+		return j.clear()
+	}
+	log.Infof("(replay) saving chunk %v again", pos)
+	return j.commit(store, pos, payload)
+}
+
+// commit saves the payload of the record in the journal to the chunk store,
+// and clears the journal.
+func (j *journal) commit(store chunkStore, pos chunk.ChunkCoordinate, payload []byte) error {
+	if err := store.save(pos, payload); err != nil {
+		return err
+	}
+	if err := store.sync(); err != nil {
+		return err
+	}
+	return j.clear()
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
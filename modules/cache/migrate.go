@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+// migration upgrades a cache from the format version before its own.
+type migration struct {
+	version uint32
+	migrate func(fs afero.Fs, format Format, settingsRepo settings.Interface) error
+}
+
+// migrations are the steps from every format version to FormatVersion, in
+// order.
+var migrations = []migration{
+	{
+		version: 2,
+		migrate: func(fs afero.Fs, format Format, settingsRepo settings.Interface) error {
+			converted, err := convertToRegionFiles(fs, format, settingsRepo)
+			log.Infof("(migrate) moved %v chunks into region files", converted)
+			return err
+		},
+	},
+	{
+		version: 3,
+		migrate: func(fs afero.Fs, format Format, settingsRepo settings.Interface) error {
+			saved, err := saveBlockTypes(fs, format, settingsRepo)
+			log.Infof("(migrate) saved %v chunks as their block types", saved)
+			return err
+		},
+	},
+}
+
+// saveBlockTypes upgrades a cache of format version 2 to version 3 by saving
+// every chunk again as its block types, and compacts the cache files, which
+// the smaller chunks leave free space in. The format is written first, since
+// caches of version 3 also read chunks saved the old way, so nothing is lost
+// if the upgrade stops partway. Corrupt chunks are left for the game to
+// quarantine.
+func saveBlockTypes(fs afero.Fs, format Format, settingsRepo settings.Interface) (int, error) {
+	format.Version = 3
+	if err := writeFormat(fs, format); err != nil {
+		return 0, err
+	}
+	cacheMod, err := open(fs, settingsRepo, format, false)
+	if err != nil {
+		return 0, err
+	}
+	positions, err := cacheMod.Chunks()
+	if err != nil {
+		cacheMod.Close()
+		return 0, err
+	}
+	saved := 0
+	for _, pos := range positions {
+		ch, err := cacheMod.Load(pos)
+		if errors.Is(err, ErrCorrupt) {
+			log.Warn(err)
+			continue
+		}
+		if err == nil {
+			err = cacheMod.Save(ch)
+		}
+		if err != nil {
+			cacheMod.Close()
+			return saved, err
+		}
+		saved++
+	}
+	for {
+		moved, err := cacheMod.CompactStep()
+		if err != nil {
+			cacheMod.Close()
+			return saved, err
+		}
+		if !moved {
+			break
+		}
+	}
+	return saved, cacheMod.Close()
+}
+
+// migrateDirectory is where Migrate writes the new files of a cache that is
+// re-chunked before they replace the old ones.
+const migrateDirectory = "migrate"
+
+// Migrate upgrades the cache in fs to FormatVersion one version at a time,
+// and then re-chunks it if it was saved with a chunk size or region size other
+// than the ones in settingsRepo. It returns the format of the cache afterwards.
+// The cache must record its format, see RecordFormat, and must not be open.
+//
+// Re-chunked chunks take every voxel that a saved chunk had from it, and the
+// rest from fill, which should return the chunk as the world generator makes
+// it. The rest is air if fill is nil. Voxels keep the lighting they were saved
+// with, unless the format only saves block types, and the adjacency of their
+// faces is worked out again within the new chunks. Scheduled updates and
+// pending actions move to the new chunk of their voxel. Corrupt chunks are
+// moved to the quarantine file first.
+func Migrate(fs afero.Fs, settingsRepo settings.Interface, fill func(chunk.ChunkCoordinate) chunk.Chunk) (Format, error) {
+	if settingsRepo == nil {
+		panic("migrate received nil settings repo")
+	}
+	if err := finishReplace(fs); err != nil {
+		return Format{}, err
+	}
+	format, err := ReadFormat(fs)
+	if err != nil {
+		return Format{}, err
+	}
+	for _, m := range migrations {
+		if m.version <= format.Version {
+			continue
+		}
+		log.Infof("(migrate) upgrading from format version %v to %v", format.Version, m.version)
+		if err := m.migrate(fs, format, settingsRepo); err != nil {
+			return format, fmt.Errorf("failed to upgrade to format version %v: %w", m.version, err)
+		}
+		format.Version = m.version
+		if err := writeFormat(fs, format); err != nil {
+			return format, err
+		}
+	}
+	to := Format{
+		Version:    format.Version,
+		ChunkSize:  settingsRepo.GetChunkSize(),
+		RegionSize: settingsRepo.GetRegionSize(),
+	}
+	if to == format {
+		return format, nil
+	}
+	log.Infof("(migrate) re-chunking from chunk size %v and region size %v to chunk size %v and region size %v",
+		format.ChunkSize, format.RegionSize, to.ChunkSize, to.RegionSize)
+	if err := rechunk(fs, settingsRepo, format, to, fill); err != nil {
+		return format, fmt.Errorf("failed to re-chunk: %w", err)
+	}
+	return to, nil
+}
+
+// rechunk rewrites the cache in fs from the format from to the format to,
+// which only differ in chunk size and region size.
+func rechunk(fs afero.Fs, settingsRepo settings.Interface, from, to Format, fill func(chunk.ChunkCoordinate) chunk.Chunk) error {
+	if fill == nil {
+		fill = func(pos chunk.ChunkCoordinate) chunk.Chunk {
+			return chunk.NewChunkEmpty(pos, to.ChunkSize)
+		}
+	}
+	fromMod, err := open(fs, settingsRepo, from, false)
+	if err != nil {
+		return err
+	}
+	rechunkFs, err := makeSideDirectory(fs, migrateDirectory)
+	if err != nil {
+		fromMod.Close()
+		return err
+	}
+	toMod, err := create(rechunkFs, settingsRepo, to)
+	if err != nil {
+		fromMod.Close()
+		return err
+	}
+	err = rechunkChunks(fromMod, toMod, fill)
+	if err == nil {
+		rechunkUpdates(fromMod, toMod)
+	}
+	if closeErr := fromMod.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := toMod.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return replaceCacheFiles(fs, migrateDirectory)
+}
+
+// rechunkChunks saves the chunks of fromMod in toMod, which has another chunk
+// size.
+func rechunkChunks(fromMod, toMod *Module, fill func(chunk.ChunkCoordinate) chunk.Chunk) error {
+	fromSize := fromMod.c.format.ChunkSize
+	toSize := toMod.c.format.ChunkSize
+	fromPositions, err := fromMod.Chunks()
+	if err != nil {
+		return err
+	}
+	covered := map[chunk.ChunkCoordinate]bool{}
+	for _, pos := range fromPositions {
+		_, err := fromMod.Load(pos)
+		if errors.Is(err, ErrCorrupt) {
+			log.Warn(err)
+			err = fromMod.Quarantine(pos)
+		} else if err == nil {
+			forEachChunkOverlapping(pos, fromSize, toSize, func(newPos chunk.ChunkCoordinate) {
+				covered[newPos] = true
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	positions := make([]chunk.ChunkCoordinate, 0, len(covered))
+	for pos := range covered {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.Z < b.Z
+	})
+	for _, pos := range positions {
+		ch := fill(pos)
+		if ch.Position() != pos || ch.Size() != toSize {
+			panic("fill returned the wrong chunk")
+		}
+		var err error
+		forEachChunkOverlapping(pos, toSize, fromSize, func(oldPos chunk.ChunkCoordinate) {
+			if err != nil {
+				return
+			}
+			var old chunk.Chunk
+			old, err = fromMod.Load(oldPos)
+			if errors.Is(err, ErrNotFound) {
+				err = nil
+				return
+			}
+			if err != nil {
+				return
+			}
+			old.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				if chunk.VoxelCoordToChunkCoord(vc, toSize) == pos {
+					ch.CopyVoxel(old, vc)
+				}
+			})
+		})
+		if err != nil {
+			return err
+		}
+		// setting every voxel to its own block type hides exactly the faces
+		// next to voxels that aren't air within the chunk
+		ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+			ch.SetBlockType(vc, ch.BlockType(vc))
+		})
+		if err := toMod.Save(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rechunkUpdates stores the scheduled updates and pending actions of fromMod
+// in toMod, under the chunks of their voxels in toMod's chunk size.
+func rechunkUpdates(fromMod, toMod *Module) {
+	toSize := toMod.c.format.ChunkSize
+	scheduled := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{}
+	for _, updates := range fromMod.c.scheduled {
+		for _, u := range updates {
+			key := chunk.VoxelCoordToChunkCoord(u.VoxPos, toSize)
+			scheduled[key] = append(scheduled[key], u)
+		}
+	}
+	for key, updates := range scheduled {
+		toMod.c.saveScheduled(key, updates)
+	}
+	pending := map[chunk.ChunkCoordinate][]chunk.PendingAction{}
+	for _, actions := range fromMod.c.pending {
+		for _, a := range actions {
+			a.ChPos = chunk.VoxelCoordToChunkCoord(a.VoxPos, toSize)
+			pending[a.ChPos] = append(pending[a.ChPos], a)
+		}
+	}
+	for key, actions := range pending {
+		toMod.c.savePending(key, actions)
+	}
+}
+
+// forEachChunkOverlapping calls f with the position of every chunk of size
+// toSize that has voxels of the chunk at pos of size fromSize.
+func forEachChunkOverlapping(pos chunk.ChunkCoordinate, fromSize, toSize uint32, f func(chunk.ChunkCoordinate)) {
+	size := int32(fromSize)
+	first := chunk.VoxelCoordToChunkCoord(chunk.VoxelCoordinate{
+		X: pos.X * size,
+		Y: pos.Y * size,
+		Z: pos.Z * size,
+	}, toSize)
+	last := chunk.VoxelCoordToChunkCoord(chunk.VoxelCoordinate{
+		X: pos.X*size + size - 1,
+		Y: pos.Y*size + size - 1,
+		Z: pos.Z*size + size - 1,
+	}, toSize)
+	for x := first.X; x <= last.X; x++ {
+		for y := first.Y; y <= last.Y; y++ {
+			for z := first.Z; z <= last.Z; z++ {
+				f(chunk.ChunkCoordinate{X: x, Y: y, Z: z})
+			}
+		}
+	}
+}
@@ -2,8 +2,12 @@ package cache
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
 	"github.com/kroppt/voxels/repositories/settings"
 	"github.com/spf13/afero"
 )
@@ -12,32 +16,249 @@ type Module struct {
 	c core
 }
 
+// Layout is how the cache files keep chunks.
+type Layout int
+
+const (
+	// LayoutFlat keeps the chunks of all regions in three files.
+	LayoutFlat Layout = iota
+	// LayoutRegionFiles keeps the chunks of every region in a file of its own.
+	LayoutRegionFiles
+)
+
+// DetectLayout returns the layout of the cache in fs. It is the layout of the
+// format the cache records, if it records one. A cache that doesn't exist yet
+// uses region files.
+func DetectLayout(fs afero.Fs) Layout {
+	if format, err := ReadFormat(fs); err == nil {
+		return format.layout()
+	}
+	if exists, _ := afero.Exists(fs, "data/voxel.data"); exists {
+		return LayoutFlat
+	}
+	return LayoutRegionFiles
+}
+
+// New opens the cache in fs with the layout it already has, and panics if it
+// can't be opened.
 func New(fs afero.Fs, settingsRepo settings.Interface) *Module {
+	m, err := Open(fs, settingsRepo)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// NewWithLayout opens the cache in fs with the given layout, and panics if it
+// can't be opened.
+func NewWithLayout(fs afero.Fs, settingsRepo settings.Interface, layout Layout) *Module {
+	m, err := openWithLayout(fs, settingsRepo, layout)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Open opens the cache in fs with the layout it already has.
+//
+// A cache that doesn't record its format yet is recorded as saved with the
+// chunk size and region size of the settings. The error wraps
+// ErrFormatMismatch if the cache was saved with another chunk size or region
+// size, which Migrate can change, or ErrUnknownFormat if it was saved by a
+// newer version of the game.
+func Open(fs afero.Fs, settingsRepo settings.Interface) (*Module, error) {
+	// finishing a replacement of the cache files can change its layout
+	if err := finishReplace(fs); err != nil {
+		return nil, err
+	}
+	return openWithLayout(fs, settingsRepo, DetectLayout(fs))
+}
+
+func openWithLayout(fs afero.Fs, settingsRepo settings.Interface, layout Layout) (*Module, error) {
 	if settingsRepo == nil {
 		panic("cache received nil settings repo")
 	}
+	if layout != LayoutFlat && layout != LayoutRegionFiles {
+		panic("cache received unknown layout")
+	}
+	if err := finishReplace(fs); err != nil {
+		return nil, err
+	}
+	format, err := recordFormat(fs, Format{
+		Version:    layoutVersion(layout),
+		ChunkSize:  settingsRepo.GetChunkSize(),
+		RegionSize: settingsRepo.GetRegionSize(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if format.layout() != layout {
+		return nil, fmt.Errorf("%w: the cache has format version %v, which has another layout", ErrFormatMismatch, format.Version)
+	}
+	if err := checkFormat(format, settingsRepo.GetChunkSize(), settingsRepo.GetRegionSize()); err != nil {
+		return nil, err
+	}
+	return open(fs, settingsRepo, format, false)
+}
+
+// OpenReadOnly opens the cache in fs without changing its files, for tools
+// that only look at a world. Saving, quarantining and compacting fail with
+// ErrReadOnly, and scheduled updates and pending actions that are saved are
+// not written. A save that stopped partway is read from the journal instead
+// of being finished. A cache that doesn't record its format yet is read as
+// saved with chunkSize and regionSize, like RecordFormat would record it.
+func OpenReadOnly(fs afero.Fs, settingsRepo settings.Interface, chunkSize, regionSize uint32) (*Module, error) {
+	if settingsRepo == nil {
+		panic("cache received nil settings repo")
+	}
+	for _, dir := range sideDirectories {
+		if replacing, err := isReplacing(fs, dir); err != nil || replacing {
+			if err == nil {
+				err = fmt.Errorf("its files are being replaced with the ones in %v, which opening it for writing finishes", dir)
+			}
+			return nil, fmt.Errorf("failed to open the cache read-only: %w", err)
+		}
+	}
+	layout := DetectLayout(fs)
+	format, err := ReadFormat(fs)
+	if errors.Is(err, ErrNoFormat) {
+		format = Format{
+			Version:    layoutVersion(layout),
+			ChunkSize:  chunkSize,
+			RegionSize: regionSize,
+		}
+		if format.ChunkSize == 0 || format.RegionSize == 0 {
+			return nil, fmt.Errorf("%w: chunk size %v and region size %v", ErrUnknownFormat, format.ChunkSize, format.RegionSize)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := checkFormat(format, settingsRepo.GetChunkSize(), settingsRepo.GetRegionSize()); err != nil {
+		return nil, err
+	}
+	return open(afero.NewReadOnlyFs(fs), settingsRepo, format, true)
+}
+
+// create records format as the format of the new cache in fs, and opens it.
+func create(fs afero.Fs, settingsRepo settings.Interface, format Format) (*Module, error) {
 	err := fs.Mkdir("data", 0755)
 	if err != nil && !errors.Is(err, os.ErrExist) {
-		panic("failed to create data directory")
+		return nil, err
+	}
+	if err := writeFormat(fs, format); err != nil {
+		return nil, err
+	}
+	return open(fs, settingsRepo, format, false)
+}
+
+// open opens the cache in fs, which has the given format. A read-only cache
+// doesn't create or write any files.
+func open(fs afero.Fs, settingsRepo settings.Interface, format Format, readOnly bool) (*Module, error) {
+	if !readOnly {
+		err := fs.Mkdir("data", 0755)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+	}
+	var store chunkStore
+	var err error
+	switch format.layout() {
+	case LayoutFlat:
+		store, err = newFlatStore(fs, format, readOnly)
+	case LayoutRegionFiles:
+		store, err = newRegionStore(fs, format, readOnly)
 	}
-	voxelFile, err := fs.OpenFile("data/voxel.data", os.O_CREATE|os.O_RDWR, 0755)
 	if err != nil {
-		panic("failed to create voxel file")
+		return nil, fmt.Errorf("failed to open the cache files: %w", err)
 	}
-	chunkFile, err := fs.OpenFile("data/chunk.data", os.O_CREATE|os.O_RDWR, 0755)
+	journal, err := openJournal(fs, readOnly)
 	if err != nil {
-		panic("failed to create chunk file")
+		store.close()
+		return nil, fmt.Errorf("failed to open the journal: %w", err)
 	}
-	regionFile, err := fs.OpenFile("data/region.data", os.O_CREATE|os.O_RDWR, 0755)
+	unreplayed := map[chunk.ChunkCoordinate][]byte{}
+	if readOnly {
+		if pos, payload, ok := journal.read(); ok {
+			unreplayed[pos] = payload
+		}
+	} else if err := journal.replay(store); err != nil {
+		log.Warnf("failed to finish the last save: %v", err)
+	}
+	scheduledFile, err := openDataFile(fs, scheduledPath, readOnly)
+	if err != nil {
+		store.close()
+		journal.close()
+		return nil, err
+	}
+	defer scheduledFile.Close()
+	pendingFile, err := openDataFile(fs, pendingPath, readOnly)
 	if err != nil {
-		panic("failed to create region file")
+		store.close()
+		journal.close()
+		return nil, err
 	}
+	defer pendingFile.Close()
 	return &Module{
 		c: core{
-			voxelFile:    voxelFile,
-			chunkFile:    chunkFile,
-			regionFile:   regionFile,
+			format:       format,
+			store:        store,
+			journal:      journal,
+			fs:           fs,
 			settingsRepo: settingsRepo,
+			scheduled:    readScheduled(scheduledFile),
+			pending:      readPending(pendingFile),
+			readOnly:     readOnly,
+			unreplayed:   unreplayed,
 		},
+	}, nil
+}
+
+// WriteBehindModule is a cache that saves chunks from a background goroutine,
+// so that saving doesn't wait for the cache files. Saved chunks wait in a
+// queue of a bounded length until Run writes them to the cache it wraps.
+type WriteBehindModule struct {
+	cacheMod  Interface
+	queueSize int
+	// io is held while cacheMod is used, which isn't safe to use from more
+	// than one goroutine.
+	io sync.Mutex
+	// writer is held while queued chunks are written.
+	writer sync.Mutex
+	// mu guards the fields below, and changed is signalled when they change.
+	mu      sync.Mutex
+	changed *sync.Cond
+	queued  map[chunk.ChunkCoordinate]*queuedChunk
+	// order is the positions of the queued chunks, from the first saved.
+	order  []chunk.ChunkCoordinate
+	closed bool
+	// err is the first error that a chunk was dropped from the queue with.
+	err error
+}
+
+// NewWriteBehind returns a cache that saves chunks to cacheMod from a
+// background goroutine, with at most queueSize chunks waiting to be written.
+// Run has to run for chunks to be written before Close.
+func NewWriteBehind(cacheMod Interface, queueSize int) *WriteBehindModule {
+	if cacheMod == nil {
+		panic("write-behind cache received nil cache module")
+	}
+	if queueSize < 1 {
+		panic("write-behind cache received a queue size less than 1")
+	}
+	m := &WriteBehindModule{
+		cacheMod:  cacheMod,
+		queueSize: queueSize,
+		queued:    map[chunk.ChunkCoordinate]*queuedChunk{},
+	}
+	m.changed = sync.NewCond(&m.mu)
+	return m
+}
+
+// Run writes queued chunks until Close is called.
+func (m *WriteBehindModule) Run() {
+	for m.waitForQueued() {
+		m.writer.Lock()
+		m.writeFirst()
+		m.writer.Unlock()
 	}
 }
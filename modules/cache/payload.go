@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/kroppt/voxels/chunk"
+)
+
+// payloadHeaderSize is the size in bytes of the header in front of payloads.
+//
+// The header is the magic bytes 'V', 'X', 'C', the codec of the data as a
+// byte, the length of the data in bytes and the CRC-32 of the data, both as
+// little endian uint32. Older caches stored payloads without a header. Those
+// start with the X coordinate of the first voxel as a float32, which is never
+// equal to the magic bytes, so they are read as raw data.
+const payloadHeaderSize = 12
+
+var payloadMagic = [3]byte{'V', 'X', 'C'}
+
+// codec is how the data after a payload header is encoded.
+type codec byte
+
+const (
+	// codecNone is the flat data of a chunk as little endian float32s.
+	codecNone codec = iota
+	// codecZlib is codecNone compressed with zlib.
+	codecZlib
+	// codecBlocks is the block type of every voxel as a little endian uint32,
+	// in the order of the flat data.
+	codecBlocks
+	// codecBlocksZlib is codecBlocks compressed with zlib.
+	codecBlocksZlib
+)
+
+// payloadSize returns the size in bytes of the raw flat data of a chunk, which
+// is also the size of payloads saved without a header.
+func payloadSize(chunkSize uint32) int {
+	return int(chunk.BytesPerElement * chunk.VertSize * chunkSize * chunkSize * chunkSize)
+}
+
+// blocksSize returns the size in bytes of the block types of a chunk.
+func blocksSize(chunkSize uint32) int {
+	return int(4 * chunkSize * chunkSize * chunkSize)
+}
+
+// encodePayload returns the data of a chunk as it is stored in the cache
+// files. If blockTypes is true, only the block types of the voxels are stored,
+// and everything else is worked out again when the chunk is loaded. The data
+// is compressed with zlib at the given level if it is from 1 to 9 and that
+// makes it smaller.
+func encodePayload(ch chunk.Chunk, level int, blockTypes bool) ([]byte, error) {
+	var raw bytes.Buffer
+	c, zlibCodec := codecNone, codecZlib
+	var err error
+	if blockTypes {
+		c, zlibCodec = codecBlocks, codecBlocksZlib
+		err = binary.Write(&raw, binary.LittleEndian, ch.BlockTypes())
+	} else {
+		err = binary.Write(&raw, binary.LittleEndian, ch.GetFlatData())
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := raw.Bytes()
+	if level >= zlib.BestSpeed && level <= zlib.BestCompression {
+		var compressed bytes.Buffer
+		w, err := zlib.NewWriterLevel(&compressed, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if compressed.Len() < len(data) {
+			data, c = compressed.Bytes(), zlibCodec
+		}
+	}
+	payload := make([]byte, payloadHeaderSize+len(data))
+	copy(payload, payloadMagic[:])
+	payload[3] = byte(c)
+	binary.LittleEndian.PutUint32(payload[4:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(payload[8:], crc32.ChecksumIEEE(data))
+	copy(payload[payloadHeaderSize:], data)
+	return payload, nil
+}
+
+// payloadHeader is the header in front of a payload.
+type payloadHeader struct {
+	codec    codec
+	length   uint32
+	checksum uint32
+}
+
+// readPayloadHeader returns the header of a payload from its first
+// payloadHeaderSize bytes, or false if the payload has no header.
+func readPayloadHeader(bs []byte) (payloadHeader, bool) {
+	if len(bs) < payloadHeaderSize || !bytes.Equal(bs[:3], payloadMagic[:]) {
+		return payloadHeader{}, false
+	}
+	return payloadHeader{
+		codec:    codec(bs[3]),
+		length:   binary.LittleEndian.Uint32(bs[4:]),
+		checksum: binary.LittleEndian.Uint32(bs[8:]),
+	}, true
+}
+
+// decodePayload returns the chunk at pos from data returned by encodePayload,
+// or from the raw flat data of a payload without a header. It returns an error
+// wrapping ErrCorrupt if the payload isn't valid.
+func decodePayload(payload []byte, chunkSize uint32, pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
+	size := payloadSize(chunkSize)
+	raw := payload
+	blockTypes := false
+	if header, ok := readPayloadHeader(payload); ok {
+		if int(header.length) != len(payload)-payloadHeaderSize {
+			return chunk.Chunk{}, corruptf(pos, "expected %v bytes of data, but got %v", header.length, len(payload)-payloadHeaderSize)
+		}
+		data := payload[payloadHeaderSize:]
+		if checksum := crc32.ChecksumIEEE(data); checksum != header.checksum {
+			return chunk.Chunk{}, corruptf(pos, "expected checksum %08x, but got %08x", header.checksum, checksum)
+		}
+		if header.codec == codecBlocks || header.codec == codecBlocksZlib {
+			blockTypes = true
+			size = blocksSize(chunkSize)
+		}
+		switch header.codec {
+		case codecNone, codecBlocks:
+			raw = data
+		case codecZlib, codecBlocksZlib:
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return chunk.Chunk{}, corruptf(pos, "%v", err)
+			}
+			raw = make([]byte, size)
+			n, err := io.ReadFull(io.LimitReader(r, int64(size)), raw)
+			if err != nil {
+				return chunk.Chunk{}, corruptf(pos, "expected %v bytes after decompressing, but got %v: %v", size, n, err)
+			}
+		default:
+			return chunk.Chunk{}, corruptf(pos, "unknown codec %v", header.codec)
+		}
+	}
+	if len(raw) != size {
+		return chunk.Chunk{}, corruptf(pos, "expected %v bytes, but got %v", size, len(raw))
+	}
+	if blockTypes {
+		blocks := make([]chunk.BlockType, len(raw)/4)
+		if err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, blocks); err != nil {
+			return chunk.Chunk{}, corruptf(pos, "%v", err)
+		}
+		ch, err := chunk.ParseBlockTypes(blocks, chunkSize, pos)
+		if err != nil {
+			return chunk.Chunk{}, corruptf(pos, "%v", err)
+		}
+		return ch, nil
+	}
+	flatData := make([]float32, len(raw)/chunk.BytesPerElement)
+	err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, flatData)
+	if err != nil {
+		return chunk.Chunk{}, corruptf(pos, "%v", err)
+	}
+	ch, err := chunk.ParseChunkData(flatData, chunkSize, pos)
+	if err != nil {
+		return chunk.Chunk{}, corruptf(pos, "%v", err)
+	}
+	return ch, nil
+}
+
+// corruptf returns an error wrapping ErrCorrupt for the chunk at pos.
+func corruptf(pos chunk.ChunkCoordinate, format string, v ...interface{}) error {
+	return fmt.Errorf("%w: chunk %v: %v", ErrCorrupt, pos, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// pendingPath is the file that keeps the pending actions of every chunk.
+const pendingPath = "data/pending.data"
+
+// readPending reads every chunk's pending actions from the pending file.
+//
+// Each entry is the chunk coordinate and the number of actions, followed by
+// the voxel coordinate, whether the face is hidden and the face of every
+// action, all as int32.
+func readPending(file afero.File) map[chunk.ChunkCoordinate][]chunk.PendingAction {
+	pending := map[chunk.ChunkCoordinate][]chunk.PendingAction{}
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		log.Warn(err)
+		return pending
+	}
+	buf := bytes.NewReader(bs)
+	for buf.Len() > 0 {
+		header := make([]int32, 4)
+		err := binary.Read(buf, binary.LittleEndian, header)
+		if err != nil {
+			log.Warnf("(readPending) %v", err)
+			return pending
+		}
+		key := chunk.ChunkCoordinate{X: header[0], Y: header[1], Z: header[2]}
+		entries := make([]int32, 5*header[3])
+		err = binary.Read(buf, binary.LittleEndian, entries)
+		if err != nil {
+			log.Warnf("(readPending) %v", err)
+			return pending
+		}
+		actions := make([]chunk.PendingAction, 0, header[3])
+		for i := 0; i < len(entries); i += 5 {
+			actions = append(actions, chunk.PendingAction{
+				ChPos:    key,
+				VoxPos:   chunk.VoxelCoordinate{X: entries[i], Y: entries[i+1], Z: entries[i+2]},
+				HideFace: entries[i+3] != 0,
+				Face:     chunk.AdjacentMask(entries[i+4]),
+			})
+		}
+		pending[key] = actions
+	}
+	return pending
+}
+
+func (c *core) savePending(key chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+	if len(actions) == 0 {
+		delete(c.pending, key)
+		return
+	}
+	c.pending[key] = append([]chunk.PendingAction(nil), actions...)
+}
+
+func (c *core) loadPending(key chunk.ChunkCoordinate) []chunk.PendingAction {
+	return append([]chunk.PendingAction(nil), c.pending[key]...)
+}
+
+// writePending replaces the contents of the pending file with the pending
+// actions of every chunk.
+func (c *core) writePending() error {
+	keys := make([]chunk.ChunkCoordinate, 0, len(c.pending))
+	for key := range c.pending {
+		keys = append(keys, key)
+	}
+	sortChunkCoordinates(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		actions := c.pending[key]
+		data := []int32{key.X, key.Y, key.Z, int32(len(actions))}
+		for _, a := range actions {
+			hideFace := int32(0)
+			if a.HideFace {
+				hideFace = 1
+			}
+			data = append(data, a.VoxPos.X, a.VoxPos.Y, a.VoxPos.Z, hideFace, int32(a.Face))
+		}
+		err := binary.Write(&buf, binary.LittleEndian, data)
+		if err != nil {
+			return err
+		}
+	}
+	return replaceFile(c.fs, pendingPath, buf.Bytes())
+}
@@ -0,0 +1,509 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// regionDirectory is the directory of region files.
+const regionDirectory = "data/region"
+
+// sectorSize is the size in bytes of the sectors that region files are divided
+// into.
+const sectorSize = 4096
+
+// maxOpenRegionFiles is how many region files are kept open at most.
+const maxOpenRegionFiles = 64
+
+// regionStore keeps the chunks of every region in a file of its own.
+//
+// A region file starts with a header of an entry for every chunk of the
+// region, in the order of chunkPosToDataOffset. Each entry is the sector the
+// chunk's payload starts at and the length of the payload in bytes, both as
+// uint32, and a sector of 0 means that the chunk isn't saved. Payloads start
+// at sector boundaries after the header.
+type regionStore struct {
+	fs     afero.Fs
+	format Format
+	files  map[regionPosition]*regionFile
+	// fileOrder holds the positions of the open region files, from the most
+	// recently used to the least.
+	fileOrder *list.List
+	// readOnly is whether region files are only read, and never created or
+	// written.
+	readOnly bool
+	// compacting is the regions that compaction hasn't finished with yet in
+	// the current pass.
+	compacting []regionPosition
+}
+
+// regionFile is an open region file and its header.
+type regionFile struct {
+	file    afero.File
+	entries []regionEntry
+	// sectors is the number of sectors in the file.
+	sectors uint32
+	// free is the sectors after the header that no payload uses.
+	free *freeSpace
+	// order is the sectors of the payloads that compaction can move, and
+	// owners the index of the entry of each of them by sector. A payload that
+	// overlaps another one, which only a corrupt file has, is left where it
+	// is.
+	order  slotOrder
+	owners map[int64]int32
+	// use is the element of the region's position in fileOrder.
+	use *list.Element
+}
+
+type regionEntry struct {
+	sector uint32
+	length uint32
+	// corrupt is whether the header entry pointed outside of the file. The
+	// chunk counts as saved, but loading it fails with ErrCorrupt.
+	corrupt bool
+}
+
+func newRegionStore(fs afero.Fs, format Format, readOnly bool) (*regionStore, error) {
+	if !readOnly {
+		if err := fs.MkdirAll(regionDirectory, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &regionStore{
+		fs:        fs,
+		format:    format,
+		files:     map[regionPosition]*regionFile{},
+		fileOrder: list.New(),
+		readOnly:  readOnly,
+	}, nil
+}
+
+func regionPath(regionPos regionPosition) string {
+	return path.Join(regionDirectory, fmt.Sprintf("r.%d.%d.%d.vxr", regionPos.x, regionPos.y, regionPos.z))
+}
+
+// parseRegionName returns the region position of a region file name.
+func parseRegionName(name string) (regionPosition, bool) {
+	var regionPos regionPosition
+	n, err := fmt.Sscanf(name, "r.%d.%d.%d.vxr", &regionPos.x, &regionPos.y, &regionPos.z)
+	if n != 3 || err != nil || regionPath(regionPos) != path.Join(regionDirectory, name) {
+		return regionPosition{}, false
+	}
+	return regionPos, true
+}
+
+// sectorsFor returns how many sectors a payload of length bytes takes up.
+func sectorsFor(length uint32) uint32 {
+	return uint32((uint64(length) + sectorSize - 1) / sectorSize)
+}
+
+func (s *regionStore) headerSectors() uint32 {
+	size := s.format.RegionSize
+	return sectorsFor(8 * size * size * size)
+}
+
+// open returns the open region file of a region, or nil if there is none and
+// create is false.
+func (s *regionStore) open(regionPos regionPosition, create bool) (*regionFile, error) {
+	if rf, ok := s.files[regionPos]; ok {
+		s.fileOrder.MoveToFront(rf.use)
+		return rf, nil
+	}
+	flags := os.O_RDWR
+	if s.readOnly {
+		flags = os.O_RDONLY
+		create = false
+	} else if create {
+		flags |= os.O_CREATE
+	}
+	file, err := s.fs.OpenFile(regionPath(regionPos), flags, 0644)
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rf, err := s.readHeader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if len(s.files) >= maxOpenRegionFiles {
+		// closes the least recently used file
+		key := s.fileOrder.Remove(s.fileOrder.Back()).(regionPosition)
+		other := s.files[key]
+		if err := other.file.Sync(); err != nil {
+			log.Warn(err)
+		}
+		if err := other.file.Close(); err != nil {
+			log.Warn(err)
+		}
+		delete(s.files, key)
+	}
+	rf.use = s.fileOrder.PushFront(regionPos)
+	s.files[regionPos] = rf
+	return rf, nil
+}
+
+// readHeader reads the header of a region file, and writes an empty header if
+// the file doesn't have a whole one. A new region file's header is written
+// before any payload, so a file without a whole header has no chunks.
+func (s *regionStore) readHeader(file afero.File) (*regionFile, error) {
+	size := s.format.RegionSize
+	headerSectors := s.headerSectors()
+	rf := &regionFile{
+		file:    file,
+		entries: make([]regionEntry, size*size*size),
+		sectors: headerSectors,
+		owners:  map[int64]int32{},
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(headerSectors*sectorSize) {
+		rf.free = &freeSpace{}
+		if s.readOnly {
+			return rf, nil
+		}
+		return rf, writeAllAt(file, make([]byte, headerSectors*sectorSize), 0)
+	}
+	bs := make([]byte, 8*len(rf.entries))
+	if err := readAllAt(file, bs, 0); err != nil {
+		return nil, err
+	}
+	values := make([]uint32, 2*len(rf.entries))
+	err = binary.Read(bytes.NewReader(bs), binary.LittleEndian, values)
+	if err != nil {
+		return nil, err
+	}
+	if sectors := uint32((info.Size() + sectorSize - 1) / sectorSize); sectors > rf.sectors {
+		rf.sectors = sectors
+	}
+	used := []extent{{off: 0, size: int64(headerSectors)}}
+	for i := range rf.entries {
+		entry := regionEntry{sector: values[2*i], length: values[2*i+1]}
+		if entry.sector == 0 {
+			continue
+		}
+		if entry.sector < headerSectors || entry.extent().end() > int64(rf.sectors) {
+			rf.entries[i] = regionEntry{corrupt: true}
+			continue
+		}
+		rf.setEntry(int32(i), entry)
+		used = append(used, entry.extent())
+	}
+	rf.free = newFreeSpace(used, int64(rf.sectors))
+	return rf, nil
+}
+
+// setEntry sets the header entry at idx, as it was read or written.
+func (rf *regionFile) setEntry(idx int32, entry regionEntry) {
+	if old := rf.entries[idx]; old.sector != 0 {
+		off := old.extent().off
+		if owner, ok := rf.owners[off]; ok && owner == idx {
+			rf.order.remove(off)
+			delete(rf.owners, off)
+		}
+	}
+	rf.entries[idx] = entry
+	if slot := entry.extent(); entry.sector != 0 && slot.size > 0 && !rf.order.overlaps(slot) {
+		rf.order.add(slot)
+		rf.owners[slot.off] = idx
+	}
+}
+
+// extent returns the sectors that the payload of the entry takes up.
+func (e regionEntry) extent() extent {
+	return extent{off: int64(e.sector), size: int64(sectorsFor(e.length))}
+}
+
+// save stores a payload in the region file of its chunk. The payload is
+// written before the header entry that points at it, so a save that stops
+// partway leaves the chunk as it was, unless it was rewritten in place.
+func (s *regionStore) save(pos chunk.ChunkCoordinate, payload []byte) error {
+	regionSize := s.format.RegionSize
+	regionPos := chunkPosToRegionPos(pos, regionSize)
+	rf, err := s.open(regionPos, true)
+	if err != nil {
+		return err
+	}
+	idx := chunkPosToDataOffset(pos, regionPos, int32(regionSize))
+	length := uint32(len(payload))
+	need := sectorsFor(length)
+	old := rf.entries[idx]
+	entry := old
+	if entry.sector == 0 || sectorsFor(entry.length) < need {
+		// doesn't fit where it was, so goes where it fits best, and the space
+		// of a failed save stays allocated until the file is opened again
+		entry.sector = uint32(rf.free.allocate(int64(need), int64(rf.sectors)))
+		if end := entry.sector + need; end > rf.sectors {
+			rf.sectors = end
+		}
+	}
+	entry.length = length
+	entry.corrupt = false
+	padded := make([]byte, need*sectorSize)
+	copy(padded, payload)
+	if err := writeAllAt(rf.file, padded, int64(entry.sector)*sectorSize); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{entry.sector, entry.length})
+	if err := writeAllAt(rf.file, buf.Bytes(), int64(8*idx)); err != nil {
+		return err
+	}
+	rf.setEntry(idx, entry)
+	if old.sector != 0 && old.sector != entry.sector {
+		rf.free.release(old.extent().off, old.extent().size)
+	} else if old.sector != 0 {
+		rf.free.release(int64(entry.sector+need), old.extent().size-int64(need))
+	}
+	return nil
+}
+
+func (s *regionStore) load(pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
+	regionSize := s.format.RegionSize
+	regionPos := chunkPosToRegionPos(pos, regionSize)
+	rf, err := s.open(regionPos, false)
+	if err != nil {
+		return chunk.Chunk{}, err
+	}
+	if rf == nil {
+		return chunk.Chunk{}, ErrNotFound
+	}
+	entry := rf.entries[chunkPosToDataOffset(pos, regionPos, int32(regionSize))]
+	if entry.corrupt {
+		return chunk.Chunk{}, corruptf(pos, "its entry in %v points outside of the file", rf.file.Name())
+	}
+	if entry.sector == 0 {
+		return chunk.Chunk{}, ErrNotFound
+	}
+	payload := make([]byte, entry.length)
+	if err := readAllAt(rf.file, payload, int64(entry.sector)*sectorSize); err != nil {
+		return chunk.Chunk{}, corruptIfShort(pos, err)
+	}
+	return decodePayload(payload, s.format.ChunkSize, pos)
+}
+
+func (s *regionStore) stored(pos chunk.ChunkCoordinate) ([]byte, error) {
+	regionSize := s.format.RegionSize
+	regionPos := chunkPosToRegionPos(pos, regionSize)
+	rf, err := s.open(regionPos, false)
+	if err != nil {
+		return nil, err
+	}
+	if rf == nil {
+		return nil, ErrNotFound
+	}
+	entry := rf.entries[chunkPosToDataOffset(pos, regionPos, int32(regionSize))]
+	if entry.corrupt {
+		// there is nothing to read where it points
+		return nil, nil
+	}
+	if entry.sector == 0 {
+		return nil, ErrNotFound
+	}
+	bs := make([]byte, entry.length)
+	if err := readAllAt(rf.file, bs, int64(entry.sector)*sectorSize); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+func (s *regionStore) remove(pos chunk.ChunkCoordinate) error {
+	regionSize := s.format.RegionSize
+	regionPos := chunkPosToRegionPos(pos, regionSize)
+	rf, err := s.open(regionPos, false)
+	if err != nil {
+		return err
+	}
+	if rf == nil {
+		return ErrNotFound
+	}
+	idx := chunkPosToDataOffset(pos, regionPos, int32(regionSize))
+	if err := writeAllAt(rf.file, make([]byte, 8), int64(8*idx)); err != nil {
+		return err
+	}
+	if entry := rf.entries[idx]; entry.sector != 0 {
+		rf.free.release(entry.extent().off, entry.extent().size)
+	}
+	rf.setEntry(idx, regionEntry{})
+	return nil
+}
+
+// compactStep moves the payload of one chunk into free sectors nearer the
+// start of its region file, going through the region files in turn, and
+// truncates the free sectors that each file ends in once no payload in it can
+// be moved. It returns false once a pass over every region file is finished.
+//
+// The payload is synced at its new place before the chunk's header entry
+// points at it, so the chunk is in one place or the other if the game stops
+// partway.
+func (s *regionStore) compactStep() (bool, error) {
+	if s.compacting == nil {
+		regionPositions, err := s.regions()
+		if err != nil {
+			return false, err
+		}
+		s.compacting = regionPositions
+	}
+	for len(s.compacting) > 0 {
+		rf, err := s.open(s.compacting[0], false)
+		if err != nil {
+			return false, err
+		}
+		if rf != nil {
+			moved, err := rf.compactStep()
+			if moved || err != nil {
+				return moved, err
+			}
+		}
+		s.compacting = s.compacting[1:]
+	}
+	s.compacting = nil
+	return false, nil
+}
+
+// compactStep moves the payload of one chunk into free sectors nearer the
+// start of the file, and truncates the free sectors that the file ends in. It
+// returns false if no payload could be moved.
+func (rf *regionFile) compactStep() (bool, error) {
+	slot, to, ok := rf.free.pickMove(&rf.order)
+	if !ok {
+		return false, rf.truncate()
+	}
+	idx := rf.owners[slot.off]
+	old := rf.entries[idx]
+	payload := make([]byte, old.length)
+	if err := readAllAt(rf.file, payload, int64(old.sector)*sectorSize); err != nil {
+		return false, err
+	}
+	entry := old
+	entry.sector = uint32(rf.free.take(to, slot.size))
+	padded := make([]byte, slot.size*sectorSize)
+	copy(padded, payload)
+	if err := writeAllAt(rf.file, padded, int64(entry.sector)*sectorSize); err != nil {
+		return false, err
+	}
+	if err := rf.file.Sync(); err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{entry.sector, entry.length})
+	if err := writeAllAt(rf.file, buf.Bytes(), int64(8*idx)); err != nil {
+		return false, err
+	}
+	if err := rf.file.Sync(); err != nil {
+		return false, err
+	}
+	rf.setEntry(idx, entry)
+	rf.free.release(slot.off, slot.size)
+	return true, rf.truncate()
+}
+
+// truncate shrinks the file by the free sectors that it ends in.
+func (rf *regionFile) truncate() error {
+	end := uint32(rf.free.trimEnd(int64(rf.sectors)))
+	if end == rf.sectors {
+		return nil
+	}
+	if err := rf.file.Truncate(int64(end) * sectorSize); err != nil {
+		return err
+	}
+	rf.sectors = end
+	return nil
+}
+
+// regions returns the positions of all regions with a region file, sorted by
+// X, then Y, then Z.
+func (s *regionStore) regions() ([]regionPosition, error) {
+	infos, err := afero.ReadDir(s.fs, regionDirectory)
+	if errors.Is(err, os.ErrNotExist) {
+		// a read-only cache doesn't make the region directory
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var regionPositions []regionPosition
+	for _, info := range infos {
+		if regionPos, ok := parseRegionName(info.Name()); ok && !info.IsDir() {
+			regionPositions = append(regionPositions, regionPos)
+		}
+	}
+	sort.Slice(regionPositions, func(i, j int) bool {
+		a, b := regionPositions[i], regionPositions[j]
+		if a.x != b.x {
+			return a.x < b.x
+		}
+		if a.y != b.y {
+			return a.y < b.y
+		}
+		return a.z < b.z
+	})
+	return regionPositions, nil
+}
+
+func (s *regionStore) chunks() ([]chunk.ChunkCoordinate, error) {
+	size := int32(s.format.RegionSize)
+	regionPositions, err := s.regions()
+	if err != nil {
+		return nil, err
+	}
+	var positions []chunk.ChunkCoordinate
+	for _, regionPos := range regionPositions {
+		rf, err := s.open(regionPos, false)
+		if err != nil {
+			return nil, err
+		}
+		if rf == nil {
+			continue
+		}
+		for off, entry := range rf.entries {
+			if entry.sector == 0 && !entry.corrupt {
+				continue
+			}
+			i := int32(off) % size
+			j := int32(off) / size % size
+			k := int32(off) / (size * size)
+			positions = append(positions, chunk.ChunkCoordinate{
+				X: regionPos.x*size + i,
+				Y: regionPos.y*size + j,
+				Z: regionPos.z*size + k,
+			})
+		}
+	}
+	return positions, nil
+}
+
+func (s *regionStore) sync() error {
+	for _, rf := range s.files {
+		if err := rf.file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *regionStore) close() error {
+	var firstErr error
+	for key, rf := range s.files {
+		if err := rf.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, key)
+	}
+	s.fileOrder.Init()
+	return firstErr
+}
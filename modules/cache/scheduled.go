@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// scheduledPath is the file that keeps the scheduled updates of every chunk.
+const scheduledPath = "data/scheduled.data"
+
+// readScheduled reads every chunk's scheduled updates from the scheduled file.
+//
+// Each entry is the chunk coordinate and the number of updates, followed by
+// the voxel coordinate and delay of every update, all as int32.
+func readScheduled(file afero.File) map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate {
+	scheduled := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{}
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		log.Warn(err)
+		return scheduled
+	}
+	buf := bytes.NewReader(bs)
+	for buf.Len() > 0 {
+		header := make([]int32, 4)
+		err := binary.Read(buf, binary.LittleEndian, header)
+		if err != nil {
+			log.Warnf("(readScheduled) %v", err)
+			return scheduled
+		}
+		key := chunk.ChunkCoordinate{X: header[0], Y: header[1], Z: header[2]}
+		entries := make([]int32, 4*header[3])
+		err = binary.Read(buf, binary.LittleEndian, entries)
+		if err != nil {
+			log.Warnf("(readScheduled) %v", err)
+			return scheduled
+		}
+		updates := make([]chunk.ScheduledUpdate, 0, header[3])
+		for i := 0; i < len(entries); i += 4 {
+			updates = append(updates, chunk.ScheduledUpdate{
+				VoxPos: chunk.VoxelCoordinate{X: entries[i], Y: entries[i+1], Z: entries[i+2]},
+				Delay:  entries[i+3],
+			})
+		}
+		scheduled[key] = updates
+	}
+	return scheduled
+}
+
+func (c *core) saveScheduled(key chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+	if len(updates) == 0 {
+		delete(c.scheduled, key)
+		return
+	}
+	c.scheduled[key] = append([]chunk.ScheduledUpdate(nil), updates...)
+}
+
+func (c *core) loadScheduled(key chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+	return append([]chunk.ScheduledUpdate(nil), c.scheduled[key]...)
+}
+
+// sortChunkCoordinates sorts keys by X, then Y, then Z, so that files are
+// written in the same order every time.
+func sortChunkCoordinates(keys []chunk.ChunkCoordinate) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].X != keys[j].X {
+			return keys[i].X < keys[j].X
+		}
+		if keys[i].Y != keys[j].Y {
+			return keys[i].Y < keys[j].Y
+		}
+		return keys[i].Z < keys[j].Z
+	})
+}
+
+// writeScheduled replaces the contents of the scheduled file with the
+// scheduled updates of every chunk.
+func (c *core) writeScheduled() error {
+	keys := make([]chunk.ChunkCoordinate, 0, len(c.scheduled))
+	for key := range c.scheduled {
+		keys = append(keys, key)
+	}
+	sortChunkCoordinates(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		updates := c.scheduled[key]
+		data := []int32{key.X, key.Y, key.Z, int32(len(updates))}
+		for _, u := range updates {
+			data = append(data, u.VoxPos.X, u.VoxPos.Y, u.VoxPos.Z, u.Delay)
+		}
+		err := binary.Write(&buf, binary.LittleEndian, data)
+		if err != nil {
+			return err
+		}
+	}
+	return replaceFile(c.fs, scheduledPath, buf.Bytes())
+}
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/spf13/afero"
+)
+
+// cacheFiles are the files and directories of a cache in either layout, in its
+// data directory. The quarantine file isn't one of them, as it is kept when
+// the cache files are replaced.
+var cacheFiles = []string{
+	"voxel.data", "chunk.data", "region.data", path.Base(regionDirectory),
+	"journal.data", "scheduled.data", "pending.data", "format.data",
+}
+
+// trimDirectory is where Trim writes the new files of a cache before they
+// replace the old ones.
+const trimDirectory = "trim"
+
+// TrimStats describes what Trim removed, or would remove in a dry run.
+type TrimStats struct {
+	// Chunks is the number of saved chunks before trimming.
+	Chunks int
+	// Removed is the number of saved chunks that were removed.
+	Removed int
+	// Corrupt is the number of saved chunks that were moved to the quarantine
+	// file because they are corrupt.
+	Corrupt int
+	// BytesBefore is the size of the cache files before trimming.
+	BytesBefore int64
+	// BytesAfter is the size of the cache files after trimming.
+	BytesAfter int64
+}
+
+// Trim removes the saved chunks of the cache in fs for which remove returns
+// true, together with their scheduled updates and pending actions, and
+// rewrites the cache files without the space they used. Corrupt chunks are
+// moved to the quarantine file. The cache must not be open. If dryRun is
+// true, the cache is opened read-only, so fs is left as it is, and the stats
+// report what trimming would do.
+func Trim(fs afero.Fs, settingsRepo settings.Interface, remove func(chunk.Chunk) bool, dryRun bool) (TrimStats, error) {
+	if settingsRepo == nil {
+		panic("trim received nil settings repo")
+	}
+	if !dryRun {
+		if err := finishReplace(fs); err != nil {
+			return TrimStats{}, err
+		}
+	}
+	var stats TrimStats
+	var err error
+	stats.BytesBefore, err = dataSize(fs)
+	if err != nil {
+		return TrimStats{}, err
+	}
+	var from *Module
+	if dryRun {
+		from, err = OpenReadOnly(fs, settingsRepo, settingsRepo.GetChunkSize(), settingsRepo.GetRegionSize())
+	} else {
+		from, err = Open(fs, settingsRepo)
+	}
+	if err != nil {
+		return TrimStats{}, err
+	}
+	var trimFs afero.Fs
+	if dryRun {
+		trimFs = afero.NewMemMapFs()
+	} else {
+		trimFs, err = makeSideDirectory(fs, trimDirectory)
+		if err != nil {
+			from.Close()
+			return TrimStats{}, err
+		}
+	}
+	to, err := create(trimFs, settingsRepo, from.c.format)
+	if err != nil {
+		from.Close()
+		return TrimStats{}, err
+	}
+	positions, err := from.Chunks()
+	if err != nil {
+		from.Close()
+		to.Close()
+		return TrimStats{}, err
+	}
+	removed := map[chunk.ChunkCoordinate]bool{}
+	for _, pos := range positions {
+		stats.Chunks++
+		ch, err := from.Load(pos)
+		switch {
+		case errors.Is(err, ErrCorrupt):
+			log.Warn(err)
+			removed[pos] = true
+			stats.Corrupt++
+			err = nil
+			if !dryRun {
+				err = from.Quarantine(pos)
+			}
+		case err != nil:
+		case remove(ch):
+			removed[pos] = true
+			stats.Removed++
+		default:
+			err = to.Save(ch)
+		}
+		if err != nil {
+			from.Close()
+			to.Close()
+			return TrimStats{}, err
+		}
+	}
+	for key, updates := range from.c.scheduled {
+		if !removed[key] {
+			to.c.saveScheduled(key, updates)
+		}
+	}
+	for key, actions := range from.c.pending {
+		if !removed[key] {
+			to.c.savePending(key, actions)
+		}
+	}
+	err = from.Close()
+	if closeErr := to.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return TrimStats{}, err
+	}
+	stats.BytesAfter, err = dataSize(trimFs)
+	if err != nil {
+		return TrimStats{}, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+	return stats, replaceCacheFiles(fs, trimDirectory)
+}
+
+// makeSideDirectory makes an empty directory in fs for the new files of a
+// cache that is rewritten, and returns a file system rooted at it. If the
+// directory holds the files of a rewrite that stopped while they replaced the
+// cache files, the replacement is finished first.
+func makeSideDirectory(fs afero.Fs, dir string) (afero.Fs, error) {
+	if err := finishReplacing(fs, dir); err != nil {
+		return nil, err
+	}
+	if err := fs.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := fs.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	return afero.NewBasePathFs(fs, dir), nil
+}
+
+// sideDirectories are the directories that caches are rewritten in.
+var sideDirectories = []string{trimDirectory, migrateDirectory}
+
+// The files in a side directory that mark how far the replacement of the
+// cache files got. Before replaceReady is written, the new files may be
+// incomplete and the cache files are untouched.
+const (
+	// replaceReady marks that the new files are complete, and the cache files
+	// are being moved aside.
+	replaceReady = "ready"
+	// replaceSwapping marks that the cache files were moved aside, and the new
+	// files are being moved in.
+	replaceSwapping = "swapping"
+)
+
+// replaceCacheFiles replaces the files of the cache in fs with the files of
+// the cache in dir, and removes dir along with the old files. The old files
+// are moved into dir before the new ones are moved in, so if the replacement
+// stops partway, finishReplace can finish it when the cache is opened again.
+func replaceCacheFiles(fs afero.Fs, dir string) error {
+	if err := afero.WriteFile(fs, path.Join(dir, replaceReady), nil, 0644); err != nil {
+		return err
+	}
+	return finishReplacing(fs, dir)
+}
+
+// finishReplace finishes replacing the cache files in fs with the files of
+// any rewrite that stopped partway.
+func finishReplace(fs afero.Fs) error {
+	for _, dir := range sideDirectories {
+		if err := finishReplacing(fs, dir); err != nil {
+			return fmt.Errorf("failed to finish replacing the cache files with the ones in %v: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// finishReplacing replaces the cache files in fs with the files in dir, from
+// where replaceCacheFiles got to, if it got as far as writing replaceReady.
+//
+// The format file is moved in last, so a cache that is only partly replaced
+// doesn't record a format.
+func finishReplacing(fs afero.Fs, dir string) error {
+	ready, err := afero.Exists(fs, path.Join(dir, replaceReady))
+	if err != nil {
+		return err
+	}
+	if ready {
+		for _, name := range cacheFiles {
+			if err := moveFiles(fs, path.Join("data", name), path.Join(dir, "old", name), ""); err != nil {
+				return err
+			}
+			if err := fs.RemoveAll(path.Join("data", name)); err != nil {
+				return err
+			}
+		}
+		if err := fs.Rename(path.Join(dir, replaceReady), path.Join(dir, replaceSwapping)); err != nil {
+			return err
+		}
+	}
+	swapping, err := afero.Exists(fs, path.Join(dir, replaceSwapping))
+	if err != nil || !swapping {
+		return err
+	}
+	if err := moveFiles(fs, path.Join(dir, "data"), "data", path.Join(dir, formatPath)); err != nil {
+		return err
+	}
+	return fs.RemoveAll(dir)
+}
+
+// isReplacing returns whether the cache files in fs are being replaced with
+// the files in dir, which finishReplacing would finish.
+func isReplacing(fs afero.Fs, dir string) (bool, error) {
+	for _, marker := range []string{replaceReady, replaceSwapping} {
+		if exists, err := afero.Exists(fs, path.Join(dir, marker)); err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// moveFiles moves the files in fs at src, or under it if it is a directory,
+// to the same paths under dst. The file at last, if there is one, is moved
+// after the others.
+func moveFiles(fs afero.Fs, src, dst, last string) error {
+	move := func(p string) error {
+		to := path.Join(dst, strings.TrimPrefix(p, src))
+		if err := fs.MkdirAll(path.Dir(to), 0755); err != nil {
+			return err
+		}
+		return fs.Rename(p, to)
+	}
+	hasLast := false
+	err := afero.Walk(fs, src, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if p == last {
+			hasLast = true
+			return nil
+		}
+		return move(p)
+	})
+	if err != nil || !hasLast {
+		return err
+	}
+	return move(last)
+}
+
+// dataSize returns the total size of the cache files in fs.
+func dataSize(fs afero.Fs) (int64, error) {
+	total := int64(0)
+	err := afero.Walk(fs, "data", func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+)
+
+// writeAttempts is how many times writing a queued chunk is tried before it is
+// dropped from the queue.
+const writeAttempts = 3
+
+// queuedChunk is a copy of a saved chunk that waits to be written.
+type queuedChunk struct {
+	ch chunk.Chunk
+	// version counts the saves of the chunk while it was queued, so that a
+	// save during a write isn't dropped when the write finishes.
+	version  int
+	attempts int
+}
+
+// Save queues a copy of the chunk to be written, replacing the queued copy if
+// the chunk is queued already. If the queue is full, Save waits until a chunk
+// is written. Errors writing the chunk are logged and returned by Close.
+func (m *WriteBehindModule) Save(ch chunk.Chunk) error {
+	pos := ch.Position()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if qc, ok := m.queued[pos]; ok {
+		qc.ch = ch.Copy()
+		qc.version++
+		qc.attempts = 0
+		return nil
+	}
+	for len(m.order) >= m.queueSize && !m.closed {
+		m.changed.Wait()
+	}
+	m.queued[pos] = &queuedChunk{ch: ch.Copy()}
+	m.order = append(m.order, pos)
+	m.changed.Broadcast()
+	return nil
+}
+
+// Load returns a copy of the chunk if it is queued, and loads it from the
+// wrapped cache otherwise.
+func (m *WriteBehindModule) Load(pos chunk.ChunkCoordinate) (chunk.Chunk, error) {
+	m.mu.Lock()
+	qc, ok := m.queued[pos]
+	var ch chunk.Chunk
+	if ok {
+		ch = qc.ch.Copy()
+	}
+	m.mu.Unlock()
+	if ok {
+		return ch, nil
+	}
+	// a chunk is only taken out of the queue once it is written, so it is in
+	// the wrapped cache by now
+	m.io.Lock()
+	defer m.io.Unlock()
+	return m.cacheMod.Load(pos)
+}
+
+// SaveScheduled replaces the scheduled updates stored for a chunk.
+func (m *WriteBehindModule) SaveScheduled(pos chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+	m.io.Lock()
+	defer m.io.Unlock()
+	m.cacheMod.SaveScheduled(pos, updates)
+}
+
+// LoadScheduled returns the scheduled updates stored for a chunk.
+func (m *WriteBehindModule) LoadScheduled(pos chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+	m.io.Lock()
+	defer m.io.Unlock()
+	return m.cacheMod.LoadScheduled(pos)
+}
+
+// SavePending replaces the pending actions stored for a chunk.
+func (m *WriteBehindModule) SavePending(pos chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+	m.io.Lock()
+	defer m.io.Unlock()
+	m.cacheMod.SavePending(pos, actions)
+}
+
+// LoadPending returns the pending actions stored for a chunk.
+func (m *WriteBehindModule) LoadPending(pos chunk.ChunkCoordinate) []chunk.PendingAction {
+	m.io.Lock()
+	defer m.io.Unlock()
+	return m.cacheMod.LoadPending(pos)
+}
+
+// Quarantine moves the data of a saved chunk into the quarantine file of the
+// wrapped cache.
+func (m *WriteBehindModule) Quarantine(pos chunk.ChunkCoordinate) error {
+	m.io.Lock()
+	defer m.io.Unlock()
+	return m.cacheMod.Quarantine(pos)
+}
+
+// Chunks returns the positions of all saved chunks, queued ones included.
+func (m *WriteBehindModule) Chunks() ([]chunk.ChunkCoordinate, error) {
+	m.io.Lock()
+	positions, err := m.cacheMod.Chunks()
+	m.io.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	saved := map[chunk.ChunkCoordinate]bool{}
+	for _, pos := range positions {
+		saved[pos] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, pos := range m.order {
+		if !saved[pos] {
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
+}
+
+// CompactStep moves one saved chunk into free space nearer the start of the
+// files of the wrapped cache.
+func (m *WriteBehindModule) CompactStep() (bool, error) {
+	m.io.Lock()
+	defer m.io.Unlock()
+	return m.cacheMod.CompactStep()
+}
+
+// Compact compacts the files of the wrapped cache a step at a time, until
+// there is nothing left to move or the module is closed. Loads and writes of
+// queued chunks only wait for the step in progress, so Compact can run in a
+// goroutine of its own while the game is played.
+func (m *WriteBehindModule) Compact() error {
+	for {
+		m.io.Lock()
+		// Close sets closed before it waits for io to close the wrapped cache
+		m.mu.Lock()
+		closed := m.closed
+		m.mu.Unlock()
+		if closed {
+			m.io.Unlock()
+			return nil
+		}
+		moved, err := m.cacheMod.CompactStep()
+		m.io.Unlock()
+		if err != nil || !moved {
+			return err
+		}
+	}
+}
+
+// Close stops Run, writes the chunks that are still queued and closes the
+// wrapped cache. It returns the first error that a chunk was dropped with, or
+// that closing the wrapped cache failed with.
+func (m *WriteBehindModule) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.changed.Broadcast()
+	m.mu.Unlock()
+	// waits for the write that Run is doing
+	m.writer.Lock()
+	for m.writeFirst() {
+	}
+	m.writer.Unlock()
+	m.io.Lock()
+	defer m.io.Unlock()
+	err := m.cacheMod.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	return err
+}
+
+// waitForQueued waits until a chunk is queued, and returns false if the module
+// is closed instead.
+func (m *WriteBehindModule) waitForQueued() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.order) == 0 && !m.closed {
+		m.changed.Wait()
+	}
+	return !m.closed
+}
+
+// writeFirst writes the chunk that was queued first, and returns false if no
+// chunk is queued. The chunk stays queued until it is written, so that Load
+// never misses it. The writer lock must be held.
+func (m *WriteBehindModule) writeFirst() bool {
+	m.mu.Lock()
+	if len(m.order) == 0 {
+		m.mu.Unlock()
+		return false
+	}
+	pos := m.order[0]
+	qc := m.queued[pos]
+	ch, version := qc.ch, qc.version
+	m.mu.Unlock()
+
+	m.io.Lock()
+	err := m.cacheMod.Save(ch)
+	m.io.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil && qc.version != version:
+		// saved again during the write, so the new copy is written next
+	case err == nil:
+		m.dequeueFirst()
+	case qc.attempts+1 < writeAttempts:
+		qc.attempts++
+		log.Warnf("trying to write chunk %v again: %v", pos, err)
+	default:
+		log.Warnf("dropping chunk %v after failing to write it %v times: %v", pos, writeAttempts, err)
+		if m.err == nil {
+			m.err = err
+		}
+		m.dequeueFirst()
+	}
+	return true
+}
+
+// dequeueFirst takes the chunk that was queued first out of the queue. The
+// lock mu must be held.
+func (m *WriteBehindModule) dequeueFirst() {
+	delete(m.queued, m.order[0])
+	m.order = m.order[1:]
+	m.changed.Broadcast()
+}
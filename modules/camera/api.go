@@ -1,8 +1,16 @@
 package camera
 
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/modules/player"
+)
+
 type Interface interface {
 	HandleMovementEvent(MovementEvent)
 	HandleLookEvent(LookEvent)
+	GetPosition() player.PositionEvent
+	GetRotation() mgl.Quat
+	Teleport(pos player.PositionEvent, rot mgl.Quat)
 	Tick()
 }
 
@@ -68,9 +76,28 @@ func (m *Module) HandleLookEvent(evt LookEvent) {
 	m.c.handleLookEvent(evt)
 }
 
+// GetPosition returns the current camera position.
+func (m *Module) GetPosition() player.PositionEvent {
+	return m.c.getPosition()
+}
+
+// GetRotation returns the current camera rotation.
+func (m *Module) GetRotation() mgl.Quat {
+	return m.c.getRotation()
+}
+
+// Teleport moves the camera to pos and turns it to rot. Movement keys that are
+// held stay held.
+func (m *Module) Teleport(pos player.PositionEvent, rot mgl.Quat) {
+	m.c.teleport(pos, rot)
+}
+
 type FnModule struct {
 	FnHandleMovementEvent func(MovementEvent)
 	FnHandleLookEvent     func(LookEvent)
+	FnGetPosition         func() player.PositionEvent
+	FnGetRotation         func() mgl.Quat
+	FnTeleport            func(player.PositionEvent, mgl.Quat)
 	FnTick                func()
 }
 
@@ -86,6 +113,26 @@ func (fn *FnModule) HandleLookEvent(lookEvent LookEvent) {
 	}
 }
 
+func (fn *FnModule) GetPosition() player.PositionEvent {
+	if fn.FnGetPosition != nil {
+		return fn.FnGetPosition()
+	}
+	return player.PositionEvent{}
+}
+
+func (fn *FnModule) GetRotation() mgl.Quat {
+	if fn.FnGetRotation != nil {
+		return fn.FnGetRotation()
+	}
+	return mgl.QuatIdent()
+}
+
+func (fn *FnModule) Teleport(pos player.PositionEvent, rot mgl.Quat) {
+	if fn.FnTeleport != nil {
+		fn.FnTeleport(pos, rot)
+	}
+}
+
 func (fn *FnModule) Tick() {
 	if fn.FnTick != nil {
 		fn.FnTick()
@@ -814,6 +814,92 @@ func TestCameraInitialDirection(t *testing.T) {
 	}
 }
 
+func TestCameraInitialDirectionGiven(t *testing.T) {
+	t.Parallel()
+	expected := player.DirectionEvent{Rotation: mgl.QuatRotate(mgl.DegToRad(90), mgl.Vec3{0, 1, 0})}
+	var actual player.DirectionEvent
+	playerMod := player.FnModule{
+		FnUpdatePlayerDirection: func(dirEvent player.DirectionEvent) {
+			actual = dirEvent
+		},
+	}
+	cameraMod := camera.NewWithDirection(&playerMod, player.PositionEvent{}, expected)
+
+	if actual != expected {
+		t.Fatalf("expected quat %v but got %v", expected, actual)
+	}
+	if rot := cameraMod.GetRotation(); rot != expected.Rotation {
+		t.Fatalf("expected camera rotation %v but got %v", expected.Rotation, rot)
+	}
+}
+
+func TestCameraGetPositionAfterMoving(t *testing.T) {
+	t.Parallel()
+	expected := player.PositionEvent{X: 1.5, Y: 2, Z: 3}
+	cameraMod := camera.New(&player.FnModule{}, player.PositionEvent{X: 1.5, Y: 2, Z: 4})
+	cameraMod.HandleMovementEvent(camera.MovementEvent{
+		Direction: camera.MoveForwards,
+		Pressed:   true,
+	})
+	cameraMod.Tick()
+
+	actual := cameraMod.GetPosition()
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestCameraGetRotationAfterLooking(t *testing.T) {
+	t.Parallel()
+	var expected mgl.Quat
+	playerMod := player.FnModule{
+		FnUpdatePlayerDirection: func(dirEvent player.DirectionEvent) {
+			expected = dirEvent.Rotation
+		},
+	}
+	cameraMod := camera.New(&playerMod, player.PositionEvent{})
+	cameraMod.HandleLookEvent(camera.LookEvent{Right: 10, Down: 5})
+
+	actual := cameraMod.GetRotation()
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestCameraTeleport(t *testing.T) {
+	t.Parallel()
+	expectPos := player.PositionEvent{X: -3.5, Y: 7, Z: 12.25}
+	expectRot := mgl.QuatRotate(mgl.DegToRad(30), mgl.Vec3{0, 1, 0})
+	var actualPos player.PositionEvent
+	var actualDir player.DirectionEvent
+	playerMod := player.FnModule{
+		FnUpdatePlayerPosition: func(posEvent player.PositionEvent) {
+			actualPos = posEvent
+		},
+		FnUpdatePlayerDirection: func(dirEvent player.DirectionEvent) {
+			actualDir = dirEvent
+		},
+	}
+	cameraMod := camera.New(&playerMod, player.PositionEvent{X: 1, Y: 2, Z: 3})
+
+	cameraMod.Teleport(expectPos, expectRot)
+
+	if actualPos != expectPos {
+		t.Fatalf("expected player position %v but got %v", expectPos, actualPos)
+	}
+	if actualDir.Rotation != expectRot {
+		t.Fatalf("expected player rotation %v but got %v", expectRot, actualDir.Rotation)
+	}
+	if pos := cameraMod.GetPosition(); pos != expectPos {
+		t.Fatalf("expected camera position %v but got %v", expectPos, pos)
+	}
+	if rot := cameraMod.GetRotation(); rot != expectRot {
+		t.Fatalf("expected camera rotation %v but got %v", expectRot, rot)
+	}
+}
+
 func TestCameraNilPlayer(t *testing.T) {
 	t.Parallel()
 	defer func() {
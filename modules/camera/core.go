@@ -56,14 +56,22 @@ func (c *core) tick() {
 		c.pos = c.pos.Add(mgl.Vec3{0.0, -1.0, 0.0})
 	}
 	if moved {
-		c.playerMod.UpdatePlayerPosition(player.PositionEvent{
-			X: c.pos.X(),
-			Y: c.pos.Y(),
-			Z: c.pos.Z(),
-		})
+		c.playerMod.UpdatePlayerPosition(c.getPosition())
 	}
 }
 
+func (c *core) getPosition() player.PositionEvent {
+	return player.PositionEvent{
+		X: c.pos.X(),
+		Y: c.pos.Y(),
+		Z: c.pos.Z(),
+	}
+}
+
+func (c *core) getRotation() mgl.Quat {
+	return c.rot
+}
+
 func (c *core) handleKeyPressFlags(idx int, pressed bool) {
 	diff := 1
 	if idx%2 == 1 {
@@ -113,3 +121,12 @@ func (c *core) handleLookEvent(evt LookEvent) {
 		Rotation: c.rot,
 	})
 }
+
+func (c *core) teleport(pos player.PositionEvent, rot mgl.Quat) {
+	c.pos = mgl.Vec3{pos.X, pos.Y, pos.Z}
+	c.rot = rot
+	c.playerMod.UpdatePlayerPosition(pos)
+	c.playerMod.UpdatePlayerDirection(player.DirectionEvent{
+		Rotation: c.rot,
+	})
+}
@@ -12,11 +12,17 @@ type Module struct {
 
 // New creates a camera.
 func New(playerMod player.Interface, initialPos player.PositionEvent) *Module {
+	return NewWithDirection(playerMod, initialPos, player.DirectionEvent{Rotation: mgl.QuatIdent()})
+}
+
+// NewWithDirection creates a camera that starts out looking in the given
+// direction.
+func NewWithDirection(playerMod player.Interface, initialPos player.PositionEvent, initialDir player.DirectionEvent) *Module {
 	if playerMod == nil {
 		panic("playerMod cannot be nil in camera")
 	}
 	playerMod.UpdatePlayerPosition(initialPos)
-	playerMod.UpdatePlayerDirection(player.DirectionEvent{Rotation: mgl.QuatIdent()})
+	playerMod.UpdatePlayerDirection(initialDir)
 	return &Module{
 		core{
 			playerMod: playerMod,
@@ -25,7 +31,7 @@ func New(playerMod player.Interface, initialPos player.PositionEvent) *Module {
 				initialPos.Y,
 				initialPos.Z,
 			},
-			rot: mgl.QuatIdent(),
+			rot: initialDir.Rotation,
 		},
 	}
 }
@@ -0,0 +1,207 @@
+package client
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/protocol"
+)
+
+type Interface interface {
+	GetPlayerID() uint32
+	GetChunkSize() uint32
+	GetSpawn() protocol.Position
+	Move(pos protocol.Position, rot mgl.Quat) error
+	AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) error
+	RemoveBlock(vc chunk.VoxelCoordinate) error
+	GetBlockType(vc chunk.VoxelCoordinate) (chunk.BlockType, bool)
+	CountChunks() int
+	GetPlayers() map[uint32]Player
+	Done() <-chan struct{}
+	Err() error
+	Close() error
+}
+
+// Player is another player on the server.
+type Player struct {
+	Name     string
+	Position protocol.Position
+	Rotation mgl.Quat
+}
+
+// ErrRejected indicates that the server refused to let the client join.
+const ErrRejected log.ConstErr = "server rejected client"
+
+// ErrProtocol indicates that the server sent something it shouldn't have.
+const ErrProtocol log.ConstErr = "server broke protocol"
+
+// GetPlayerID returns the ID the server gave this client's player.
+func (m *Module) GetPlayerID() uint32 {
+	return m.c.welcome.PlayerID
+}
+
+// GetChunkSize returns the chunk size of the server's world.
+func (m *Module) GetChunkSize() uint32 {
+	return m.c.welcome.ChunkSize
+}
+
+// GetSpawn returns where new players start out.
+func (m *Module) GetSpawn() protocol.Position {
+	return m.c.welcome.Spawn
+}
+
+// Move tells the server where the player is and where it looks. The server
+// sends the chunks around that position in return.
+func (m *Module) Move(pos protocol.Position, rot mgl.Quat) error {
+	return m.c.send(protocol.Move{
+		Position: pos,
+		Rotation: rot,
+	})
+}
+
+// AddBlock asks the server to place a block. The block only appears once the
+// server sends it back.
+func (m *Module) AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) error {
+	return m.c.send(protocol.AddBlock{
+		VoxPos:    vc,
+		BlockType: bt,
+	})
+}
+
+// RemoveBlock asks the server to remove a block. The block only disappears
+// once the server sends it back.
+func (m *Module) RemoveBlock(vc chunk.VoxelCoordinate) error {
+	return m.c.send(protocol.RemoveBlock{
+		VoxPos: vc,
+	})
+}
+
+// GetBlockType returns the block type at vc and whether the chunk holding it
+// was received.
+func (m *Module) GetBlockType(vc chunk.VoxelCoordinate) (chunk.BlockType, bool) {
+	return m.c.getBlockType(vc)
+}
+
+// CountChunks returns how many chunks were received and not unloaded since.
+func (m *Module) CountChunks() int {
+	return m.c.countChunks()
+}
+
+// GetPlayers returns the other players on the server by ID.
+func (m *Module) GetPlayers() map[uint32]Player {
+	return m.c.getPlayers()
+}
+
+// Done returns a channel that is closed when the connection ends.
+func (m *Module) Done() <-chan struct{} {
+	return m.c.done
+}
+
+// Err returns why the connection ended, once Done is closed.
+func (m *Module) Err() error {
+	return m.c.getErr()
+}
+
+// Close leaves the server.
+func (m *Module) Close() error {
+	return m.c.conn.Close()
+}
+
+type FnModule struct {
+	FnGetPlayerID  func() uint32
+	FnGetChunkSize func() uint32
+	FnGetSpawn     func() protocol.Position
+	FnMove         func(pos protocol.Position, rot mgl.Quat) error
+	FnAddBlock     func(vc chunk.VoxelCoordinate, bt chunk.BlockType) error
+	FnRemoveBlock  func(vc chunk.VoxelCoordinate) error
+	FnGetBlockType func(vc chunk.VoxelCoordinate) (chunk.BlockType, bool)
+	FnCountChunks  func() int
+	FnGetPlayers   func() map[uint32]Player
+	FnDone         func() <-chan struct{}
+	FnErr          func() error
+	FnClose        func() error
+}
+
+func (fn FnModule) GetPlayerID() uint32 {
+	if fn.FnGetPlayerID != nil {
+		return fn.FnGetPlayerID()
+	}
+	return 0
+}
+
+func (fn FnModule) GetChunkSize() uint32 {
+	if fn.FnGetChunkSize != nil {
+		return fn.FnGetChunkSize()
+	}
+	return 1
+}
+
+func (fn FnModule) GetSpawn() protocol.Position {
+	if fn.FnGetSpawn != nil {
+		return fn.FnGetSpawn()
+	}
+	return protocol.Position{}
+}
+
+func (fn FnModule) Move(pos protocol.Position, rot mgl.Quat) error {
+	if fn.FnMove != nil {
+		return fn.FnMove(pos, rot)
+	}
+	return nil
+}
+
+func (fn FnModule) AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) error {
+	if fn.FnAddBlock != nil {
+		return fn.FnAddBlock(vc, bt)
+	}
+	return nil
+}
+
+func (fn FnModule) RemoveBlock(vc chunk.VoxelCoordinate) error {
+	if fn.FnRemoveBlock != nil {
+		return fn.FnRemoveBlock(vc)
+	}
+	return nil
+}
+
+func (fn FnModule) GetBlockType(vc chunk.VoxelCoordinate) (chunk.BlockType, bool) {
+	if fn.FnGetBlockType != nil {
+		return fn.FnGetBlockType(vc)
+	}
+	return chunk.BlockTypeAir, false
+}
+
+func (fn FnModule) CountChunks() int {
+	if fn.FnCountChunks != nil {
+		return fn.FnCountChunks()
+	}
+	return 0
+}
+
+func (fn FnModule) GetPlayers() map[uint32]Player {
+	if fn.FnGetPlayers != nil {
+		return fn.FnGetPlayers()
+	}
+	return nil
+}
+
+func (fn FnModule) Done() <-chan struct{} {
+	if fn.FnDone != nil {
+		return fn.FnDone()
+	}
+	return nil
+}
+
+func (fn FnModule) Err() error {
+	if fn.FnErr != nil {
+		return fn.FnErr()
+	}
+	return nil
+}
+
+func (fn FnModule) Close() error {
+	if fn.FnClose != nil {
+		return fn.FnClose()
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/client"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/protocol"
+)
+
+// fakeServer answers the hello of a client on the other end of conn with
+// reply.
+func fakeServer(t *testing.T, conn net.Conn, reply protocol.Message) {
+	t.Helper()
+	msg, err := protocol.ReadMessage(conn)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if hello, ok := msg.(protocol.Hello); !ok || hello.Version != protocol.Version || hello.Name != "alice" {
+		t.Errorf("expected hello from alice but got %+v", msg)
+		return
+	}
+	if err := protocol.WriteMessage(conn, reply); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientRejected(t *testing.T) {
+	t.Parallel()
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	go fakeServer(t, serverConn, protocol.Reject{Reason: "full"})
+	_, err := client.New(clientConn, "alice", &graphics.FnModule{})
+	if !errors.Is(err, client.ErrRejected) {
+		t.Fatalf("expected %v but got %v", client.ErrRejected, err)
+	}
+}
+
+func TestClientAppliesBlockDeltas(t *testing.T) {
+	t.Parallel()
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	go fakeServer(t, serverConn, protocol.Welcome{
+		Version:   protocol.Version,
+		PlayerID:  7,
+		ChunkSize: 1,
+	})
+	updated := make(chan chunk.ChunkCoordinate, 10)
+	clientMod, err := client.New(clientConn, "alice", &graphics.FnModule{
+		FnUpdateChunk: func(ch chunk.Chunk) {
+			updated <- ch.Position()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientMod.Close()
+	if clientMod.GetPlayerID() != 7 {
+		t.Fatalf("expected player ID 7 but got %v", clientMod.GetPlayerID())
+	}
+
+	left := chunk.ChunkCoordinate{X: -1}
+	right := chunk.ChunkCoordinate{X: 0}
+	msgs := []protocol.Message{
+		protocol.NewChunkData(chunk.NewChunkEmpty(left, 1)),
+		protocol.NewChunkData(chunk.NewChunkEmpty(right, 1)),
+		protocol.BlockDelta{VoxPos: chunk.VoxelCoordinate{X: -1}, BlockType: chunk.BlockTypeStone},
+		protocol.BlockDelta{VoxPos: chunk.VoxelCoordinate{X: 0}, BlockType: chunk.BlockTypeDirt},
+	}
+	for _, msg := range msgs {
+		if err := protocol.WriteMessage(serverConn, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for bt, _ := clientMod.GetBlockType(chunk.VoxelCoordinate{X: 0}); bt != chunk.BlockTypeDirt; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for block deltas")
+		}
+		time.Sleep(time.Millisecond)
+		bt, _ = clientMod.GetBlockType(chunk.VoxelCoordinate{X: 0})
+	}
+	// each delta updates its own chunk and the faces of its neighbor
+	updates := map[chunk.ChunkCoordinate]int{}
+	for len(updated) > 0 {
+		updates[<-updated]++
+	}
+	if updates[left] != 2 || updates[right] != 2 {
+		t.Fatalf("expected 2 updates of each chunk but got %v", updates)
+	}
+	if bt, ok := clientMod.GetBlockType(chunk.VoxelCoordinate{X: -1}); !ok || bt != chunk.BlockTypeStone {
+		t.Fatalf("expected stone but got %v", bt)
+	}
+	if clientMod.CountChunks() != 2 {
+		t.Fatalf("expected 2 chunks but got %v", clientMod.CountChunks())
+	}
+}
+
+// receive returns the next chunk sent on chunks, failing the test if none is
+// sent soon.
+func receive(t *testing.T, chunks chan chunk.Chunk) chunk.Chunk {
+	t.Helper()
+	select {
+	case ch := <-chunks:
+		return ch
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a chunk")
+		return chunk.Chunk{}
+	}
+}
+
+func TestClientMatchesFacesOfReceivedChunks(t *testing.T) {
+	t.Parallel()
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	go fakeServer(t, serverConn, protocol.Welcome{
+		Version:   protocol.Version,
+		PlayerID:  7,
+		ChunkSize: 1,
+	})
+	updated := make(chan chunk.Chunk, 10)
+	loaded := make(chan chunk.Chunk, 10)
+	clientMod, err := client.New(clientConn, "alice", &graphics.FnModule{
+		FnLoadChunk: func(ch chunk.Chunk) {
+			loaded <- ch
+		},
+		FnUpdateChunk: func(ch chunk.Chunk) {
+			updated <- ch
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientMod.Close()
+
+	left := chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: -1}, 1)
+	left.SetBlockType(chunk.VoxelCoordinate{X: -1}, chunk.BlockTypeStone)
+	right := chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: 0}, 1)
+	right.SetBlockType(chunk.VoxelCoordinate{X: 0}, chunk.BlockTypeDirt)
+	for _, ch := range []chunk.Chunk{left, right} {
+		if err := protocol.WriteMessage(serverConn, protocol.NewChunkData(ch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive(t, loaded)
+	rightLoaded := receive(t, loaded)
+	leftUpdated := receive(t, updated)
+
+	if leftUpdated.Position() != left.Position() {
+		t.Fatalf("expected chunk %v to be updated but got %v", left.Position(), leftUpdated.Position())
+	}
+	if adj := leftUpdated.Adjacency(chunk.VoxelCoordinate{X: -1}); adj&chunk.AdjacentRight == 0 {
+		t.Fatalf("expected the right face of the left chunk to be adjacent, but got %v", adj)
+	}
+	if adj := rightLoaded.Adjacency(chunk.VoxelCoordinate{X: 0}); adj&chunk.AdjacentLeft == 0 {
+		t.Fatalf("expected the left face of the right chunk to be adjacent, but got %v", adj)
+	}
+}
+
+func TestClientStopsOnProtocolError(t *testing.T) {
+	t.Parallel()
+	clientConn, serverConn := net.Pipe()
+	go fakeServer(t, serverConn, protocol.Welcome{Version: protocol.Version, ChunkSize: 1})
+	clientMod, err := client.New(clientConn, "alice", &graphics.FnModule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protocol.WriteMessage(serverConn, protocol.Welcome{Version: protocol.Version})
+	select {
+	case <-clientMod.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for client to stop")
+	}
+	if !errors.Is(clientMod.Err(), client.ErrProtocol) {
+		t.Fatalf("expected %v but got %v", client.ErrProtocol, clientMod.Err())
+	}
+	serverConn.Close()
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/protocol"
+)
+
+type core struct {
+	conn        net.Conn
+	graphicsMod graphics.Interface
+	welcome     protocol.Welcome
+	// writeMu keeps messages from interleaving on conn
+	writeMu sync.Mutex
+	// mu guards everything below, which the receiving goroutine changes
+	mu      sync.Mutex
+	chunks  map[chunk.ChunkCoordinate]chunk.Chunk
+	players map[uint32]Player
+	err     error
+	done    chan struct{}
+}
+
+func (c *core) send(msg protocol.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return protocol.WriteMessage(c.conn, msg)
+}
+
+// receive applies messages from the server until the connection ends.
+func (c *core) receive() {
+	var err error
+	for err == nil {
+		var msg protocol.Message
+		msg, err = protocol.ReadMessage(c.conn)
+		if err == nil {
+			err = c.apply(msg)
+		}
+	}
+	c.conn.Close()
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *core) apply(msg protocol.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch m := msg.(type) {
+	case protocol.ChunkData:
+		if m.Size != c.welcome.ChunkSize {
+			return fmt.Errorf("%w: chunk of size %v", ErrProtocol, m.Size)
+		}
+		ch := m.Chunk()
+		_, loaded := c.chunks[m.Pos]
+		c.chunks[m.Pos] = ch
+		c.matchNeighbors(ch)
+		if loaded {
+			c.graphicsMod.UpdateChunk(ch)
+		} else {
+			c.graphicsMod.LoadChunk(ch)
+		}
+	case protocol.ChunkUnload:
+		if _, ok := c.chunks[m.Pos]; ok {
+			delete(c.chunks, m.Pos)
+			c.graphicsMod.UnloadChunk(m.Pos)
+		}
+	case protocol.BlockDelta:
+		c.applyBlockDelta(m)
+	case protocol.PlayerPosition:
+		c.players[m.PlayerID] = Player{
+			Name:     m.Name,
+			Position: m.Position,
+			Rotation: m.Rotation,
+		}
+	case protocol.PlayerLeft:
+		delete(c.players, m.PlayerID)
+	default:
+		return fmt.Errorf("%w: unexpected %T", ErrProtocol, msg)
+	}
+	return nil
+}
+
+// applyBlockDelta changes a block in the chunks that were received, including
+// the faces of neighbors in other chunks.
+func (c *core) applyBlockDelta(m protocol.BlockDelta) {
+	cc := chunk.VoxelCoordToChunkCoord(m.VoxPos, c.welcome.ChunkSize)
+	ch, ok := c.chunks[cc]
+	if !ok {
+		return
+	}
+	actions := ch.SetBlockType(m.VoxPos, m.BlockType)
+	byChunk := map[chunk.ChunkCoordinate]*list.List{}
+	for action := actions.Front(); action != nil; action = action.Next() {
+		pa := action.Value.(chunk.PendingAction)
+		if _, ok := c.chunks[pa.ChPos]; !ok {
+			continue
+		}
+		if _, ok := byChunk[pa.ChPos]; !ok {
+			byChunk[pa.ChPos] = list.New()
+		}
+		byChunk[pa.ChPos].PushBack(pa)
+	}
+	c.graphicsMod.UpdateChunk(ch)
+	for neighbor, actions := range byChunk {
+		c.chunks[neighbor].ApplyActions(actions)
+		c.graphicsMod.UpdateChunk(c.chunks[neighbor])
+	}
+}
+
+// matchNeighbors sets the adjacency of the faces between ch and the chunks
+// next to it that were received, as the server doesn't send chunks again when
+// only their faces change.
+func (c *core) matchNeighbors(ch chunk.Chunk) {
+	pos := ch.Position()
+	sides := []chunk.ChunkCoordinate{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}, {Z: -1}, {Z: 1}}
+	for _, d := range sides {
+		neighbor, ok := c.chunks[chunk.ChunkCoordinate{X: pos.X + d.X, Y: pos.Y + d.Y, Z: pos.Z + d.Z}]
+		if !ok {
+			continue
+		}
+		if _, changed := ch.MatchAdjacency(neighbor); changed {
+			c.graphicsMod.UpdateChunk(neighbor)
+		}
+	}
+}
+
+func (c *core) getBlockType(vc chunk.VoxelCoordinate) (chunk.BlockType, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.chunks[chunk.VoxelCoordToChunkCoord(vc, c.welcome.ChunkSize)]
+	if !ok {
+		return chunk.BlockTypeAir, false
+	}
+	return ch.BlockType(vc), true
+}
+
+func (c *core) countChunks() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.chunks)
+}
+
+func (c *core) getPlayers() map[uint32]Player {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	players := make(map[uint32]Player, len(c.players))
+	for id, p := range c.players {
+		players[id] = p
+	}
+	return players
+}
+
+func (c *core) getErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
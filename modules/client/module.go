@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/protocol"
+)
+
+// Module is a connection to a multiplayer server. It keeps a copy of the
+// chunks in range of the player and shows them with a graphics module.
+type Module struct {
+	c *core
+}
+
+// New joins the server at the other end of conn under the given name. On
+// success, the module owns conn and must be closed.
+func New(conn net.Conn, name string, graphicsMod graphics.Interface) (*Module, error) {
+	if conn == nil {
+		panic("client received a nil connection")
+	}
+	if graphicsMod == nil {
+		panic("client received a nil graphics module")
+	}
+	err := protocol.WriteMessage(conn, protocol.Hello{
+		Version: protocol.Version,
+		Name:    name,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	msg, err := protocol.ReadMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var welcome protocol.Welcome
+	switch m := msg.(type) {
+	case protocol.Welcome:
+		welcome = m
+	case protocol.Reject:
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrRejected, m.Reason)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("%w: expected welcome but got %T", ErrProtocol, msg)
+	}
+	c := &core{
+		conn:        conn,
+		graphicsMod: graphicsMod,
+		welcome:     welcome,
+		chunks:      map[chunk.ChunkCoordinate]chunk.Chunk{},
+		players:     map[uint32]Player{},
+		done:        make(chan struct{}),
+	}
+	go c.receive()
+	return &Module{c}, nil
+}
@@ -3,13 +3,14 @@ package graphics
 import (
 	mgl "github.com/go-gl/mathgl/mgl64"
 	"github.com/kroppt/voxels/chunk"
-	"github.com/veandco/go-sdl2/sdl"
 )
 
+// Interface is what draws the world. It has no window events, so that
+// programs that don't draw, like the headless simulation and the tools, don't
+// need SDL.
 type Interface interface {
 	CreateWindow(title string) error
 	ShowWindow()
-	PollEvent() (sdl.Event, bool)
 	LoadChunk(chunk.Chunk)
 	UnloadChunk(chunk.ChunkCoordinate)
 	UpdateChunk(chunk.Chunk)
@@ -20,64 +21,9 @@ type Interface interface {
 	Close()
 }
 
-// CreateWindow creates an SDL window.
-func (m *Module) CreateWindow(title string) error {
-	return m.c.createWindow(title)
-}
-
-// ShowWindow makes the current window visible.
-func (m *Module) ShowWindow() {
-	m.c.showWindow()
-}
-
-// PollEvent returns the next event if present and whether it was present.
-func (m *Module) PollEvent() (sdl.Event, bool) {
-	return m.c.pollEvent()
-}
-
-// LoadChunk loads a chunk.
-func (m *Module) LoadChunk(chunk chunk.Chunk) {
-	m.c.loadChunk(chunk)
-}
-
-// UpdateChunk updates a chunk.
-func (m *Module) UpdateChunk(chunk chunk.Chunk) {
-	m.c.updateChunk(chunk)
-}
-
-// UnloadChunk unloads a chunk.
-func (m *Module) UnloadChunk(pos chunk.ChunkCoordinate) {
-	m.c.unloadChunk(pos)
-}
-
-// UpdateView updates what chunks the graphics module should
-// try to render.
-func (m *Module) UpdateView(viewableChunks map[chunk.ChunkCoordinate]struct{}, viewMat mgl.Mat4) {
-	m.c.updateView(viewableChunks, viewMat)
-}
-
-// UpdateSelection updates the currently selected voxel
-func (m *Module) UpdateSelection(selectedVoxel chunk.VoxelCoordinate, selected bool) {
-	m.c.updateSelection(selectedVoxel, selected)
-}
-
-// DestroyWindow destroys an SDL window.
-func (m *Module) DestroyWindow() error {
-	return m.c.destroyWindow()
-}
-
-func (m *Module) Render() {
-	m.c.render()
-}
-
-// Close does nothing.
-func (m *Module) Close() {
-}
-
 type FnModule struct {
 	FnCreateWindow    func(string)
 	FnShowWindow      func()
-	FnPollEvent       func() (sdl.Event, bool)
 	FnLoadChunk       func(chunk.Chunk)
 	FnUpdateChunk     func(chunk.Chunk)
 	FnUnloadChunk     func(chunk.ChunkCoordinate)
@@ -101,13 +47,6 @@ func (fn FnModule) ShowWindow() {
 	}
 }
 
-func (fn FnModule) PollEvent() (sdl.Event, bool) {
-	if fn.FnPollEvent != nil {
-		return fn.FnPollEvent()
-	}
-	return nil, false
-}
-
 func (fn FnModule) LoadChunk(chunk chunk.Chunk) {
 	if fn.FnLoadChunk != nil {
 		fn.FnLoadChunk(chunk)
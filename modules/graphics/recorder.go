@@ -0,0 +1,117 @@
+package graphics
+
+import (
+	"sync"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+)
+
+// Recording is what a Recorder was asked to do.
+type Recording struct {
+	ChunkLoads      int
+	ChunkUnloads    int
+	ChunkUpdates    int
+	ViewUpdates     int
+	SelectionsShown int
+	Renders         int
+	// LoadedChunks is how many chunks are loaded right now.
+	LoadedChunks int
+	// ViewableChunks is how many chunks were in view at the last view update.
+	ViewableChunks int
+}
+
+// Recorder is a graphics backend without a window or OpenGL context. It keeps
+// track of what it would have drawn, for running without a GPU.
+type Recorder struct {
+	mu        sync.Mutex
+	recording Recording
+	loaded    map[chunk.ChunkCoordinate]struct{}
+}
+
+// NewRecorder creates a graphics backend that only records calls.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		loaded: map[chunk.ChunkCoordinate]struct{}{},
+	}
+}
+
+// GetRecording returns what was recorded so far.
+func (r *Recorder) GetRecording() Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.recording
+	rec.LoadedChunks = len(r.loaded)
+	return rec
+}
+
+// CreateWindow does nothing.
+func (r *Recorder) CreateWindow(title string) error {
+	return nil
+}
+
+// ShowWindow does nothing.
+func (r *Recorder) ShowWindow() {
+}
+
+// LoadChunk records a chunk load.
+func (r *Recorder) LoadChunk(ch chunk.Chunk) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.loaded[ch.Position()]; ok {
+		panic("attempting to load over an already-loaded chunk")
+	}
+	r.loaded[ch.Position()] = struct{}{}
+	r.recording.ChunkLoads++
+}
+
+// UnloadChunk records a chunk unload.
+func (r *Recorder) UnloadChunk(pos chunk.ChunkCoordinate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.loaded[pos]; !ok {
+		panic("attempting to unload a chunk that is not loaded")
+	}
+	delete(r.loaded, pos)
+	r.recording.ChunkUnloads++
+}
+
+// UpdateChunk records a chunk update.
+func (r *Recorder) UpdateChunk(ch chunk.Chunk) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording.ChunkUpdates++
+}
+
+// UpdateView records a view update.
+func (r *Recorder) UpdateView(viewableChunks map[chunk.ChunkCoordinate]struct{}, viewMat mgl.Mat4) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording.ViewUpdates++
+	r.recording.ViewableChunks = len(viewableChunks)
+}
+
+// UpdateSelection records a selection update that shows a selection.
+func (r *Recorder) UpdateSelection(selectedVoxel chunk.VoxelCoordinate, selected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if selected {
+		r.recording.SelectionsShown++
+	}
+}
+
+// DestroyWindow does nothing.
+func (r *Recorder) DestroyWindow() error {
+	return nil
+}
+
+// Render records a frame.
+func (r *Recorder) Render() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording.Renders++
+}
+
+// Close does nothing.
+func (r *Recorder) Close() {
+}
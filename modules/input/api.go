@@ -9,6 +9,11 @@ func (m *Module) RouteEvents() bool {
 	return m.c.routeEvents()
 }
 
+// SetRecorder makes the module record the events it routes from now on.
+func (m *Module) SetRecorder(recorder *Recorder) {
+	m.c.recorder = recorder
+}
+
 // PixelsToRadians converts from pixels to radians in terms of camera rotation.
 func (m *Module) PixelsToRadians(xRel, yRel int32) (float64, float64) {
 	return m.c.pixelsToRadians(xRel, yRel)
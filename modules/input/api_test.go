@@ -1,13 +1,24 @@
 package input_test
 
 import (
+	"bytes"
+	"container/list"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
 	"github.com/kroppt/voxels/modules/camera"
-	"github.com/kroppt/voxels/modules/graphics"
 	"github.com/kroppt/voxels/modules/input"
 	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/renderer"
+	"github.com/kroppt/voxels/modules/script"
+	"github.com/kroppt/voxels/modules/tick"
+	"github.com/kroppt/voxels/modules/view"
+	"github.com/kroppt/voxels/modules/world"
 	"github.com/kroppt/voxels/repositories/settings"
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -32,16 +43,13 @@ func TestModuleRouteEvents(t *testing.T) {
 	t.Run("returns false on quit event", func(t *testing.T) {
 		t.Parallel()
 
-		graphicsMod := graphics.FnModule{
+		graphicsMod := renderer.FnModule{
 			FnPollEvent: func() (sdl.Event, bool) {
 				return &sdl.QuitEvent{
 					Type:      sdl.QUIT,
 					Timestamp: 0,
 				}, true
 			},
-			FnDestroyWindow: func() error {
-				return nil
-			},
 		}
 		mod := input.New(graphicsMod, nil, nil, nil)
 
@@ -55,13 +63,10 @@ func TestModuleRouteEvents(t *testing.T) {
 	t.Run("returns true after consuming all events", func(t *testing.T) {
 		t.Parallel()
 
-		graphicsMod := graphics.FnModule{
+		graphicsMod := renderer.FnModule{
 			FnPollEvent: func() (sdl.Event, bool) {
 				return nil, false
 			},
-			FnDestroyWindow: func() error {
-				return nil
-			},
 		}
 		mod := input.New(graphicsMod, nil, nil, nil)
 
@@ -200,7 +205,7 @@ func TestModuleRouteEvents(t *testing.T) {
 				Type:      sdl.QUIT,
 				Timestamp: 0,
 			}
-			graphicsMod := graphics.FnModule{
+			graphicsMod := renderer.FnModule{
 				FnPollEvent: func() (sdl.Event, bool) {
 					if first {
 						first = false
@@ -208,9 +213,6 @@ func TestModuleRouteEvents(t *testing.T) {
 					}
 					return &quitKeyboardEvent, true
 				},
-				FnDestroyWindow: func() error {
-					return nil
-				},
 			}
 
 			expectEvent := camera.MovementEvent{
@@ -287,7 +289,7 @@ func TestModuleRouteEvents(t *testing.T) {
 			}
 
 			first := true
-			graphicsMod := graphics.FnModule{
+			graphicsMod := renderer.FnModule{
 				FnPollEvent: func() (sdl.Event, bool) {
 					if first {
 						first = false
@@ -295,9 +297,6 @@ func TestModuleRouteEvents(t *testing.T) {
 					}
 					return &quitEvent, true
 				},
-				FnDestroyWindow: func() error {
-					return nil
-				},
 			}
 			var evtHandle *camera.LookEvent
 			cameraMod := &camera.FnModule{
@@ -368,7 +367,7 @@ func TestRouteScrollEventsToPlayer(t *testing.T) {
 				Y:         tC.amount,
 				Direction: 0,
 			}
-			graphicsMod := graphics.FnModule{
+			graphicsMod := renderer.FnModule{
 				FnPollEvent: func() (sdl.Event, bool) {
 					if first {
 						first = false
@@ -376,9 +375,6 @@ func TestRouteScrollEventsToPlayer(t *testing.T) {
 					}
 					return &quitEvent, true
 				},
-				FnDestroyWindow: func() error {
-					return nil
-				},
 			}
 			expected := player.ActionEvent{
 				Scroll: tC.scrollDir,
@@ -419,7 +415,7 @@ func TestMouseMotionOnlyPassedToCameraIfM1Held(t *testing.T) {
 	}
 
 	first := true
-	graphicsMod := graphics.FnModule{
+	graphicsMod := renderer.FnModule{
 		FnPollEvent: func() (sdl.Event, bool) {
 			if first {
 				first = false
@@ -540,3 +536,240 @@ func TestModulePixelsToRadians(t *testing.T) {
 		})
 	}
 }
+
+func TestRecorderWritesEventsWithTick(t *testing.T) {
+	t.Parallel()
+	events := []sdl.Event{
+		&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_A}},
+		&sdl.MouseWheelEvent{Y: -1},
+	}
+	graphicsMod := renderer.FnModule{
+		FnPollEvent: func() (sdl.Event, bool) {
+			if len(events) == 0 {
+				return nil, false
+			}
+			evt := events[0]
+			events = events[1:]
+			return evt, true
+		},
+	}
+	var movements []camera.MovementEvent
+	cameraMod := &camera.FnModule{
+		FnHandleMovementEvent: func(evt camera.MovementEvent) {
+			movements = append(movements, evt)
+		},
+	}
+	var buf strings.Builder
+	recorder := input.NewRecorder(&buf, tick.FnModule{
+		FnGetTick: func() int { return 42 },
+	}, script.Start{
+		Position:  player.PositionEvent{X: 0.5, Y: -2, Z: 1e9},
+		Rotation:  mgl.QuatIdent(),
+		Seed:      -7,
+		Generator: "flat",
+	})
+	mod := input.New(graphicsMod, cameraMod, nil, &player.FnModule{})
+	mod.SetRecorder(recorder)
+
+	mod.RouteEvents()
+
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "start 0.5 -2 1e+09 1 0 0 0 -7 flat\n42 press left\n42 scroll down\n"
+	if buf.String() != expect {
+		t.Fatalf("expected recording %q but got %q", expect, buf.String())
+	}
+	if len(movements) != 1 {
+		t.Fatalf("expected recorded events to still be routed, but got %v", movements)
+	}
+}
+
+type game struct {
+	cameraMod camera.Interface
+	playerMod player.Interface
+	worldMod  *world.Module
+}
+
+func newGame() game {
+	settingsRepo := &settings.FnRepository{
+		FnGetChunkSize:      func() uint32 { return 4 },
+		FnGetRenderDistance: func() uint32 { return 1 },
+		FnGetFOV:            func() float64 { return 60 },
+		FnGetResolution:     func() (uint32, uint32) { return 1280, 720 },
+	}
+	generator := &world.FnGenerator{
+		FnGenerateChunk: func(pos chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(pos, 4)
+			actions := list.New()
+			if pos.Y < 0 {
+				ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+					actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeDirt))
+				})
+			}
+			return ch, actions
+		},
+	}
+	graphicsMod := &renderer.FnModule{}
+	viewMod := view.New(graphicsMod, settingsRepo)
+	worldMod := world.New(graphicsMod, generator, settingsRepo, &cache.FnModule{}, viewMod)
+	playerMod := player.New(worldMod, settingsRepo, viewMod)
+	cameraMod := camera.New(playerMod, player.PositionEvent{X: 0.5, Y: 1.5, Z: 0.5})
+	return game{cameraMod, playerMod, worldMod}
+}
+
+// state returns what a replay must reproduce: where the camera is and the
+// blocks near the start.
+func (g game) state() (player.PositionEvent, mgl.Quat, []chunk.BlockType) {
+	var blocks []chunk.BlockType
+	for x := int32(-4); x < 4; x++ {
+		for y := int32(-4); y < 4; y++ {
+			for z := int32(-4); z < 4; z++ {
+				blocks = append(blocks, g.worldMod.GetBlockType(chunk.VoxelCoordinate{X: x, Y: y, Z: z}))
+			}
+		}
+	}
+	return g.cameraMod.GetPosition(), g.cameraMod.GetRotation(), blocks
+}
+
+func TestReplayGivesSameResult(t *testing.T) {
+	t.Parallel()
+	eventsByTick := map[int][]sdl.Event{
+		0: {
+			&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_W}},
+			&sdl.MouseMotionEvent{State: sdl.BUTTON_LEFT, XRel: 37, YRel: 420},
+		},
+		2: {&sdl.KeyboardEvent{Type: sdl.KEYUP, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_W}}},
+		3: {&sdl.MouseWheelEvent{Y: -1}},
+		5: {&sdl.MouseWheelEvent{Y: 1}},
+		6: {&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_D}}},
+	}
+	recorded := newGame()
+	var pending []sdl.Event
+	graphicsMod := renderer.FnModule{
+		FnPollEvent: func() (sdl.Event, bool) {
+			if len(pending) == 0 {
+				return nil, false
+			}
+			evt := pending[0]
+			pending = pending[1:]
+			return evt, true
+		},
+	}
+	settingsRepo := &settings.FnRepository{
+		FnGetFOV:        func() float64 { return 60 },
+		FnGetResolution: func() (uint32, uint32) { return 1280, 720 },
+	}
+	tickMod := tick.New(recorded.cameraMod, recorded.worldMod, tick.FnTime{}, 1)
+	var recording bytes.Buffer
+	recorder := input.NewRecorder(&recording, tickMod, script.Start{
+		Position:  recorded.cameraMod.GetPosition(),
+		Rotation:  recorded.cameraMod.GetRotation(),
+		Generator: "flat",
+	})
+	inputMod := input.New(graphicsMod, recorded.cameraMod, settingsRepo, recorded.playerMod)
+	inputMod.SetRecorder(recorder)
+	for tickMod.GetTick() <= 6 {
+		pending = eventsByTick[tickMod.GetTick()]
+		inputMod.RouteEvents()
+		tickMod.AdvanceTick()
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expectPos, expectRot, expectBlocks := recorded.state()
+	var withoutActions []string
+	for _, line := range strings.SplitAfter(recording.String(), "\n") {
+		if !strings.Contains(line, "scroll") {
+			withoutActions = append(withoutActions, line)
+		}
+	}
+	unedited := newGame()
+	replay, err := input.NewReplay(strings.NewReader(strings.Join(withoutActions, "")), unedited.cameraMod, unedited.playerMod, unedited.worldMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.Run()
+	if _, _, blocks := unedited.state(); reflect.DeepEqual(blocks, expectBlocks) {
+		t.Fatal("expected the recorded actions to edit blocks, but they didn't")
+	}
+
+	for i := 0; i < 2; i++ {
+		replayed := newGame()
+		replay, err := input.NewReplay(bytes.NewReader(recording.Bytes()), replayed.cameraMod, replayed.playerMod, replayed.worldMod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replay.Run()
+
+		if replay.GetTick() != tickMod.GetTick() {
+			t.Fatalf("expected replay to end on tick %v but got %v", tickMod.GetTick(), replay.GetTick())
+		}
+		pos, rot, blocks := replayed.state()
+		if pos != expectPos {
+			t.Fatalf("expected position %v but got %v", expectPos, pos)
+		}
+		if rot != expectRot {
+			t.Fatalf("expected rotation %v but got %v", expectRot, rot)
+		}
+		if !reflect.DeepEqual(blocks, expectBlocks) {
+			t.Fatal("expected replay to give the same blocks, but it didn't")
+		}
+	}
+}
+
+func TestReplayStartsFromRecordedPose(t *testing.T) {
+	t.Parallel()
+	recorded := newGame()
+	recorded.cameraMod.Teleport(player.PositionEvent{X: 2.5, Y: 3, Z: -1.5}, mgl.QuatRotate(1, mgl.Vec3{0, 1, 0}))
+	var pending []sdl.Event
+	graphicsMod := renderer.FnModule{
+		FnPollEvent: func() (sdl.Event, bool) {
+			if len(pending) == 0 {
+				return nil, false
+			}
+			evt := pending[0]
+			pending = pending[1:]
+			return evt, true
+		},
+	}
+	settingsRepo := &settings.FnRepository{
+		FnGetFOV:        func() float64 { return 60 },
+		FnGetResolution: func() (uint32, uint32) { return 1280, 720 },
+	}
+	tickMod := tick.New(recorded.cameraMod, recorded.worldMod, tick.FnTime{}, 1)
+	var recording bytes.Buffer
+	recorder := input.NewRecorder(&recording, tickMod, script.Start{
+		Position:  recorded.cameraMod.GetPosition(),
+		Rotation:  recorded.cameraMod.GetRotation(),
+		Generator: "flat",
+	})
+	inputMod := input.New(graphicsMod, recorded.cameraMod, settingsRepo, recorded.playerMod)
+	inputMod.SetRecorder(recorder)
+	pending = []sdl.Event{
+		&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_W}},
+		&sdl.KeyboardEvent{Type: sdl.KEYUP, Keysym: sdl.Keysym{Scancode: sdl.SCANCODE_W}},
+		&sdl.MouseMotionEvent{State: sdl.BUTTON_LEFT, XRel: -12, YRel: 30},
+	}
+	inputMod.RouteEvents()
+	tickMod.AdvanceTick()
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expectPos, expectRot, _ := recorded.state()
+
+	replayed := newGame()
+	replay, err := input.NewReplay(bytes.NewReader(recording.Bytes()), replayed.cameraMod, replayed.playerMod, replayed.worldMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.Run()
+
+	pos, rot, _ := replayed.state()
+	if pos != expectPos {
+		t.Fatalf("expected position %v but got %v", expectPos, pos)
+	}
+	if rot != expectRot {
+		t.Fatalf("expected rotation %v but got %v", expectRot, rot)
+	}
+}
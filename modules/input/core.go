@@ -4,17 +4,18 @@ import (
 	"math"
 
 	"github.com/kroppt/voxels/modules/camera"
-	"github.com/kroppt/voxels/modules/graphics"
 	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/renderer"
 	"github.com/kroppt/voxels/repositories/settings"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 type core struct {
-	graphicsMod  graphics.Interface
+	graphicsMod  renderer.Interface
 	cameraMod    camera.Interface
 	settingsRepo settings.Interface
 	playerMod    player.Interface
+	recorder     *Recorder
 	quit         bool
 }
 
@@ -42,37 +43,37 @@ func (m *core) routeEvent(e sdl.Event) {
 				Direction: camera.MoveForwards,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(forward)
+			m.handleMovement(forward)
 		case sdl.SCANCODE_D:
 			right := camera.MovementEvent{
 				Direction: camera.MoveRight,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(right)
+			m.handleMovement(right)
 		case sdl.SCANCODE_S:
 			back := camera.MovementEvent{
 				Direction: camera.MoveBackwards,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(back)
+			m.handleMovement(back)
 		case sdl.SCANCODE_A:
 			left := camera.MovementEvent{
 				Direction: camera.MoveLeft,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(left)
+			m.handleMovement(left)
 		case sdl.SCANCODE_SPACE:
 			up := camera.MovementEvent{
 				Direction: camera.MoveUp,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(up)
+			m.handleMovement(up)
 		case sdl.SCANCODE_LSHIFT:
 			down := camera.MovementEvent{
 				Direction: camera.MoveDown,
 				Pressed:   pressed,
 			}
-			m.cameraMod.HandleMovementEvent(down)
+			m.handleMovement(down)
 		}
 
 	case *sdl.MouseMotionEvent:
@@ -82,18 +83,39 @@ func (m *core) routeEvent(e sdl.Event) {
 			Down:  yRad,
 		}
 		if evt.State == sdl.BUTTON_LEFT {
-			m.cameraMod.HandleLookEvent(lookEvt)
+			m.handleLook(lookEvt)
 		}
 	case *sdl.MouseWheelEvent:
 		if evt.Y < 0 {
-			m.playerMod.UpdatePlayerAction(player.ActionEvent{Scroll: player.ScrollDown})
+			m.handleAction(player.ActionEvent{Scroll: player.ScrollDown})
 		} else {
-			m.playerMod.UpdatePlayerAction(player.ActionEvent{Scroll: player.ScrollUp})
+			m.handleAction(player.ActionEvent{Scroll: player.ScrollUp})
 		}
 	}
 
 }
 
+func (m *core) handleMovement(evt camera.MovementEvent) {
+	if m.recorder != nil {
+		m.recorder.recordMovement(evt)
+	}
+	m.cameraMod.HandleMovementEvent(evt)
+}
+
+func (m *core) handleLook(evt camera.LookEvent) {
+	if m.recorder != nil {
+		m.recorder.recordLook(evt)
+	}
+	m.cameraMod.HandleLookEvent(evt)
+}
+
+func (m *core) handleAction(evt player.ActionEvent) {
+	if m.recorder != nil {
+		m.recorder.recordAction(evt)
+	}
+	m.playerMod.UpdatePlayerAction(evt)
+}
+
 func (m *core) pixelsToRadians(xRel, yRel int32) (float64, float64) {
 	const nearDistance = 0.1
 	fovY := m.settingsRepo.GetFOV() * math.Pi / 180
@@ -2,8 +2,8 @@ package input
 
 import (
 	"github.com/kroppt/voxels/modules/camera"
-	"github.com/kroppt/voxels/modules/graphics"
 	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/renderer"
 	"github.com/kroppt/voxels/repositories/settings"
 )
 
@@ -14,7 +14,7 @@ type Module struct {
 
 // New creates a synchronous input module.
 func New(
-	graphicsMod graphics.Interface,
+	graphicsMod renderer.Interface,
 	cameraMod camera.Interface,
 	settingsRepo settings.Interface,
 	playerMod player.Interface,
@@ -0,0 +1,49 @@
+package input
+
+import (
+	"io"
+
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/script"
+	"github.com/kroppt/voxels/modules/tick"
+)
+
+// Recorder writes the events that the input module routes, along with the
+// tick they happened on, as a script that Replay plays back.
+type Recorder struct {
+	writer  *script.Writer
+	tickMod tick.Interface
+}
+
+// NewRecorder creates a recorder that writes to w and takes the tick from
+// tickMod. The recording starts with start, so that a replay begins from the
+// same camera pose in the same world.
+func NewRecorder(w io.Writer, tickMod tick.Interface, start script.Start) *Recorder {
+	if tickMod == nil {
+		panic("recorder received a nil tick module")
+	}
+	writer := script.NewWriter(w)
+	writer.WriteStart(start)
+	return &Recorder{
+		writer:  writer,
+		tickMod: tickMod,
+	}
+}
+
+// Err returns the first error that happened while writing, if any.
+func (r *Recorder) Err() error {
+	return r.writer.Err()
+}
+
+func (r *Recorder) recordMovement(evt camera.MovementEvent) {
+	r.writer.WriteMovement(r.tickMod.GetTick(), evt)
+}
+
+func (r *Recorder) recordLook(evt camera.LookEvent) {
+	r.writer.WriteLook(r.tickMod.GetTick(), evt)
+}
+
+func (r *Recorder) recordAction(evt player.ActionEvent) {
+	r.writer.WriteAction(r.tickMod.GetTick(), evt)
+}
@@ -0,0 +1,76 @@
+package input
+
+import (
+	"io"
+	"time"
+
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/script"
+	"github.com/kroppt/voxels/modules/tick"
+	"github.com/kroppt/voxels/modules/world"
+)
+
+// replayTickRateNano is the tick rate of a replay. Since the clock of a
+// replay only moves when it is told to, the rate doesn't change the result.
+const replayTickRateNano = int64(1 * 1e6)
+
+// Replay plays back a recording made by a Recorder. Events are sent on the
+// tick they were recorded on, before that tick is advanced, like the game
+// loop does. The tick module runs on a fake clock, so the same recording
+// played against the same world always gives the same result.
+type Replay struct {
+	scriptMod *script.Module
+	tickMod   *tick.Module
+	now       time.Time
+}
+
+// NewReplay reads a recording to play back to the given modules. If the
+// recording says where it starts from, the camera is moved there before the
+// first tick. The world isn't checked against the one it was recorded in.
+func NewReplay(
+	reader io.Reader,
+	cameraMod camera.Interface,
+	playerMod player.Interface,
+	worldMod world.Interface,
+) (*Replay, error) {
+	scriptMod := script.New(cameraMod, playerMod, worldMod)
+	if err := scriptMod.Load(reader); err != nil {
+		return nil, err
+	}
+	if start, ok := scriptMod.GetStart(); ok {
+		cameraMod.Teleport(start.Position, start.Rotation)
+	}
+	r := &Replay{
+		scriptMod: scriptMod,
+		now:       time.Unix(0, 0),
+	}
+	r.tickMod = tick.New(cameraMod, worldMod, tick.FnTime{
+		FnNow: func() time.Time {
+			return r.now
+		},
+	}, replayTickRateNano)
+	return r, nil
+}
+
+// Step sends the events of the current tick and advances it.
+func (r *Replay) Step() {
+	r.scriptMod.RunTick(r.tickMod.GetTick())
+	r.now = r.now.Add(time.Duration(replayTickRateNano))
+	if !r.tickMod.IsNextTickReady() {
+		panic("replay clock fell behind the tick rate")
+	}
+	r.tickMod.AdvanceTick()
+}
+
+// Run steps until every recorded event was sent.
+func (r *Replay) Run() {
+	for r.tickMod.GetTick() <= r.scriptMod.GetLastTick() {
+		r.Step()
+	}
+}
+
+// GetTick returns the tick the replay is on.
+func (r *Replay) GetTick() int {
+	return r.tickMod.GetTick()
+}
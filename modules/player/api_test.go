@@ -245,6 +245,74 @@ func TestModuleUpdatePlayerPosition(t *testing.T) {
 	})
 }
 
+func TestModuleUpdatePlayerPositionUnloadDistance(t *testing.T) {
+	t.Parallel()
+	const chunkSize = 10
+	settingsMod := settings.FnRepository{
+		FnGetRenderDistance: func() uint32 {
+			return 2
+		},
+		FnGetUnloadDistance: func() uint32 {
+			return 3
+		},
+		FnGetChunkSize: func() uint32 {
+			return chunkSize
+		},
+	}
+
+	t.Run("moving back and forth over a chunk border doesn't reload chunks", func(t *testing.T) {
+		t.Parallel()
+		worldMod := &world.FnModule{}
+		playerMod := player.New(worldMod, settingsMod, &view.FnModule{})
+		playerMod.UpdatePlayerPosition(player.PositionEvent{X: 5, Y: 0, Z: 0})
+		playerMod.UpdatePlayerPosition(player.PositionEvent{X: chunkSize + 5, Y: 0, Z: 0})
+		loads := 0
+		unloads := 0
+		worldMod.FnLoadChunk = func(chunk.ChunkCoordinate) {
+			loads++
+		}
+		worldMod.FnUnloadChunk = func(chunk.ChunkCoordinate) {
+			unloads++
+		}
+
+		for i := 0; i < 5; i++ {
+			playerMod.UpdatePlayerPosition(player.PositionEvent{X: 5, Y: 0, Z: 0})
+			playerMod.UpdatePlayerPosition(player.PositionEvent{X: chunkSize + 5, Y: 0, Z: 0})
+		}
+
+		if loads != 0 {
+			t.Fatalf("expected no chunks to be loaded again, but %v were", loads)
+		}
+		if unloads != 0 {
+			t.Fatalf("expected no chunks to be unloaded, but %v were", unloads)
+		}
+	})
+
+	t.Run("chunks past the unload distance are unloaded", func(t *testing.T) {
+		t.Parallel()
+		expected := map[chunk.ChunkCoordinate]struct{}{}
+		for y := int32(-2); y <= 2; y++ {
+			for z := int32(-2); z <= 2; z++ {
+				expected[chunk.ChunkCoordinate{X: -2, Y: y, Z: z}] = struct{}{}
+			}
+		}
+		worldMod := &world.FnModule{}
+		playerMod := player.New(worldMod, settingsMod, &view.FnModule{})
+		playerMod.UpdatePlayerPosition(player.PositionEvent{X: 5, Y: 0, Z: 0})
+		playerMod.UpdatePlayerPosition(player.PositionEvent{X: chunkSize + 5, Y: 0, Z: 0})
+		actual := map[chunk.ChunkCoordinate]struct{}{}
+		worldMod.FnUnloadChunk = func(pos chunk.ChunkCoordinate) {
+			actual[pos] = struct{}{}
+		}
+
+		playerMod.UpdatePlayerPosition(player.PositionEvent{X: 2*chunkSize + 5, Y: 0, Z: 0})
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected to unload %v but got %v", expected, actual)
+		}
+	})
+}
+
 func TestUpdateViewWithoutPos(t *testing.T) {
 	t.Parallel()
 	viewMod := &view.FnModule{
@@ -8,15 +8,14 @@ import (
 )
 
 type core struct {
-	worldMod     world.Interface
-	settingsMod  settings.Interface
-	viewMod      view.Interface
-	lastChunkPos chunk.ChunkCoordinate
-	posAssigned  bool
-	position     PositionEvent
-	dirAssigned  bool
-	direction    DirectionEvent
-	firstLoad    bool
+	worldMod    world.Interface
+	settingsMod settings.Interface
+	viewMod     view.Interface
+	loaded      map[chunk.ChunkCoordinate]struct{}
+	posAssigned bool
+	position    PositionEvent
+	dirAssigned bool
+	direction   DirectionEvent
 }
 
 // chunkRange is the range of chunks between Min and Max.
@@ -82,49 +81,46 @@ func (c *core) viewState() view.ViewState {
 	}
 }
 
-func (c *core) updatePosition(posEvent PositionEvent) {
-	newChunkPos := chunk.VoxelCoordToChunkCoord(toVoxelPos(posEvent), c.settingsMod.GetChunkSize())
-	renderDistance := int32(c.settingsMod.GetRenderDistance())
-	old := chunkRange{
-		Min: chunk.ChunkCoordinate{
-			X: c.lastChunkPos.X - renderDistance,
-			Y: c.lastChunkPos.Y - renderDistance,
-			Z: c.lastChunkPos.Z - renderDistance,
-		},
-		Max: chunk.ChunkCoordinate{
-			X: c.lastChunkPos.X + renderDistance,
-			Y: c.lastChunkPos.Y + renderDistance,
-			Z: c.lastChunkPos.Z + renderDistance,
-		},
-	}
-	new := chunkRange{
+// rangeAround returns the chunks within distance chunks of pos.
+func rangeAround(pos chunk.ChunkCoordinate, distance int32) chunkRange {
+	return chunkRange{
 		Min: chunk.ChunkCoordinate{
-			X: newChunkPos.X - renderDistance,
-			Y: newChunkPos.Y - renderDistance,
-			Z: newChunkPos.Z - renderDistance,
+			X: pos.X - distance,
+			Y: pos.Y - distance,
+			Z: pos.Z - distance,
 		},
 		Max: chunk.ChunkCoordinate{
-			X: newChunkPos.X + renderDistance,
-			Y: newChunkPos.Y + renderDistance,
-			Z: newChunkPos.Z + renderDistance,
+			X: pos.X + distance,
+			Y: pos.Y + distance,
+			Z: pos.Z + distance,
 		},
 	}
-	new.forEach(func(pos chunk.ChunkCoordinate) bool {
-		if !old.contains(pos) || c.firstLoad {
+}
+
+func (c *core) updatePosition(posEvent PositionEvent) {
+	newChunkPos := chunk.VoxelCoordToChunkCoord(toVoxelPos(posEvent), c.settingsMod.GetChunkSize())
+	renderDistance := int32(c.settingsMod.GetRenderDistance())
+	// chunks stay loaded a little past the render distance, so moving back and
+	// forth over a chunk border doesn't unload and reload them every time
+	unloadDistance := int32(c.settingsMod.GetUnloadDistance())
+	if unloadDistance < renderDistance {
+		unloadDistance = renderDistance
+	}
+	render := rangeAround(newChunkPos, renderDistance)
+	keep := rangeAround(newChunkPos, unloadDistance)
+	render.forEach(func(pos chunk.ChunkCoordinate) bool {
+		if _, ok := c.loaded[pos]; !ok {
 			c.worldMod.LoadChunk(pos)
+			c.loaded[pos] = struct{}{}
 		}
 		return false
 	})
-	old.forEach(func(pos chunk.ChunkCoordinate) bool {
-		if !new.contains(pos) && !c.firstLoad {
+	for pos := range c.loaded {
+		if !keep.contains(pos) {
 			c.worldMod.UnloadChunk(pos)
+			delete(c.loaded, pos)
 		}
-		return false
-	})
-	if c.firstLoad {
-		c.firstLoad = false
 	}
-	c.lastChunkPos = newChunkPos
 
 	c.posAssigned = true
 	c.position = posEvent
@@ -1,6 +1,7 @@
 package player
 
 import (
+	"github.com/kroppt/voxels/chunk"
 	"github.com/kroppt/voxels/modules/view"
 	"github.com/kroppt/voxels/modules/world"
 	"github.com/kroppt/voxels/repositories/settings"
@@ -26,7 +27,7 @@ func New(worldMod world.Interface, settingsMod settings.Interface, viewMod view.
 		worldMod:    worldMod,
 		settingsMod: settingsMod,
 		viewMod:     viewMod,
-		firstLoad:   true,
+		loaded:      map[chunk.ChunkCoordinate]struct{}{},
 	}
 	return &Module{
 		core,
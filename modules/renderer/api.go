@@ -0,0 +1,82 @@
+package renderer
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Interface is a graphics module with an SDL window, which is also where
+// input events come from.
+type Interface interface {
+	graphics.Interface
+	PollEvent() (sdl.Event, bool)
+}
+
+// CreateWindow creates an SDL window.
+func (m *Module) CreateWindow(title string) error {
+	return m.c.createWindow(title)
+}
+
+// ShowWindow makes the current window visible.
+func (m *Module) ShowWindow() {
+	m.c.showWindow()
+}
+
+// PollEvent returns the next event if present and whether it was present.
+func (m *Module) PollEvent() (sdl.Event, bool) {
+	return m.c.pollEvent()
+}
+
+// LoadChunk loads a chunk.
+func (m *Module) LoadChunk(chunk chunk.Chunk) {
+	m.c.loadChunk(chunk)
+}
+
+// UpdateChunk updates a chunk.
+func (m *Module) UpdateChunk(chunk chunk.Chunk) {
+	m.c.updateChunk(chunk)
+}
+
+// UnloadChunk unloads a chunk.
+func (m *Module) UnloadChunk(pos chunk.ChunkCoordinate) {
+	m.c.unloadChunk(pos)
+}
+
+// UpdateView updates what chunks the graphics module should
+// try to render.
+func (m *Module) UpdateView(viewableChunks map[chunk.ChunkCoordinate]struct{}, viewMat mgl.Mat4) {
+	m.c.updateView(viewableChunks, viewMat)
+}
+
+// UpdateSelection updates the currently selected voxel
+func (m *Module) UpdateSelection(selectedVoxel chunk.VoxelCoordinate, selected bool) {
+	m.c.updateSelection(selectedVoxel, selected)
+}
+
+// DestroyWindow destroys an SDL window.
+func (m *Module) DestroyWindow() error {
+	return m.c.destroyWindow()
+}
+
+func (m *Module) Render() {
+	m.c.render()
+}
+
+// Close does nothing.
+func (m *Module) Close() {
+}
+
+// FnModule is a graphics.FnModule that can also poll events.
+type FnModule struct {
+	graphics.FnModule
+	FnPollEvent func() (sdl.Event, bool)
+}
+
+func (fn FnModule) PollEvent() (sdl.Event, bool) {
+	if fn.FnPollEvent != nil {
+		return fn.FnPollEvent()
+	}
+	return nil, false
+}
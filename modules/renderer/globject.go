@@ -1,4 +1,4 @@
-package graphics
+package renderer
 
 import (
 	"github.com/go-gl/gl/v2.1/gl"
@@ -1,4 +1,4 @@
-package graphics
+package renderer
 
 import (
 	mgl "github.com/go-gl/mathgl/mgl64"
@@ -1,4 +1,4 @@
-package graphics
+package renderer
 
 const vertCrossShader = `
 #version 420 core
@@ -0,0 +1,108 @@
+package script
+
+import (
+	"io"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/player"
+)
+
+type Interface interface {
+	Load(reader io.Reader) error
+	RunTick(tick int)
+	GetLastTick() int
+	GetStart() (Start, bool)
+}
+
+// Start is where a script starts from: the camera pose before the first tick,
+// and the world it was made in.
+type Start struct {
+	Position  player.PositionEvent
+	Rotation  mgl.Quat
+	Seed      int64
+	Generator string
+}
+
+// ErrSyntax indicates that a script line could not be parsed.
+const ErrSyntax log.ConstErr = "script syntax is invalid"
+
+// Load adds the commands of a script to the ones already loaded.
+//
+// Every line is a tick number followed by a command:
+//
+//	<tick> press <direction>
+//	<tick> release <direction>
+//	<tick> look <right> <down>
+//	<tick> scroll up|down
+//	<tick> add <x> <y> <z> <block type>
+//	<tick> remove <x> <y> <z>
+//
+// Directions and block types are named as they are printed. Empty lines and
+// lines starting with # are ignored. A script may also have one line without
+// a tick that gives where it starts from, with the rotation as a quaternion:
+//
+//	start <x> <y> <z> <w> <i> <j> <k> <seed> <generator>
+func (m *Module) Load(reader io.Reader) error {
+	return m.c.load(reader)
+}
+
+// ReadStart reads where the script in reader starts from, without loading its
+// commands. It returns false if the script has no start line.
+func ReadStart(reader io.Reader) (Start, bool, error) {
+	c := core{commands: map[int][]command{}, lastTick: -1}
+	if err := c.load(reader); err != nil {
+		return Start{}, false, err
+	}
+	return c.start, c.hasStart, nil
+}
+
+// RunTick runs the commands of the given tick, in the order they were loaded.
+func (m *Module) RunTick(tick int) {
+	m.c.runTick(tick)
+}
+
+// GetLastTick returns the tick of the last command, or -1 if there are none.
+func (m *Module) GetLastTick() int {
+	return m.c.lastTick
+}
+
+// GetStart returns where the loaded scripts start from, or false if none of
+// them had a start line.
+func (m *Module) GetStart() (Start, bool) {
+	return m.c.start, m.c.hasStart
+}
+
+type FnModule struct {
+	FnLoad        func(reader io.Reader) error
+	FnRunTick     func(tick int)
+	FnGetLastTick func() int
+	FnGetStart    func() (Start, bool)
+}
+
+func (fn FnModule) Load(reader io.Reader) error {
+	if fn.FnLoad != nil {
+		return fn.FnLoad(reader)
+	}
+	return nil
+}
+
+func (fn FnModule) RunTick(tick int) {
+	if fn.FnRunTick != nil {
+		fn.FnRunTick(tick)
+	}
+}
+
+func (fn FnModule) GetLastTick() int {
+	if fn.FnGetLastTick != nil {
+		return fn.FnGetLastTick()
+	}
+	return -1
+}
+
+func (fn FnModule) GetStart() (Start, bool) {
+	if fn.FnGetStart != nil {
+		return fn.FnGetStart()
+	}
+	return Start{}, false
+}
@@ -0,0 +1,312 @@
+package script_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/script"
+	"github.com/kroppt/voxels/modules/world"
+)
+
+func TestModuleNew(t *testing.T) {
+	t.Parallel()
+
+	t.Run("return is non-nil", func(t *testing.T) {
+		t.Parallel()
+		if script.New(&camera.FnModule{}, &player.FnModule{}, &world.FnModule{}) == nil {
+			t.Fatal("expected non-nil return")
+		}
+	})
+
+	t.Run("panic on nil camera", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatal("expected panic, but didn't")
+			}
+		}()
+		script.New(nil, &player.FnModule{}, &world.FnModule{})
+	})
+
+	t.Run("panic on nil world", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatal("expected panic, but didn't")
+			}
+		}()
+		script.New(&camera.FnModule{}, &player.FnModule{}, nil)
+	})
+
+	t.Run("panic on nil player", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatal("expected panic, but didn't")
+			}
+		}()
+		script.New(&camera.FnModule{}, nil, &world.FnModule{})
+	})
+}
+
+func TestScriptRunsCommandsOfTick(t *testing.T) {
+	t.Parallel()
+	var movements []camera.MovementEvent
+	var looks []camera.LookEvent
+	cameraMod := &camera.FnModule{
+		FnHandleMovementEvent: func(evt camera.MovementEvent) {
+			movements = append(movements, evt)
+		},
+		FnHandleLookEvent: func(evt camera.LookEvent) {
+			looks = append(looks, evt)
+		},
+	}
+	scriptMod := script.New(cameraMod, &player.FnModule{}, &world.FnModule{})
+	err := scriptMod.Load(strings.NewReader(strings.Join([]string{
+		"# walk forwards while looking around",
+		"2 press forwards",
+		"",
+		"2 look 1.5 -2",
+		"5 release forwards",
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptMod.RunTick(0)
+	scriptMod.RunTick(1)
+	scriptMod.RunTick(2)
+
+	expectMovements := []camera.MovementEvent{{Direction: camera.MoveForwards, Pressed: true}}
+	if !reflect.DeepEqual(movements, expectMovements) {
+		t.Fatalf("expected movements %v but got %v", expectMovements, movements)
+	}
+	expectLooks := []camera.LookEvent{{Right: 1.5, Down: -2}}
+	if !reflect.DeepEqual(looks, expectLooks) {
+		t.Fatalf("expected looks %v but got %v", expectLooks, looks)
+	}
+	if last := scriptMod.GetLastTick(); last != 5 {
+		t.Fatalf("expected last tick 5 but got %v", last)
+	}
+}
+
+func TestScriptEditsOnlyLoadedVoxels(t *testing.T) {
+	t.Parallel()
+	loaded := chunk.VoxelCoordinate{X: 1, Y: -2, Z: 3}
+	var added []chunk.VoxelCoordinate
+	var addedTypes []chunk.BlockType
+	var removed []chunk.VoxelCoordinate
+	worldMod := &world.FnModule{
+		FnIsVoxelLoaded: func(vc chunk.VoxelCoordinate) bool {
+			return vc == loaded
+		},
+		FnAddBlock: func(vc chunk.VoxelCoordinate, bt chunk.BlockType) {
+			added = append(added, vc)
+			addedTypes = append(addedTypes, bt)
+		},
+		FnRemoveBlock: func(vc chunk.VoxelCoordinate) {
+			removed = append(removed, vc)
+		},
+	}
+	scriptMod := script.New(&camera.FnModule{}, &player.FnModule{}, worldMod)
+	err := scriptMod.Load(strings.NewReader(strings.Join([]string{
+		"0 add 1 -2 3 sand",
+		"0 add 100 0 0 sand",
+		"1 remove 1 -2 3",
+		"1 remove 100 0 0",
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptMod.RunTick(0)
+	scriptMod.RunTick(1)
+
+	if !reflect.DeepEqual(added, []chunk.VoxelCoordinate{loaded}) {
+		t.Fatalf("expected to add at %v but got %v", loaded, added)
+	}
+	if !reflect.DeepEqual(addedTypes, []chunk.BlockType{chunk.BlockTypeSand}) {
+		t.Fatalf("expected to add sand but got %v", addedTypes)
+	}
+	if !reflect.DeepEqual(removed, []chunk.VoxelCoordinate{loaded}) {
+		t.Fatalf("expected to remove at %v but got %v", loaded, removed)
+	}
+}
+
+func TestScriptInvalidLines(t *testing.T) {
+	t.Parallel()
+	lines := []string{
+		"press forwards",
+		"-1 press forwards",
+		"3 press sideways",
+		"3 jump",
+		"3 look 1",
+		"3 scroll left",
+		"3 add 1 2 3 bedrock",
+		"3 add 1 2 x dirt",
+		"3 remove 1 2",
+		"start 1 2 3 1 0 0 0 5",
+		"start 1 2 NaN 1 0 0 0 5 alex",
+		"start 1 2 3 1 0 0 0 x alex",
+	}
+	for _, line := range lines {
+		line := line
+		t.Run(line, func(t *testing.T) {
+			t.Parallel()
+			called := false
+			cameraMod := &camera.FnModule{
+				FnHandleMovementEvent: func(camera.MovementEvent) {
+					called = true
+				},
+			}
+			scriptMod := script.New(cameraMod, &player.FnModule{}, &world.FnModule{})
+
+			err := scriptMod.Load(strings.NewReader("0 press forwards\n" + line))
+			scriptMod.RunTick(0)
+
+			if !errors.Is(err, script.ErrSyntax) {
+				t.Fatalf("expected %q but got %q", script.ErrSyntax, err)
+			}
+			if !strings.Contains(err.Error(), "line 2") {
+				t.Fatalf("expected error to name line 2, but got %q", err)
+			}
+			if called {
+				t.Fatal("expected nothing to be loaded from an invalid script, but it was")
+			}
+		})
+	}
+}
+
+func TestScriptWithoutCommandsHasNoLastTick(t *testing.T) {
+	t.Parallel()
+	scriptMod := script.New(&camera.FnModule{}, &player.FnModule{}, &world.FnModule{})
+
+	err := scriptMod.Load(strings.NewReader("# nothing to do\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := scriptMod.GetLastTick(); last != -1 {
+		t.Fatalf("expected last tick -1 but got %v", last)
+	}
+}
+
+func TestWriterOutputLoadsBack(t *testing.T) {
+	t.Parallel()
+	var buf strings.Builder
+	writer := script.NewWriter(&buf)
+	movement := camera.MovementEvent{Direction: camera.MoveLeft, Pressed: true}
+	look := camera.LookEvent{Right: 0.1 + 0.2, Down: -1e-17}
+	action := player.ActionEvent{Scroll: player.ScrollDown}
+	writer.WriteMovement(0, movement)
+	writer.WriteLook(3, look)
+	writer.WriteAction(3, action)
+	writer.WriteAction(4, player.ActionEvent{})
+	if err := writer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var movements []camera.MovementEvent
+	var looks []camera.LookEvent
+	var actions []player.ActionEvent
+	cameraMod := &camera.FnModule{
+		FnHandleMovementEvent: func(evt camera.MovementEvent) {
+			movements = append(movements, evt)
+		},
+		FnHandleLookEvent: func(evt camera.LookEvent) {
+			looks = append(looks, evt)
+		},
+	}
+	playerMod := &player.FnModule{
+		FnUpdatePlayerAction: func(evt player.ActionEvent) {
+			actions = append(actions, evt)
+		},
+	}
+	scriptMod := script.New(cameraMod, playerMod, &world.FnModule{})
+	if err := scriptMod.Load(strings.NewReader(buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	for tick := 0; tick <= scriptMod.GetLastTick(); tick++ {
+		scriptMod.RunTick(tick)
+	}
+
+	if !reflect.DeepEqual(movements, []camera.MovementEvent{movement}) {
+		t.Fatalf("expected movements %v but got %v", movement, movements)
+	}
+	if !reflect.DeepEqual(looks, []camera.LookEvent{look}) {
+		t.Fatalf("expected looks %v but got %v", look, looks)
+	}
+	if !reflect.DeepEqual(actions, []player.ActionEvent{action}) {
+		t.Fatalf("expected actions %v but got %v", action, actions)
+	}
+	if last := scriptMod.GetLastTick(); last != 3 {
+		t.Fatalf("expected last tick 3 but got %v", last)
+	}
+}
+
+func TestWriterStartLoadsBack(t *testing.T) {
+	t.Parallel()
+	expect := script.Start{
+		Position:  player.PositionEvent{X: 0.1 + 0.2, Y: -64, Z: 1e-9},
+		Rotation:  mgl.QuatRotate(0.7, mgl.Vec3{0, 1, 0}),
+		Seed:      -1234567890123,
+		Generator: "heightmap",
+	}
+	var buf strings.Builder
+	writer := script.NewWriter(&buf)
+	writer.WriteStart(expect)
+	writer.WriteMovement(2, camera.MovementEvent{Direction: camera.MoveUp, Pressed: true})
+	if err := writer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	scriptMod := script.New(&camera.FnModule{}, &player.FnModule{}, &world.FnModule{})
+	if err := scriptMod.Load(strings.NewReader(buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	start, ok, err := script.ReadStart(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, loaded := scriptMod.GetStart(); !loaded || actual != expect {
+		t.Fatalf("expected loaded start %v but got %v, %v", expect, actual, loaded)
+	}
+	if !ok || start != expect {
+		t.Fatalf("expected read start %v but got %v, %v", expect, start, ok)
+	}
+	if last := scriptMod.GetLastTick(); last != 2 {
+		t.Fatalf("expected last tick 2 but got %v", last)
+	}
+}
+
+func TestScriptWithoutStart(t *testing.T) {
+	t.Parallel()
+	scriptMod := script.New(&camera.FnModule{}, &player.FnModule{}, &world.FnModule{})
+
+	err := scriptMod.Load(strings.NewReader("0 press forwards\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start, ok := scriptMod.GetStart(); ok {
+		t.Fatalf("expected no start but got %v", start)
+	}
+}
+
+func TestScriptStartGivenTwice(t *testing.T) {
+	t.Parallel()
+	line := "start 1 2 3 1 0 0 0 5 alex\n"
+
+	_, _, err := script.ReadStart(strings.NewReader(line + line))
+
+	if !errors.Is(err, script.ErrSyntax) {
+		t.Fatalf("expected %q but got %q", script.ErrSyntax, err)
+	}
+}
@@ -0,0 +1,237 @@
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/world"
+)
+
+type core struct {
+	cameraMod camera.Interface
+	playerMod player.Interface
+	worldMod  world.Interface
+	commands  map[int][]command
+	lastTick  int
+	start     Start
+	hasStart  bool
+}
+
+type command func(c *core)
+
+var directions = map[string]camera.MoveDirection{}
+
+var scrollNames = map[player.ScrollDirection]string{
+	player.ScrollUp:   "up",
+	player.ScrollDown: "down",
+}
+
+var scrolls = map[string]player.ScrollDirection{}
+
+func init() {
+	for d := camera.MoveForwards; d <= camera.MoveDown; d++ {
+		directions[d.String()] = d
+	}
+	for scroll, name := range scrollNames {
+		scrolls[name] = scroll
+	}
+}
+
+func (c *core) load(reader io.Reader) error {
+	parsed := map[int][]command{}
+	lastTick := c.lastTick
+	var start Start
+	hasStart := false
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] == "start" {
+			var err error
+			if hasStart {
+				err = fmt.Errorf("start was already given")
+			} else {
+				start, err = parseStart(fields[1:])
+			}
+			if err != nil {
+				return fmt.Errorf("%w at line %v: %v", ErrSyntax, lineNumber, err)
+			}
+			hasStart = true
+			continue
+		}
+		tick, cmd, err := parseLine(fields)
+		if err != nil {
+			return fmt.Errorf("%w at line %v: %v", ErrSyntax, lineNumber, err)
+		}
+		parsed[tick] = append(parsed[tick], cmd)
+		if tick > lastTick {
+			lastTick = tick
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for tick, cmds := range parsed {
+		c.commands[tick] = append(c.commands[tick], cmds...)
+	}
+	c.lastTick = lastTick
+	if hasStart {
+		c.start = start
+		c.hasStart = true
+	}
+	return nil
+}
+
+func parseStart(args []string) (Start, error) {
+	if len(args) != 9 {
+		return Start{}, fmt.Errorf("expected start <x> <y> <z> <w> <i> <j> <k> <seed> <generator>")
+	}
+	var values [7]float64
+	for i, arg := range args[:7] {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return Start{}, fmt.Errorf("invalid number %q", arg)
+		}
+		values[i] = v
+	}
+	seed, err := strconv.ParseInt(args[7], 10, 64)
+	if err != nil {
+		return Start{}, fmt.Errorf("invalid seed %q", args[7])
+	}
+	return Start{
+		Position: player.PositionEvent{X: values[0], Y: values[1], Z: values[2]},
+		Rotation: mgl.Quat{
+			W: values[3],
+			V: mgl.Vec3{values[4], values[5], values[6]},
+		},
+		Seed:      seed,
+		Generator: args[8],
+	}, nil
+}
+
+func parseLine(fields []string) (int, command, error) {
+	if len(fields) < 2 {
+		return 0, nil, fmt.Errorf("expected a tick and a command")
+	}
+	tick, err := strconv.Atoi(fields[0])
+	if err != nil || tick < 0 {
+		return 0, nil, fmt.Errorf("invalid tick %q", fields[0])
+	}
+	args := fields[2:]
+	switch name := fields[1]; name {
+	case "press", "release":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("expected %v <direction>", name)
+		}
+		dir, ok := directions[args[0]]
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid direction %q", args[0])
+		}
+		evt := camera.MovementEvent{
+			Direction: dir,
+			Pressed:   name == "press",
+		}
+		return tick, func(c *core) {
+			c.cameraMod.HandleMovementEvent(evt)
+		}, nil
+	case "look":
+		if len(args) != 2 {
+			return 0, nil, fmt.Errorf("expected look <right> <down>")
+		}
+		right, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid right %q", args[0])
+		}
+		down, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid down %q", args[1])
+		}
+		evt := camera.LookEvent{
+			Right: right,
+			Down:  down,
+		}
+		return tick, func(c *core) {
+			c.cameraMod.HandleLookEvent(evt)
+		}, nil
+	case "scroll":
+		if len(args) != 1 {
+			return 0, nil, fmt.Errorf("expected scroll up|down")
+		}
+		scroll, ok := scrolls[args[0]]
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid scroll %q", args[0])
+		}
+		evt := player.ActionEvent{Scroll: scroll}
+		return tick, func(c *core) {
+			c.playerMod.UpdatePlayerAction(evt)
+		}, nil
+	case "add":
+		if len(args) != 4 {
+			return 0, nil, fmt.Errorf("expected add <x> <y> <z> <block type>")
+		}
+		vc, err := parseVoxel(args[:3])
+		if err != nil {
+			return 0, nil, err
+		}
+		bt, ok := chunk.ParseBlockType(args[3])
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid block type %q", args[3])
+		}
+		return tick, func(c *core) {
+			if !c.worldMod.IsVoxelLoaded(vc) {
+				log.Warnf("script tried to add a block at %v, which isn't loaded", vc)
+				return
+			}
+			c.worldMod.AddBlock(vc, bt)
+		}, nil
+	case "remove":
+		if len(args) != 3 {
+			return 0, nil, fmt.Errorf("expected remove <x> <y> <z>")
+		}
+		vc, err := parseVoxel(args)
+		if err != nil {
+			return 0, nil, err
+		}
+		return tick, func(c *core) {
+			if !c.worldMod.IsVoxelLoaded(vc) {
+				log.Warnf("script tried to remove a block at %v, which isn't loaded", vc)
+				return
+			}
+			c.worldMod.RemoveBlock(vc)
+		}, nil
+	default:
+		return 0, nil, fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func parseVoxel(args []string) (chunk.VoxelCoordinate, error) {
+	var coords [3]int32
+	for i, arg := range args {
+		v, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return chunk.VoxelCoordinate{}, fmt.Errorf("invalid coordinate %q", arg)
+		}
+		coords[i] = int32(v)
+	}
+	return chunk.VoxelCoordinate{X: coords[0], Y: coords[1], Z: coords[2]}, nil
+}
+
+func (c *core) runTick(tick int) {
+	for _, cmd := range c.commands[tick] {
+		cmd(c)
+	}
+}
@@ -0,0 +1,35 @@
+package script
+
+import (
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+	"github.com/kroppt/voxels/modules/world"
+)
+
+// Module plays back scripted movement, actions and edits.
+type Module struct {
+	c core
+}
+
+// New creates a script module that sends movement to cameraMod, actions to
+// playerMod and edits to worldMod.
+func New(cameraMod camera.Interface, playerMod player.Interface, worldMod world.Interface) *Module {
+	if cameraMod == nil {
+		panic("script received a nil camera module")
+	}
+	if playerMod == nil {
+		panic("script received a nil player module")
+	}
+	if worldMod == nil {
+		panic("script received a nil world module")
+	}
+	return &Module{
+		core{
+			cameraMod: cameraMod,
+			playerMod: playerMod,
+			worldMod:  worldMod,
+			commands:  map[int][]command{},
+			lastTick:  -1,
+		},
+	}
+}
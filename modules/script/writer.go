@@ -0,0 +1,86 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/player"
+)
+
+// Writer writes commands in the format that Load reads. Looks are written
+// with as many digits as it takes to read back exactly the same value.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter creates a writer of commands to w.
+func NewWriter(w io.Writer) *Writer {
+	if w == nil {
+		panic("script writer received a nil writer")
+	}
+	return &Writer{w: w}
+}
+
+// WriteStart writes the start line.
+func (w *Writer) WriteStart(start Start) {
+	if w.err != nil {
+		return
+	}
+	fields := []string{"start"}
+	for _, v := range []float64{
+		start.Position.X, start.Position.Y, start.Position.Z,
+		start.Rotation.W, start.Rotation.X(), start.Rotation.Y(), start.Rotation.Z(),
+	} {
+		fields = append(fields, formatFloat(v))
+	}
+	fields = append(fields, strconv.FormatInt(start.Seed, 10), start.Generator)
+	_, w.err = fmt.Fprintln(w.w, strings.Join(fields, " "))
+}
+
+// WriteMovement writes a press or release command.
+func (w *Writer) WriteMovement(tick int, evt camera.MovementEvent) {
+	name := "release"
+	if evt.Pressed {
+		name = "press"
+	}
+	w.writeLine(tick, name, evt.Direction.String())
+}
+
+// WriteLook writes a look command.
+func (w *Writer) WriteLook(tick int, evt camera.LookEvent) {
+	w.writeLine(tick, "look", formatFloat(evt.Right), formatFloat(evt.Down))
+}
+
+// WriteAction writes a scroll command. Actions without a scroll are skipped.
+func (w *Writer) WriteAction(tick int, evt player.ActionEvent) {
+	name, ok := scrollNames[evt.Scroll]
+	if !ok {
+		return
+	}
+	w.writeLine(tick, "scroll", name)
+}
+
+// Err returns the first error that happened while writing, if any. Nothing
+// is written after an error.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) writeLine(tick int, fields ...string) {
+	if w.err != nil {
+		return
+	}
+	line := strconv.Itoa(tick)
+	for _, field := range fields {
+		line += " " + field
+	}
+	_, w.err = fmt.Fprintln(w.w, line)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
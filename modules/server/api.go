@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net"
+)
+
+type Interface interface {
+	SetRandomTickSeed(seed int64)
+	Run()
+	Serve(listener net.Listener) error
+	CountPlayers() int
+	Close()
+}
+
+// SetRandomTickSeed seeds the random ticks of the world. It must be called
+// before Run.
+func (m *Module) SetRandomTickSeed(seed int64) {
+	m.c.worldMod.SetRandomTickSeed(seed)
+}
+
+// Run ticks the world and handles what clients send until Close is called.
+// The world is saved before Run returns.
+func (m *Module) Run() {
+	m.c.run()
+}
+
+// Serve accepts clients on listener until Close is called. It returns nil
+// if it stopped because of Close.
+func (m *Module) Serve(listener net.Listener) error {
+	return m.c.serve(listener)
+}
+
+// CountPlayers returns how many players are connected.
+func (m *Module) CountPlayers() int {
+	count := make(chan int, 1)
+	if !m.c.post(func() { count <- len(m.c.clients) }) {
+		return 0
+	}
+	return <-count
+}
+
+// Close disconnects all clients and stops Run and Serve.
+func (m *Module) Close() {
+	m.c.close()
+}
+
+type FnModule struct {
+	FnSetRandomTickSeed func(seed int64)
+	FnRun               func()
+	FnServe             func(listener net.Listener) error
+	FnCountPlayers      func() int
+	FnClose             func()
+}
+
+func (fn FnModule) SetRandomTickSeed(seed int64) {
+	if fn.FnSetRandomTickSeed != nil {
+		fn.FnSetRandomTickSeed(seed)
+	}
+}
+
+func (fn FnModule) Run() {
+	if fn.FnRun != nil {
+		fn.FnRun()
+	}
+}
+
+func (fn FnModule) Serve(listener net.Listener) error {
+	if fn.FnServe != nil {
+		return fn.FnServe(listener)
+	}
+	return nil
+}
+
+func (fn FnModule) CountPlayers() int {
+	if fn.FnCountPlayers != nil {
+		return fn.FnCountPlayers()
+	}
+	return 0
+}
+
+func (fn FnModule) Close() {
+	if fn.FnClose != nil {
+		fn.FnClose()
+	}
+}
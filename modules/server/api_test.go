@@ -0,0 +1,344 @@
+package server_test
+
+import (
+	"container/list"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/client"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/modules/server"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/protocol"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+const chunkSize = 2
+
+// flatGenerator makes dirt below y = 0 and air above.
+var flatGenerator = &world.FnGenerator{
+	FnGenerateChunk: func(pos chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+		ch := chunk.NewChunkEmpty(pos, chunkSize)
+		actions := list.New()
+		if pos.Y < 0 {
+			ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeDirt))
+			})
+		}
+		return ch, actions
+	},
+}
+
+var testSettings = &settings.FnRepository{
+	FnGetChunkSize:      func() uint32 { return chunkSize },
+	FnGetRenderDistance: func() uint32 { return 1 },
+}
+
+type testServer struct {
+	*server.Module
+	addr    string
+	stopped chan struct{}
+}
+
+func startServer(t *testing.T, cacheMod cache.Interface) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &testServer{
+		Module:  server.New(flatGenerator, testSettings, cacheMod, protocol.Position{X: 0.5, Y: 0.5, Z: 0.5}, time.Millisecond),
+		addr:    listener.Addr().String(),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		srv.Run()
+		close(srv.stopped)
+	}()
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			t.Errorf("serve failed: %v", err)
+		}
+	}()
+	t.Cleanup(srv.stop)
+	return srv
+}
+
+func (srv *testServer) stop() {
+	srv.Close()
+	<-srv.stopped
+}
+
+func join(t *testing.T, srv *testServer, name string) *client.Module {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientMod, err := client.New(conn, name, &graphics.FnModule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientMod.Close() })
+	return clientMod
+}
+
+// eventually fails the test if cond doesn't become true soon.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func hasBlock(clientMod *client.Module, vc chunk.VoxelCoordinate, expect chunk.BlockType) func() bool {
+	return func() bool {
+		bt, ok := clientMod.GetBlockType(vc)
+		return ok && bt == expect
+	}
+}
+
+func TestServerRejectsWrongVersion(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	conn, err := net.Dial("tcp", srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = protocol.WriteMessage(conn, protocol.Hello{Version: protocol.Version + 1, Name: "future"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := protocol.ReadMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.(protocol.Reject); !ok {
+		t.Fatalf("expected reject but got %T", msg)
+	}
+}
+
+func TestClientRejected(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	conn, err := net.Dial("tcp", srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.New(conn, "", &graphics.FnModule{})
+	if !errors.Is(err, client.ErrRejected) {
+		t.Fatalf("expected %v but got %v", client.ErrRejected, err)
+	}
+}
+
+func TestClientReceivesChunksAroundIt(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	alice := join(t, srv, "alice")
+	if alice.GetChunkSize() != chunkSize {
+		t.Fatalf("expected chunk size %v but got %v", chunkSize, alice.GetChunkSize())
+	}
+	if err := alice.Move(alice.GetSpawn(), mgl.QuatIdent()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "chunks around spawn", func() bool { return alice.CountChunks() == 27 })
+	bt, _ := alice.GetBlockType(chunk.VoxelCoordinate{X: 0, Y: -1, Z: 0})
+	if bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected dirt below spawn but got %v", bt)
+	}
+
+	if err := alice.Move(protocol.Position{X: 100, Y: 0.5, Z: 0.5}, mgl.QuatIdent()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "chunks around spawn to be unloaded", func() bool {
+		_, ok := alice.GetBlockType(chunk.VoxelCoordinate{X: 0, Y: -1, Z: 0})
+		return !ok && alice.CountChunks() == 27
+	})
+}
+
+func TestServerSendsEachChunkOnce(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	conn, err := net.Dial("tcp", srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := protocol.WriteMessage(conn, protocol.Hello{Version: protocol.Version, Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := protocol.ReadMessage(conn); err != nil {
+		t.Fatal(err)
+	} else if _, ok := msg.(protocol.Welcome); !ok {
+		t.Fatalf("expected welcome but got %T", msg)
+	}
+	if err := protocol.WriteMessage(conn, protocol.Move{Position: protocol.Position{X: 0.5, Y: 0.5, Z: 0.5}, Rotation: mgl.QuatIdent()}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := map[chunk.ChunkCoordinate]int{}
+	for {
+		// loading the chunks changes the faces between them, which
+		// mustn't be sent again
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		msg, err := protocol.ReadMessage(conn)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, ok := msg.(protocol.ChunkData)
+		if !ok {
+			t.Fatalf("expected only chunk data but got %T", msg)
+		}
+		sent[data.Pos]++
+	}
+
+	if len(sent) != 27 {
+		t.Fatalf("expected 27 chunks but got %v", len(sent))
+	}
+	for pos, count := range sent {
+		if count != 1 {
+			t.Fatalf("expected chunk %v to be sent once but it was sent %v times", pos, count)
+		}
+	}
+}
+
+func TestBlockEditsReachBothClients(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	alice := join(t, srv, "alice")
+	bob := join(t, srv, "bob")
+	for _, clientMod := range []*client.Module{alice, bob} {
+		if err := clientMod.Move(clientMod.GetSpawn(), mgl.QuatIdent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "chunks around spawn", func() bool {
+		return alice.CountChunks() == 27 && bob.CountChunks() == 27
+	})
+
+	below := chunk.VoxelCoordinate{X: 0, Y: -1, Z: 0}
+	if err := alice.RemoveBlock(below); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "removed block", hasBlock(bob, below, chunk.BlockTypeAir))
+	eventually(t, "removed block", hasBlock(alice, below, chunk.BlockTypeAir))
+
+	above := chunk.VoxelCoordinate{X: 1, Y: 0, Z: 1}
+	if err := bob.AddBlock(above, chunk.BlockTypeStone); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "added block", hasBlock(alice, above, chunk.BlockTypeStone))
+	eventually(t, "added block", hasBlock(bob, above, chunk.BlockTypeStone))
+}
+
+func TestServerIgnoresInvalidEdits(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	alice := join(t, srv, "alice")
+	if err := alice.Move(alice.GetSpawn(), mgl.QuatIdent()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "chunks around spawn", func() bool { return alice.CountChunks() == 27 })
+
+	dirt := chunk.VoxelCoordinate{X: 0, Y: -1, Z: 0}
+	air := chunk.VoxelCoordinate{X: 0, Y: 1, Z: 0}
+	far := chunk.VoxelCoordinate{X: 50, Y: 1, Z: 0}
+	edits := []func() error{
+		func() error { return alice.AddBlock(dirt, chunk.BlockTypeStone) },
+		func() error { return alice.RemoveBlock(air) },
+		func() error { return alice.AddBlock(air, chunk.BlockTypeAir) },
+		func() error { return alice.AddBlock(far, chunk.BlockTypeStone) },
+		// a valid edit last, since the server handles edits in order
+		func() error { return alice.AddBlock(air, chunk.BlockTypeLog) },
+	}
+	for _, edit := range edits {
+		if err := edit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "valid edit", hasBlock(alice, air, chunk.BlockTypeLog))
+	if bt, _ := alice.GetBlockType(dirt); bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected dirt to stay but got %v", bt)
+	}
+}
+
+func TestPlayersSeeEachOther(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t, &cache.FnModule{})
+	alice := join(t, srv, "alice")
+	bob := join(t, srv, "bob")
+	if alice.GetPlayerID() == bob.GetPlayerID() {
+		t.Fatal("expected players to have different IDs")
+	}
+	bobPos := protocol.Position{X: 3, Y: 4, Z: 5}
+	if err := bob.Move(bobPos, mgl.QuatIdent()); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "bob's position", func() bool {
+		player, ok := alice.GetPlayers()[bob.GetPlayerID()]
+		return ok && player.Name == "bob" && player.Position == bobPos
+	})
+
+	carol := join(t, srv, "carol")
+	eventually(t, "existing players sent to new player", func() bool {
+		_, ok := carol.GetPlayers()[bob.GetPlayerID()]
+		return ok
+	})
+
+	bob.Close()
+	eventually(t, "bob to leave", func() bool {
+		_, ok := alice.GetPlayers()[bob.GetPlayerID()]
+		return !ok && srv.CountPlayers() == 2
+	})
+}
+
+func TestServerSavesEditsOnClose(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	saved := map[chunk.ChunkCoordinate]chunk.Chunk{}
+	srv := startServer(t, &cache.FnModule{
+		FnSave: func(ch chunk.Chunk) error {
+			mu.Lock()
+			defer mu.Unlock()
+			saved[ch.Position()] = ch
+			return nil
+		},
+	})
+	alice := join(t, srv, "alice")
+	if err := alice.Move(alice.GetSpawn(), mgl.QuatIdent()); err != nil {
+		t.Fatal(err)
+	}
+	vc := chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}
+	eventually(t, "chunks around spawn", func() bool { return alice.CountChunks() == 27 })
+	if err := alice.AddBlock(vc, chunk.BlockTypeLog); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "added block", hasBlock(alice, vc, chunk.BlockTypeLog))
+
+	srv.stop()
+	<-alice.Done()
+	mu.Lock()
+	defer mu.Unlock()
+	ch, ok := saved[chunk.ChunkCoordinate{}]
+	if !ok {
+		t.Fatal("expected edited chunk to be saved")
+	}
+	if bt := ch.BlockType(vc); bt != chunk.BlockTypeLog {
+		t.Fatalf("expected saved %v but got %v", chunk.BlockTypeLog, bt)
+	}
+}
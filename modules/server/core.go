@@ -0,0 +1,396 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/protocol"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// handshakeTimeout is how long a new connection has to say hello.
+const handshakeTimeout = 10 * time.Second
+
+// clientQueueSize is how many messages may wait to be sent to a client. A
+// client that falls further behind is disconnected.
+const clientQueueSize = 4096
+
+type client struct {
+	id       uint32
+	name     string
+	conn     net.Conn
+	out      chan protocol.Message
+	chunks   map[chunk.ChunkCoordinate]struct{}
+	position protocol.Position
+	rotation mgl.Quat
+	moved    bool
+}
+
+type core struct {
+	settingsRepo settings.Interface
+	worldMod     *world.Module
+	sink         *sink
+	spawn        protocol.Position
+	tickRate     time.Duration
+	do           chan func()
+	done         chan struct{}
+	// mu guards closed and listeners, and is held while posting so nothing
+	// is posted after the server closed
+	mu        sync.RWMutex
+	closed    bool
+	listeners []net.Listener
+	// everything below is only touched by the goroutine in run
+	clients  map[uint32]*client
+	lastID   uint32
+	interest map[chunk.ChunkCoordinate]int
+}
+
+func (c *core) run() {
+	ticker := time.NewTicker(c.tickRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case f := <-c.do:
+			f()
+		case <-ticker.C:
+			c.worldMod.Tick()
+		case <-c.done:
+			c.shutdown()
+			return
+		}
+	}
+}
+
+// shutdown finishes what was posted before the server closed, then
+// disconnects everyone and saves the world.
+func (c *core) shutdown() {
+	for len(c.do) > 0 {
+		(<-c.do)()
+	}
+	for _, cl := range c.clients {
+		c.disconnect(cl)
+	}
+	c.worldMod.Quit()
+}
+
+// post makes the goroutine in run call f. It returns false if the server
+// closed, in which case f is never called.
+func (c *core) post(f func()) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return false
+	}
+	c.do <- f
+	return true
+}
+
+func (c *core) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	for _, listener := range c.listeners {
+		listener.Close()
+	}
+}
+
+func (c *core) serve(listener net.Listener) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	c.listeners = append(c.listeners, listener)
+	c.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			if c.closed {
+				return nil
+			}
+			return err
+		}
+		go c.handleConn(conn)
+	}
+}
+
+// handleConn greets a new connection and reads what the client sends until
+// it disconnects.
+func (c *core) handleConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	msg, err := protocol.ReadMessage(conn)
+	if err != nil {
+		log.Warnf("client %v failed to say hello: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	hello, ok := msg.(protocol.Hello)
+	if !ok {
+		log.Warnf("client %v sent %T instead of hello", conn.RemoteAddr(), msg)
+		conn.Close()
+		return
+	}
+	if reason := checkHello(hello); reason != "" {
+		protocol.WriteMessage(conn, protocol.Reject{Reason: reason})
+		conn.Close()
+		return
+	}
+	cl := &client{
+		name:   hello.Name,
+		conn:   conn,
+		out:    make(chan protocol.Message, clientQueueSize),
+		chunks: map[chunk.ChunkCoordinate]struct{}{},
+	}
+	go c.write(cl)
+	if !c.post(func() { c.join(cl) }) {
+		close(cl.out)
+		return
+	}
+	for {
+		msg, err := protocol.ReadMessage(conn)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Infof("client %v disconnected: %v", cl.name, err)
+			}
+			c.post(func() { c.leave(cl) })
+			return
+		}
+		if !c.post(func() { c.handle(cl, msg) }) {
+			return
+		}
+	}
+}
+
+// checkHello returns why a client can't join, or the empty string if it can.
+func checkHello(hello protocol.Hello) string {
+	if hello.Version != protocol.Version {
+		return "unsupported protocol version"
+	}
+	if hello.Name == "" {
+		return "empty player name"
+	}
+	return ""
+}
+
+// write sends the queued messages of cl until the queue is closed.
+func (c *core) write(cl *client) {
+	for msg := range cl.out {
+		if err := protocol.WriteMessage(cl.conn, msg); err != nil {
+			cl.conn.Close()
+			for range cl.out {
+			}
+			return
+		}
+	}
+	cl.conn.Close()
+}
+
+// send queues msg for cl, disconnecting cl if it fell too far behind.
+func (c *core) send(cl *client, msg protocol.Message) {
+	if _, ok := c.clients[cl.id]; !ok {
+		return
+	}
+	select {
+	case cl.out <- msg:
+	default:
+		log.Warnf("client %v fell too far behind", cl.name)
+		c.leave(cl)
+	}
+}
+
+func (c *core) join(cl *client) {
+	c.lastID++
+	cl.id = c.lastID
+	c.clients[cl.id] = cl
+	log.Infof("client %v joined as player %v", cl.name, cl.id)
+	c.send(cl, protocol.Welcome{
+		Version:   protocol.Version,
+		PlayerID:  cl.id,
+		ChunkSize: c.settingsRepo.GetChunkSize(),
+		Spawn:     c.spawn,
+	})
+	for _, other := range c.clients {
+		if other != cl && other.moved {
+			c.send(cl, playerPosition(other))
+		}
+	}
+}
+
+// leave forgets cl and tells the other clients it left.
+func (c *core) leave(cl *client) {
+	if _, ok := c.clients[cl.id]; !ok {
+		return
+	}
+	c.disconnect(cl)
+	for _, other := range c.clients {
+		c.send(other, protocol.PlayerLeft{PlayerID: cl.id})
+	}
+}
+
+// disconnect forgets cl and closes its connection once everything queued
+// for it was sent.
+func (c *core) disconnect(cl *client) {
+	delete(c.clients, cl.id)
+	for pos := range cl.chunks {
+		c.release(pos)
+	}
+	cl.chunks = nil
+	close(cl.out)
+}
+
+func (c *core) handle(cl *client, msg protocol.Message) {
+	if _, ok := c.clients[cl.id]; !ok {
+		return
+	}
+	switch m := msg.(type) {
+	case protocol.Move:
+		c.move(cl, m)
+	case protocol.AddBlock:
+		if !c.canEdit(cl, m.VoxPos) || m.BlockType == chunk.BlockTypeAir {
+			return
+		}
+		if c.worldMod.GetBlockType(m.VoxPos) != chunk.BlockTypeAir {
+			return
+		}
+		c.worldMod.AddBlock(m.VoxPos, m.BlockType)
+	case protocol.RemoveBlock:
+		if !c.canEdit(cl, m.VoxPos) {
+			return
+		}
+		if c.worldMod.GetBlockType(m.VoxPos) == chunk.BlockTypeAir {
+			return
+		}
+		c.worldMod.RemoveBlock(m.VoxPos)
+	default:
+		log.Warnf("client %v sent unexpected %T", cl.name, msg)
+		c.leave(cl)
+	}
+}
+
+// canEdit returns whether cl may change the block at vc, which it may only
+// if it was sent the chunk holding it.
+func (c *core) canEdit(cl *client, vc chunk.VoxelCoordinate) bool {
+	pos := chunk.VoxelCoordToChunkCoord(vc, c.settingsRepo.GetChunkSize())
+	_, ok := cl.chunks[pos]
+	return ok && c.worldMod.IsVoxelLoaded(vc)
+}
+
+func (c *core) move(cl *client, m protocol.Move) {
+	cl.position = m.Position
+	cl.rotation = m.Rotation
+	cl.moved = true
+	c.updateChunks(cl)
+	for _, other := range c.clients {
+		if other != cl {
+			c.send(other, playerPosition(cl))
+		}
+	}
+}
+
+func playerPosition(cl *client) protocol.PlayerPosition {
+	return protocol.PlayerPosition{
+		PlayerID: cl.id,
+		Name:     cl.name,
+		Position: cl.position,
+		Rotation: cl.rotation,
+	}
+}
+
+// updateChunks sends cl the chunks around it that it doesn't have yet, and
+// takes back the ones it moved away from. Like for a local player, chunks
+// are taken back a little past the render distance.
+func (c *core) updateChunks(cl *client) {
+	center := chunk.VoxelCoordToChunkCoord(chunk.VoxelCoordinate{
+		X: int32(math.Floor(cl.position.X)),
+		Y: int32(math.Floor(cl.position.Y)),
+		Z: int32(math.Floor(cl.position.Z)),
+	}, c.settingsRepo.GetChunkSize())
+	renderDistance := int32(c.settingsRepo.GetRenderDistance())
+	unloadDistance := int32(c.settingsRepo.GetUnloadDistance())
+	if unloadDistance < renderDistance {
+		unloadDistance = renderDistance
+	}
+	for pos := range cl.chunks {
+		if distance(center, pos) > unloadDistance {
+			delete(cl.chunks, pos)
+			c.send(cl, protocol.ChunkUnload{Pos: pos})
+			c.release(pos)
+		}
+	}
+	for x := center.X - renderDistance; x <= center.X+renderDistance; x++ {
+		for y := center.Y - renderDistance; y <= center.Y+renderDistance; y++ {
+			for z := center.Z - renderDistance; z <= center.Z+renderDistance; z++ {
+				pos := chunk.ChunkCoordinate{X: x, Y: y, Z: z}
+				if _, ok := cl.chunks[pos]; ok {
+					continue
+				}
+				c.acquire(pos)
+				cl.chunks[pos] = struct{}{}
+				c.send(cl, protocol.NewChunkData(c.sink.getChunk(pos)))
+			}
+		}
+	}
+}
+
+// distance returns the largest distance between a and b along any axis.
+func distance(a, b chunk.ChunkCoordinate) int32 {
+	d := abs(a.X - b.X)
+	if dy := abs(a.Y - b.Y); dy > d {
+		d = dy
+	}
+	if dz := abs(a.Z - b.Z); dz > d {
+		d = dz
+	}
+	return d
+}
+
+func abs(a int32) int32 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// acquire loads the chunk at pos in the world if no client had it yet.
+func (c *core) acquire(pos chunk.ChunkCoordinate) {
+	c.interest[pos]++
+	if c.interest[pos] == 1 {
+		c.worldMod.LoadChunk(pos)
+	}
+}
+
+// release unloads the chunk at pos from the world once no client has it.
+func (c *core) release(pos chunk.ChunkCoordinate) {
+	c.interest[pos]--
+	if c.interest[pos] == 0 {
+		delete(c.interest, pos)
+		c.worldMod.UnloadChunk(pos)
+	}
+}
+
+// sendChunkChange sends msgs to every client that has the chunk at pos.
+func (c *core) sendChunkChange(pos chunk.ChunkCoordinate, msgs []protocol.Message) {
+	for _, cl := range c.clients {
+		if _, ok := cl.chunks[pos]; !ok {
+			continue
+		}
+		for _, msg := range msgs {
+			c.send(cl, msg)
+		}
+	}
+}
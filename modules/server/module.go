@@ -0,0 +1,54 @@
+package server
+
+import (
+	"time"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/modules/view"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/protocol"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// Module is a multiplayer server. It owns the world and lets clients
+// connected over the network move around in it and edit it.
+type Module struct {
+	c *core
+}
+
+// New creates a server for the world made by generator and stored in
+// cacheMod. New players start at spawn, and the world ticks every tickRate.
+func New(
+	generator world.Generator,
+	settingsRepo settings.Interface,
+	cacheMod cache.Interface,
+	spawn protocol.Position,
+	tickRate time.Duration,
+) *Module {
+	if generator == nil {
+		panic("server received a nil generator")
+	}
+	if settingsRepo == nil {
+		panic("server received a nil settings repo")
+	}
+	if tickRate <= 0 {
+		panic("server received a non-positive tick rate")
+	}
+	c := &core{
+		settingsRepo: settingsRepo,
+		spawn:        spawn,
+		tickRate:     tickRate,
+		do:           make(chan func(), 1024),
+		done:         make(chan struct{}),
+		clients:      map[uint32]*client{},
+		interest:     map[chunk.ChunkCoordinate]int{},
+	}
+	c.sink = &sink{
+		c:      c,
+		chunks: map[chunk.ChunkCoordinate]chunk.Chunk{},
+		blocks: map[chunk.ChunkCoordinate][]chunk.BlockType{},
+	}
+	c.worldMod = world.New(c.sink, generator, settingsRepo, cacheMod, &view.FnModule{})
+	return &Module{c}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/graphics"
+	"github.com/kroppt/voxels/protocol"
+)
+
+// sink stands in for graphics in the server's world. Instead of drawing
+// chunks, it tells clients how they changed.
+type sink struct {
+	graphics.FnModule
+	c      *core
+	chunks map[chunk.ChunkCoordinate]chunk.Chunk
+	// blocks holds the block types of each chunk as last sent, in
+	// chunk.ForEachVoxel order
+	blocks map[chunk.ChunkCoordinate][]chunk.BlockType
+}
+
+func blockTypes(ch chunk.Chunk) []chunk.BlockType {
+	blocks := make([]chunk.BlockType, 0, ch.Size()*ch.Size()*ch.Size())
+	ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+		blocks = append(blocks, ch.BlockType(vc))
+	})
+	return blocks
+}
+
+func (s *sink) LoadChunk(ch chunk.Chunk) {
+	s.chunks[ch.Position()] = ch
+	s.blocks[ch.Position()] = blockTypes(ch)
+}
+
+func (s *sink) UnloadChunk(pos chunk.ChunkCoordinate) {
+	delete(s.chunks, pos)
+	delete(s.blocks, pos)
+}
+
+// UpdateChunk sends the blocks of ch that changed to the clients that have
+// it. If only faces changed, for example because a neighbor was loaded,
+// nothing is sent, as clients work out the faces between chunks themselves.
+func (s *sink) UpdateChunk(ch chunk.Chunk) {
+	pos := ch.Position()
+	old := s.blocks[pos]
+	var deltas []protocol.Message
+	i := 0
+	ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+		if bt := ch.BlockType(vc); i < len(old) && old[i] != bt {
+			old[i] = bt
+			deltas = append(deltas, protocol.BlockDelta{
+				VoxPos:    vc,
+				BlockType: bt,
+			})
+		}
+		i++
+	})
+	s.chunks[pos] = ch
+	if len(deltas) != 0 {
+		s.c.sendChunkChange(pos, deltas)
+	}
+}
+
+func (s *sink) getChunk(pos chunk.ChunkCoordinate) chunk.Chunk {
+	ch, ok := s.chunks[pos]
+	if !ok {
+		panic("server sent a chunk the world never loaded")
+	}
+	return ch
+}
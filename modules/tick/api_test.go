@@ -1,16 +1,18 @@
 package tick_test
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/kroppt/voxels/modules/camera"
 	"github.com/kroppt/voxels/modules/tick"
+	"github.com/kroppt/voxels/modules/world"
 )
 
 func TestNewTickNotNil(t *testing.T) {
 	t.Parallel()
-	tickMod := tick.New(&camera.FnModule{}, tick.FnTime{}, 1)
+	tickMod := tick.New(&camera.FnModule{}, world.FnModule{}, tick.FnTime{}, 1)
 	if tickMod == nil {
 		t.Fatal("new tick module was nil")
 	}
@@ -23,7 +25,17 @@ func TestNewTickCameraNotNil(t *testing.T) {
 			t.Fatal("expected panic, but didn't")
 		}
 	}()
-	tick.New(nil, tick.FnTime{}, 1)
+	tick.New(nil, world.FnModule{}, tick.FnTime{}, 1)
+}
+
+func TestNewTickWorldNotNil(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatal("expected panic, but didn't")
+		}
+	}()
+	tick.New(&camera.FnModule{}, nil, tick.FnTime{}, 1)
 }
 
 func TestNewTickTimeModuleNotNil(t *testing.T) {
@@ -33,7 +45,7 @@ func TestNewTickTimeModuleNotNil(t *testing.T) {
 			t.Fatal("expected panic, but didn't")
 		}
 	}()
-	tick.New(&camera.FnModule{}, nil, 1)
+	tick.New(&camera.FnModule{}, world.FnModule{}, nil, 1)
 }
 
 func TestTickRatePositive(t *testing.T) {
@@ -43,12 +55,12 @@ func TestTickRatePositive(t *testing.T) {
 			t.Fatal("expected panic, but didn't")
 		}
 	}()
-	tick.New(&camera.FnModule{}, tick.FnTime{}, 0)
+	tick.New(&camera.FnModule{}, world.FnModule{}, tick.FnTime{}, 0)
 }
 
 func TestGetCurrentTick(t *testing.T) {
 	t.Parallel()
-	tickMod := tick.New(&camera.FnModule{}, tick.FnTime{}, 1)
+	tickMod := tick.New(&camera.FnModule{}, world.FnModule{}, tick.FnTime{}, 1)
 	expected := 0
 	actual := tickMod.GetTick()
 
@@ -59,7 +71,7 @@ func TestGetCurrentTick(t *testing.T) {
 
 func TestAdvanceTick(t *testing.T) {
 	t.Parallel()
-	tickMod := tick.New(&camera.FnModule{}, tick.FnTime{}, 1)
+	tickMod := tick.New(&camera.FnModule{}, world.FnModule{}, tick.FnTime{}, 1)
 	expected := 1
 	tickMod.AdvanceTick()
 	actual := tickMod.GetTick()
@@ -78,7 +90,7 @@ func TestNextTickIsNotReadyIfNotEnoughTimeHasPassed(t *testing.T) {
 			return current
 		},
 	}
-	tickMod := tick.New(&camera.Module{}, timeMod, 1)
+	tickMod := tick.New(&camera.Module{}, world.FnModule{}, timeMod, 1)
 	actual := tickMod.IsNextTickReady()
 
 	if actual != expected {
@@ -96,7 +108,7 @@ func TestNextTickIsReadyIfEnoughTimeHasPassed(t *testing.T) {
 		},
 	}
 	tickRateNano := 500 * 1e6
-	tickMod := tick.New(&camera.Module{}, timeMod, 500*1e6)
+	tickMod := tick.New(&camera.Module{}, world.FnModule{}, timeMod, 500*1e6)
 	timeMod.FnNow = func() time.Time {
 		return current.Add(time.Duration(tickRateNano))
 	}
@@ -117,7 +129,7 @@ func TestNextTickIsNotReadyIfBarelyNotEnoughTimeHasPassed(t *testing.T) {
 		},
 	}
 	tickRateNano := 500 * 1e6
-	tickMod := tick.New(&camera.Module{}, timeMod, 500*1e6)
+	tickMod := tick.New(&camera.Module{}, world.FnModule{}, timeMod, 500*1e6)
 	timeMod.FnNow = func() time.Time {
 		return current.Add(time.Duration(tickRateNano - 1))
 	}
@@ -137,9 +149,30 @@ func TestCameraReceivesTick(t *testing.T) {
 			actual = true
 		},
 	}
-	tickMod := tick.New(cameraMod, tick.FnTime{}, 1)
+	tickMod := tick.New(cameraMod, world.FnModule{}, tick.FnTime{}, 1)
 	tickMod.AdvanceTick()
 	if actual != expected {
 		t.Fatal("expected camera to receive tick, but didn't")
 	}
 }
+
+func TestWorldReceivesTickAfterCamera(t *testing.T) {
+	t.Parallel()
+	var order []string
+	cameraMod := &camera.FnModule{
+		FnTick: func() {
+			order = append(order, "camera")
+		},
+	}
+	worldMod := world.FnModule{
+		FnTick: func() {
+			order = append(order, "world")
+		},
+	}
+	tickMod := tick.New(cameraMod, worldMod, tick.FnTime{}, 1)
+	tickMod.AdvanceTick()
+	expected := []string{"camera", "world"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected tick order %v but got %v", expected, order)
+	}
+}
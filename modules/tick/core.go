@@ -2,10 +2,12 @@ package tick
 
 import (
 	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/world"
 )
 
 type core struct {
 	cameraMod    camera.Interface
+	worldMod     world.Interface
 	timeMod      Time
 	tickRateNano int64
 	lastTickNano int64
@@ -20,6 +22,7 @@ func (c *core) advanceTick() {
 	c.lastTickNano = c.timeMod.Now().UnixNano()
 	c.currentTick++
 	c.cameraMod.Tick()
+	c.worldMod.Tick()
 }
 
 func (c *core) isNextTickReady() bool {
@@ -1,15 +1,21 @@
 package tick
 
-import "github.com/kroppt/voxels/modules/camera"
+import (
+	"github.com/kroppt/voxels/modules/camera"
+	"github.com/kroppt/voxels/modules/world"
+)
 
 type Module struct {
 	c core
 }
 
-func New(cameraMod camera.Interface, timeMod Time, tickRateNano int64) *Module {
+func New(cameraMod camera.Interface, worldMod world.Interface, timeMod Time, tickRateNano int64) *Module {
 	if cameraMod == nil {
 		panic("camera module was nil")
 	}
+	if worldMod == nil {
+		panic("world module was nil")
+	}
 	if timeMod == nil {
 		panic("time module was nil")
 	}
@@ -19,6 +25,7 @@ func New(cameraMod camera.Interface, timeMod Time, tickRateNano int64) *Module {
 	return &Module{
 		core{
 			cameraMod:    cameraMod,
+			worldMod:     worldMod,
 			timeMod:      timeMod,
 			lastTickNano: timeMod.Now().UnixNano(),
 			tickRateNano: tickRateNano,
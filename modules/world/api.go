@@ -11,12 +11,22 @@ type Interface interface {
 	UnloadChunk(chunk.ChunkCoordinate)
 	Quit()
 	CountLoadedChunks() int
+	IsVoxelLoaded(chunk.VoxelCoordinate) bool
 	GetBlockType(chunk.VoxelCoordinate) chunk.BlockType
 	RemoveBlock(chunk.VoxelCoordinate)
 	AddBlock(chunk.VoxelCoordinate, chunk.BlockType)
+	SetBlocks([]BlockEdit)
+	ScheduleUpdate(chunk.VoxelCoordinate, int)
+	Tick()
 	Close()
 }
 
+// BlockEdit is a change of the block at a voxel.
+type BlockEdit struct {
+	VoxPos    chunk.VoxelCoordinate
+	BlockType chunk.BlockType
+}
+
 type ViewState struct {
 	Pos mgl.Vec3
 	Dir mgl.Quat
@@ -38,6 +48,11 @@ func (m *Module) CountLoadedChunks() int {
 	return m.c.countLoadedChunks()
 }
 
+// IsVoxelLoaded returns whether the chunk containing the voxel is loaded.
+func (m *Module) IsVoxelLoaded(vc chunk.VoxelCoordinate) bool {
+	return m.c.isVoxelLoaded(vc)
+}
+
 func (m *Module) GetBlockType(pos chunk.VoxelCoordinate) chunk.BlockType {
 	return m.c.getBlockType(pos)
 }
@@ -50,6 +65,43 @@ func (m *Module) AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) {
 	m.c.addBlock(vc, bt)
 }
 
+// SetBlocks makes many edits at once, in order. Every chunk that changes is
+// only updated once, no matter how many of its blocks changed. The voxels
+// must be loaded.
+func (m *Module) SetBlocks(edits []BlockEdit) {
+	m.c.setBlocks(edits)
+}
+
+// ScheduleUpdate schedules an update of the voxel delay ticks from now. The
+// update is handled by the scheduled update handler of the voxel's block type
+// when it is due.
+func (m *Module) ScheduleUpdate(vc chunk.VoxelCoordinate, delay int) {
+	m.c.scheduleUpdate(vc, delay)
+}
+
+// Tick advances the world by one tick, performing due scheduled updates and
+// random block ticks.
+func (m *Module) Tick() {
+	m.c.tick()
+}
+
+// SetScheduledUpdateHandler sets the handler called when a scheduled update of a
+// voxel of the given block type is due. A nil handler removes it.
+func (m *Module) SetScheduledUpdateHandler(bt chunk.BlockType, handler ScheduledUpdateHandler) {
+	m.c.setScheduledUpdateHandler(bt, handler)
+}
+
+// SetRandomTickSeed reseeds the random number generator used for random ticks.
+func (m *Module) SetRandomTickSeed(seed int64) {
+	m.c.setRandomTickSeed(seed)
+}
+
+// SetRandomTickHandler sets the handler called when a voxel of the given block
+// type receives a random tick. A nil handler removes it.
+func (m *Module) SetRandomTickHandler(bt chunk.BlockType, handler RandomTickHandler) {
+	m.c.setRandomTickHandler(bt, handler)
+}
+
 // Close does nothing.
 func (m *Module) Close() {
 }
@@ -59,9 +111,13 @@ type FnModule struct {
 	FnUnloadChunk       func(chunk.ChunkCoordinate)
 	FnQuit              func()
 	FnCountLoadedChunks func() int
+	FnIsVoxelLoaded     func(chunk.VoxelCoordinate) bool
 	FnGetBlockType      func(chunk.VoxelCoordinate) chunk.BlockType
 	FnRemoveBlock       func(chunk.VoxelCoordinate)
 	FnAddBlock          func(chunk.VoxelCoordinate, chunk.BlockType)
+	FnSetBlocks         func([]BlockEdit)
+	FnScheduleUpdate    func(chunk.VoxelCoordinate, int)
+	FnTick              func()
 	FnClose             func()
 }
 
@@ -90,6 +146,13 @@ func (fn FnModule) CountLoadedChunks() int {
 	return 0
 }
 
+func (fn FnModule) IsVoxelLoaded(vc chunk.VoxelCoordinate) bool {
+	if fn.FnIsVoxelLoaded != nil {
+		return fn.FnIsVoxelLoaded(vc)
+	}
+	return false
+}
+
 func (fn FnModule) GetBlockType(pos chunk.VoxelCoordinate) chunk.BlockType {
 	if fn.FnGetBlockType != nil {
 		return fn.FnGetBlockType(pos)
@@ -109,6 +172,24 @@ func (fn FnModule) AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) {
 	}
 }
 
+func (fn FnModule) SetBlocks(edits []BlockEdit) {
+	if fn.FnSetBlocks != nil {
+		fn.FnSetBlocks(edits)
+	}
+}
+
+func (fn FnModule) ScheduleUpdate(vc chunk.VoxelCoordinate, delay int) {
+	if fn.FnScheduleUpdate != nil {
+		fn.FnScheduleUpdate(vc, delay)
+	}
+}
+
+func (fn FnModule) Tick() {
+	if fn.FnTick != nil {
+		fn.FnTick()
+	}
+}
+
 func (fn FnModule) Close() {
 	if fn.FnClose != nil {
 		fn.FnClose()
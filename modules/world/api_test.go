@@ -2,7 +2,15 @@ package world_test
 
 import (
 	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -249,8 +257,9 @@ func TestWorldAddedSavesOnUnload(t *testing.T) {
 
 	var saved bool
 	cacheMod := &cache.FnModule{
-		FnSave: func(chunk.Chunk) {
+		FnSave: func(chunk.Chunk) error {
 			saved = true
+			return nil
 		},
 	}
 	settingsRepo := settings.FnRepository{
@@ -279,8 +288,9 @@ func TestWorldRemovedSavesOnUnload(t *testing.T) {
 
 	var saved bool
 	cacheMod := &cache.FnModule{
-		FnSave: func(chunk.Chunk) {
+		FnSave: func(chunk.Chunk) error {
 			saved = true
+			return nil
 		},
 	}
 	settingsRepo := settings.FnRepository{
@@ -310,9 +320,9 @@ func TestWorldLoadCallsCacheLoad(t *testing.T) {
 
 	var actualCc chunk.ChunkCoordinate
 	cacheMod := &cache.FnModule{
-		FnLoad: func(cc chunk.ChunkCoordinate) (chunk.Chunk, bool) {
+		FnLoad: func(cc chunk.ChunkCoordinate) (chunk.Chunk, error) {
 			actualCc = cc
-			return chunk.Chunk{}, true
+			return chunk.Chunk{}, nil
 		},
 	}
 	expectCc := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 1}
@@ -330,8 +340,9 @@ func TestWorldClosesCacheOnQuit(t *testing.T) {
 	expected := true
 	acutal := false
 	cacheMod := &cache.FnModule{
-		FnClose: func() {
+		FnClose: func() error {
 			acutal = true
+			return nil
 		},
 	}
 	worldMod := world.New(&graphics.FnModule{}, &world.FnGenerator{}, &settings.FnRepository{}, cacheMod, &view.FnModule{})
@@ -341,11 +352,162 @@ func TestWorldClosesCacheOnQuit(t *testing.T) {
 	}
 }
 
+func TestWorldLoadHandlesCacheErrors(t *testing.T) {
+	t.Parallel()
+	errRead := errors.New("read failed")
+	testCases := []struct {
+		desc             string
+		errs             []error
+		expectLoads      int
+		expectGenerated  bool
+		expectQuarantine bool
+	}{
+		{
+			desc:            "generates chunks that aren't saved",
+			errs:            []error{cache.ErrNotFound},
+			expectLoads:     1,
+			expectGenerated: true,
+		},
+		{
+			desc:             "quarantines and generates corrupt chunks",
+			errs:             []error{fmt.Errorf("%w: bad checksum", cache.ErrCorrupt)},
+			expectLoads:      1,
+			expectGenerated:  true,
+			expectQuarantine: true,
+		},
+		{
+			desc:            "tries again after read errors",
+			errs:            []error{errRead, nil},
+			expectLoads:     2,
+			expectGenerated: false,
+		},
+		{
+			desc:            "generates chunks that can't be read",
+			errs:            []error{errRead, errRead, errRead, errRead},
+			expectLoads:     3,
+			expectGenerated: true,
+		},
+	}
+	for _, tC := range testCases {
+		tC := tC
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+			loads := 0
+			quarantined := false
+			cacheMod := &cache.FnModule{
+				FnLoad: func(cc chunk.ChunkCoordinate) (chunk.Chunk, error) {
+					err := tC.errs[loads]
+					loads++
+					if err != nil {
+						return chunk.Chunk{}, err
+					}
+					return chunk.NewChunkEmpty(cc, 1), nil
+				},
+				FnSave: func(chunk.Chunk) error {
+					t.Fatal("expected the chunk in the cache not to be replaced")
+					return nil
+				},
+				FnQuarantine: func(chunk.ChunkCoordinate) error {
+					quarantined = true
+					return nil
+				},
+			}
+			generated := false
+			gen := &world.FnGenerator{
+				FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+					generated = true
+					return chunk.NewChunkEmpty(cc, 1), list.New()
+				},
+			}
+			worldMod := world.New(graphics.FnModule{}, gen, settings.FnRepository{}, cacheMod, &view.FnModule{})
+
+			worldMod.LoadChunk(chunk.ChunkCoordinate{})
+			worldMod.Quit()
+
+			if loads != tC.expectLoads {
+				t.Fatalf("expected %v loads but got %v", tC.expectLoads, loads)
+			}
+			if generated != tC.expectGenerated {
+				t.Fatalf("expected generated to be %v but got %v", tC.expectGenerated, generated)
+			}
+			if quarantined != tC.expectQuarantine {
+				t.Fatalf("expected quarantined to be %v but got %v", tC.expectQuarantine, quarantined)
+			}
+		})
+	}
+}
+
+func TestWorldDoesNotSaveOverUnreadableChunk(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize:      func() uint32 { return 1 },
+		FnGetRetainedChunks: func() uint32 { return 0 },
+	}
+	readable := false
+	cacheMod := &cache.FnModule{
+		FnLoad: func(cc chunk.ChunkCoordinate) (chunk.Chunk, error) {
+			if !readable {
+				return chunk.Chunk{}, errors.New("read failed")
+			}
+			ch := chunk.NewChunkEmpty(cc, 1)
+			ch.SetBlockType(chunk.VoxelCoordinate{}, chunk.BlockTypeStone)
+			return ch, nil
+		},
+		FnSave: func(ch chunk.Chunk) error {
+			t.Fatalf("expected the chunk that couldn't be read not to be saved over, but it was")
+			return nil
+		},
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			return chunk.NewChunkEmpty(cc, 1), list.New()
+		},
+	}
+	worldMod := world.New(&graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+	worldMod.AddBlock(chunk.VoxelCoordinate{}, chunk.BlockTypeSnow)
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{})
+
+	readable = true
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{}); bt != chunk.BlockTypeStone {
+		t.Fatalf("expected the saved chunk to load once it can be read, but got block type %v", bt)
+	}
+	worldMod.Quit()
+}
+
+func TestWorldTriesSavingAgain(t *testing.T) {
+	t.Parallel()
+	saves := 0
+	cacheMod := &cache.FnModule{
+		FnSave: func(chunk.Chunk) error {
+			saves++
+			return errors.New("write failed")
+		},
+	}
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 1
+		},
+	}
+	worldMod := world.New(&graphics.FnModule{}, &world.FnGenerator{}, settingsRepo, cacheMod, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+	worldMod.AddBlock(chunk.VoxelCoordinate{}, chunk.BlockTypeSnow)
+
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{})
+
+	if saves != 3 {
+		t.Fatalf("expected 3 saves but got %v", saves)
+	}
+}
+
 func TestWorldUnmodifiedNotSavedOnUnload(t *testing.T) {
 	t.Parallel()
 	cacheMod := &cache.FnModule{
-		FnSave: func(chunk.Chunk) {
+		FnSave: func(chunk.Chunk) error {
 			t.Fatal("chunk was saved when none were expected to")
+			return nil
 		},
 	}
 	worldMod := world.New(&graphics.FnModule{}, &world.FnGenerator{}, settings.FnRepository{}, cacheMod, &view.FnModule{})
@@ -356,8 +518,9 @@ func TestWorldUnmodifiedNotSavedOnUnload(t *testing.T) {
 func TestWorldUnmodifiedNotSavedOnQuit(t *testing.T) {
 	t.Parallel()
 	cacheMod := &cache.FnModule{
-		FnSave: func(chunk.Chunk) {
+		FnSave: func(chunk.Chunk) error {
 			t.Fatal("chunk was saved when none were expected to")
+			return nil
 		},
 	}
 	worldMod := world.New(&graphics.FnModule{}, &world.FnGenerator{}, settings.FnRepository{}, cacheMod, &view.FnModule{})
@@ -600,11 +763,19 @@ func TestGraphicsAdjacentChunksLoadAndUpdate(t *testing.T) {
 
 func TestWorldSaveAllChunksOnQuit(t *testing.T) {
 	t.Parallel()
-	expectSaved := 18
+	expectSaved := 2
 	actualSaved := 0
+	expectPending := 16
+	actualPending := map[chunk.ChunkCoordinate]struct{}{}
 	cacheMod := &cache.FnModule{
-		FnSave: func(chunk.Chunk) {
+		FnSave: func(chunk.Chunk) error {
 			actualSaved++
+			return nil
+		},
+		FnSavePending: func(cc chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+			if len(actions) > 0 {
+				actualPending[cc] = struct{}{}
+			}
 		},
 	}
 	settingsRepo := settings.FnRepository{
@@ -631,6 +802,60 @@ func TestWorldSaveAllChunksOnQuit(t *testing.T) {
 	if actualSaved != expectSaved {
 		t.Fatalf("expected chunk count to be %v but was %v", expectSaved, actualSaved)
 	}
+	if len(actualPending) != expectPending {
+		t.Fatalf("expected pending actions of %v chunks to be saved but got %v", expectPending, len(actualPending))
+	}
+}
+
+func TestPendingActionsAppliedWhenChunkLoaded(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 1 },
+	}
+	stored := map[chunk.ChunkCoordinate][]chunk.PendingAction{}
+	cacheMod := &cache.FnModule{
+		FnSavePending: func(cc chunk.ChunkCoordinate, actions []chunk.PendingAction) {
+			stored[cc] = actions
+		},
+		FnLoadPending: func(cc chunk.ChunkCoordinate) []chunk.PendingAction {
+			return stored[cc]
+		},
+	}
+	generated := map[chunk.ChunkCoordinate]int{}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			generated[cc]++
+			ch := chunk.NewChunkEmpty(cc, 1)
+			return ch, ch.SetBlockType(chunk.VoxelCoordinate{X: cc.X, Y: cc.Y, Z: cc.Z}, chunk.BlockTypeDirt)
+		},
+	}
+	worldMod := world.New(&graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+	worldMod.Quit()
+	neighbor := chunk.ChunkCoordinate{X: 1}
+	if generated[neighbor] != 0 {
+		t.Fatal("expected quit not to generate chunks with pending actions, but it did")
+	}
+	if len(stored[neighbor]) == 0 {
+		t.Fatal("expected pending actions of neighbor to be stored, but they were not")
+	}
+
+	var loaded chunk.Chunk
+	graphicsMod := &graphics.FnModule{
+		FnLoadChunk: func(ch chunk.Chunk) {
+			loaded = ch
+		},
+	}
+	worldMod = world.New(graphicsMod, testGen, settingsRepo, cacheMod, &view.FnModule{})
+
+	worldMod.LoadChunk(neighbor)
+
+	if loaded.Adjacency(chunk.VoxelCoordinate{X: 1}) == 0 {
+		t.Fatal("expected stored pending actions to be applied on load, but they were not")
+	}
+	if len(stored[neighbor]) != 0 {
+		t.Fatalf("expected stored pending actions to be cleared after loading, but got %v", stored[neighbor])
+	}
 }
 
 func TestWorldAddBlock(t *testing.T) {
@@ -803,6 +1028,67 @@ func TestWorldAddBlockUpdatesGraphicsNeighbor(t *testing.T) {
 	}
 }
 
+func TestWorldSetBlocksMatchesSingleEdits(t *testing.T) {
+	t.Parallel()
+
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 2
+		},
+	}
+	chunkPos1 := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	chunkPos2 := chunk.ChunkCoordinate{X: 1, Y: 0, Z: 0}
+	var edits []world.BlockEdit
+	chunk.NewChunkEmpty(chunkPos1, 2).ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+		edits = append(edits, world.BlockEdit{VoxPos: vc, BlockType: chunk.BlockTypeStone})
+	})
+	edits = append(edits,
+		world.BlockEdit{VoxPos: chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}, BlockType: chunk.BlockTypeAir},
+		world.BlockEdit{VoxPos: chunk.VoxelCoordinate{X: 2, Y: 1, Z: 1}, BlockType: chunk.BlockTypeSand},
+		world.BlockEdit{VoxPos: chunk.VoxelCoordinate{X: 3, Y: 1, Z: 1}, BlockType: chunk.BlockTypeLeaf},
+	)
+	newWorld := func(updates map[chunk.ChunkCoordinate]int) (*world.Module, map[chunk.ChunkCoordinate]chunk.Chunk) {
+		chunks := map[chunk.ChunkCoordinate]chunk.Chunk{}
+		graphicsMod := &graphics.FnModule{
+			FnLoadChunk: func(ch chunk.Chunk) {
+				chunks[ch.Position()] = ch
+			},
+			FnUpdateChunk: func(ch chunk.Chunk) {
+				updates[ch.Position()]++
+			},
+		}
+		worldMod := world.New(graphicsMod, &world.FnGenerator{
+			FnGenerateChunk: func(chPos chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+				return chunk.NewChunkEmpty(chPos, settingsRepo.GetChunkSize()), list.New()
+			},
+		}, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+		worldMod.LoadChunk(chunkPos1)
+		worldMod.LoadChunk(chunkPos2)
+		return worldMod, chunks
+	}
+	single, expectChunks := newWorld(map[chunk.ChunkCoordinate]int{})
+	for _, edit := range edits {
+		if edit.BlockType == chunk.BlockTypeAir {
+			single.RemoveBlock(edit.VoxPos)
+		} else {
+			single.AddBlock(edit.VoxPos, edit.BlockType)
+		}
+	}
+	updates := map[chunk.ChunkCoordinate]int{}
+	bulk, actualChunks := newWorld(updates)
+
+	bulk.SetBlocks(edits)
+
+	if !reflect.DeepEqual(actualChunks, expectChunks) {
+		t.Fatalf("expected chunks %v but got %v", expectChunks, actualChunks)
+	}
+	// a chunk is updated for its own edits and for edits of its neighbor
+	expectUpdates := map[chunk.ChunkCoordinate]int{chunkPos1: 2, chunkPos2: 2}
+	if !reflect.DeepEqual(updates, expectUpdates) {
+		t.Fatalf("expected updates %v but got %v", expectUpdates, updates)
+	}
+}
+
 func BenchmarkWorldLoadUnload(b *testing.B) {
 	chPos := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
 	chunkSize := uint32(25)
@@ -1018,3 +1304,749 @@ func BenchmarkTravelingInWorldParallel(b *testing.B) {
 	worldMod.Close()
 	<-done
 }
+
+func TestRandomTickMeltsSnowNearLight(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize:       func() uint32 { return 1 },
+		FnGetRandomTickSpeed: func() uint32 { return 1 },
+	}
+	blocks := map[chunk.VoxelCoordinate]chunk.BlockType{
+		{X: 0, Y: 0, Z: 0}: chunk.BlockTypeSnowSides,
+		{X: 2, Y: 0, Z: 0}: chunk.BlockTypeLight,
+		{X: 9, Y: 0, Z: 0}: chunk.BlockTypeSnow,
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			vc := chunk.VoxelCoordinate{X: cc.X, Y: cc.Y, Z: cc.Z}
+			return ch, ch.SetBlockType(vc, blocks[vc])
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+	for vc := range blocks {
+		worldMod.LoadChunk(chunk.ChunkCoordinate{X: vc.X, Y: vc.Y, Z: vc.Z})
+	}
+
+	worldMod.Tick()
+
+	if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}); bt != chunk.BlockTypeAir {
+		t.Fatalf("expected snow near light to melt, but got block type %v", bt)
+	}
+	if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{X: 9, Y: 0, Z: 0}); bt != chunk.BlockTypeSnow {
+		t.Fatalf("expected snow far from light to stay, but got block type %v", bt)
+	}
+}
+
+func TestRandomTickSpreadsGrassOntoDirt(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize:       func() uint32 { return 3 },
+		FnGetRandomTickSpeed: func() uint32 { return 5 },
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 3)
+			actions := list.New()
+			ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				if vc.Y != 0 {
+					return
+				}
+				if vc.X == 0 && vc.Z == 0 {
+					actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeGrassSides))
+				} else {
+					actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeDirt))
+				}
+			})
+			return ch, actions
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	for i := 0; i < 1000; i++ {
+		worldMod.Tick()
+	}
+
+	for x := int32(0); x < 3; x++ {
+		for z := int32(0); z < 3; z++ {
+			vc := chunk.VoxelCoordinate{X: x, Y: 0, Z: z}
+			if bt := worldMod.GetBlockType(vc); bt != chunk.BlockTypeGrassSides {
+				t.Fatalf("expected grass to spread to %v, but got block type %v", vc, bt)
+			}
+		}
+	}
+}
+
+func TestRandomTickGrassDoesNotSpreadUnderBlocks(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize:       func() uint32 { return 3 },
+		FnGetRandomTickSpeed: func() uint32 { return 5 },
+	}
+	covered := chunk.VoxelCoordinate{X: 1, Y: 0, Z: 0}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 3)
+			actions := list.New()
+			actions.PushBackList(ch.SetBlockType(chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}, chunk.BlockTypeGrass))
+			actions.PushBackList(ch.SetBlockType(covered, chunk.BlockTypeDirt))
+			actions.PushBackList(ch.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 1, Z: 0}, chunk.BlockTypeStone))
+			return ch, actions
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	for i := 0; i < 100; i++ {
+		worldMod.Tick()
+	}
+
+	if bt := worldMod.GetBlockType(covered); bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected covered dirt to stay dirt, but got block type %v", bt)
+	}
+}
+
+func TestRandomTickIsDeterministic(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize:       func() uint32 { return 4 },
+		FnGetRandomTickSpeed: func() uint32 { return 2 },
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 4)
+			actions := list.New()
+			ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeStone))
+			})
+			return ch, actions
+		},
+	}
+	runTicks := func() []chunk.VoxelCoordinate {
+		var ticked []chunk.VoxelCoordinate
+		worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+		worldMod.SetRandomTickSeed(42)
+		worldMod.SetRandomTickHandler(chunk.BlockTypeStone, func(_ world.Interface, vc chunk.VoxelCoordinate, _ *rand.Rand) {
+			ticked = append(ticked, vc)
+		})
+		for x := int32(-1); x <= 1; x++ {
+			for z := int32(-1); z <= 1; z++ {
+				worldMod.LoadChunk(chunk.ChunkCoordinate{X: x, Y: 0, Z: z})
+			}
+		}
+		for i := 0; i < 10; i++ {
+			worldMod.Tick()
+		}
+		return ticked
+	}
+
+	expected := runTicks()
+	actual := runTicks()
+
+	if len(expected) != 9*2*10 {
+		t.Fatalf("expected %v random ticks but got %v", 9*2*10, len(expected))
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected the same random ticks with the same seed, but got %v and %v", expected, actual)
+	}
+}
+
+func TestRandomTickHandlerRemoved(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetRandomTickSpeed: func() uint32 { return 1 },
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			return ch, ch.SetBlockType(chunk.VoxelCoordinate{}, chunk.BlockTypeSnow)
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+	worldMod.SetRandomTickHandler(chunk.BlockTypeSnow, func(world.Interface, chunk.VoxelCoordinate, *rand.Rand) {
+		t.Fatal("expected removed handler to not be called, but it was")
+	})
+	worldMod.SetRandomTickHandler(chunk.BlockTypeSnow, nil)
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	worldMod.Tick()
+}
+
+func TestScheduledUpdateRunsWhenDue(t *testing.T) {
+	t.Parallel()
+	vc := chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			return ch, ch.SetBlockType(vc, chunk.BlockTypeLog)
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settings.FnRepository{}, &cache.FnModule{}, &view.FnModule{})
+	var updated []chunk.VoxelCoordinate
+	worldMod.SetScheduledUpdateHandler(chunk.BlockTypeLog, func(_ world.Interface, vc chunk.VoxelCoordinate) {
+		updated = append(updated, vc)
+	})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	worldMod.ScheduleUpdate(vc, 3)
+	worldMod.Tick()
+	worldMod.Tick()
+	if len(updated) != 0 {
+		t.Fatalf("expected no updates before they are due, but got %v", updated)
+	}
+	worldMod.Tick()
+	if !reflect.DeepEqual(updated, []chunk.VoxelCoordinate{vc}) {
+		t.Fatalf("expected update of %v but got %v", vc, updated)
+	}
+	worldMod.Tick()
+	if len(updated) != 1 {
+		t.Fatalf("expected the update to run once, but it ran %v times", len(updated))
+	}
+}
+
+func TestSandFallsWhenBlockBelowIsRemoved(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 4 },
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 4)
+			actions := list.New()
+			actions.PushBackList(ch.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 0, Z: 1}, chunk.BlockTypeStone))
+			actions.PushBackList(ch.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 2, Z: 1}, chunk.BlockTypeDirt))
+			actions.PushBackList(ch.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 3, Z: 1}, chunk.BlockTypeSand))
+			return ch, actions
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, &cache.FnModule{}, &view.FnModule{})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+
+	worldMod.RemoveBlock(chunk.VoxelCoordinate{X: 1, Y: 2, Z: 1})
+	for i := 0; i < 5; i++ {
+		worldMod.Tick()
+	}
+
+	if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}); bt != chunk.BlockTypeSand {
+		t.Fatalf("expected sand to land on stone, but got block type %v", bt)
+	}
+	for _, y := range []int32{2, 3} {
+		if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{X: 1, Y: y, Z: 1}); bt != chunk.BlockTypeAir {
+			t.Fatalf("expected sand to have fallen from y=%v, but got block type %v", y, bt)
+		}
+	}
+}
+
+func TestScheduledUpdatesPersistWithUnloadedChunk(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 2 },
+	}
+	saved := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{}
+	cacheMod := &cache.FnModule{
+		FnSaveScheduled: func(cc chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+			saved[cc] = updates
+		},
+		FnLoadScheduled: func(cc chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+			return saved[cc]
+		},
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 2)
+			actions := list.New()
+			ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				actions.PushBackList(ch.SetBlockType(vc, chunk.BlockTypeLog))
+			})
+			return ch, actions
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	var updated []chunk.VoxelCoordinate
+	worldMod.SetScheduledUpdateHandler(chunk.BlockTypeLog, func(_ world.Interface, vc chunk.VoxelCoordinate) {
+		updated = append(updated, vc)
+	})
+	unloaded := chunk.ChunkCoordinate{X: 1, Y: 0, Z: 0}
+	first := chunk.VoxelCoordinate{X: 2, Y: 0, Z: 0}
+	second := chunk.VoxelCoordinate{X: 3, Y: 1, Z: 1}
+	worldMod.LoadChunk(chunk.ChunkCoordinate{})
+	worldMod.LoadChunk(unloaded)
+	worldMod.ScheduleUpdate(second, 5)
+	worldMod.ScheduleUpdate(first, 4)
+	worldMod.ScheduleUpdate(chunk.VoxelCoordinate{}, 100)
+	worldMod.Tick()
+
+	worldMod.UnloadChunk(unloaded)
+	expectSaved := []chunk.ScheduledUpdate{
+		{VoxPos: first, Delay: 3},
+		{VoxPos: second, Delay: 4},
+	}
+	if !reflect.DeepEqual(saved[unloaded], expectSaved) {
+		t.Fatalf("expected saved updates %v but got %v", expectSaved, saved[unloaded])
+	}
+	for i := 0; i < 10; i++ {
+		worldMod.Tick()
+	}
+	if len(updated) != 0 {
+		t.Fatalf("expected no updates while the chunk is unloaded, but got %v", updated)
+	}
+
+	worldMod.LoadChunk(unloaded)
+	for i := 0; i < 4; i++ {
+		worldMod.Tick()
+	}
+	expectUpdated := []chunk.VoxelCoordinate{first, second}
+	if !reflect.DeepEqual(updated, expectUpdated) {
+		t.Fatalf("expected updates %v after reloading but got %v", expectUpdated, updated)
+	}
+}
+
+func TestScheduledUpdatesKeepOrderAfterUnloadingAChunk(t *testing.T) {
+	t.Parallel()
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			return ch, ch.SetBlockType(chunk.VoxelCoordinate{X: cc.X}, chunk.BlockTypeLog)
+		},
+	}
+	var saved []chunk.ScheduledUpdate
+	cacheMod := &cache.FnModule{
+		FnSaveScheduled: func(cc chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+			if cc.X == 2 {
+				saved = updates
+			}
+		},
+	}
+	settingsRepo := settings.FnRepository{
+		FnGetRetainedChunks: func() uint32 { return 0 },
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	var updated []int32
+	worldMod.SetScheduledUpdateHandler(chunk.BlockTypeLog, func(_ world.Interface, vc chunk.VoxelCoordinate) {
+		updated = append(updated, vc.X)
+	})
+	for x := int32(0); x < 4; x++ {
+		worldMod.LoadChunk(chunk.ChunkCoordinate{X: x})
+	}
+	delays := []int{7, 3, 5, 3, 1, 8, 2, 5, 6, 4, 2, 9}
+	for i, delay := range delays {
+		worldMod.ScheduleUpdate(chunk.VoxelCoordinate{X: int32(i % 4)}, delay)
+	}
+
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{X: 2})
+	for i := 0; i < 10; i++ {
+		worldMod.Tick()
+	}
+
+	// the updates of the other chunks, by delay and then in scheduling order
+	expectUpdated := []int32{0, 1, 3, 1, 3, 0, 0, 1, 3}
+	if !reflect.DeepEqual(updated, expectUpdated) {
+		t.Fatalf("expected updates %v but got %v", expectUpdated, updated)
+	}
+	expectSaved := []chunk.ScheduledUpdate{
+		{VoxPos: chunk.VoxelCoordinate{X: 2}, Delay: 2},
+		{VoxPos: chunk.VoxelCoordinate{X: 2}, Delay: 2},
+		{VoxPos: chunk.VoxelCoordinate{X: 2}, Delay: 5},
+	}
+	if !reflect.DeepEqual(saved, expectSaved) {
+		t.Fatalf("expected saved updates %v but got %v", expectSaved, saved)
+	}
+}
+
+func TestScheduledUpdatesSavedOnQuit(t *testing.T) {
+	t.Parallel()
+	saved := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{}
+	cacheMod := &cache.FnModule{
+		FnSaveScheduled: func(cc chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+			saved[cc] = updates
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, &world.FnGenerator{}, settings.FnRepository{}, cacheMod, &view.FnModule{})
+	vc := chunk.VoxelCoordinate{X: 4, Y: 5, Z: 6}
+	worldMod.LoadChunk(chunk.ChunkCoordinate{X: 4, Y: 5, Z: 6})
+	worldMod.ScheduleUpdate(vc, 7)
+
+	worldMod.Quit()
+
+	expected := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{
+		{X: 4, Y: 5, Z: 6}: {{VoxPos: vc, Delay: 7}},
+	}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Fatalf("expected saved updates %v but got %v", expected, saved)
+	}
+}
+
+func TestScheduledUpdatesRunOnceAcrossReopen(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	vc := chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			return ch, ch.SetBlockType(vc, chunk.BlockTypeLog)
+		},
+	}
+	updated := 0
+	open := func() world.Interface {
+		worldMod := world.New(graphics.FnModule{}, testGen, settings.FnRepository{}, cache.New(fs, settings.FnRepository{}), &view.FnModule{})
+		worldMod.SetScheduledUpdateHandler(chunk.BlockTypeLog, func(world.Interface, chunk.VoxelCoordinate) {
+			updated++
+		})
+		worldMod.LoadChunk(chunk.ChunkCoordinate{})
+		return worldMod
+	}
+	worldMod := open()
+	worldMod.ScheduleUpdate(vc, 2)
+	worldMod.Quit()
+
+	for i := 0; i < 2; i++ {
+		worldMod = open()
+		worldMod.Tick()
+		worldMod.Tick()
+		worldMod.Quit()
+	}
+
+	if updated != 1 {
+		t.Fatalf("expected the update to run once, but it ran %v times", updated)
+	}
+}
+
+func TestRetainedChunkReloadsWithoutCacheOrGenerator(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetRetainedChunks: func() uint32 { return 1 },
+	}
+	cacheLoads := 0
+	cacheMod := &cache.FnModule{
+		FnLoad: func(chunk.ChunkCoordinate) (chunk.Chunk, error) {
+			cacheLoads++
+			return chunk.Chunk{}, cache.ErrNotFound
+		},
+		FnSave: func(chunk.Chunk) error {
+			t.Fatal("expected retained chunk not to be saved, but it was")
+			return nil
+		},
+	}
+	generated := 0
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			generated++
+			return chunk.NewChunkEmpty(cc, 1), list.New()
+		},
+	}
+	var graphicsUnloaded []chunk.ChunkCoordinate
+	graphicsMod := &graphics.FnModule{
+		FnUnloadChunk: func(cc chunk.ChunkCoordinate) {
+			graphicsUnloaded = append(graphicsUnloaded, cc)
+		},
+	}
+	worldMod := world.New(graphicsMod, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	cc := chunk.ChunkCoordinate{X: 1, Y: 2, Z: 3}
+	worldMod.LoadChunk(cc)
+	worldMod.AddBlock(chunk.VoxelCoordinate{X: 1, Y: 2, Z: 3}, chunk.BlockTypeDirt)
+
+	worldMod.UnloadChunk(cc)
+	worldMod.LoadChunk(cc)
+
+	if cacheLoads != 1 || generated != 1 {
+		t.Fatalf("expected one cache load and generation, but got %v and %v", cacheLoads, generated)
+	}
+	if !reflect.DeepEqual(graphicsUnloaded, []chunk.ChunkCoordinate{cc}) {
+		t.Fatalf("expected graphics to unload %v but got %v", cc, graphicsUnloaded)
+	}
+	if bt := worldMod.GetBlockType(chunk.VoxelCoordinate{X: 1, Y: 2, Z: 3}); bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected reloaded chunk to keep its changes, but got block type %v", bt)
+	}
+	if worldMod.CountLoadedChunks() != 1 {
+		t.Fatalf("expected 1 loaded chunk but got %v", worldMod.CountLoadedChunks())
+	}
+}
+
+func TestRetainedChunksEvictLeastRecentlyUnloaded(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetRetainedChunks: func() uint32 { return 2 },
+	}
+	var saved []chunk.ChunkCoordinate
+	cacheMod := &cache.FnModule{
+		FnSave: func(ch chunk.Chunk) error {
+			saved = append(saved, ch.Position())
+			return nil
+		},
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			return chunk.NewChunkEmpty(cc, 1), list.New()
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	for x := int32(0); x < 4; x++ {
+		worldMod.LoadChunk(chunk.ChunkCoordinate{X: x})
+		worldMod.AddBlock(chunk.VoxelCoordinate{X: x}, chunk.BlockTypeDirt)
+	}
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{X: 0})
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{X: 1})
+	worldMod.LoadChunk(chunk.ChunkCoordinate{X: 0})
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{X: 0})
+
+	worldMod.UnloadChunk(chunk.ChunkCoordinate{X: 2})
+
+	expected := []chunk.ChunkCoordinate{{X: 1}}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Fatalf("expected evicted chunks %v to be saved but got %v", expected, saved)
+	}
+}
+
+func TestRetainedChunksSavedOnQuit(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetRetainedChunks: func() uint32 { return 10 },
+	}
+	saved := map[chunk.ChunkCoordinate]struct{}{}
+	savedScheduled := map[chunk.ChunkCoordinate][]chunk.ScheduledUpdate{}
+	cacheMod := &cache.FnModule{
+		FnSave: func(ch chunk.Chunk) error {
+			saved[ch.Position()] = struct{}{}
+			return nil
+		},
+		FnSaveScheduled: func(cc chunk.ChunkCoordinate, updates []chunk.ScheduledUpdate) {
+			savedScheduled[cc] = updates
+		},
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			return chunk.NewChunkEmpty(cc, 1), list.New()
+		},
+	}
+	worldMod := world.New(graphics.FnModule{}, testGen, settingsRepo, cacheMod, &view.FnModule{})
+	modified := chunk.ChunkCoordinate{X: 5}
+	unmodified := chunk.ChunkCoordinate{X: 9}
+	worldMod.LoadChunk(modified)
+	worldMod.LoadChunk(unmodified)
+	worldMod.AddBlock(chunk.VoxelCoordinate{X: 5}, chunk.BlockTypeDirt)
+	worldMod.ScheduleUpdate(chunk.VoxelCoordinate{X: 9}, 3)
+	worldMod.UnloadChunk(modified)
+	worldMod.UnloadChunk(unmodified)
+
+	worldMod.Quit()
+
+	if _, ok := saved[modified]; !ok {
+		t.Fatal("expected modified retained chunk to be saved, but it was not")
+	}
+	if _, ok := saved[unmodified]; ok {
+		t.Fatal("expected unmodified retained chunk not to be saved, but it was")
+	}
+	expectScheduled := []chunk.ScheduledUpdate{{VoxPos: chunk.VoxelCoordinate{X: 9}, Delay: 3}}
+	if !reflect.DeepEqual(savedScheduled[unmodified], expectScheduled) {
+		t.Fatalf("expected saved updates %v but got %v", expectScheduled, savedScheduled[unmodified])
+	}
+}
+
+func TestNewGeneratorByName(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"alex", "flat", "trent"} {
+		gen, err := world.NewGenerator(name, nil, settings.FnRepository{})
+		if err != nil {
+			t.Fatalf("expected generator %v to exist, but got %v", name, err)
+		}
+		if gen == nil {
+			t.Fatalf("expected generator %v to be non-nil", name)
+		}
+	}
+	_, err := world.NewGenerator("missing", nil, settings.FnRepository{})
+	if !errors.Is(err, world.ErrUnknownGenerator) {
+		t.Fatalf("expected %q but got %q", world.ErrUnknownGenerator, err)
+	}
+}
+
+func TestIsUnchanged(t *testing.T) {
+	t.Parallel()
+	gen := world.NewFlatWorldGenerator(settings.FnRepository{
+		FnGetChunkSize: func() uint32 {
+			return 2
+		},
+	})
+	pos := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	ch, _ := gen.GenerateChunk(pos)
+
+	if !world.IsUnchanged(gen, ch) {
+		t.Fatal("expected a generated chunk to be unchanged")
+	}
+	ch.SetBlockType(chunk.VoxelCoordinate{X: 1, Y: 1, Z: 1}, chunk.BlockTypeLeaf)
+	if world.IsUnchanged(gen, ch) {
+		t.Fatal("expected a chunk with a changed block to be changed")
+	}
+}
+
+func TestHeightmapInterpolatesBetweenPixels(t *testing.T) {
+	t.Parallel()
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(1, 0, color.Gray{Y: 255})
+	gen := world.NewHeightmapGenerator(img, world.HeightmapConfig{
+		HorizontalScale: 2,
+		VerticalScale:   10,
+		SeaLevel:        5,
+		Fill:            0.5,
+	}, settings.FnRepository{})
+	expect := map[[2]int32]int32{
+		{0, 0}:  5,
+		{1, 0}:  10,
+		{2, 0}:  15,
+		{3, 0}:  15,
+		{2, 1}:  15,
+		{4, 0}:  10,
+		{-1, 0}: 10,
+		{0, 2}:  10,
+	}
+	for pos, h := range expect {
+		if actual := gen.HeightAt(pos[0], pos[1]); actual != h {
+			t.Fatalf("expected height %v at %v but got %v", h, pos, actual)
+		}
+	}
+}
+
+func TestHeightmapLayersTerrain(t *testing.T) {
+	t.Parallel()
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+	settingsRepo := &settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 16 },
+	}
+	gen := world.NewHeightmapGenerator(img, world.HeightmapConfig{
+		HorizontalScale: 1,
+		VerticalScale:   10,
+		SeaLevel:        2,
+	}, settingsRepo)
+
+	ch, _ := gen.GenerateChunk(chunk.ChunkCoordinate{})
+
+	expect := map[int32]chunk.BlockType{
+		13: chunk.BlockTypeAir,
+		12: chunk.BlockTypeGrassSides,
+		11: chunk.BlockTypeDirt,
+		10: chunk.BlockTypeDirt,
+		9:  chunk.BlockTypeStone,
+	}
+	for y, bt := range expect {
+		if actual := ch.BlockType(chunk.VoxelCoordinate{Y: y}); actual != bt {
+			t.Fatalf("expected %v at height %v but got %v", bt, y, actual)
+		}
+	}
+	// outside of the image, the fill is black at sea level
+	if actual := ch.BlockType(chunk.VoxelCoordinate{X: 1, Y: 2}); actual != chunk.BlockTypeGrassSides {
+		t.Fatalf("expected %v at sea level but got %v", chunk.BlockTypeGrassSides, actual)
+	}
+}
+
+func TestNewHeightmapGeneratorFromSettings(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "terrain.png")
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	gen, err := world.NewGenerator("heightmap", map[string]string{
+		"image":         path,
+		"verticalScale": "4",
+		"seaLevel":      "-3",
+	}, settings.FnRepository{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := gen.(*world.HeightmapGenerator).HeightAt(0, 0); h != 1 {
+		t.Fatalf("expected height 1 but got %v", h)
+	}
+	invalid := []map[string]string{
+		{},
+		{"image": path, "fill": "2"},
+		{"image": path, "horizontalScale": "0"},
+		{"image": path, "seaLevel": "high"},
+	}
+	for _, generatorSettings := range invalid {
+		_, err := world.NewGenerator("heightmap", generatorSettings, settings.FnRepository{})
+		if !errors.Is(err, world.ErrHeightmap) {
+			t.Fatalf("expected %q for %v but got %q", world.ErrHeightmap, generatorSettings, err)
+		}
+	}
+}
+
+func TestFindSafeSpawnAboveTerrain(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 2 },
+	}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 2)
+			ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+				if vc.Y < 5 {
+					ch.SetBlockType(vc, chunk.BlockTypeDirt)
+				}
+			})
+			return ch, list.New()
+		},
+	}
+	expected := chunk.VoxelCoordinate{X: 1, Y: 5, Z: -1}
+
+	actual := world.FindSafeSpawn(testGen, &cache.FnModule{}, settingsRepo, chunk.VoxelCoordinate{X: 1, Y: -3, Z: -1})
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestFindSafeSpawnSkipsGapsTooSmall(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 1 },
+	}
+	solid := map[int32]bool{0: true, 2: true, 3: true}
+	testGen := &world.FnGenerator{
+		FnGenerateChunk: func(cc chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			if solid[cc.Y] {
+				ch.SetBlockType(chunk.VoxelCoordinate{X: cc.X, Y: cc.Y, Z: cc.Z}, chunk.BlockTypeStone)
+			}
+			return ch, list.New()
+		},
+	}
+	expected := chunk.VoxelCoordinate{X: 0, Y: 4, Z: 0}
+
+	actual := world.FindSafeSpawn(testGen, &cache.FnModule{}, settingsRepo, chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0})
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestFindSafeSpawnPrefersSavedChunks(t *testing.T) {
+	t.Parallel()
+	settingsRepo := settings.FnRepository{
+		FnGetChunkSize: func() uint32 { return 1 },
+	}
+	cacheMod := &cache.FnModule{
+		FnLoad: func(cc chunk.ChunkCoordinate) (chunk.Chunk, error) {
+			ch := chunk.NewChunkEmpty(cc, 1)
+			if cc.Y == 0 {
+				ch.SetBlockType(chunk.VoxelCoordinate{X: cc.X, Y: cc.Y, Z: cc.Z}, chunk.BlockTypeStone)
+			}
+			return ch, nil
+		},
+	}
+	expected := chunk.VoxelCoordinate{X: 0, Y: 1, Z: 0}
+
+	actual := world.FindSafeSpawn(&world.FnGenerator{}, cacheMod, settingsRepo, chunk.VoxelCoordinate{X: 0, Y: 0, Z: 0})
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
@@ -1,9 +1,13 @@
 package world
 
 import (
+	"container/heap"
 	"container/list"
+	"math/rand"
+	"sort"
 
 	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
 	"github.com/kroppt/voxels/modules/cache"
 	"github.com/kroppt/voxels/modules/graphics"
 	"github.com/kroppt/voxels/modules/view"
@@ -11,29 +15,67 @@ import (
 )
 
 type core struct {
-	graphicsMod    graphics.Interface
-	generator      Generator
-	settingsRepo   settings.Interface
-	cacheMod       cache.Interface
-	viewMod        view.Interface
-	loadedChunks   map[chunk.ChunkCoordinate]*chunkState
-	pendingActions map[chunk.ChunkCoordinate]*list.List
+	graphicsMod        graphics.Interface
+	generator          Generator
+	settingsRepo       settings.Interface
+	cacheMod           cache.Interface
+	viewMod            view.Interface
+	loadedChunks       map[chunk.ChunkCoordinate]*chunkState
+	pendingActions     map[chunk.ChunkCoordinate]*list.List
+	rng                *rand.Rand
+	randomTickHandlers map[chunk.BlockType]RandomTickHandler
+	updateHandlers     map[chunk.BlockType]ScheduledUpdateHandler
+	updates            updateQueue
+	updateSeq          int
+	currentTick        int
+	// chunkUpdates holds the scheduled updates in updates by chunk
+	chunkUpdates map[chunk.ChunkCoordinate][]*scheduledUpdate
+	// tickOrder is loadedChunks in a fixed order, or nil if it must be rebuilt
+	tickOrder []chunk.ChunkCoordinate
+	// retained holds unloaded chunks kept in memory, as elements of
+	// retainOrder, which is ordered most recently unloaded first
+	retained    map[chunk.ChunkCoordinate]*list.Element
+	retainOrder *list.List
 }
 
 type chunkState struct {
 	ch       chunk.Chunk
 	modified bool
+	// standIn is set if the saved chunk couldn't be read and ch was generated
+	// in its place, so ch must not be saved over it
+	standIn bool
 }
 
 func (c *core) loadChunk(pos chunk.ChunkCoordinate) {
 	if _, ok := c.loadedChunks[pos]; ok {
 		panic("tried to load already-loaded chunk")
 	}
-	ch, ok := c.cacheMod.Load(pos)
+	var cs *chunkState
+	var scheduled []chunk.ScheduledUpdate
 	actions := list.New()
-	if !ok {
-		ch, actions = c.generator.GenerateChunk(pos)
+	if rc, ok := c.takeRetained(pos); ok {
+		cs = rc.cs
+		scheduled = rc.scheduled
+	} else {
+		ch, result := loadSaved(c.cacheMod, pos)
+		if result != loadedSaved {
+			ch, actions = c.generator.GenerateChunk(pos)
+		}
+		cs = &chunkState{
+			ch:       ch,
+			modified: false,
+			standIn:  result == loadFailed,
+		}
+		scheduled = c.cacheMod.LoadScheduled(pos)
+		if len(scheduled) != 0 {
+			// the updates run again only if they are saved again
+			c.cacheMod.SaveScheduled(pos, nil)
+		}
+		if !cs.standIn {
+			c.takeStoredPendingActions(pos)
+		}
 	}
+	ch := cs.ch
 	var root *view.Octree
 	ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
 		if ch.BlockType(vc) != chunk.BlockTypeAir {
@@ -42,28 +84,49 @@ func (c *core) loadChunk(pos chunk.ChunkCoordinate) {
 	})
 	c.viewMod.AddTree(pos, root)
 
-	c.loadedChunks[pos] = &chunkState{
-		ch:       ch,
-		modified: false,
-	}
+	c.loadedChunks[pos] = cs
+	c.tickOrder = nil
 	c.handlePendingActions(actions)
 	if _, ok := c.pendingActions[pos]; ok {
 		c.performPendingActions(pos)
 	}
+	c.matchNeighbours(pos)
+	for _, u := range scheduled {
+		c.scheduleUpdate(u.VoxPos, int(u.Delay))
+	}
 	c.graphicsMod.LoadChunk(ch)
 }
 
+// matchNeighbours sets the adjacency of the faces between the chunk at pos and
+// the loaded chunks next to it from the block types on either side, because
+// saved chunks only know which of their faces are adjacent within themselves.
+func (c *core) matchNeighbours(pos chunk.ChunkCoordinate) {
+	ch := c.loadedChunks[pos].ch
+	sides := []chunk.ChunkCoordinate{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}, {Z: -1}, {Z: 1}}
+	for _, d := range sides {
+		cs, ok := c.loadedChunks[chunk.ChunkCoordinate{X: pos.X + d.X, Y: pos.Y + d.Y, Z: pos.Z + d.Z}]
+		if !ok {
+			continue
+		}
+		if _, changed := ch.MatchAdjacency(cs.ch); changed {
+			c.graphicsMod.UpdateChunk(cs.ch)
+		}
+	}
+}
+
+// unloadChunk releases the chunk's view and graphics resources and keeps it in
+// memory until it is evicted to the cache.
 func (c *core) unloadChunk(pos chunk.ChunkCoordinate) {
 	cs, ok := c.loadedChunks[pos]
 	if !ok {
 		panic("tried to unload a chunk that is not loaded")
 	}
-	if cs.modified {
-		c.cacheMod.Save(cs.ch)
-	}
+	scheduled := c.takeScheduledUpdates(pos)
 	c.viewMod.RemoveTree(pos)
 	delete(c.loadedChunks, pos)
+	c.tickOrder = nil
 	c.graphicsMod.UnloadChunk(pos)
+	c.retain(pos, cs, scheduled)
 }
 
 func (c *core) handlePendingActions(actions *list.List) {
@@ -99,32 +162,64 @@ func (c *core) performPendingActions(cc chunk.ChunkCoordinate) {
 	if !ok {
 		panic("attempted to perform pending actions on a chunk that isn't loaded")
 	}
+	if cs.standIn {
+		// kept for when the saved chunk can be read
+		return
+	}
 	cs.ch.ApplyActions(actions)
 	c.loadedChunks[cc].modified = true
 	delete(c.pendingActions, cc)
 }
 
+// takeStoredPendingActions moves the pending actions the cache holds for pos in
+// front of the ones collected since, as they are older.
+func (c *core) takeStoredPendingActions(pos chunk.ChunkCoordinate) {
+	stored := c.cacheMod.LoadPending(pos)
+	if len(stored) == 0 {
+		return
+	}
+	actions := list.New()
+	for _, pa := range stored {
+		actions.PushBack(pa)
+	}
+	if newer, ok := c.pendingActions[pos]; ok {
+		actions.PushBackList(newer)
+	}
+	c.pendingActions[pos] = actions
+	c.cacheMod.SavePending(pos, nil)
+}
+
 func (c *core) quit() {
+	c.evictAll()
+	// pending actions are only applied once their chunk is loaded again
 	for key, actions := range c.pendingActions {
-		ch, ok := c.cacheMod.Load(key)
-		if !ok {
-			ch, _ = c.generator.GenerateChunk(key)
+		stored := c.cacheMod.LoadPending(key)
+		for action := actions.Front(); action != nil; action = action.Next() {
+			stored = append(stored, action.Value.(chunk.PendingAction))
 		}
-		ch.ApplyActions(actions)
-		c.cacheMod.Save(ch)
+		c.cacheMod.SavePending(key, stored)
 	}
 	for _, cs := range c.loadedChunks {
-		if cs.modified {
-			c.cacheMod.Save(cs.ch)
-		}
+		saveChunkState(c.cacheMod, cs)
+	}
+	for pos := range c.chunkUpdates {
+		c.cacheMod.SaveScheduled(pos, c.takeScheduledUpdates(pos))
+	}
+	if err := c.cacheMod.Close(); err != nil {
+		log.Warnf("failed to close the cache: %v", err)
 	}
-	c.cacheMod.Close()
 }
 
 func (c *core) countLoadedChunks() int {
 	return len(c.loadedChunks)
 }
 
+func (c *core) isVoxelLoaded(vc chunk.VoxelCoordinate) bool {
+	cc := chunk.VoxelCoordToChunkCoord(vc, c.settingsRepo.GetChunkSize())
+	_, ok := c.loadedChunks[cc]
+	return ok
+}
+
 func (c *core) getBlockType(pos chunk.VoxelCoordinate) chunk.BlockType {
 	key := chunk.VoxelCoordToChunkCoord(pos, c.settingsRepo.GetChunkSize())
 	if _, ok := c.loadedChunks[key]; !ok {
@@ -144,6 +239,7 @@ func (c *core) removeBlock(vc chunk.VoxelCoordinate) {
 	c.handlePendingActions(actions)
 	c.viewMod.RemoveNode(vc)
 	c.graphicsMod.UpdateChunk(cs.ch)
+	c.scheduleBlockUpdate(chunk.VoxelCoordinate{X: vc.X, Y: vc.Y + 1, Z: vc.Z})
 }
 
 func (c *core) addBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) {
@@ -157,4 +253,195 @@ func (c *core) addBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType) {
 	c.handlePendingActions(actions)
 	c.viewMod.AddNode(vc)
 	c.graphicsMod.UpdateChunk(cs.ch)
+	c.scheduleBlockUpdate(vc)
+}
+
+func (c *core) setBlocks(edits []BlockEdit) {
+	chunkSize := c.settingsRepo.GetChunkSize()
+	changed := map[chunk.ChunkCoordinate]*chunkState{}
+	actions := list.New()
+	for _, edit := range edits {
+		key := chunk.VoxelCoordToChunkCoord(edit.VoxPos, chunkSize)
+		cs, ok := c.loadedChunks[key]
+		if !ok {
+			panic("tried to set a block in a chunk that isn't loaded")
+		}
+		wasAir := cs.ch.BlockType(edit.VoxPos) == chunk.BlockTypeAir
+		isAir := edit.BlockType == chunk.BlockTypeAir
+		actions.PushBackList(cs.ch.SetBlockType(edit.VoxPos, edit.BlockType))
+		cs.modified = true
+		changed[key] = cs
+		if wasAir && !isAir {
+			c.viewMod.AddNode(edit.VoxPos)
+		} else if !wasAir && isAir {
+			c.viewMod.RemoveNode(edit.VoxPos)
+		}
+	}
+	c.handlePendingActions(actions)
+	for _, cs := range changed {
+		c.graphicsMod.UpdateChunk(cs.ch)
+	}
+	for _, edit := range edits {
+		if edit.BlockType == chunk.BlockTypeAir {
+			c.scheduleBlockUpdate(chunk.VoxelCoordinate{X: edit.VoxPos.X, Y: edit.VoxPos.Y + 1, Z: edit.VoxPos.Z})
+		} else {
+			c.scheduleBlockUpdate(edit.VoxPos)
+		}
+	}
+}
+
+func (c *core) tick() {
+	c.currentTick++
+	c.runScheduledUpdates()
+	c.randomTick()
+}
+
+func (c *core) scheduleUpdate(vc chunk.VoxelCoordinate, delay int) {
+	if !c.isVoxelLoaded(vc) {
+		panic("tried to schedule an update in a chunk that isn't loaded")
+	}
+	if delay < 1 {
+		delay = 1
+	}
+	u := &scheduledUpdate{
+		tick: c.currentTick + delay,
+		seq:  c.updateSeq,
+		vc:   vc,
+		cc:   chunk.VoxelCoordToChunkCoord(vc, c.settingsRepo.GetChunkSize()),
+	}
+	c.updateSeq++
+	heap.Push(&c.updates, u)
+	u.chunkIndex = len(c.chunkUpdates[u.cc])
+	c.chunkUpdates[u.cc] = append(c.chunkUpdates[u.cc], u)
+}
+
+// forgetChunkUpdate removes u, which was taken out of the queue, from the
+// updates of its chunk.
+func (c *core) forgetChunkUpdate(u *scheduledUpdate) {
+	updates := c.chunkUpdates[u.cc]
+	last := len(updates) - 1
+	updates[u.chunkIndex] = updates[last]
+	updates[u.chunkIndex].chunkIndex = u.chunkIndex
+	updates[last] = nil
+	if last == 0 {
+		delete(c.chunkUpdates, u.cc)
+	} else {
+		c.chunkUpdates[u.cc] = updates[:last]
+	}
+}
+
+// scheduleBlockUpdate schedules an update of vc after it or a block it rests
+// on changed, if its block type has a scheduled update handler.
+func (c *core) scheduleBlockUpdate(vc chunk.VoxelCoordinate) {
+	if !c.isVoxelLoaded(vc) {
+		return
+	}
+	if _, ok := c.updateHandlers[c.getBlockType(vc)]; ok {
+		c.scheduleUpdate(vc, blockUpdateDelay)
+	}
+}
+
+func (c *core) setScheduledUpdateHandler(bt chunk.BlockType, handler ScheduledUpdateHandler) {
+	if handler == nil {
+		delete(c.updateHandlers, bt)
+		return
+	}
+	c.updateHandlers[bt] = handler
+}
+
+func (c *core) runScheduledUpdates() {
+	worldMod := &Module{c}
+	for c.updates.Len() > 0 && c.updates[0].tick <= c.currentTick {
+		u := heap.Pop(&c.updates).(*scheduledUpdate)
+		c.forgetChunkUpdate(u)
+		if handler, ok := c.updateHandlers[c.getBlockType(u.vc)]; ok {
+			handler(worldMod, u.vc)
+		}
+	}
+}
+
+// takeScheduledUpdates removes the scheduled updates in the chunk at pos from
+// the queue and returns them in the order they are due. Delays are relative to
+// the current tick, so no time passes for unloaded chunks.
+func (c *core) takeScheduledUpdates(pos chunk.ChunkCoordinate) []chunk.ScheduledUpdate {
+	updates := c.chunkUpdates[pos]
+	if len(updates) == 0 {
+		return nil
+	}
+	delete(c.chunkUpdates, pos)
+	for _, u := range updates {
+		heap.Remove(&c.updates, u.index)
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].before(updates[j])
+	})
+	taken := make([]chunk.ScheduledUpdate, len(updates))
+	for i, u := range updates {
+		taken[i] = chunk.ScheduledUpdate{
+			VoxPos: u.vc,
+			Delay:  int32(u.tick - c.currentTick),
+		}
+	}
+	return taken
+}
+
+func (c *core) setRandomTickSeed(seed int64) {
+	c.rng.Seed(seed)
+}
+
+func (c *core) setRandomTickHandler(bt chunk.BlockType, handler RandomTickHandler) {
+	if handler == nil {
+		delete(c.randomTickHandlers, bt)
+		return
+	}
+	c.randomTickHandlers[bt] = handler
+}
+
+// getTickOrder returns the loaded chunks sorted by position, so that random
+// ticks only depend on the seed and not on map iteration order.
+func (c *core) getTickOrder() []chunk.ChunkCoordinate {
+	if c.tickOrder != nil {
+		return c.tickOrder
+	}
+	c.tickOrder = make([]chunk.ChunkCoordinate, 0, len(c.loadedChunks))
+	for cc := range c.loadedChunks {
+		c.tickOrder = append(c.tickOrder, cc)
+	}
+	sort.Slice(c.tickOrder, func(i, j int) bool {
+		a, b := c.tickOrder[i], c.tickOrder[j]
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.Z < b.Z
+	})
+	return c.tickOrder
+}
+
+func (c *core) randomTick() {
+	speed := int(c.settingsRepo.GetRandomTickSpeed())
+	if speed == 0 || len(c.randomTickHandlers) == 0 {
+		return
+	}
+	size := int32(c.settingsRepo.GetChunkSize())
+	worldMod := &Module{c}
+	for _, cc := range c.getTickOrder() {
+		for i := 0; i < speed; i++ {
+			cs, ok := c.loadedChunks[cc]
+			if !ok {
+				// a handler unloaded the chunk
+				break
+			}
+			vc := chunk.VoxelCoordinate{
+				X: cc.X*size + c.rng.Int31n(size),
+				Y: cc.Y*size + c.rng.Int31n(size),
+				Z: cc.Z*size + c.rng.Int31n(size),
+			}
+			if handler, ok := c.randomTickHandlers[cs.ch.BlockType(vc)]; ok {
+				handler(worldMod, vc, c.rng)
+			}
+		}
+	}
 }
@@ -2,9 +2,11 @@ package world
 
 import (
 	"container/list"
+	"fmt"
 	"math"
 
 	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
 	"github.com/kroppt/voxels/repositories/settings"
 )
 
@@ -23,6 +25,38 @@ func (fn *FnGenerator) GenerateChunk(pos chunk.ChunkCoordinate) (chunk.Chunk, *l
 	return chunk.NewChunkEmpty(pos, 1), list.New()
 }
 
+// ErrUnknownGenerator indicates that there is no generator with the given name.
+const ErrUnknownGenerator log.ConstErr = "unknown world generator"
+
+// NewGenerator creates the generator with the given name and generator
+// settings, as stored in world metadata.
+func NewGenerator(name string, generatorSettings map[string]string, settingsRepo settings.Interface) (Generator, error) {
+	switch name {
+	case "alex":
+		return NewAlexWorldGenerator(settingsRepo), nil
+	case "flat":
+		return NewFlatWorldGenerator(settingsRepo), nil
+	case "heightmap":
+		return newHeightmapGeneratorFromSettings(generatorSettings, settingsRepo)
+	case "trent":
+		return NewTrentWorldGenerator(settingsRepo), nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownGenerator, name)
+}
+
+// IsUnchanged returns whether every voxel of ch has the block type that gen
+// generates for it.
+func IsUnchanged(gen Generator, ch chunk.Chunk) bool {
+	generated, _ := gen.GenerateChunk(ch.Position())
+	unchanged := true
+	ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+		if ch.BlockType(vc) != generated.BlockType(vc) {
+			unchanged = false
+		}
+	})
+	return unchanged
+}
+
 type TrentWorldGenerator struct {
 	settingsRepo settings.Interface
 }
@@ -119,12 +153,18 @@ func (gen *AlexWorldGenerator) GenerateChunk(chPos chunk.ChunkCoordinate) (chunk
 }
 
 func alexHelper(pos chunk.VoxelCoordinate) chunk.BlockType {
-	h := int(math.Round(noiseAt(int(pos.X), int(pos.Z))) + 10)
-	if int(pos.Y) > h {
+	h := int32(math.Round(noiseAt(int(pos.X), int(pos.Z))) + 10)
+	return terrainLayer(pos.Y, h)
+}
+
+// terrainLayer returns the block type at height y of terrain whose top block
+// is at height h: grass on top of two layers of dirt on top of stone.
+func terrainLayer(y, h int32) chunk.BlockType {
+	if y > h {
 		return chunk.BlockTypeAir
-	} else if int(pos.Y) == h {
+	} else if y == h {
 		return chunk.BlockTypeGrassSides
-	} else if int(pos.Y) < h && int(pos.Y) > h-3 {
+	} else if y < h && y > h-3 {
 		return chunk.BlockTypeDirt
 	} else {
 		return chunk.BlockTypeStone
@@ -0,0 +1,183 @@
+package world
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// ErrHeightmap indicates that the settings of a heightmap generator are invalid.
+const ErrHeightmap log.ConstErr = "invalid heightmap settings"
+
+// HeightmapConfig configures how a HeightmapGenerator turns an image into
+// terrain.
+type HeightmapConfig struct {
+	// HorizontalScale is how many voxels apart neighboring pixels are.
+	HorizontalScale float64
+	// VerticalScale is how many voxels higher white is than black.
+	VerticalScale float64
+	// SeaLevel is the height of black.
+	SeaLevel int32
+	// Fill is the grey level, from 0 for black to 1 for white, of the terrain
+	// outside of the image.
+	Fill float64
+}
+
+// DefaultHeightmapConfig returns the configuration used for settings that a
+// heightmap world doesn't have.
+func DefaultHeightmapConfig() HeightmapConfig {
+	return HeightmapConfig{
+		HorizontalScale: 1,
+		VerticalScale:   32,
+	}
+}
+
+// HeightmapGenerator generates terrain whose height is the brightness of a
+// greyscale image. The top left pixel of the image is at X and Z 0, and heights
+// between pixels are interpolated.
+type HeightmapGenerator struct {
+	settingsRepo  settings.Interface
+	config        HeightmapConfig
+	width, height int
+	grey          []float64
+}
+
+// NewHeightmapGenerator creates a generator of the terrain drawn in img.
+func NewHeightmapGenerator(img image.Image, config HeightmapConfig, settingsRepo settings.Interface) *HeightmapGenerator {
+	if img == nil {
+		panic("heightmap world generator missing image")
+	}
+	if settingsRepo == nil {
+		panic("heightmap world generator missing settings repo")
+	}
+	if !(config.HorizontalScale > 0) {
+		panic("heightmap world generator horizontal scale must be positive")
+	}
+	bounds := img.Bounds()
+	gen := &HeightmapGenerator{
+		settingsRepo: settingsRepo,
+		config:       config,
+		width:        bounds.Dx(),
+		height:       bounds.Dy(),
+		grey:         make([]float64, bounds.Dx()*bounds.Dy()),
+	}
+	for y := 0; y < gen.height; y++ {
+		for x := 0; x < gen.width; x++ {
+			c := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			gen.grey[y*gen.width+x] = float64(c.Y) / math.MaxUint16
+		}
+	}
+	return gen
+}
+
+// HeightmapImageSetting is the generator setting of the heightmap generator
+// that is the path of its image.
+const HeightmapImageSetting = "image"
+
+// newHeightmapGeneratorFromSettings creates a heightmap generator from the
+// generator settings of a world. The image setting is the path of a PNG file,
+// and the others override DefaultHeightmapConfig.
+func newHeightmapGeneratorFromSettings(generatorSettings map[string]string, settingsRepo settings.Interface) (*HeightmapGenerator, error) {
+	config := DefaultHeightmapConfig()
+	floats := map[string]*float64{
+		"horizontalScale": &config.HorizontalScale,
+		"verticalScale":   &config.VerticalScale,
+		"fill":            &config.Fill,
+	}
+	for key, ptr := range floats {
+		value, ok := generatorSettings[key]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: %v=%v", ErrHeightmap, key, value)
+		}
+		*ptr = v
+	}
+	if value, ok := generatorSettings["seaLevel"]; ok {
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: seaLevel=%v", ErrHeightmap, value)
+		}
+		config.SeaLevel = int32(v)
+	}
+	if config.HorizontalScale <= 0 {
+		return nil, fmt.Errorf("%w: horizontal scale must be positive", ErrHeightmap)
+	}
+	if config.Fill < 0 || config.Fill > 1 {
+		return nil, fmt.Errorf("%w: fill must be from 0 to 1", ErrHeightmap)
+	}
+	path, ok := generatorSettings[HeightmapImageSetting]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing image", ErrHeightmap)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %v", ErrHeightmap, path, err)
+	}
+	return NewHeightmapGenerator(img, config, settingsRepo), nil
+}
+
+func (gen *HeightmapGenerator) GenerateChunk(chPos chunk.ChunkCoordinate) (chunk.Chunk, *list.List) {
+	size := int32(gen.settingsRepo.GetChunkSize())
+	ch := chunk.NewChunkEmpty(chPos, uint32(size))
+	pending := list.New()
+	heights := make([]int32, size*size)
+	for i := int32(0); i < size; i++ {
+		for j := int32(0); j < size; j++ {
+			heights[i*size+j] = gen.HeightAt(chPos.X*size+i, chPos.Z*size+j)
+		}
+	}
+	ch.ForEachVoxel(func(vc chunk.VoxelCoordinate) {
+		h := heights[(vc.X-chPos.X*size)*size+vc.Z-chPos.Z*size]
+		pending.PushBackList(ch.SetBlockType(vc, terrainLayer(vc.Y, h)))
+	})
+	return ch, pending
+}
+
+// HeightAt returns the height of the top block of the terrain at x, z.
+func (gen *HeightmapGenerator) HeightAt(x, z int32) int32 {
+	u := float64(x) / gen.config.HorizontalScale
+	v := float64(z) / gen.config.HorizontalScale
+	grey := gen.config.Fill
+	if u >= 0 && v >= 0 && u < float64(gen.width) && v < float64(gen.height) {
+		u0, v0 := math.Floor(u), math.Floor(v)
+		fu, fv := u-u0, v-v0
+		px, py := int(u0), int(v0)
+		top := lerp(gen.pixel(px, py), gen.pixel(px+1, py), fu)
+		bottom := lerp(gen.pixel(px, py+1), gen.pixel(px+1, py+1), fu)
+		grey = lerp(top, bottom, fv)
+	}
+	return gen.config.SeaLevel + int32(math.Round(grey*gen.config.VerticalScale))
+}
+
+// pixel returns the grey level of a pixel, where pixels past the right and
+// bottom edges are the same as the ones on the edges.
+func (gen *HeightmapGenerator) pixel(x, y int) float64 {
+	if x >= gen.width {
+		x = gen.width - 1
+	}
+	if y >= gen.height {
+		y = gen.height - 1
+	}
+	return gen.grey[y*gen.width+x]
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
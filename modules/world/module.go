@@ -2,6 +2,7 @@ package world
 
 import (
 	"container/list"
+	"math/rand"
 
 	"github.com/kroppt/voxels/chunk"
 	"github.com/kroppt/voxels/modules/cache"
@@ -11,7 +12,7 @@ import (
 )
 
 type Module struct {
-	c core
+	c *core
 }
 
 func New(
@@ -34,21 +35,27 @@ func New(
 		panic("world received a nil view module")
 	}
 	return &Module{
-		core{
-			graphicsMod:    graphicsMod,
-			generator:      generator,
-			settingsRepo:   settingsRepo,
-			cacheMod:       cacheMod,
-			viewMod:        viewMod,
-			loadedChunks:   map[chunk.ChunkCoordinate]*chunkState{},
-			pendingActions: map[chunk.ChunkCoordinate]*list.List{},
+		&core{
+			graphicsMod:        graphicsMod,
+			generator:          generator,
+			settingsRepo:       settingsRepo,
+			cacheMod:           cacheMod,
+			viewMod:            viewMod,
+			loadedChunks:       map[chunk.ChunkCoordinate]*chunkState{},
+			retained:           map[chunk.ChunkCoordinate]*list.Element{},
+			retainOrder:        list.New(),
+			pendingActions:     map[chunk.ChunkCoordinate]*list.List{},
+			rng:                rand.New(rand.NewSource(0)),
+			randomTickHandlers: DefaultRandomTickHandlers(),
+			updateHandlers:     DefaultScheduledUpdateHandlers(),
+			chunkUpdates:       map[chunk.ChunkCoordinate][]*scheduledUpdate{},
 		},
 	}
 }
 
 type ParallelModule struct {
 	do chan func()
-	c  core
+	c  *core
 }
 
 func NewParallel(
@@ -72,14 +79,20 @@ func NewParallel(
 	}
 	return &ParallelModule{
 		do: make(chan func(), 1024),
-		c: core{
-			graphicsMod:    graphicsMod,
-			generator:      generator,
-			settingsRepo:   settingsRepo,
-			cacheMod:       cacheMod,
-			viewMod:        viewMod,
-			loadedChunks:   map[chunk.ChunkCoordinate]*chunkState{},
-			pendingActions: map[chunk.ChunkCoordinate]*list.List{},
+		c: &core{
+			graphicsMod:        graphicsMod,
+			generator:          generator,
+			settingsRepo:       settingsRepo,
+			cacheMod:           cacheMod,
+			viewMod:            viewMod,
+			loadedChunks:       map[chunk.ChunkCoordinate]*chunkState{},
+			retained:           map[chunk.ChunkCoordinate]*list.Element{},
+			retainOrder:        list.New(),
+			pendingActions:     map[chunk.ChunkCoordinate]*list.List{},
+			rng:                rand.New(rand.NewSource(0)),
+			randomTickHandlers: DefaultRandomTickHandlers(),
+			updateHandlers:     DefaultScheduledUpdateHandlers(),
+			chunkUpdates:       map[chunk.ChunkCoordinate][]*scheduledUpdate{},
 		},
 	}
 }
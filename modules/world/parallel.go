@@ -26,6 +26,14 @@ func (m *ParallelModule) CountLoadedChunks() int {
 	return <-done
 }
 
+func (m *ParallelModule) IsVoxelLoaded(vc chunk.VoxelCoordinate) bool {
+	done := make(chan bool)
+	m.do <- func() {
+		done <- m.c.isVoxelLoaded(vc)
+	}
+	return <-done
+}
+
 func (m *ParallelModule) GetBlockType(pos chunk.VoxelCoordinate) chunk.BlockType {
 	done := make(chan chunk.BlockType)
 	m.do <- func() {
@@ -51,3 +59,42 @@ func (m *ParallelModule) AddBlock(vc chunk.VoxelCoordinate, bt chunk.BlockType)
 	}
 	<-done
 }
+
+func (m *ParallelModule) SetBlocks(edits []BlockEdit) {
+	done := make(chan struct{})
+	m.do <- func() {
+		m.c.setBlocks(edits)
+		close(done)
+	}
+	<-done
+}
+
+func (m *ParallelModule) ScheduleUpdate(vc chunk.VoxelCoordinate, delay int) {
+	m.do <- func() {
+		m.c.scheduleUpdate(vc, delay)
+	}
+}
+
+func (m *ParallelModule) Tick() {
+	m.do <- func() {
+		m.c.tick()
+	}
+}
+
+func (m *ParallelModule) SetRandomTickSeed(seed int64) {
+	m.do <- func() {
+		m.c.setRandomTickSeed(seed)
+	}
+}
+
+func (m *ParallelModule) SetRandomTickHandler(bt chunk.BlockType, handler RandomTickHandler) {
+	m.do <- func() {
+		m.c.setRandomTickHandler(bt, handler)
+	}
+}
+
+func (m *ParallelModule) SetScheduledUpdateHandler(bt chunk.BlockType, handler ScheduledUpdateHandler) {
+	m.do <- func() {
+		m.c.setScheduledUpdateHandler(bt, handler)
+	}
+}
@@ -0,0 +1,64 @@
+package world
+
+import (
+	"math/rand"
+
+	"github.com/kroppt/voxels/chunk"
+)
+
+// RandomTickHandler is called when the voxel at vc was picked for a random
+// tick. Changes to the world should go through worldMod.
+type RandomTickHandler func(worldMod Interface, vc chunk.VoxelCoordinate, rng *rand.Rand)
+
+// DefaultRandomTickHandlers returns the random tick handlers of every block
+// type that changes by itself.
+func DefaultRandomTickHandlers() map[chunk.BlockType]RandomTickHandler {
+	return map[chunk.BlockType]RandomTickHandler{
+		chunk.BlockTypeGrass:      SpreadGrass,
+		chunk.BlockTypeGrassSides: SpreadGrass,
+		chunk.BlockTypeSnow:       MeltSnow,
+		chunk.BlockTypeSnowSides:  MeltSnow,
+	}
+}
+
+// SpreadGrass picks a random voxel around vc and turns it into grass if it is
+// dirt with nothing on top of it.
+func SpreadGrass(worldMod Interface, vc chunk.VoxelCoordinate, rng *rand.Rand) {
+	target := chunk.VoxelCoordinate{
+		X: vc.X + rng.Int31n(3) - 1,
+		Y: vc.Y + rng.Int31n(3) - 1,
+		Z: vc.Z + rng.Int31n(3) - 1,
+	}
+	above := chunk.VoxelCoordinate{X: target.X, Y: target.Y + 1, Z: target.Z}
+	if !worldMod.IsVoxelLoaded(target) || !worldMod.IsVoxelLoaded(above) {
+		return
+	}
+	if worldMod.GetBlockType(target) != chunk.BlockTypeDirt {
+		return
+	}
+	if worldMod.GetBlockType(above) != chunk.BlockTypeAir {
+		return
+	}
+	worldMod.AddBlock(target, chunk.BlockTypeGrassSides)
+}
+
+// snowMeltDistance is the furthest a light can be from snow and still melt it.
+const snowMeltDistance = 2
+
+// MeltSnow removes the snow at vc if there is a light close to it.
+func MeltSnow(worldMod Interface, vc chunk.VoxelCoordinate, rng *rand.Rand) {
+	for x := vc.X - snowMeltDistance; x <= vc.X+snowMeltDistance; x++ {
+		for y := vc.Y - snowMeltDistance; y <= vc.Y+snowMeltDistance; y++ {
+			for z := vc.Z - snowMeltDistance; z <= vc.Z+snowMeltDistance; z++ {
+				near := chunk.VoxelCoordinate{X: x, Y: y, Z: z}
+				if !worldMod.IsVoxelLoaded(near) {
+					continue
+				}
+				if worldMod.GetBlockType(near) == chunk.BlockTypeLight {
+					worldMod.RemoveBlock(vc)
+					return
+				}
+			}
+		}
+	}
+}
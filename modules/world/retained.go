@@ -0,0 +1,58 @@
+package world
+
+import (
+	"container/list"
+
+	"github.com/kroppt/voxels/chunk"
+)
+
+// retainedChunk is a chunk that was unloaded but is still kept in memory, so
+// that loading it again doesn't need the cache or the generator.
+type retainedChunk struct {
+	pos       chunk.ChunkCoordinate
+	cs        *chunkState
+	scheduled []chunk.ScheduledUpdate
+}
+
+// retain keeps an unloaded chunk in memory as the most recently used one, then
+// evicts the least recently used chunks over the retention limit.
+func (c *core) retain(pos chunk.ChunkCoordinate, cs *chunkState, scheduled []chunk.ScheduledUpdate) {
+	c.retained[pos] = c.retainOrder.PushFront(&retainedChunk{
+		pos:       pos,
+		cs:        cs,
+		scheduled: scheduled,
+	})
+	limit := int(c.settingsRepo.GetRetainedChunks())
+	for c.retainOrder.Len() > limit {
+		c.evict(c.retainOrder.Back())
+	}
+}
+
+// takeRetained removes the chunk at pos from memory and returns it, if it was
+// retained.
+func (c *core) takeRetained(pos chunk.ChunkCoordinate) (*retainedChunk, bool) {
+	elem, ok := c.retained[pos]
+	if !ok {
+		return nil, false
+	}
+	c.retainOrder.Remove(elem)
+	delete(c.retained, pos)
+	return elem.Value.(*retainedChunk), true
+}
+
+// evict drops a retained chunk from memory, saving it first if it changed.
+// A chunk that stood in for one that couldn't be read is tried again from the
+// cache the next time it loads.
+func (c *core) evict(elem *list.Element) {
+	rc := c.retainOrder.Remove(elem).(*retainedChunk)
+	delete(c.retained, rc.pos)
+	saveChunkState(c.cacheMod, rc.cs)
+	c.cacheMod.SaveScheduled(rc.pos, rc.scheduled)
+}
+
+// evictAll drops every retained chunk from memory.
+func (c *core) evictAll() {
+	for c.retainOrder.Len() > 0 {
+		c.evict(c.retainOrder.Back())
+	}
+}
@@ -0,0 +1,94 @@
+package world
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+)
+
+// cacheAttempts is how many times reading or writing a chunk in the cache is
+// tried before giving up.
+const cacheAttempts = 3
+
+// cacheRetryDelay is how long to wait before trying the cache again the first
+// time. The wait doubles with every attempt after that.
+const cacheRetryDelay = 10 * time.Millisecond
+
+// loadResult is how loading a saved chunk went.
+type loadResult int
+
+const (
+	// loadedSaved means the saved chunk was loaded.
+	loadedSaved loadResult = iota
+	// loadNotSaved means there is no saved chunk, so it has to be generated.
+	loadNotSaved
+	// loadFailed means the saved chunk couldn't be read. A chunk generated in
+	// its place must not be saved over it.
+	loadFailed
+)
+
+// loadSaved returns the chunk saved at pos, if it could be loaded.
+//
+// A chunk that isn't saved is reported quietly. A corrupt chunk is moved to the
+// quarantine file of the cache and reported as not saved, with a warning. A
+// chunk that can't be read is tried again first, waiting longer every time.
+func loadSaved(cacheMod cache.Interface, pos chunk.ChunkCoordinate) (chunk.Chunk, loadResult) {
+	for attempt := 1; ; attempt++ {
+		ch, err := cacheMod.Load(pos)
+		switch {
+		case err == nil:
+			return ch, loadedSaved
+		case errors.Is(err, cache.ErrNotFound):
+			return chunk.Chunk{}, loadNotSaved
+		case errors.Is(err, cache.ErrCorrupt):
+			log.Warnf("generating chunk %v again and quarantining its saved data: %v", pos, err)
+			if err := cacheMod.Quarantine(pos); err != nil {
+				log.Warnf("failed to quarantine chunk %v: %v", pos, err)
+			}
+			return chunk.Chunk{}, loadNotSaved
+		case attempt < cacheAttempts:
+			log.Warnf("trying to load chunk %v again: %v", pos, err)
+			time.Sleep(retryDelay(attempt))
+		default:
+			log.Warnf("failed to load chunk %v %v times, it won't be saved until it loads: %v", pos, attempt, err)
+			return chunk.Chunk{}, loadFailed
+		}
+	}
+}
+
+// retryDelay returns how long to wait after the given failed attempt.
+func retryDelay(attempt int) time.Duration {
+	return cacheRetryDelay << (attempt - 1)
+}
+
+// saveChunk saves a chunk, trying again if it fails.
+func saveChunk(cacheMod cache.Interface, ch chunk.Chunk) {
+	for attempt := 1; ; attempt++ {
+		err := cacheMod.Save(ch)
+		if err == nil {
+			return
+		}
+		if attempt == cacheAttempts {
+			log.Warnf("lost the changes to chunk %v after failing to save it %v times: %v", ch.Position(), attempt, err)
+			return
+		}
+		log.Warnf("trying to save chunk %v again: %v", ch.Position(), err)
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+// saveChunkState saves the chunk of cs if it changed, unless it stands in for a
+// saved chunk that couldn't be read.
+func saveChunkState(cacheMod cache.Interface, cs *chunkState) {
+	if !cs.modified {
+		return
+	}
+	if cs.standIn {
+		log.Warnf("dropping the changes to chunk %v, as its saved data couldn't be read", cs.ch.Position())
+		return
+	}
+	saveChunk(cacheMod, cs.ch)
+}
@@ -0,0 +1,89 @@
+package world
+
+import (
+	"github.com/kroppt/voxels/chunk"
+)
+
+// ScheduledUpdateHandler is called when a scheduled update of the voxel at vc
+// is due. Changes to the world should go through worldMod.
+type ScheduledUpdateHandler func(worldMod Interface, vc chunk.VoxelCoordinate)
+
+// blockUpdateDelay is the number of ticks after a block changes that its
+// scheduled update is run.
+const blockUpdateDelay = 1
+
+// DefaultScheduledUpdateHandlers returns the scheduled update handlers of every
+// block type that reacts to changes around it.
+func DefaultScheduledUpdateHandlers() map[chunk.BlockType]ScheduledUpdateHandler {
+	return map[chunk.BlockType]ScheduledUpdateHandler{
+		chunk.BlockTypeSand: FallBlock,
+	}
+}
+
+// FallBlock moves the block at vc down by one voxel if there is nothing below
+// it.
+func FallBlock(worldMod Interface, vc chunk.VoxelCoordinate) {
+	below := chunk.VoxelCoordinate{X: vc.X, Y: vc.Y - 1, Z: vc.Z}
+	if !worldMod.IsVoxelLoaded(below) {
+		return
+	}
+	if worldMod.GetBlockType(below) != chunk.BlockTypeAir {
+		return
+	}
+	bt := worldMod.GetBlockType(vc)
+	worldMod.RemoveBlock(vc)
+	worldMod.AddBlock(below, bt)
+}
+
+// scheduledUpdate is an update of vc, in the chunk at cc, that is due on tick.
+// seq orders updates that are due on the same tick by when they were
+// scheduled. index is its position in the update queue, and chunkIndex its
+// position among the updates of its chunk.
+type scheduledUpdate struct {
+	tick       int
+	seq        int
+	vc         chunk.VoxelCoordinate
+	cc         chunk.ChunkCoordinate
+	index      int
+	chunkIndex int
+}
+
+// before returns whether u is due before other.
+func (u *scheduledUpdate) before(other *scheduledUpdate) bool {
+	if u.tick != other.tick {
+		return u.tick < other.tick
+	}
+	return u.seq < other.seq
+}
+
+// updateQueue is a min-heap of scheduled updates for use with container/heap.
+type updateQueue []*scheduledUpdate
+
+func (q updateQueue) Len() int {
+	return len(q)
+}
+
+func (q updateQueue) Less(i, j int) bool {
+	return q[i].before(q[j])
+}
+
+func (q updateQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *updateQueue) Push(x interface{}) {
+	u := x.(*scheduledUpdate)
+	u.index = len(*q)
+	*q = append(*q, u)
+}
+
+func (q *updateQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	u := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return u
+}
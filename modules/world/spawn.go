@@ -0,0 +1,57 @@
+package world
+
+import (
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// playerHeight is how many voxels of air the player needs to stand in.
+const playerHeight = 2
+
+// maxSpawnSearchHeight is how far above the requested spawn a safe spawn is
+// looked for before giving up.
+const maxSpawnSearchHeight = 256
+
+// FindSafeSpawn returns the lowest voxel at or above vc with enough air above
+// it for the player to not be stuck inside the terrain. Saved chunks are looked
+// at before generating. If no such voxel is found, vc is returned.
+func FindSafeSpawn(generator Generator, cacheMod cache.Interface, settingsRepo settings.Interface, vc chunk.VoxelCoordinate) chunk.VoxelCoordinate {
+	if generator == nil {
+		panic("world received a nil generator")
+	}
+	if cacheMod == nil {
+		panic("world received a nil cache module")
+	}
+	if settingsRepo == nil {
+		panic("world received a nil settings repo")
+	}
+	chunkSize := settingsRepo.GetChunkSize()
+	chunks := map[chunk.ChunkCoordinate]chunk.Chunk{}
+	blockType := func(vc chunk.VoxelCoordinate) chunk.BlockType {
+		cc := chunk.VoxelCoordToChunkCoord(vc, chunkSize)
+		ch, ok := chunks[cc]
+		if !ok {
+			var result loadResult
+			ch, result = loadSaved(cacheMod, cc)
+			if result != loadedSaved {
+				ch, _ = generator.GenerateChunk(cc)
+			}
+			chunks[cc] = ch
+		}
+		return ch.BlockType(vc)
+	}
+	air := 0
+	for dy := int32(0); dy < maxSpawnSearchHeight+playerHeight; dy++ {
+		check := chunk.VoxelCoordinate{X: vc.X, Y: vc.Y + dy, Z: vc.Z}
+		if blockType(check) != chunk.BlockTypeAir {
+			air = 0
+			continue
+		}
+		air++
+		if air == playerHeight {
+			return chunk.VoxelCoordinate{X: vc.X, Y: check.Y - playerHeight + 1, Z: vc.Z}
+		}
+	}
+	return vc
+}
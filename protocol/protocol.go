@@ -0,0 +1,503 @@
+// Package protocol is the binary format spoken between the multiplayer server
+// and its clients.
+//
+// Every message is framed as a little-endian uint32 length, followed by that
+// many bytes: a one byte message type and the message's fields. Integers and
+// floats are little-endian, strings are a uint16 length followed by UTF-8
+// bytes, and lists are a uint32 count followed by their elements.
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+)
+
+// Version is the protocol version. Clients and servers only talk to peers of
+// the same version.
+const Version = 1
+
+// MaxFrameSize is the largest message that is read, in bytes.
+const MaxFrameSize = 1 << 24
+
+// maxChunkSize is the largest chunk size that can be sent.
+const maxChunkSize = 64
+
+// ErrFrameTooLarge indicates that a message is larger than MaxFrameSize.
+const ErrFrameTooLarge log.ConstErr = "message is too large"
+
+// ErrUnknownMessage indicates that a message has an unknown type.
+const ErrUnknownMessage log.ConstErr = "unknown message type"
+
+// ErrMalformed indicates that a message's fields could not be decoded.
+const ErrMalformed log.ConstErr = "malformed message"
+
+// MessageType identifies a kind of message.
+type MessageType uint8
+
+const (
+	// TypeHello is sent by a client to join.
+	TypeHello MessageType = iota + 1
+	// TypeWelcome is the server accepting a client.
+	TypeWelcome
+	// TypeReject is the server refusing a client.
+	TypeReject
+	// TypeMove is a client moving or looking around.
+	TypeMove
+	// TypeAddBlock is a client wanting to place a block.
+	TypeAddBlock
+	// TypeRemoveBlock is a client wanting to remove a block.
+	TypeRemoveBlock
+	// TypeChunkData is the contents of a chunk that came into range.
+	TypeChunkData
+	// TypeChunkUnload is a chunk that went out of range.
+	TypeChunkUnload
+	// TypeBlockDelta is a block that changed.
+	TypeBlockDelta
+	// TypePlayerPosition is where another player is.
+	TypePlayerPosition
+	// TypePlayerLeft is another player leaving.
+	TypePlayerLeft
+)
+
+// Message is anything that can be sent.
+type Message interface {
+	Type() MessageType
+}
+
+// Position is a point in the world in voxel coordinates.
+type Position struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// Hello asks to join the server.
+type Hello struct {
+	Version uint32
+	Name    string
+}
+
+// Welcome accepts a client that said hello.
+type Welcome struct {
+	Version   uint32
+	PlayerID  uint32
+	ChunkSize uint32
+	Spawn     Position
+}
+
+// Reject refuses a client that said hello, after which the connection is
+// closed.
+type Reject struct {
+	Reason string
+}
+
+// Move tells the server where the client's player is and where it looks.
+type Move struct {
+	Position Position
+	Rotation mgl.Quat
+}
+
+// AddBlock asks the server to place a block.
+type AddBlock struct {
+	VoxPos    chunk.VoxelCoordinate
+	BlockType chunk.BlockType
+}
+
+// RemoveBlock asks the server to remove a block.
+type RemoveBlock struct {
+	VoxPos chunk.VoxelCoordinate
+}
+
+// ChunkData is the contents of a chunk. Voxels holds the vbits and lighting
+// bits of every voxel, in the order of the chunk's flat data.
+type ChunkData struct {
+	Pos    chunk.ChunkCoordinate
+	Size   uint32
+	Voxels []uint32
+}
+
+// ChunkUnload tells a client to drop a chunk.
+type ChunkUnload struct {
+	Pos chunk.ChunkCoordinate
+}
+
+// BlockDelta tells a client that a block changed.
+type BlockDelta struct {
+	VoxPos    chunk.VoxelCoordinate
+	BlockType chunk.BlockType
+}
+
+// PlayerPosition tells a client where another player is.
+type PlayerPosition struct {
+	PlayerID uint32
+	Name     string
+	Position Position
+	Rotation mgl.Quat
+}
+
+// PlayerLeft tells a client that another player left.
+type PlayerLeft struct {
+	PlayerID uint32
+}
+
+func (Hello) Type() MessageType          { return TypeHello }
+func (Welcome) Type() MessageType        { return TypeWelcome }
+func (Reject) Type() MessageType         { return TypeReject }
+func (Move) Type() MessageType           { return TypeMove }
+func (AddBlock) Type() MessageType       { return TypeAddBlock }
+func (RemoveBlock) Type() MessageType    { return TypeRemoveBlock }
+func (ChunkData) Type() MessageType      { return TypeChunkData }
+func (ChunkUnload) Type() MessageType    { return TypeChunkUnload }
+func (BlockDelta) Type() MessageType     { return TypeBlockDelta }
+func (PlayerPosition) Type() MessageType { return TypePlayerPosition }
+func (PlayerLeft) Type() MessageType     { return TypePlayerLeft }
+
+// NewChunkData returns the message that sends ch.
+func NewChunkData(ch chunk.Chunk) ChunkData {
+	flatData := ch.GetFlatData()
+	voxels := make([]uint32, 0, 2*len(flatData)/chunk.VertSize)
+	for off := 0; off < len(flatData); off += chunk.VertSize {
+		voxels = append(voxels, uint32(flatData[off+3]), uint32(flatData[off+4]))
+	}
+	return ChunkData{
+		Pos:    ch.Position(),
+		Size:   ch.Size(),
+		Voxels: voxels,
+	}
+}
+
+// Chunk returns the chunk that was sent. The message must have been read with
+// ReadMessage or created with NewChunkData.
+func (m ChunkData) Chunk() chunk.Chunk {
+	size := int32(m.Size)
+	flatData := make([]float32, 0, chunk.VertSize*len(m.Voxels)/2)
+	for i := int32(0); i < int32(len(m.Voxels))/2; i++ {
+		flatData = append(flatData,
+			float32(m.Pos.X*size+i%size),
+			float32(m.Pos.Y*size+i/size%size),
+			float32(m.Pos.Z*size+i/(size*size)),
+			float32(m.Voxels[2*i]),
+			float32(m.Voxels[2*i+1]),
+		)
+	}
+	return chunk.NewChunkFromData(flatData, m.Size, m.Pos)
+}
+
+// WriteMessage writes one framed message to w.
+func WriteMessage(w io.Writer, msg Message) error {
+	var e encoder
+	e.buf.Write([]byte{0, 0, 0, 0, byte(msg.Type())})
+	switch m := msg.(type) {
+	case Hello:
+		e.uint32(m.Version)
+		e.string(m.Name)
+	case Welcome:
+		e.uint32(m.Version)
+		e.uint32(m.PlayerID)
+		e.uint32(m.ChunkSize)
+		e.position(m.Spawn)
+	case Reject:
+		e.string(m.Reason)
+	case Move:
+		e.position(m.Position)
+		e.quat(m.Rotation)
+	case AddBlock:
+		e.voxel(m.VoxPos)
+		e.uint32(uint32(m.BlockType))
+	case RemoveBlock:
+		e.voxel(m.VoxPos)
+	case ChunkData:
+		e.chunk(m.Pos)
+		e.uint32(m.Size)
+		e.uint32(uint32(len(m.Voxels)))
+		for _, v := range m.Voxels {
+			e.uint32(v)
+		}
+	case ChunkUnload:
+		e.chunk(m.Pos)
+	case BlockDelta:
+		e.voxel(m.VoxPos)
+		e.uint32(uint32(m.BlockType))
+	case PlayerPosition:
+		e.uint32(m.PlayerID)
+		e.string(m.Name)
+		e.position(m.Position)
+		e.quat(m.Rotation)
+	case PlayerLeft:
+		e.uint32(m.PlayerID)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnknownMessage, msg)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	frame := e.buf.Bytes()
+	if len(frame)-4 > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	binary.LittleEndian.PutUint32(frame, uint32(len(frame)-4))
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadMessage reads one framed message from r.
+func ReadMessage(r io.Reader) (Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[:])
+	if length > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	if length == 0 {
+		return nil, fmt.Errorf("%w: empty frame", ErrMalformed)
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d := decoder{data: frame[1:]}
+	var msg Message
+	switch MessageType(frame[0]) {
+	case TypeHello:
+		msg = Hello{
+			Version: d.uint32(),
+			Name:    d.string(),
+		}
+	case TypeWelcome:
+		msg = Welcome{
+			Version:   d.uint32(),
+			PlayerID:  d.uint32(),
+			ChunkSize: d.uint32(),
+			Spawn:     d.position(),
+		}
+	case TypeReject:
+		msg = Reject{
+			Reason: d.string(),
+		}
+	case TypeMove:
+		msg = Move{
+			Position: d.position(),
+			Rotation: d.quat(),
+		}
+	case TypeAddBlock:
+		msg = AddBlock{
+			VoxPos:    d.voxel(),
+			BlockType: d.blockType(),
+		}
+	case TypeRemoveBlock:
+		msg = RemoveBlock{
+			VoxPos: d.voxel(),
+		}
+	case TypeChunkData:
+		msg = d.chunkData()
+	case TypeChunkUnload:
+		msg = ChunkUnload{
+			Pos: d.chunk(),
+		}
+	case TypeBlockDelta:
+		msg = BlockDelta{
+			VoxPos:    d.voxel(),
+			BlockType: d.blockType(),
+		}
+	case TypePlayerPosition:
+		msg = PlayerPosition{
+			PlayerID: d.uint32(),
+			Name:     d.string(),
+			Position: d.position(),
+			Rotation: d.quat(),
+		}
+	case TypePlayerLeft:
+		msg = PlayerLeft{
+			PlayerID: d.uint32(),
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMessage, frame[0])
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("%w: %v trailing bytes", ErrMalformed, len(d.data))
+	}
+	return msg, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) float64(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) string(s string) {
+	if len(s) > math.MaxUint16 {
+		e.err = fmt.Errorf("%w: string of %v bytes is too long", ErrMalformed, len(s))
+		return
+	}
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], uint16(len(s)))
+	e.buf.Write(b[:])
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) position(p Position) {
+	e.float64(p.X)
+	e.float64(p.Y)
+	e.float64(p.Z)
+}
+
+func (e *encoder) quat(q mgl.Quat) {
+	e.float64(q.W)
+	e.float64(q.X())
+	e.float64(q.Y())
+	e.float64(q.Z())
+}
+
+func (e *encoder) voxel(vc chunk.VoxelCoordinate) {
+	e.int32(vc.X)
+	e.int32(vc.Y)
+	e.int32(vc.Z)
+}
+
+func (e *encoder) chunk(cc chunk.ChunkCoordinate) {
+	e.int32(cc.X)
+	e.int32(cc.Y)
+	e.int32(cc.Z)
+}
+
+// decoder reads fields until the first error, after which it only returns
+// zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = fmt.Errorf("%w: message is cut short", ErrMalformed)
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) int32() int32 {
+	return int32(d.uint32())
+}
+
+func (d *decoder) float64() float64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	b := d.take(2)
+	if b == nil {
+		return ""
+	}
+	return string(d.take(int(binary.LittleEndian.Uint16(b))))
+}
+
+func (d *decoder) position() Position {
+	return Position{
+		X: d.float64(),
+		Y: d.float64(),
+		Z: d.float64(),
+	}
+}
+
+func (d *decoder) quat() mgl.Quat {
+	w := d.float64()
+	return mgl.Quat{W: w, V: mgl.Vec3{d.float64(), d.float64(), d.float64()}}
+}
+
+func (d *decoder) voxel() chunk.VoxelCoordinate {
+	return chunk.VoxelCoordinate{
+		X: d.int32(),
+		Y: d.int32(),
+		Z: d.int32(),
+	}
+}
+
+func (d *decoder) chunk() chunk.ChunkCoordinate {
+	return chunk.ChunkCoordinate{
+		X: d.int32(),
+		Y: d.int32(),
+		Z: d.int32(),
+	}
+}
+
+func (d *decoder) blockType() chunk.BlockType {
+	bt := chunk.BlockType(d.uint32())
+	if d.err == nil && bt > chunk.BlockTypeLeaf {
+		d.err = fmt.Errorf("%w: invalid block type %v", ErrMalformed, uint32(bt))
+	}
+	return bt
+}
+
+// chunkData decodes chunk data, making sure that it describes a valid chunk.
+func (d *decoder) chunkData() ChunkData {
+	m := ChunkData{
+		Pos:  d.chunk(),
+		Size: d.uint32(),
+	}
+	count := d.uint32()
+	if d.err != nil {
+		return m
+	}
+	if m.Size == 0 || m.Size > maxChunkSize || count != 2*m.Size*m.Size*m.Size {
+		d.err = fmt.Errorf("%w: invalid chunk size %v with %v values", ErrMalformed, m.Size, count)
+		return m
+	}
+	m.Voxels = make([]uint32, count)
+	for i := range m.Voxels {
+		m.Voxels[i] = d.uint32()
+	}
+	for i := 0; i < len(m.Voxels) && d.err == nil; i += 2 {
+		if m.Voxels[i] > chunk.LargestVbits || m.Voxels[i+1] > chunk.LightAll {
+			d.err = fmt.Errorf("%w: invalid voxel bits", ErrMalformed)
+		}
+	}
+	return m
+}
@@ -0,0 +1,127 @@
+package protocol_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/protocol"
+)
+
+func testChunk() chunk.Chunk {
+	ch := chunk.NewChunkEmpty(chunk.ChunkCoordinate{X: -1, Y: 2, Z: 3}, 3)
+	ch.SetBlockType(chunk.VoxelCoordinate{X: -3, Y: 6, Z: 9}, chunk.BlockTypeSand)
+	ch.SetBlockType(chunk.VoxelCoordinate{X: -2, Y: 6, Z: 9}, chunk.BlockTypeLeaf)
+	ch.SetLighting(chunk.VoxelCoordinate{X: -1, Y: 8, Z: 11}, chunk.LightTop, 7)
+	return ch
+}
+
+func TestWriteThenReadIsSame(t *testing.T) {
+	t.Parallel()
+	rot := mgl.QuatRotate(1, mgl.Vec3{0, 1, 0})
+	messages := []protocol.Message{
+		protocol.Hello{Version: protocol.Version, Name: "alex"},
+		protocol.Welcome{Version: protocol.Version, PlayerID: 7, ChunkSize: 5, Spawn: protocol.Position{X: 0.5, Y: -20, Z: 1e9}},
+		protocol.Reject{Reason: "full"},
+		protocol.Move{Position: protocol.Position{X: 1, Y: 2, Z: 3}, Rotation: rot},
+		protocol.AddBlock{VoxPos: chunk.VoxelCoordinate{X: -1, Y: 2, Z: -3}, BlockType: chunk.BlockTypeClay},
+		protocol.RemoveBlock{VoxPos: chunk.VoxelCoordinate{X: 4, Y: -5, Z: 6}},
+		protocol.NewChunkData(testChunk()),
+		protocol.ChunkUnload{Pos: chunk.ChunkCoordinate{X: 1, Y: -1, Z: 0}},
+		protocol.BlockDelta{VoxPos: chunk.VoxelCoordinate{X: 9, Y: 8, Z: 7}, BlockType: chunk.BlockTypeAir},
+		protocol.PlayerPosition{PlayerID: 3, Name: "trent", Position: protocol.Position{X: -1.5}, Rotation: rot},
+		protocol.PlayerLeft{PlayerID: 3},
+	}
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		if err := protocol.WriteMessage(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range messages {
+		actual, err := protocol.ReadMessage(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	}
+	if _, err := protocol.ReadMessage(&buf); err != io.EOF {
+		t.Fatalf("expected %v after the last message but got %v", io.EOF, err)
+	}
+}
+
+func TestChunkDataRebuildsChunk(t *testing.T) {
+	t.Parallel()
+	expected := testChunk()
+
+	actual := protocol.NewChunkData(expected).Chunk()
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("expected rebuilt chunk to be the same, but it was not")
+	}
+}
+
+func frame(msgType protocol.MessageType, fields ...interface{}) []byte {
+	var payload bytes.Buffer
+	payload.WriteByte(byte(msgType))
+	for _, f := range fields {
+		_ = binary.Write(&payload, binary.LittleEndian, f)
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(payload.Len()))
+	buf.Write(payload.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadInvalidMessages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"too large", []byte{0xFF, 0xFF, 0xFF, 0xFF}, protocol.ErrFrameTooLarge},
+		{"unknown type", frame(200), protocol.ErrUnknownMessage},
+		{"empty frame", []byte{0, 0, 0, 0}, protocol.ErrMalformed},
+		{"cut short", frame(protocol.TypeRemoveBlock, int32(1), int32(2)), protocol.ErrMalformed},
+		{"trailing bytes", frame(protocol.TypePlayerLeft, uint32(1), uint32(2)), protocol.ErrMalformed},
+		{"invalid block type", frame(protocol.TypeAddBlock, int32(1), int32(2), int32(3), uint32(1000)), protocol.ErrMalformed},
+		{"invalid chunk size", frame(protocol.TypeChunkData, int32(0), int32(0), int32(0), uint32(0), uint32(0)), protocol.ErrMalformed},
+		{"wrong voxel count", frame(protocol.TypeChunkData, int32(0), int32(0), int32(0), uint32(1), uint32(1), uint32(0)), protocol.ErrMalformed},
+		{"invalid vbits", frame(protocol.TypeChunkData, int32(0), int32(0), int32(0), uint32(1), uint32(2), chunk.LargestVbits+1, uint32(0)), protocol.ErrMalformed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := protocol.ReadMessage(bytes.NewReader(tt.data))
+
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %q but got %q", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestReadTruncatedFrame(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := protocol.WriteMessage(&buf, protocol.Reject{Reason: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := protocol.ReadMessage(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected %v but got %v", io.ErrUnexpectedEOF, err)
+	}
+}
@@ -23,6 +23,14 @@ type Interface interface {
 	GetCrosshairLength() float64
 	SetCrosshairThickness(thickness float64)
 	GetCrosshairThickness() float64
+	SetRandomTickSpeed(speed uint32)
+	GetRandomTickSpeed() uint32
+	SetUnloadDistance(unloadDistance uint32)
+	GetUnloadDistance() uint32
+	SetRetainedChunks(retainedChunks uint32)
+	GetRetainedChunks() uint32
+	SetCompressionLevel(compressionLevel uint32)
+	GetCompressionLevel() uint32
 	SetFromReader(reader io.Reader) error
 }
 
@@ -128,6 +136,54 @@ func (r *Repository) GetCrosshairThickness() float64 {
 	return r.c.getCrosshairThickness()
 }
 
+// SetRandomTickSpeed sets how many random voxels per loaded chunk are ticked
+// every tick.
+func (r *Repository) SetRandomTickSpeed(speed uint32) {
+	r.c.setRandomTickSpeed(speed)
+}
+
+// GetRandomTickSpeed gets how many random voxels per loaded chunk are ticked
+// every tick.
+func (r *Repository) GetRandomTickSpeed() uint32 {
+	return r.c.getRandomTickSpeed()
+}
+
+// SetUnloadDistance sets how far from the player in chunks loaded chunks are
+// kept before unloading.
+func (r *Repository) SetUnloadDistance(unloadDistance uint32) {
+	r.c.setUnloadDistance(unloadDistance)
+}
+
+// GetUnloadDistance gets how far from the player in chunks loaded chunks are
+// kept before unloading.
+func (r *Repository) GetUnloadDistance() uint32 {
+	return r.c.getUnloadDistance()
+}
+
+// SetRetainedChunks sets how many unloaded chunks are kept in memory in case
+// they are loaded again.
+func (r *Repository) SetRetainedChunks(retainedChunks uint32) {
+	r.c.setRetainedChunks(retainedChunks)
+}
+
+// GetRetainedChunks gets how many unloaded chunks are kept in memory in case
+// they are loaded again.
+func (r *Repository) GetRetainedChunks() uint32 {
+	return r.c.getRetainedChunks()
+}
+
+// SetCompressionLevel sets the zlib compression level of saved chunks, from 1
+// to 9, or 0 to save them uncompressed.
+func (r *Repository) SetCompressionLevel(compressionLevel uint32) {
+	r.c.setCompressionLevel(compressionLevel)
+}
+
+// GetCompressionLevel gets the zlib compression level of saved chunks, from 1
+// to 9, or 0 to save them uncompressed.
+func (r *Repository) GetCompressionLevel() uint32 {
+	return r.c.getCompressionLevel()
+}
+
 // SetFromReader sets repository value from a reader in key=value format.
 func (r *Repository) SetFromReader(reader io.Reader) error {
 	return r.c.setFromReader(reader)
@@ -151,6 +207,14 @@ type FnRepository struct {
 	FnGetCrosshairLength    func() float64
 	FnSetCrosshairThickness func(thickness float64)
 	FnGetCrosshairThickness func() float64
+	FnSetRandomTickSpeed    func(speed uint32)
+	FnGetRandomTickSpeed    func() uint32
+	FnSetUnloadDistance     func(unloadDistance uint32)
+	FnGetUnloadDistance     func() uint32
+	FnSetRetainedChunks     func(retainedChunks uint32)
+	FnGetRetainedChunks     func() uint32
+	FnSetCompressionLevel   func(compressionLevel uint32)
+	FnGetCompressionLevel   func() uint32
 }
 
 func (fn FnRepository) SetFOV(degY float64) {
@@ -264,3 +328,55 @@ func (fn FnRepository) GetCrosshairThickness() float64 {
 	}
 	return 2
 }
+
+func (fn FnRepository) SetRandomTickSpeed(speed uint32) {
+	if fn.FnSetRandomTickSpeed != nil {
+		fn.FnSetRandomTickSpeed(speed)
+	}
+}
+
+func (fn FnRepository) GetRandomTickSpeed() uint32 {
+	if fn.FnGetRandomTickSpeed != nil {
+		return fn.FnGetRandomTickSpeed()
+	}
+	return 0
+}
+
+func (fn FnRepository) SetUnloadDistance(unloadDistance uint32) {
+	if fn.FnSetUnloadDistance != nil {
+		fn.FnSetUnloadDistance(unloadDistance)
+	}
+}
+
+func (fn FnRepository) GetUnloadDistance() uint32 {
+	if fn.FnGetUnloadDistance != nil {
+		return fn.FnGetUnloadDistance()
+	}
+	return 0
+}
+
+func (fn FnRepository) SetRetainedChunks(retainedChunks uint32) {
+	if fn.FnSetRetainedChunks != nil {
+		fn.FnSetRetainedChunks(retainedChunks)
+	}
+}
+
+func (fn FnRepository) GetRetainedChunks() uint32 {
+	if fn.FnGetRetainedChunks != nil {
+		return fn.FnGetRetainedChunks()
+	}
+	return 0
+}
+
+func (fn FnRepository) SetCompressionLevel(compressionLevel uint32) {
+	if fn.FnSetCompressionLevel != nil {
+		fn.FnSetCompressionLevel(compressionLevel)
+	}
+}
+
+func (fn FnRepository) GetCompressionLevel() uint32 {
+	if fn.FnGetCompressionLevel != nil {
+		return fn.FnGetCompressionLevel()
+	}
+	return 0
+}
@@ -128,6 +128,85 @@ func TestRepositoryCrosshair(t *testing.T) {
 	})
 }
 
+func TestRepositoryRandomTickSpeed(t *testing.T) {
+	t.Parallel()
+
+	t.Run("set then get is same", func(t *testing.T) {
+		t.Parallel()
+		settings := settings.New()
+		expected := uint32(3)
+
+		settings.SetRandomTickSpeed(expected)
+		actual := settings.GetRandomTickSpeed()
+
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+}
+
+func TestRepositoryUnloadDistance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("set then get is same", func(t *testing.T) {
+		t.Parallel()
+		settings := settings.New()
+		expected := uint32(7)
+
+		settings.SetUnloadDistance(expected)
+		actual := settings.GetUnloadDistance()
+
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+}
+
+func TestRepositoryRetainedChunks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("set then get is same", func(t *testing.T) {
+		t.Parallel()
+		settings := settings.New()
+		expected := uint32(64)
+
+		settings.SetRetainedChunks(expected)
+		actual := settings.GetRetainedChunks()
+
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+}
+
+func TestRepositoryCompressionLevel(t *testing.T) {
+	t.Parallel()
+
+	t.Run("set then get is same", func(t *testing.T) {
+		t.Parallel()
+		settings := settings.New()
+		expected := uint32(9)
+
+		settings.SetCompressionLevel(expected)
+		actual := settings.GetCompressionLevel()
+
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+
+	t.Run("fails parsing levels above 9", func(t *testing.T) {
+		t.Parallel()
+		settingsMod := settings.New()
+
+		err := settingsMod.SetFromReader(strings.NewReader("compressionLevel=10"))
+
+		if !errors.Is(err, settings.ErrParseValue) {
+			t.Fatalf("expected %v but got %v", settings.ErrParseValue, err)
+		}
+	})
+}
+
 func TestRepositoryFromReader(t *testing.T) {
 	t.Parallel()
 
@@ -194,6 +273,10 @@ func TestRepositoryFromReader(t *testing.T) {
 			"regionSize=5",
 			"crosshairLength=0.03",
 			"crosshairThickness=2.0",
+			"randomTickSpeed=3",
+			"unloadDistance=11",
+			"retainedChunks=100",
+			"compressionLevel=6",
 		}, "\n"))
 		settings := settings.New()
 
@@ -213,6 +296,10 @@ func TestRepositoryFromReader(t *testing.T) {
 		expectRegionSize := 5
 		expectCrosshairLength := 0.03
 		expectCrosshairThickness := 2.0
+		expectRandomTickSpeed := 3
+		expectUnloadDistance := 11
+		expectRetainedChunks := 100
+		expectCompressionLevel := 6
 
 		fov := settings.GetFOV()
 		if fov != expectFOV {
@@ -253,5 +340,21 @@ func TestRepositoryFromReader(t *testing.T) {
 		if crosshairThickness != expectCrosshairThickness {
 			t.Fatalf("expected crosshair size %v but got %v", expectCrosshairThickness, crosshairThickness)
 		}
+		randomTickSpeed := settings.GetRandomTickSpeed()
+		if randomTickSpeed != uint32(expectRandomTickSpeed) {
+			t.Fatalf("expected random tick speed %v but got %v", expectRandomTickSpeed, randomTickSpeed)
+		}
+		unloadDistance := settings.GetUnloadDistance()
+		if unloadDistance != uint32(expectUnloadDistance) {
+			t.Fatalf("expected unload distance %v but got %v", expectUnloadDistance, unloadDistance)
+		}
+		retainedChunks := settings.GetRetainedChunks()
+		if retainedChunks != uint32(expectRetainedChunks) {
+			t.Fatalf("expected retained chunks %v but got %v", expectRetainedChunks, retainedChunks)
+		}
+		compressionLevel := settings.GetCompressionLevel()
+		if compressionLevel != uint32(expectCompressionLevel) {
+			t.Fatalf("expected compression level %v but got %v", expectCompressionLevel, compressionLevel)
+		}
 	})
 }
@@ -20,6 +20,10 @@ type core struct {
 	regionSize         uint32
 	crosshairLength    float64
 	crosshairThickness float64
+	randomTickSpeed    uint32
+	unloadDistance     uint32
+	retainedChunks     uint32
+	compressionLevel   uint32
 }
 
 func (c *core) setFOV(degY float64) {
@@ -92,6 +96,38 @@ func (c *core) getCrosshairThickness() float64 {
 	return c.crosshairThickness
 }
 
+func (c *core) setRandomTickSpeed(speed uint32) {
+	c.randomTickSpeed = speed
+}
+
+func (c *core) getRandomTickSpeed() uint32 {
+	return c.randomTickSpeed
+}
+
+func (c *core) setUnloadDistance(unloadDistance uint32) {
+	c.unloadDistance = unloadDistance
+}
+
+func (c *core) getUnloadDistance() uint32 {
+	return c.unloadDistance
+}
+
+func (c *core) setRetainedChunks(retainedChunks uint32) {
+	c.retainedChunks = retainedChunks
+}
+
+func (c *core) getRetainedChunks() uint32 {
+	return c.retainedChunks
+}
+
+func (c *core) setCompressionLevel(compressionLevel uint32) {
+	c.compressionLevel = compressionLevel
+}
+
+func (c *core) getCompressionLevel() uint32 {
+	return c.compressionLevel
+}
+
 func (c *core) setFromReader(reader io.Reader) error {
 	scanner := bufio.NewScanner(reader)
 	lineNumber := 0
@@ -205,6 +241,42 @@ func (c *core) setFromReader(reader io.Reader) error {
 				}
 			}
 			c.setCrosshairThickness(crosshairThickness)
+		case "randomTickSpeed":
+			speed, err := strconv.Atoi(value)
+			if err != nil || speed < 0 {
+				return &ErrParse{
+					Line: lineNumber,
+					Err:  ErrParseValue,
+				}
+			}
+			c.setRandomTickSpeed(uint32(speed))
+		case "unloadDistance":
+			ud, err := strconv.Atoi(value)
+			if err != nil || ud < 0 {
+				return &ErrParse{
+					Line: lineNumber,
+					Err:  ErrParseValue,
+				}
+			}
+			c.setUnloadDistance(uint32(ud))
+		case "retainedChunks":
+			retained, err := strconv.Atoi(value)
+			if err != nil || retained < 0 {
+				return &ErrParse{
+					Line: lineNumber,
+					Err:  ErrParseValue,
+				}
+			}
+			c.setRetainedChunks(uint32(retained))
+		case "compressionLevel":
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 0 || v > 9 {
+				return &ErrParse{
+					Line: lineNumber,
+					Err:  ErrParseValue,
+				}
+			}
+			c.setCompressionLevel(uint32(v))
 		default:
 			log.Warnf("invalid settings entry: %v=%v", key, value)
 		}
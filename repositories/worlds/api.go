@@ -0,0 +1,263 @@
+package worlds
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+type Interface interface {
+	Create(meta Metadata) (string, error)
+	Import(meta Metadata, dataDir string) (string, error)
+	HasLegacyData(dataDir string) bool
+	List() ([]World, error)
+	Find(name string) (string, error)
+	Open(id string) (Metadata, error)
+	GetSelected() (string, bool)
+	GetSelectedFs() afero.Fs
+	SaveMetadata(id string, meta Metadata) error
+	Rename(id string, name string) error
+	Delete(id string) error
+	SavePlayerState(id string, state PlayerState) error
+	LoadPlayerState(id string) (PlayerState, error)
+}
+
+// FormatVersion is the save format version of newly created worlds. Worlds of
+// version 1 keep their chunks in three files, and worlds of version 2 and later
+// keep them in a file per region. Worlds of version 3 save only the block types
+// of chunks.
+const FormatVersion = 3
+
+// Position is a point in the world in voxel coordinates.
+type Position struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// Metadata describes a world.
+type Metadata struct {
+	Name              string
+	Seed              int64
+	Generator         string
+	GeneratorSettings map[string]string
+	ChunkSize         uint32
+	RegionSize        uint32
+	Spawn             Position
+	FormatVersion     uint32
+}
+
+// PlayerState is where the player was and which way they were looking when the
+// world was last saved.
+type PlayerState struct {
+	Position Position
+	Rotation mgl.Quat
+}
+
+// World is a world's ID together with its metadata.
+type World struct {
+	ID       string
+	Metadata Metadata
+}
+
+// ErrWorldNotFound indicates that there is no world with the given ID.
+const ErrWorldNotFound log.ConstErr = "world not found"
+
+// ErrWorldOpen indicates that the world is open and cannot be deleted.
+const ErrWorldOpen log.ConstErr = "world is open"
+
+// ErrInvalidName indicates that a world name is empty, has no usable
+// characters, or has control characters or an equals sign.
+const ErrInvalidName log.ConstErr = "world name is invalid"
+
+// ErrMetadata indicates that a world's metadata file could not be parsed.
+const ErrMetadata log.ConstErr = "world metadata is invalid"
+
+// ErrNoPlayerState indicates that the world has no saved player state yet.
+const ErrNoPlayerState log.ConstErr = "world has no player state"
+
+// ErrPlayerState indicates that a world's player state file could not be
+// parsed.
+const ErrPlayerState log.ConstErr = "player state is invalid"
+
+// Create creates a world directory with the given metadata and returns the new
+// world's ID. The ID is derived from the name and never changes.
+func (r *Repository) Create(meta Metadata) (string, error) {
+	return r.c.create(meta)
+}
+
+// Import creates a world with the given metadata like Create, whose save
+// files are the ones in dataDir, and returns the new world's ID. dataDir is
+// moved into the world directory as its data directory.
+func (r *Repository) Import(meta Metadata, dataDir string) (string, error) {
+	return r.c.importWorld(meta, dataDir)
+}
+
+// HasLegacyData returns whether dataDir is a directory, such as the one that
+// older versions of the game saved their only world in, which Import can
+// import.
+func (r *Repository) HasLegacyData(dataDir string) bool {
+	return r.c.hasLegacyData(dataDir)
+}
+
+// List returns every world, sorted by ID.
+func (r *Repository) List() ([]World, error) {
+	return r.c.list()
+}
+
+// Find returns the ID of the world with the given name, or ErrWorldNotFound if
+// there is none.
+func (r *Repository) Find(name string) (string, error) {
+	return r.c.find(name)
+}
+
+// Open selects the world with the given ID and returns its metadata.
+func (r *Repository) Open(id string) (Metadata, error) {
+	return r.c.open(id)
+}
+
+// GetSelected returns the ID of the open world, if there is one.
+func (r *Repository) GetSelected() (string, bool) {
+	return r.c.getSelected()
+}
+
+// GetSelectedFs returns a file system rooted at the open world's directory.
+func (r *Repository) GetSelectedFs() afero.Fs {
+	return r.c.getSelectedFs()
+}
+
+// SaveMetadata overwrites the metadata of the world with the given ID.
+func (r *Repository) SaveMetadata(id string, meta Metadata) error {
+	return r.c.saveMetadata(id, meta)
+}
+
+// Rename changes the name of the world with the given ID. The ID stays the same.
+func (r *Repository) Rename(id string, name string) error {
+	return r.c.rename(id, name)
+}
+
+// Delete removes the world with the given ID and all of its saved data.
+func (r *Repository) Delete(id string) error {
+	return r.c.delete(id)
+}
+
+// SavePlayerState overwrites the saved player state of the world with the
+// given ID.
+func (r *Repository) SavePlayerState(id string, state PlayerState) error {
+	return r.c.savePlayerState(id, state)
+}
+
+// LoadPlayerState returns the saved player state of the world with the given
+// ID, or ErrNoPlayerState if it was never saved. The rotation is normalized, and
+// a state with a value that isn't finite or a rotation of zero length fails with
+// ErrPlayerState.
+func (r *Repository) LoadPlayerState(id string) (PlayerState, error) {
+	return r.c.loadPlayerState(id)
+}
+
+type FnRepository struct {
+	FnCreate          func(meta Metadata) (string, error)
+	FnImport          func(meta Metadata, dataDir string) (string, error)
+	FnHasLegacyData   func(dataDir string) bool
+	FnList            func() ([]World, error)
+	FnFind            func(name string) (string, error)
+	FnOpen            func(id string) (Metadata, error)
+	FnGetSelected     func() (string, bool)
+	FnGetSelectedFs   func() afero.Fs
+	FnSaveMetadata    func(id string, meta Metadata) error
+	FnRename          func(id string, name string) error
+	FnDelete          func(id string) error
+	FnSavePlayerState func(id string, state PlayerState) error
+	FnLoadPlayerState func(id string) (PlayerState, error)
+}
+
+func (fn FnRepository) Create(meta Metadata) (string, error) {
+	if fn.FnCreate != nil {
+		return fn.FnCreate(meta)
+	}
+	return "", nil
+}
+
+func (fn FnRepository) Import(meta Metadata, dataDir string) (string, error) {
+	if fn.FnImport != nil {
+		return fn.FnImport(meta, dataDir)
+	}
+	return "", nil
+}
+
+func (fn FnRepository) HasLegacyData(dataDir string) bool {
+	if fn.FnHasLegacyData != nil {
+		return fn.FnHasLegacyData(dataDir)
+	}
+	return false
+}
+
+func (fn FnRepository) List() ([]World, error) {
+	if fn.FnList != nil {
+		return fn.FnList()
+	}
+	return nil, nil
+}
+
+func (fn FnRepository) Find(name string) (string, error) {
+	if fn.FnFind != nil {
+		return fn.FnFind(name)
+	}
+	return "", ErrWorldNotFound
+}
+
+func (fn FnRepository) Open(id string) (Metadata, error) {
+	if fn.FnOpen != nil {
+		return fn.FnOpen(id)
+	}
+	return Metadata{}, nil
+}
+
+func (fn FnRepository) GetSelected() (string, bool) {
+	if fn.FnGetSelected != nil {
+		return fn.FnGetSelected()
+	}
+	return "", false
+}
+
+func (fn FnRepository) GetSelectedFs() afero.Fs {
+	if fn.FnGetSelectedFs != nil {
+		return fn.FnGetSelectedFs()
+	}
+	return afero.NewMemMapFs()
+}
+
+func (fn FnRepository) SaveMetadata(id string, meta Metadata) error {
+	if fn.FnSaveMetadata != nil {
+		return fn.FnSaveMetadata(id, meta)
+	}
+	return nil
+}
+
+func (fn FnRepository) Rename(id string, name string) error {
+	if fn.FnRename != nil {
+		return fn.FnRename(id, name)
+	}
+	return nil
+}
+
+func (fn FnRepository) Delete(id string) error {
+	if fn.FnDelete != nil {
+		return fn.FnDelete(id)
+	}
+	return nil
+}
+
+func (fn FnRepository) SavePlayerState(id string, state PlayerState) error {
+	if fn.FnSavePlayerState != nil {
+		return fn.FnSavePlayerState(id, state)
+	}
+	return nil
+}
+
+func (fn FnRepository) LoadPlayerState(id string) (PlayerState, error) {
+	if fn.FnLoadPlayerState != nil {
+		return fn.FnLoadPlayerState(id)
+	}
+	return PlayerState{}, ErrNoPlayerState
+}
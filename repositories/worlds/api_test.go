@@ -0,0 +1,520 @@
+package worlds_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/repositories/worlds"
+	"github.com/spf13/afero"
+)
+
+func testMetadata(name string) worlds.Metadata {
+	return worlds.Metadata{
+		Name:      name,
+		Seed:      -1234567890123,
+		Generator: "alex",
+		GeneratorSettings: map[string]string{
+			"seaLevel": "4",
+			"image":    "maps/island.png",
+		},
+		ChunkSize:     5,
+		RegionSize:    6,
+		Spawn:         worlds.Position{X: 0.5, Y: 20, Z: -3.25},
+		FormatVersion: worlds.FormatVersion,
+	}
+}
+
+func TestRepositoryNew(t *testing.T) {
+	t.Parallel()
+
+	t.Run("return is non-nil", func(t *testing.T) {
+		t.Parallel()
+		if worlds.New(afero.NewMemMapFs()) == nil {
+			t.Fatal("expected non-nil return")
+		}
+	})
+
+	t.Run("panic on nil file system", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatal("expected panic, but didn't")
+			}
+		}()
+		worlds.New(nil)
+	})
+}
+
+func TestRepositoryCreateThenOpenIsSame(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	expected := testMetadata("My World")
+
+	id, err := worldsRepo.Create(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := worldsRepo.Open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "my-world" {
+		t.Fatalf("expected id %v but got %v", "my-world", id)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected metadata %v but got %v", expected, actual)
+	}
+	selected, ok := worldsRepo.GetSelected()
+	if !ok || selected != id {
+		t.Fatalf("expected %v to be selected but got %v", id, selected)
+	}
+}
+
+func TestRepositoryCreateInvalidName(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	_, err := worldsRepo.Create(testMetadata(" ?! "))
+
+	if !errors.Is(err, worlds.ErrInvalidName) {
+		t.Fatalf("expected %q but got %q", worlds.ErrInvalidName, err)
+	}
+}
+
+func TestRepositoryRejectsNamesThatBreakMetadata(t *testing.T) {
+	t.Parallel()
+	names := []string{"my\nworld", "seed=5", "tab\there", "bell\a"}
+	for _, name := range names {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			worldsRepo := worlds.New(afero.NewMemMapFs())
+			id, err := worldsRepo.Create(testMetadata("World"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, createErr := worldsRepo.Create(testMetadata(name))
+			renameErr := worldsRepo.Rename(id, name)
+			saveErr := worldsRepo.SaveMetadata(id, testMetadata(name))
+
+			for _, err := range []error{createErr, renameErr, saveErr} {
+				if !errors.Is(err, worlds.ErrInvalidName) {
+					t.Fatalf("expected %q but got %q", worlds.ErrInvalidName, err)
+				}
+			}
+			meta, err := worldsRepo.Open(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Name != "World" {
+				t.Fatalf("expected the name to stay World but got %q", meta.Name)
+			}
+		})
+	}
+}
+
+func TestRepositoryCreateSameNameGetsNewID(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	id1, err := worldsRepo.Create(testMetadata("World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := worldsRepo.Create(testMetadata("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id1 == id2 {
+		t.Fatalf("expected different ids but both were %v", id1)
+	}
+}
+
+func TestRepositoryList(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	for _, name := range []string{"b", "c", "a"} {
+		if _, err := worldsRepo.Create(testMetadata(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := worldsRepo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "c"}
+	actual := []string{}
+	for _, w := range list {
+		actual = append(actual, w.ID)
+		if w.Metadata.Name != w.ID {
+			t.Fatalf("expected world %v to have name %v but got %v", w.ID, w.ID, w.Metadata.Name)
+		}
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected worlds %v but got %v", expected, actual)
+	}
+}
+
+func TestRepositoryFind(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	if _, err := worldsRepo.Create(testMetadata("Other")); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := worldsRepo.Create(testMetadata("My World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := worldsRepo.Find("My World")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errMissing := worldsRepo.Find("Missing")
+
+	if actual != expected {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	if !errors.Is(errMissing, worlds.ErrWorldNotFound) {
+		t.Fatalf("expected %q but got %q", worlds.ErrWorldNotFound, errMissing)
+	}
+}
+
+func TestRepositoryListWithoutWorlds(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	list, err := worldsRepo.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected no worlds but got %v", list)
+	}
+}
+
+func TestRepositoryRenameKeepsID(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	id, err := worldsRepo.Create(testMetadata("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = worldsRepo.Rename(id, "New Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := worldsRepo.Open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Name != "New Name" {
+		t.Fatalf("expected name %v but got %v", "New Name", meta.Name)
+	}
+	if meta.Seed != testMetadata("").Seed {
+		t.Fatalf("expected rename to keep seed %v but got %v", testMetadata("").Seed, meta.Seed)
+	}
+}
+
+func TestRepositoryRenameMissing(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	err := worldsRepo.Rename("missing", "name")
+
+	if !errors.Is(err, worlds.ErrWorldNotFound) {
+		t.Fatalf("expected %q but got %q", worlds.ErrWorldNotFound, err)
+	}
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	id, err := worldsRepo.Create(testMetadata("doomed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = afero.WriteFile(fs, "worlds/doomed/data/voxel.data", []byte{1, 2, 3}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = worldsRepo.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := afero.DirExists(fs, "worlds/doomed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("expected world directory to be removed, but it was not")
+	}
+	_, err = worldsRepo.Open(id)
+	if !errors.Is(err, worlds.ErrWorldNotFound) {
+		t.Fatalf("expected %q but got %q", worlds.ErrWorldNotFound, err)
+	}
+}
+
+func TestRepositoryDeleteOpenWorld(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	id, err := worldsRepo.Create(testMetadata("open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worldsRepo.Open(id); err != nil {
+		t.Fatal(err)
+	}
+
+	err = worldsRepo.Delete(id)
+
+	if !errors.Is(err, worlds.ErrWorldOpen) {
+		t.Fatalf("expected %q but got %q", worlds.ErrWorldOpen, err)
+	}
+}
+
+func TestRepositorySelectedFsIsWorldDirectory(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	id, err := worldsRepo.Create(testMetadata("files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worldsRepo.Open(id); err != nil {
+		t.Fatal(err)
+	}
+
+	err = afero.WriteFile(worldsRepo.GetSelectedFs(), "chunk.data", []byte{1}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := afero.Exists(fs, "worlds/files/chunk.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected file to be written in the world directory, but it was not")
+	}
+}
+
+func TestRepositoryImportMovesDataIntoWorld(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	if err := afero.WriteFile(fs, "data/voxel.data", []byte{1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !worldsRepo.HasLegacyData("data") {
+		t.Fatal("expected the data directory to be found, but it wasn't")
+	}
+
+	id, err := worldsRepo.Import(testMetadata("Old World"), "data")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worldsRepo.HasLegacyData("data") {
+		t.Fatal("expected the data directory to be gone after importing it")
+	}
+	if _, err := worldsRepo.Open(id); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := afero.ReadFile(worldsRepo.GetSelectedFs(), "data/voxel.data")
+	if err != nil || !reflect.DeepEqual(bs, []byte{1, 2}) {
+		t.Fatalf("expected the imported file in the world directory, but got %v, %v", bs, err)
+	}
+	if exists, _ := afero.DirExists(fs, "data"); exists {
+		t.Fatal("expected the data directory to be moved")
+	}
+}
+
+func TestRepositoryHasLegacyDataOnlyForDirectories(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	if err := afero.WriteFile(fs, "data", []byte{1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if worldsRepo.HasLegacyData("data") {
+		t.Fatal("expected a file not to be taken for a data directory")
+	}
+	if worldsRepo.HasLegacyData("missing") {
+		t.Fatal("expected a missing directory not to be found")
+	}
+}
+
+func TestRepositoryImportMissingData(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	_, err := worldsRepo.Import(testMetadata("Old World"), "data")
+
+	if err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	if list, _ := worldsRepo.List(); len(list) != 0 {
+		t.Fatalf("expected no world to be created, but got %v", list)
+	}
+}
+
+func TestRepositoryOpenInvalidMetadata(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	err := afero.WriteFile(fs, "worlds/broken/world.conf", []byte("name=broken\nseed=abc\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = worldsRepo.Open("broken")
+
+	if !errors.Is(err, worlds.ErrMetadata) {
+		t.Fatalf("expected %q but got %q", worlds.ErrMetadata, err)
+	}
+}
+
+func TestRepositoryPlayerStateSaveThenLoadIsSame(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	id, err := worldsRepo.Create(testMetadata("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := worlds.PlayerState{
+		Position: worlds.Position{X: 1.5, Y: -20.125, Z: 300},
+		Rotation: mgl.QuatRotate(mgl.DegToRad(30), mgl.Vec3{0, 1, 0}),
+	}
+
+	err = worldsRepo.SavePlayerState(id, expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := worldsRepo.LoadPlayerState(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestRepositoryLoadPlayerStateNeverSaved(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+	id, err := worldsRepo.Create(testMetadata("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = worldsRepo.LoadPlayerState(id)
+
+	if !errors.Is(err, worlds.ErrNoPlayerState) {
+		t.Fatalf("expected %q but got %q", worlds.ErrNoPlayerState, err)
+	}
+}
+
+func TestRepositorySavePlayerStateMissingWorld(t *testing.T) {
+	t.Parallel()
+	worldsRepo := worlds.New(afero.NewMemMapFs())
+
+	err := worldsRepo.SavePlayerState("missing", worlds.PlayerState{Rotation: mgl.QuatIdent()})
+
+	if !errors.Is(err, worlds.ErrWorldNotFound) {
+		t.Fatalf("expected %q but got %q", worlds.ErrWorldNotFound, err)
+	}
+}
+
+func TestRepositoryLoadPlayerStateInvalid(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	id, err := worldsRepo.Create(testMetadata("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = afero.WriteFile(fs, "worlds/"+id+"/player.conf", []byte("x=1\nrotW=oops\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = worldsRepo.LoadPlayerState(id)
+
+	if !errors.Is(err, worlds.ErrPlayerState) {
+		t.Fatalf("expected %q but got %q", worlds.ErrPlayerState, err)
+	}
+}
+
+func TestRepositoryLoadPlayerStateRejectsValuesThatArentFinite(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"position is NaN":      "x=NaN\n",
+		"position is infinite": "y=+Inf\n",
+		"rotation is NaN":      "rotW=nan\n",
+		"rotation is infinite": "rotX=-Inf\n",
+		"rotation is zero":     "rotW=0\nrotX=0\nrotY=0\nrotZ=0\n",
+	}
+	for name, file := range files {
+		file := file
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			fs := afero.NewMemMapFs()
+			worldsRepo := worlds.New(fs)
+			id, err := worldsRepo.Create(testMetadata("world"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = afero.WriteFile(fs, "worlds/"+id+"/player.conf", []byte(file), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = worldsRepo.LoadPlayerState(id)
+
+			if !errors.Is(err, worlds.ErrPlayerState) {
+				t.Fatalf("expected %q but got %q", worlds.ErrPlayerState, err)
+			}
+		})
+	}
+}
+
+func TestRepositoryLoadPlayerStateNormalizesRotation(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	worldsRepo := worlds.New(fs)
+	id, err := worldsRepo.Create(testMetadata("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = afero.WriteFile(fs, "worlds/"+id+"/player.conf", []byte("rotW=2\nrotX=0\nrotY=2\nrotZ=0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := worldsRepo.LoadPlayerState(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := mgl.QuatRotate(mgl.DegToRad(90), mgl.Vec3{0, 1, 0})
+	if !state.Rotation.ApproxEqual(expected) {
+		t.Fatalf("expected rotation %v but got %v", expected, state.Rotation)
+	}
+}
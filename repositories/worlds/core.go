@@ -0,0 +1,330 @@
+package worlds
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// worldsDirectory is the directory holding one directory per world.
+const worldsDirectory = "worlds"
+
+// metadataFileName is the name of the metadata file in a world directory.
+const metadataFileName = "world.conf"
+
+// generatorSettingPrefix prefixes the keys of generator settings in the
+// metadata file.
+const generatorSettingPrefix = "generator."
+
+type core struct {
+	fs       afero.Fs
+	selected string
+}
+
+func worldDirectory(id string) string {
+	return path.Join(worldsDirectory, id)
+}
+
+func metadataPath(id string) string {
+	return path.Join(worldsDirectory, id, metadataFileName)
+}
+
+// nameToID turns a world name into a directory name by lowercasing it and
+// dropping everything that isn't a letter, digit, dash or underscore.
+func nameToID(name string) string {
+	var id strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			id.WriteRune(r)
+		case r == ' ':
+			id.WriteRune('-')
+		}
+	}
+	return id.String()
+}
+
+// isValidName returns whether name can be the name of a world: it must turn
+// into a directory name, and must not break the line it is written on in the
+// metadata file.
+func isValidName(name string) bool {
+	if nameToID(name) == "" {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *core) exists(id string) bool {
+	_, err := c.fs.Stat(metadataPath(id))
+	return err == nil
+}
+
+func (c *core) create(meta Metadata) (string, error) {
+	if !isValidName(meta.Name) {
+		return "", ErrInvalidName
+	}
+	base := nameToID(meta.Name)
+	id := base
+	for i := 2; ; i++ {
+		_, err := c.fs.Stat(worldDirectory(id))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		id = fmt.Sprintf("%v-%v", base, i)
+	}
+	err := c.fs.MkdirAll(worldDirectory(id), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = c.writeMetadata(id, meta)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (c *core) importWorld(meta Metadata, dataDir string) (string, error) {
+	if _, err := c.fs.Stat(dataDir); err != nil {
+		return "", err
+	}
+	id, err := c.create(meta)
+	if err != nil {
+		return "", err
+	}
+	worldDataDir := path.Join(worldDirectory(id), "data")
+	if err := c.moveFiles(dataDir, worldDataDir); err != nil {
+		// what was moved is put back, so that importing can be tried again
+		if c.moveFiles(worldDataDir, dataDir) == nil {
+			c.fs.RemoveAll(worldDirectory(id))
+		}
+		return "", err
+	}
+	return id, c.fs.RemoveAll(dataDir)
+}
+
+func (c *core) hasLegacyData(dataDir string) bool {
+	exists, err := afero.DirExists(c.fs, dataDir)
+	return err == nil && exists
+}
+
+// moveFiles moves the files under src to the same paths under dst.
+func (c *core) moveFiles(src, dst string) error {
+	return afero.Walk(c.fs, src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		to := path.Join(dst, strings.TrimPrefix(p, src))
+		if err := c.fs.MkdirAll(path.Dir(to), 0755); err != nil {
+			return err
+		}
+		return c.fs.Rename(p, to)
+	})
+}
+
+func (c *core) list() ([]World, error) {
+	infos, err := afero.ReadDir(c.fs, worldsDirectory)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	worlds := []World{}
+	for _, info := range infos {
+		if !info.IsDir() || !c.exists(info.Name()) {
+			continue
+		}
+		meta, err := c.readMetadata(info.Name())
+		if err != nil {
+			log.Warnf("skipping world %v: %v", info.Name(), err)
+			continue
+		}
+		worlds = append(worlds, World{
+			ID:       info.Name(),
+			Metadata: meta,
+		})
+	}
+	sort.Slice(worlds, func(i, j int) bool {
+		return worlds[i].ID < worlds[j].ID
+	})
+	return worlds, nil
+}
+
+func (c *core) find(name string) (string, error) {
+	worlds, err := c.list()
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSpace(name)
+	for _, w := range worlds {
+		if w.Metadata.Name == name {
+			return w.ID, nil
+		}
+	}
+	return "", ErrWorldNotFound
+}
+
+func (c *core) open(id string) (Metadata, error) {
+	meta, err := c.readMetadata(id)
+	if err != nil {
+		return Metadata{}, err
+	}
+	c.selected = id
+	return meta, nil
+}
+
+func (c *core) getSelected() (string, bool) {
+	return c.selected, c.selected != ""
+}
+
+func (c *core) getSelectedFs() afero.Fs {
+	if c.selected == "" {
+		panic("no world is open")
+	}
+	return afero.NewBasePathFs(c.fs, worldDirectory(c.selected))
+}
+
+func (c *core) saveMetadata(id string, meta Metadata) error {
+	if !c.exists(id) {
+		return ErrWorldNotFound
+	}
+	return c.writeMetadata(id, meta)
+}
+
+func (c *core) rename(id string, name string) error {
+	name = strings.TrimSpace(name)
+	if !isValidName(name) {
+		return ErrInvalidName
+	}
+	meta, err := c.readMetadata(id)
+	if err != nil {
+		return err
+	}
+	meta.Name = name
+	return c.writeMetadata(id, meta)
+}
+
+func (c *core) delete(id string) error {
+	if !c.exists(id) {
+		return ErrWorldNotFound
+	}
+	if id == c.selected {
+		return ErrWorldOpen
+	}
+	return c.fs.RemoveAll(worldDirectory(id))
+}
+
+func (c *core) writeMetadata(id string, meta Metadata) error {
+	if !isValidName(meta.Name) {
+		return ErrInvalidName
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "name=%v\n", strings.TrimSpace(meta.Name))
+	fmt.Fprintf(&sb, "seed=%v\n", meta.Seed)
+	fmt.Fprintf(&sb, "generator=%v\n", meta.Generator)
+	keys := make([]string, 0, len(meta.GeneratorSettings))
+	for key := range meta.GeneratorSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "%v%v=%v\n", generatorSettingPrefix, key, meta.GeneratorSettings[key])
+	}
+	fmt.Fprintf(&sb, "chunkSize=%v\n", meta.ChunkSize)
+	fmt.Fprintf(&sb, "regionSize=%v\n", meta.RegionSize)
+	fmt.Fprintf(&sb, "spawnX=%v\n", formatFloat(meta.Spawn.X))
+	fmt.Fprintf(&sb, "spawnY=%v\n", formatFloat(meta.Spawn.Y))
+	fmt.Fprintf(&sb, "spawnZ=%v\n", formatFloat(meta.Spawn.Z))
+	fmt.Fprintf(&sb, "formatVersion=%v\n", meta.FormatVersion)
+	return afero.WriteFile(c.fs, metadataPath(id), []byte(sb.String()), 0644)
+}
+
+func (c *core) readMetadata(id string) (Metadata, error) {
+	if !c.exists(id) {
+		return Metadata{}, ErrWorldNotFound
+	}
+	file, err := c.fs.Open(metadataPath(id))
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer file.Close()
+	return parseMetadata(file)
+}
+
+func parseMetadata(reader io.Reader) (Metadata, error) {
+	meta := Metadata{
+		GeneratorSettings: map[string]string{},
+	}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		elements := strings.SplitN(line, "=", 2)
+		if len(elements) != 2 {
+			return Metadata{}, fmt.Errorf("%w: expected key=value at line %v", ErrMetadata, lineNumber)
+		}
+		key := strings.TrimSpace(elements[0])
+		value := strings.TrimSpace(elements[1])
+		var err error
+		switch key {
+		case "name":
+			meta.Name = value
+		case "seed":
+			meta.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "generator":
+			meta.Generator = value
+		case "chunkSize":
+			meta.ChunkSize, err = parseUint32(value)
+		case "regionSize":
+			meta.RegionSize, err = parseUint32(value)
+		case "spawnX":
+			meta.Spawn.X, err = strconv.ParseFloat(value, 64)
+		case "spawnY":
+			meta.Spawn.Y, err = strconv.ParseFloat(value, 64)
+		case "spawnZ":
+			meta.Spawn.Z, err = strconv.ParseFloat(value, 64)
+		case "formatVersion":
+			meta.FormatVersion, err = parseUint32(value)
+		default:
+			if !strings.HasPrefix(key, generatorSettingPrefix) {
+				log.Warnf("invalid world metadata entry: %v=%v", key, value)
+				continue
+			}
+			meta.GeneratorSettings[strings.TrimPrefix(key, generatorSettingPrefix)] = value
+		}
+		if err != nil {
+			return Metadata{}, fmt.Errorf("%w: invalid %v at line %v", ErrMetadata, key, lineNumber)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Metadata{}, err
+	}
+	return meta, nil
+}
+
+func parseUint32(value string) (uint32, error) {
+	v, err := strconv.ParseUint(value, 10, 32)
+	return uint32(v), err
+}
@@ -0,0 +1,114 @@
+package worlds
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl64"
+	"github.com/kroppt/voxels/log"
+	"github.com/spf13/afero"
+)
+
+// playerFileName is the name of the player state file in a world directory.
+const playerFileName = "player.conf"
+
+func playerPath(id string) string {
+	return path.Join(worldsDirectory, id, playerFileName)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (c *core) savePlayerState(id string, state PlayerState) error {
+	if !c.exists(id) {
+		return ErrWorldNotFound
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "x=%v\n", formatFloat(state.Position.X))
+	fmt.Fprintf(&sb, "y=%v\n", formatFloat(state.Position.Y))
+	fmt.Fprintf(&sb, "z=%v\n", formatFloat(state.Position.Z))
+	fmt.Fprintf(&sb, "rotW=%v\n", formatFloat(state.Rotation.W))
+	fmt.Fprintf(&sb, "rotX=%v\n", formatFloat(state.Rotation.X()))
+	fmt.Fprintf(&sb, "rotY=%v\n", formatFloat(state.Rotation.Y()))
+	fmt.Fprintf(&sb, "rotZ=%v\n", formatFloat(state.Rotation.Z()))
+	return afero.WriteFile(c.fs, playerPath(id), []byte(sb.String()), 0644)
+}
+
+func (c *core) loadPlayerState(id string) (PlayerState, error) {
+	if !c.exists(id) {
+		return PlayerState{}, ErrWorldNotFound
+	}
+	file, err := c.fs.Open(playerPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return PlayerState{}, ErrNoPlayerState
+	}
+	if err != nil {
+		return PlayerState{}, err
+	}
+	defer file.Close()
+	return parsePlayerState(file)
+}
+
+func parsePlayerState(reader io.Reader) (PlayerState, error) {
+	state := PlayerState{
+		Rotation: mgl.QuatIdent(),
+	}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		elements := strings.SplitN(line, "=", 2)
+		if len(elements) != 2 {
+			return PlayerState{}, fmt.Errorf("%w: expected key=value at line %v", ErrPlayerState, lineNumber)
+		}
+		key := strings.TrimSpace(elements[0])
+		value := strings.TrimSpace(elements[1])
+		var target *float64
+		switch key {
+		case "x":
+			target = &state.Position.X
+		case "y":
+			target = &state.Position.Y
+		case "z":
+			target = &state.Position.Z
+		case "rotW":
+			target = &state.Rotation.W
+		case "rotX":
+			target = &state.Rotation.V[0]
+		case "rotY":
+			target = &state.Rotation.V[1]
+		case "rotZ":
+			target = &state.Rotation.V[2]
+		default:
+			log.Warnf("invalid player state entry: %v=%v", key, value)
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return PlayerState{}, fmt.Errorf("%w: invalid %v at line %v", ErrPlayerState, key, lineNumber)
+		}
+		*target = v
+	}
+	if err := scanner.Err(); err != nil {
+		return PlayerState{}, err
+	}
+	if state.Rotation.Len() == 0 {
+		return PlayerState{}, fmt.Errorf("%w: rotation has zero length", ErrPlayerState)
+	}
+	// a rotation edited by hand or rounded when saved may not be a unit
+	// quaternion, which the camera expects
+	state.Rotation = state.Rotation.Normalize()
+	return state, nil
+}
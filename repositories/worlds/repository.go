@@ -0,0 +1,21 @@
+package worlds
+
+import "github.com/spf13/afero"
+
+// Repository stores the worlds that can be played.
+type Repository struct {
+	c core
+}
+
+// New creates and returns a new worlds repository that keeps worlds in
+// directories under the worlds directory of fs.
+func New(fs afero.Fs) *Repository {
+	if fs == nil {
+		panic("worlds repository received a nil file system")
+	}
+	return &Repository{
+		core{
+			fs: fs,
+		},
+	}
+}
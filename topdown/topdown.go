@@ -0,0 +1,159 @@
+// Package topdown renders maps of saved worlds as seen from above.
+package topdown
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/vox"
+)
+
+// ErrNoColor indicates that a block type on the map has no color.
+const ErrNoColor log.ConstErr = "block type has no color"
+
+// Options control how a map is drawn.
+type Options struct {
+	// Colors are the colors of the top blocks of columns.
+	Colors vox.BlockColors
+	// Shade makes higher columns lighter and lower columns darker.
+	Shade bool
+	// Grid draws the borders of chunks.
+	Grid bool
+}
+
+// column is the top block of a column of voxels.
+type column struct {
+	height    int32
+	blockType chunk.BlockType
+}
+
+// Render draws the saved chunks of cacheMod from above, with X to the right
+// and Z down. Every pixel is a column of voxels, colored by its highest block
+// that isn't air. Columns without any such block are transparent. The second
+// return value is the voxel coordinate of the top left pixel, whose Y is 0.
+func Render(cacheMod cache.Interface, settingsRepo settings.Interface, options Options) (*image.RGBA, chunk.VoxelCoordinate, error) {
+	size := int32(settingsRepo.GetChunkSize())
+	positions, err := cacheMod.Chunks()
+	if err != nil {
+		return nil, chunk.VoxelCoordinate{}, err
+	}
+	stacks := map[[2]int32][]int32{}
+	for _, pos := range positions {
+		key := [2]int32{pos.X, pos.Z}
+		stacks[key] = append(stacks[key], pos.Y)
+	}
+	if len(stacks) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0)), chunk.VoxelCoordinate{}, nil
+	}
+	var low, high [2]int32
+	first := true
+	for key := range stacks {
+		for i := range key {
+			if first || key[i] < low[i] {
+				low[i] = key[i]
+			}
+			if first || key[i] > high[i] {
+				high[i] = key[i]
+			}
+		}
+		first = false
+	}
+	width := int(high[0]-low[0]+1) * int(size)
+	depth := int(high[1]-low[1]+1) * int(size)
+	columns := make([]column, width*depth)
+	found := make([]bool, width*depth)
+	for key, ys := range stacks {
+		// the highest chunk with a block decides a column
+		sort.Slice(ys, func(i, j int) bool { return ys[i] > ys[j] })
+		for _, y := range ys {
+			pos := chunk.ChunkCoordinate{X: key[0], Y: y, Z: key[1]}
+			ch, err := cacheMod.Load(pos)
+			if err != nil {
+				log.Warnf("failed to load chunk %v: %v", pos, err)
+				continue
+			}
+			for i := int32(0); i < size; i++ {
+				for k := int32(0); k < size; k++ {
+					px := int(key[0]-low[0])*int(size) + int(i)
+					pz := int(key[1]-low[1])*int(size) + int(k)
+					idx := pz*width + px
+					if found[idx] {
+						continue
+					}
+					for j := size - 1; j >= 0; j-- {
+						vc := chunk.VoxelCoordinate{X: key[0]*size + i, Y: y*size + j, Z: key[1]*size + k}
+						if bt := ch.BlockType(vc); bt != chunk.BlockTypeAir {
+							columns[idx] = column{height: vc.Y, blockType: bt}
+							found[idx] = true
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, depth))
+	var lowest, highest int32
+	first = true
+	for idx, col := range columns {
+		if !found[idx] {
+			continue
+		}
+		if first || col.height < lowest {
+			lowest = col.height
+		}
+		if first || col.height > highest {
+			highest = col.height
+		}
+		first = false
+	}
+	for idx, col := range columns {
+		if !found[idx] {
+			continue
+		}
+		c, ok := options.Colors[col.blockType]
+		if !ok {
+			return nil, chunk.VoxelCoordinate{}, fmt.Errorf("%w: %v", ErrNoColor, col.blockType)
+		}
+		if options.Shade && highest > lowest {
+			t := float64(col.height-lowest) / float64(highest-lowest)
+			c = scale(c, 0.6+0.8*t)
+		}
+		img.SetRGBA(idx%width, idx/width, c)
+	}
+	if options.Grid {
+		for pz := 0; pz < depth; pz++ {
+			for px := 0; px < width; px++ {
+				if px%int(size) != 0 && pz%int(size) != 0 {
+					continue
+				}
+				c := img.RGBAAt(px, pz)
+				if c.A == 0 {
+					img.SetRGBA(px, pz, color.RGBA{A: 64})
+				} else {
+					img.SetRGBA(px, pz, scale(c, 0.75))
+				}
+			}
+		}
+	}
+	corner := chunk.VoxelCoordinate{X: low[0] * size, Z: low[1] * size}
+	return img, corner, nil
+}
+
+// scale multiplies the red, green and blue of c by f, up to white.
+func scale(c color.RGBA, f float64) color.RGBA {
+	component := func(v uint8) uint8 {
+		scaled := float64(v) * f
+		if scaled > 255 {
+			return 255
+		}
+		return uint8(scaled)
+	}
+	return color.RGBA{R: component(c.R), G: component(c.G), B: component(c.B), A: c.A}
+}
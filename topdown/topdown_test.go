@@ -0,0 +1,122 @@
+package topdown_test
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/cache"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/topdown"
+	"github.com/kroppt/voxels/vox"
+	"github.com/spf13/afero"
+)
+
+var testSettings = settings.FnRepository{
+	FnGetChunkSize:  func() uint32 { return 2 },
+	FnGetRegionSize: func() uint32 { return 2 },
+}
+
+var (
+	stone = color.RGBA{R: 100, G: 100, B: 100, A: 255}
+	leaf  = color.RGBA{G: 200, A: 255}
+)
+
+// newTestCache saves chunks with the given blocks and no others.
+func newTestCache(blocks map[chunk.VoxelCoordinate]chunk.BlockType) *cache.Module {
+	cacheMod := cache.New(afero.NewMemMapFs(), testSettings)
+	chunks := map[chunk.ChunkCoordinate]chunk.Chunk{}
+	for vc, bt := range blocks {
+		pos := chunk.VoxelCoordToChunkCoord(vc, 2)
+		ch, ok := chunks[pos]
+		if !ok {
+			ch = chunk.NewChunkEmpty(pos, 2)
+			chunks[pos] = ch
+		}
+		ch.SetBlockType(vc, bt)
+	}
+	for _, ch := range chunks {
+		cacheMod.Save(ch)
+	}
+	return cacheMod
+}
+
+func TestRenderColorsHighestBlock(t *testing.T) {
+	t.Parallel()
+	cacheMod := newTestCache(map[chunk.VoxelCoordinate]chunk.BlockType{
+		{X: -2, Y: 0, Z: 0}: chunk.BlockTypeStone,
+		{X: -2, Y: 3, Z: 0}: chunk.BlockTypeLeaf,
+		{X: -1, Y: 1, Z: 1}: chunk.BlockTypeStone,
+		{X: 1, Y: -1, Z: 3}: chunk.BlockTypeStone,
+	})
+	colors := vox.BlockColors{chunk.BlockTypeStone: stone, chunk.BlockTypeLeaf: leaf}
+
+	img, corner, err := topdown.Render(cacheMod, testSettings, topdown.Options{Colors: colors})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (chunk.VoxelCoordinate{X: -2}); corner != expect {
+		t.Fatalf("expected corner %v but got %v", expect, corner)
+	}
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 4 || h != 4 {
+		t.Fatalf("expected a 4x4 map but got %vx%v", w, h)
+	}
+	expect := map[[2]int]color.RGBA{
+		{0, 0}: leaf,
+		{1, 1}: stone,
+		{3, 3}: stone,
+		{1, 0}: {},
+		{2, 0}: {},
+	}
+	for p, c := range expect {
+		if actual := img.RGBAAt(p[0], p[1]); actual != c {
+			t.Fatalf("expected %v at %v but got %v", c, p, actual)
+		}
+	}
+}
+
+func TestRenderShadingAndGrid(t *testing.T) {
+	t.Parallel()
+	cacheMod := newTestCache(map[chunk.VoxelCoordinate]chunk.BlockType{
+		{X: 0, Y: 0, Z: 1}: chunk.BlockTypeStone,
+		{X: 1, Y: 1, Z: 1}: chunk.BlockTypeStone,
+	})
+	colors := vox.BlockColors{chunk.BlockTypeStone: stone}
+
+	img, _, err := topdown.Render(cacheMod, testSettings, topdown.Options{
+		Colors: colors,
+		Shade:  true,
+		Grid:   true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lowest column is darker and also on the grid
+	low := img.RGBAAt(0, 1)
+	high := img.RGBAAt(1, 1)
+	if expect := (color.RGBA{R: 45, G: 45, B: 45, A: 255}); low != expect {
+		t.Fatalf("expected %v on the lowest column but got %v", expect, low)
+	}
+	if expect := (color.RGBA{R: 140, G: 140, B: 140, A: 255}); high != expect {
+		t.Fatalf("expected %v on the highest column but got %v", expect, high)
+	}
+	if expect := (color.RGBA{A: 64}); img.RGBAAt(1, 0) != expect {
+		t.Fatalf("expected %v on the grid but got %v", expect, img.RGBAAt(1, 0))
+	}
+}
+
+func TestRenderMissingColor(t *testing.T) {
+	t.Parallel()
+	cacheMod := newTestCache(map[chunk.VoxelCoordinate]chunk.BlockType{
+		{}: chunk.BlockTypeClay,
+	})
+
+	_, _, err := topdown.Render(cacheMod, testSettings, topdown.Options{Colors: vox.BlockColors{}})
+
+	if !errors.Is(err, topdown.ErrNoColor) {
+		t.Fatalf("expected %v but got %v", topdown.ErrNoColor, err)
+	}
+}
@@ -0,0 +1,102 @@
+package vox
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+)
+
+// BlockColors is the color of each block type in .vox files.
+type BlockColors map[chunk.BlockType]color.RGBA
+
+// DefaultBlockColors returns the colors that most resemble the block
+// textures.
+func DefaultBlockColors() BlockColors {
+	return BlockColors{
+		chunk.BlockTypeDirt:       {R: 134, G: 96, B: 67, A: 255},
+		chunk.BlockTypeGrass:      {R: 95, G: 159, B: 53, A: 255},
+		chunk.BlockTypeGrassSides: {R: 110, G: 140, B: 60, A: 255},
+		chunk.BlockTypeLabeled:    {R: 255, G: 255, B: 255, A: 255},
+		chunk.BlockTypeCorrupted:  {R: 255, G: 0, B: 220, A: 255},
+		chunk.BlockTypeStone:      {R: 125, G: 125, B: 125, A: 255},
+		chunk.BlockTypeLight:      {R: 255, G: 240, B: 180, A: 255},
+		chunk.BlockTypeSnow:       {R: 240, G: 250, B: 255, A: 255},
+		chunk.BlockTypeSnowSides:  {R: 200, G: 210, B: 215, A: 255},
+		chunk.BlockTypeSand:       {R: 219, G: 207, B: 163, A: 255},
+		chunk.BlockTypeLog:        {R: 102, G: 81, B: 50, A: 255},
+		chunk.BlockTypeLogDark:    {R: 60, G: 46, B: 29, A: 255},
+		chunk.BlockTypeClay:       {R: 160, G: 166, B: 179, A: 255},
+		chunk.BlockTypeLeaf:       {R: 60, G: 120, B: 40, A: 255},
+	}
+}
+
+// ErrColorTable indicates that a table of block colors could not be read.
+const ErrColorTable log.ConstErr = "invalid block color table"
+
+// ReadBlockColors reads a table of block colors. Every line is a block type
+// followed by the red, green and blue of its color:
+//
+//	<block type> <red> <green> <blue>
+//
+// Empty lines and lines starting with # are ignored.
+func ReadBlockColors(r io.Reader) (BlockColors, error) {
+	colors := BlockColors{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%w at line %v: expected a block type and 3 components", ErrColorTable, lineNumber)
+		}
+		bt, ok := chunk.ParseBlockType(fields[0])
+		if !ok || bt == chunk.BlockTypeAir {
+			return nil, fmt.Errorf("%w at line %v: invalid block type %q", ErrColorTable, lineNumber, fields[0])
+		}
+		var components [3]uint8
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%w at line %v: invalid component %q", ErrColorTable, lineNumber, field)
+			}
+			components[i] = uint8(v)
+		}
+		colors[bt] = color.RGBA{R: components[0], G: components[1], B: components[2], A: 255}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return colors, nil
+}
+
+// Nearest returns the block type whose color is closest to c, and false if
+// there are no block types. Of equally close block types, the first one is
+// returned.
+func (colors BlockColors) Nearest(c color.RGBA) (chunk.BlockType, bool) {
+	nearest := chunk.BlockTypeAir
+	best := -1
+	for bt, bc := range colors {
+		if bt == chunk.BlockTypeAir {
+			continue
+		}
+		dr := int(bc.R) - int(c.R)
+		dg := int(bc.G) - int(c.G)
+		db := int(bc.B) - int(c.B)
+		distance := dr*dr + dg*dg + db*db
+		if best == -1 || distance < best || (distance == best && bt < nearest) {
+			nearest = bt
+			best = distance
+		}
+	}
+	return nearest, best != -1
+}
@@ -0,0 +1,226 @@
+package vox
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/log"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// ErrInvalidBox indicates that a box's minimum is past its maximum.
+const ErrInvalidBox log.ConstErr = "box minimum is past its maximum"
+
+// ErrNoColor indicates that a block type has no color to export it with.
+const ErrNoColor log.ConstErr = "block type has no color"
+
+// World is the part of world.Interface that moving blocks in and out of .vox
+// files needs.
+type World interface {
+	LoadChunk(chunk.ChunkCoordinate)
+	UnloadChunk(chunk.ChunkCoordinate)
+	IsVoxelLoaded(chunk.VoxelCoordinate) bool
+	GetBlockType(chunk.VoxelCoordinate) chunk.BlockType
+	SetBlocks([]world.BlockEdit)
+}
+
+// Box is the voxels from Min to Max, inclusive.
+type Box struct {
+	Min chunk.VoxelCoordinate
+	Max chunk.VoxelCoordinate
+}
+
+func (box Box) validate() error {
+	if box.Min.X > box.Max.X || box.Min.Y > box.Max.Y || box.Min.Z > box.Max.Z {
+		return fmt.Errorf("%w: %v to %v", ErrInvalidBox, box.Min, box.Max)
+	}
+	return nil
+}
+
+// voxSize returns the size of box in a .vox scene.
+func (box Box) voxSize() [3]int32 {
+	return [3]int32{
+		box.Max.X - box.Min.X + 1,
+		box.Max.Z - box.Min.Z + 1,
+		box.Max.Y - box.Min.Y + 1,
+	}
+}
+
+// toVox returns where vc is in a .vox scene of box. The world's Y axis points
+// up, and .vox's Z axis does. To keep the handedness, the world's Z axis
+// becomes .vox's negative Y axis.
+func (box Box) toVox(vc chunk.VoxelCoordinate) [3]int32 {
+	return [3]int32{
+		vc.X - box.Min.X,
+		box.Max.Z - vc.Z,
+		vc.Y - box.Min.Y,
+	}
+}
+
+// forEachChunk calls fn with every chunk that overlaps box, loading the
+// chunk in worldMod for the duration of the call if it wasn't loaded yet.
+// The voxels from and to are the corners of the part of the chunk in box.
+// It stops at the first error fn returns.
+func (box Box) forEachChunk(worldMod World, chunkSize uint32, fn func(from, to chunk.VoxelCoordinate) error) error {
+	minChunk := chunk.VoxelCoordToChunkCoord(box.Min, chunkSize)
+	maxChunk := chunk.VoxelCoordToChunkCoord(box.Max, chunkSize)
+	size := int32(chunkSize)
+	for x := minChunk.X; x <= maxChunk.X; x++ {
+		for y := minChunk.Y; y <= maxChunk.Y; y++ {
+			for z := minChunk.Z; z <= maxChunk.Z; z++ {
+				pos := chunk.ChunkCoordinate{X: x, Y: y, Z: z}
+				corner := chunk.VoxelCoordinate{X: x * size, Y: y * size, Z: z * size}
+				loaded := worldMod.IsVoxelLoaded(corner)
+				if !loaded {
+					worldMod.LoadChunk(pos)
+				}
+				err := fn(chunk.VoxelCoordinate{
+					X: max(corner.X, box.Min.X),
+					Y: max(corner.Y, box.Min.Y),
+					Z: max(corner.Z, box.Min.Z),
+				}, chunk.VoxelCoordinate{
+					X: min(corner.X+size-1, box.Max.X),
+					Y: min(corner.Y+size-1, box.Max.Y),
+					Z: min(corner.Z+size-1, box.Max.Z),
+				})
+				if !loaded {
+					worldMod.UnloadChunk(pos)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func forEachVoxel(from, to chunk.VoxelCoordinate, fn func(chunk.VoxelCoordinate) error) error {
+	for x := from.X; x <= to.X; x++ {
+		for y := from.Y; y <= to.Y; y++ {
+			for z := from.Z; z <= to.Z; z++ {
+				if err := fn(chunk.VoxelCoordinate{X: x, Y: y, Z: z}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Export writes the blocks of worldMod in box to w as a .vox file. Chunks
+// that aren't loaded are loaded while they are read. Boxes larger than
+// MaxModelSize are split into several models.
+func Export(w io.Writer, worldMod World, settingsRepo settings.Interface, box Box, colors BlockColors) error {
+	if err := box.validate(); err != nil {
+		return err
+	}
+	var f File
+	indices, err := assignColors(colors, &f.Palette)
+	if err != nil {
+		return err
+	}
+	size := box.voxSize()
+	models := map[[3]int32]*Model{}
+	err = box.forEachChunk(worldMod, settingsRepo.GetChunkSize(), func(from, to chunk.VoxelCoordinate) error {
+		return forEachVoxel(from, to, func(vc chunk.VoxelCoordinate) error {
+			bt := worldMod.GetBlockType(vc)
+			if bt == chunk.BlockTypeAir {
+				return nil
+			}
+			index, ok := indices[bt]
+			if !ok {
+				return fmt.Errorf("%w: %v", ErrNoColor, bt)
+			}
+			pos := box.toVox(vc)
+			var key [3]int32
+			for i := range pos {
+				key[i] = pos[i] / MaxModelSize
+			}
+			m, ok := models[key]
+			if !ok {
+				m = &Model{}
+				for i := range key {
+					m.Offset[i] = key[i] * MaxModelSize
+					m.Size[i] = min(size[i]-m.Offset[i], MaxModelSize)
+				}
+				models[key] = m
+			}
+			m.Voxels = append(m.Voxels, Voxel{
+				X:     uint8(pos[0] - m.Offset[0]),
+				Y:     uint8(pos[1] - m.Offset[1]),
+				Z:     uint8(pos[2] - m.Offset[2]),
+				Color: index,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	keys := make([][3]int32, 0, len(models))
+	for key := range models {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+	for _, key := range keys {
+		f.Models = append(f.Models, *models[key])
+	}
+	if len(f.Models) == 0 {
+		// a file needs a model, even if there is nothing in it
+		f.Models = append(f.Models, Model{Size: [3]int32{
+			min(size[0], MaxModelSize),
+			min(size[1], MaxModelSize),
+			min(size[2], MaxModelSize),
+		}})
+	}
+	return Write(w, f)
+}
+
+// assignColors gives every block type in colors a color index, in block type
+// order, and puts the colors in palette.
+func assignColors(colors BlockColors, palette *[256]color.RGBA) (map[chunk.BlockType]uint8, error) {
+	types := make([]chunk.BlockType, 0, len(colors))
+	for bt := range colors {
+		if bt != chunk.BlockTypeAir {
+			types = append(types, bt)
+		}
+	}
+	if len(types) > len(palette)-1 {
+		return nil, fmt.Errorf("%v block types don't fit in a palette", len(types))
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	indices := make(map[chunk.BlockType]uint8, len(types))
+	for i, bt := range types {
+		indices[bt] = uint8(i + 1)
+		palette[i+1] = colors[bt]
+	}
+	return indices, nil
+}
+
+func max(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
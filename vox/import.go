@@ -0,0 +1,83 @@
+package vox
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+)
+
+// Import places the voxels of f in worldMod, with the lowest corner of the
+// scene at origin. Every color is placed as the block type with the nearest
+// color in colors. Chunks that aren't loaded are loaded while they are
+// edited, and the edits of a chunk are made at once.
+func Import(f File, worldMod World, settingsRepo settings.Interface, origin chunk.VoxelCoordinate, colors BlockColors) error {
+	var types [256]chunk.BlockType
+	for i := 1; i < len(types); i++ {
+		bt, ok := colors.Nearest(f.Palette[i])
+		if !ok {
+			return fmt.Errorf("%w: no block types to import as", ErrNoColor)
+		}
+		types[i] = bt
+	}
+	if len(f.Models) == 0 {
+		return nil
+	}
+	low := f.Models[0].Offset
+	high := f.Models[0].Offset
+	for _, m := range f.Models {
+		for i := range low {
+			low[i] = min(low[i], m.Offset[i])
+			high[i] = max(high[i], m.Offset[i]+m.Size[i]-1)
+		}
+	}
+	chunkSize := settingsRepo.GetChunkSize()
+	edits := map[chunk.ChunkCoordinate][]world.BlockEdit{}
+	for _, m := range f.Models {
+		for _, v := range m.Voxels {
+			if v.Color == 0 {
+				continue
+			}
+			// the inverse of Box.toVox
+			vc := chunk.VoxelCoordinate{
+				X: origin.X + m.Offset[0] + int32(v.X) - low[0],
+				Y: origin.Y + m.Offset[2] + int32(v.Z) - low[2],
+				Z: origin.Z + high[1] - m.Offset[1] - int32(v.Y),
+			}
+			key := chunk.VoxelCoordToChunkCoord(vc, chunkSize)
+			edits[key] = append(edits[key], world.BlockEdit{
+				VoxPos:    vc,
+				BlockType: types[v.Color],
+			})
+		}
+	}
+	keys := make([]chunk.ChunkCoordinate, 0, len(edits))
+	for key := range edits {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.Z < b.Z
+	})
+	size := int32(chunkSize)
+	for _, key := range keys {
+		corner := chunk.VoxelCoordinate{X: key.X * size, Y: key.Y * size, Z: key.Z * size}
+		loaded := worldMod.IsVoxelLoaded(corner)
+		if !loaded {
+			worldMod.LoadChunk(key)
+		}
+		worldMod.SetBlocks(edits[key])
+		if !loaded {
+			worldMod.UnloadChunk(key)
+		}
+	}
+	return nil
+}
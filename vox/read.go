@@ -0,0 +1,340 @@
+package vox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kroppt/voxels/log"
+)
+
+// ErrMalformed indicates that a .vox file could not be read.
+const ErrMalformed log.ConstErr = "malformed vox file"
+
+// maxFileSize is the largest .vox file that is read, in bytes.
+const maxFileSize = 1 << 30
+
+// Read reads a .vox file. Models are placed by the scene graph if there is
+// one, and chunks other than the ones that Write writes are skipped. A file
+// without a palette has MagicaVoxel's default palette.
+func Read(r io.Reader) (File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return File{}, err
+	}
+	if len(data) > maxFileSize {
+		return File{}, fmt.Errorf("%w: larger than %v bytes", ErrMalformed, maxFileSize)
+	}
+	d := &decoder{data: data}
+	if magic := d.take(4); d.err == nil && string(magic) != "VOX " {
+		return File{}, fmt.Errorf("%w: not a vox file", ErrMalformed)
+	}
+	d.int()
+	id, _, children := d.chunk()
+	if d.err == nil && id != "MAIN" {
+		return File{}, fmt.Errorf("%w: expected MAIN chunk but got %q", ErrMalformed, id)
+	}
+	if d.err != nil {
+		return File{}, d.err
+	}
+	return readMain(children)
+}
+
+func readMain(children []byte) (File, error) {
+	var f File
+	s := scene{
+		transforms: map[int32]transform{},
+		groups:     map[int32][]int32{},
+		shapes:     map[int32]int32{},
+	}
+	d := &decoder{data: children}
+	hasPalette := false
+	for d.err == nil && len(d.data) > 0 {
+		id, content, _ := d.chunk()
+		if d.err != nil {
+			break
+		}
+		c := &decoder{data: content}
+		switch id {
+		case "SIZE":
+			var m Model
+			for i := range m.Size {
+				m.Size[i] = c.int()
+				if c.err == nil && (m.Size[i] < 1 || m.Size[i] > MaxModelSize) {
+					c.fail("model size %v", m.Size[i])
+				}
+			}
+			f.Models = append(f.Models, m)
+		case "XYZI":
+			if len(f.Models) == 0 || f.Models[len(f.Models)-1].Voxels != nil {
+				return File{}, fmt.Errorf("%w: XYZI without SIZE", ErrMalformed)
+			}
+			m := &f.Models[len(f.Models)-1]
+			count := c.int()
+			if c.err == nil && (count < 0 || int(count) > len(c.data)/4) {
+				c.fail("%v voxels", count)
+			}
+			if c.err != nil {
+				break
+			}
+			m.Voxels = make([]Voxel, 0, count)
+			for i := int32(0); i < count && c.err == nil; i++ {
+				b := c.take(4)
+				if c.err != nil {
+					break
+				}
+				v := Voxel{X: b[0], Y: b[1], Z: b[2], Color: b[3]}
+				if int32(v.X) >= m.Size[0] || int32(v.Y) >= m.Size[1] || int32(v.Z) >= m.Size[2] {
+					c.fail("voxel %v outside of size %v", v, m.Size)
+				}
+				m.Voxels = append(m.Voxels, v)
+			}
+		case "RGBA":
+			for i := 1; i <= 256 && c.err == nil; i++ {
+				b := c.take(4)
+				if c.err == nil && i < 256 {
+					f.Palette[i] = color.RGBA{R: b[0], G: b[1], B: b[2], A: b[3]}
+				}
+			}
+			hasPalette = true
+		case "nTRN":
+			s.readTransform(c)
+		case "nGRP":
+			s.readGroup(c)
+		case "nSHP":
+			s.readShape(c)
+		}
+		if c.err != nil {
+			return File{}, fmt.Errorf("%v chunk: %w", id, c.err)
+		}
+	}
+	if d.err != nil {
+		return File{}, d.err
+	}
+	if len(f.Models) == 0 {
+		return File{}, fmt.Errorf("%w: no models", ErrMalformed)
+	}
+	if !hasPalette {
+		f.Palette = defaultPalette()
+	}
+	for i := range f.Models {
+		if f.Models[i].Voxels == nil {
+			return File{}, fmt.Errorf("%w: SIZE without XYZI", ErrMalformed)
+		}
+	}
+	if err := s.place(f.Models); err != nil {
+		return File{}, err
+	}
+	return f, nil
+}
+
+// defaultPalette returns the palette of files without an RGBA chunk, which is
+// the palette that MagicaVoxel starts with. Color indices 1 to 215 mix red,
+// green and blue in steps of 0x33 from white down to just before black, and
+// the rest are ramps of red, green, blue and grey down towards black.
+func defaultPalette() [256]color.RGBA {
+	var palette [256]color.RGBA
+	i := 1
+	for r := 5; r >= 0; r-- {
+		for g := 5; g >= 0; g-- {
+			for b := 5; b >= 0; b-- {
+				if r+g+b > 0 {
+					palette[i] = color.RGBA{R: uint8(r * 0x33), G: uint8(g * 0x33), B: uint8(b * 0x33), A: 0xff}
+					i++
+				}
+			}
+		}
+	}
+	ramp := []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+	for _, mix := range []color.RGBA{{R: 1}, {G: 1}, {B: 1}, {R: 1, G: 1, B: 1}} {
+		for _, v := range ramp {
+			palette[i] = color.RGBA{R: mix.R * v, G: mix.G * v, B: mix.B * v, A: 0xff}
+			i++
+		}
+	}
+	return palette
+}
+
+type transform struct {
+	child       int32
+	translation [3]int32
+}
+
+// scene is the scene graph of a file, which places models.
+type scene struct {
+	transforms map[int32]transform
+	groups     map[int32][]int32
+	shapes     map[int32]int32
+}
+
+func (s *scene) readTransform(d *decoder) {
+	id := d.int()
+	d.dict()
+	t := transform{child: d.int()}
+	d.int()
+	d.int()
+	frames := d.int()
+	for i := int32(0); i < frames && d.err == nil; i++ {
+		attrs := d.dict()
+		if i > 0 || attrs["_t"] == "" {
+			continue
+		}
+		fields := strings.Fields(attrs["_t"])
+		if len(fields) != 3 {
+			d.fail("translation %q", attrs["_t"])
+			return
+		}
+		for j, field := range fields {
+			v, err := strconv.ParseInt(field, 10, 32)
+			if err != nil {
+				d.fail("translation %q", attrs["_t"])
+				return
+			}
+			t.translation[j] = int32(v)
+		}
+	}
+	s.transforms[id] = t
+}
+
+func (s *scene) readGroup(d *decoder) {
+	id := d.int()
+	d.dict()
+	count := d.int()
+	if d.err == nil && (count < 0 || int(count) > len(d.data)/4) {
+		d.fail("%v children", count)
+		return
+	}
+	children := make([]int32, count)
+	for i := range children {
+		children[i] = d.int()
+	}
+	s.groups[id] = children
+}
+
+func (s *scene) readShape(d *decoder) {
+	id := d.int()
+	d.dict()
+	if count := d.int(); d.err == nil && count < 1 {
+		d.fail("shape without models")
+		return
+	}
+	s.shapes[id] = d.int()
+}
+
+// place sets the offset of every model that the scene graph places. Models
+// that it doesn't place stay where they are.
+func (s *scene) place(models []Model) error {
+	if len(s.transforms) == 0 {
+		return nil
+	}
+	var visit func(node int32, at [3]int32, depth int) error
+	visit = func(node int32, at [3]int32, depth int) error {
+		if depth > len(s.transforms)+len(s.groups)+len(s.shapes) {
+			return fmt.Errorf("%w: scene graph has a cycle", ErrMalformed)
+		}
+		if t, ok := s.transforms[node]; ok {
+			for i := range at {
+				at[i] += t.translation[i]
+			}
+			return visit(t.child, at, depth+1)
+		}
+		if children, ok := s.groups[node]; ok {
+			for _, child := range children {
+				if err := visit(child, at, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if model, ok := s.shapes[node]; ok {
+			if model < 0 || int(model) >= len(models) {
+				return fmt.Errorf("%w: shape of model %v", ErrMalformed, model)
+			}
+			m := &models[model]
+			for i := range at {
+				m.Offset[i] = at[i] - m.Size[i]/2
+			}
+			return nil
+		}
+		return fmt.Errorf("%w: scene graph node %v", ErrMalformed, node)
+	}
+	return visit(0, [3]int32{}, 0)
+}
+
+// decoder reads values from data until the first error.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, v ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %v", ErrMalformed, fmt.Sprintf(format, v...))
+	}
+}
+
+// take returns the next n bytes. After an error, it returns nil, so callers
+// have to check d.err before they look at the bytes.
+func (d *decoder) take(n int) []byte {
+	if n < 0 {
+		d.fail("negative length")
+		n = 0
+	}
+	if d.err == nil && n > len(d.data) {
+		d.fail("unexpected end of data")
+	}
+	if d.err != nil {
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// int returns the next int32, or 0 after an error.
+func (d *decoder) int() int32 {
+	b := d.take(4)
+	if d.err != nil {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(b))
+}
+
+func (d *decoder) string() string {
+	n := d.int()
+	if d.err == nil && (n < 0 || int(n) > len(d.data)) {
+		d.fail("string of %v bytes", n)
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) dict() map[string]string {
+	n := d.int()
+	if d.err == nil && (n < 0 || int(n) > len(d.data)/8) {
+		d.fail("dictionary of %v pairs", n)
+		return nil
+	}
+	dict := make(map[string]string, n)
+	for i := int32(0); i < n; i++ {
+		key := d.string()
+		dict[key] = d.string()
+	}
+	return dict
+}
+
+// chunk reads a chunk's ID, content and children.
+func (d *decoder) chunk() (string, []byte, []byte) {
+	id := string(d.take(4))
+	contentSize := d.int()
+	childrenSize := d.int()
+	if d.err == nil && (contentSize < 0 || childrenSize < 0) {
+		d.fail("chunk %q has a negative size", id)
+	}
+	content := d.take(int(contentSize))
+	children := d.take(int(childrenSize))
+	return id, content, children
+}
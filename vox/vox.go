@@ -0,0 +1,167 @@
+// Package vox reads and writes the MagicaVoxel .vox format, and moves boxes
+// of blocks between it and the world.
+//
+// A .vox file is the magic "VOX ", a version, and a MAIN chunk. Every chunk
+// is a four byte ID, the size of its content, the size of its children, its
+// content and its children. MAIN holds a SIZE and XYZI chunk per model, a
+// scene graph placing the models, and the RGBA palette. All integers are
+// little-endian int32s.
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+
+	"github.com/kroppt/voxels/log"
+)
+
+// version is the format version that is written.
+const version = 150
+
+// MaxModelSize is the largest a model may be along any axis.
+const MaxModelSize = 256
+
+// ErrInvalidModel indicates that a model can't be written as it is.
+const ErrInvalidModel log.ConstErr = "invalid vox model"
+
+// Voxel is a voxel of a model. Color is an index into the palette of the
+// file, and is never 0.
+type Voxel struct {
+	X     uint8
+	Y     uint8
+	Z     uint8
+	Color uint8
+}
+
+// Model is a box of voxels. Like in MagicaVoxel, Z points up.
+type Model struct {
+	Size [3]int32
+	// Offset is where the model's corner is in the scene.
+	Offset [3]int32
+	Voxels []Voxel
+}
+
+// File is the contents of a .vox file.
+type File struct {
+	Models []Model
+	// Palette holds the color of every color index. Index 0 is unused.
+	Palette [256]color.RGBA
+}
+
+// Write writes f to w.
+func Write(w io.Writer, f File) error {
+	var main bytes.Buffer
+	for i, m := range f.Models {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("model %v: %w", i, err)
+		}
+		var size bytes.Buffer
+		writeInts(&size, m.Size[0], m.Size[1], m.Size[2])
+		writeChunk(&main, "SIZE", size.Bytes(), nil)
+		var xyzi bytes.Buffer
+		writeInts(&xyzi, int32(len(m.Voxels)))
+		for _, v := range m.Voxels {
+			xyzi.Write([]byte{v.X, v.Y, v.Z, v.Color})
+		}
+		writeChunk(&main, "XYZI", xyzi.Bytes(), nil)
+	}
+	writeScene(&main, f.Models)
+	var rgba bytes.Buffer
+	// the palette is stored from color index 1 on, and the last entry is
+	// never used
+	for _, c := range f.Palette[1:] {
+		rgba.Write([]byte{c.R, c.G, c.B, c.A})
+	}
+	rgba.Write([]byte{0, 0, 0, 0})
+	writeChunk(&main, "RGBA", rgba.Bytes(), nil)
+
+	var out bytes.Buffer
+	out.WriteString("VOX ")
+	writeInts(&out, version)
+	writeChunk(&out, "MAIN", nil, main.Bytes())
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func (m Model) validate() error {
+	for _, s := range m.Size {
+		if s < 1 || s > MaxModelSize {
+			return fmt.Errorf("%w: size %v", ErrInvalidModel, m.Size)
+		}
+	}
+	for _, v := range m.Voxels {
+		if int32(v.X) >= m.Size[0] || int32(v.Y) >= m.Size[1] || int32(v.Z) >= m.Size[2] {
+			return fmt.Errorf("%w: voxel %v outside of size %v", ErrInvalidModel, v, m.Size)
+		}
+		if v.Color == 0 {
+			return fmt.Errorf("%w: voxel %v has color 0", ErrInvalidModel, v)
+		}
+	}
+	return nil
+}
+
+// writeScene writes the scene graph that places every model at its offset: a
+// root transform, a group, and a transform and shape for each model.
+// MagicaVoxel places a model by its center, rounded down.
+func writeScene(buf *bytes.Buffer, models []Model) {
+	var content bytes.Buffer
+	writeInts(&content, 0)
+	writeDict(&content)
+	writeInts(&content, 1, -1, -1, 1)
+	writeDict(&content)
+	writeChunk(buf, "nTRN", content.Bytes(), nil)
+
+	content.Reset()
+	writeInts(&content, 1)
+	writeDict(&content)
+	writeInts(&content, int32(len(models)))
+	for i := range models {
+		writeInts(&content, int32(2+2*i))
+	}
+	writeChunk(buf, "nGRP", content.Bytes(), nil)
+
+	for i, m := range models {
+		content.Reset()
+		writeInts(&content, int32(2+2*i))
+		writeDict(&content)
+		writeInts(&content, int32(3+2*i), -1, 0, 1)
+		writeDict(&content, "_t", fmt.Sprintf("%v %v %v",
+			m.Offset[0]+m.Size[0]/2,
+			m.Offset[1]+m.Size[1]/2,
+			m.Offset[2]+m.Size[2]/2,
+		))
+		writeChunk(buf, "nTRN", content.Bytes(), nil)
+
+		content.Reset()
+		writeInts(&content, int32(3+2*i))
+		writeDict(&content)
+		writeInts(&content, 1, int32(i))
+		writeDict(&content)
+		writeChunk(buf, "nSHP", content.Bytes(), nil)
+	}
+}
+
+func writeChunk(buf *bytes.Buffer, id string, content, children []byte) {
+	buf.WriteString(id)
+	writeInts(buf, int32(len(content)), int32(len(children)))
+	buf.Write(content)
+	buf.Write(children)
+}
+
+func writeInts(buf *bytes.Buffer, values ...int32) {
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+}
+
+// writeDict writes a dictionary of the given keys and values, in pairs.
+func writeDict(buf *bytes.Buffer, pairs ...string) {
+	writeInts(buf, int32(len(pairs)/2))
+	for _, s := range pairs {
+		writeInts(buf, int32(len(s)))
+		buf.WriteString(s)
+	}
+}
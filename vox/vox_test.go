@@ -0,0 +1,484 @@
+package vox_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kroppt/voxels/chunk"
+	"github.com/kroppt/voxels/modules/world"
+	"github.com/kroppt/voxels/repositories/settings"
+	"github.com/kroppt/voxels/vox"
+)
+
+type rawChunk struct {
+	id      string
+	content []byte
+}
+
+// readMain returns the children of the MAIN chunk of a .vox file.
+func readMain(t *testing.T, data []byte) []rawChunk {
+	t.Helper()
+	if string(data[:4]) != "VOX " {
+		t.Fatalf("expected magic \"VOX \" but got %q", data[:4])
+	}
+	if string(data[8:12]) != "MAIN" {
+		t.Fatalf("expected MAIN chunk but got %q", data[8:12])
+	}
+	children := data[20:]
+	if size := binary.LittleEndian.Uint32(data[16:20]); int(size) != len(children) {
+		t.Fatalf("expected MAIN children to be %v bytes but got %v", len(children), size)
+	}
+	var chunks []rawChunk
+	for len(children) > 0 {
+		contentSize := binary.LittleEndian.Uint32(children[4:8])
+		chunks = append(chunks, rawChunk{
+			id:      string(children[:4]),
+			content: children[12 : 12+contentSize],
+		})
+		children = children[12+contentSize:]
+	}
+	return chunks
+}
+
+func ints(data []byte) []int32 {
+	values := make([]int32, len(data)/4)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, values)
+	return values
+}
+
+func TestWriteChunkLayout(t *testing.T) {
+	t.Parallel()
+	f := vox.File{
+		Models: []vox.Model{{
+			Size:   [3]int32{2, 3, 4},
+			Voxels: []vox.Voxel{{X: 1, Y: 2, Z: 3, Color: 5}},
+		}},
+	}
+	f.Palette[5] = color.RGBA{R: 1, G: 2, B: 3, A: 4}
+	var buf bytes.Buffer
+
+	if err := vox.Write(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := readMain(t, buf.Bytes())
+	var ids []string
+	for _, c := range chunks {
+		ids = append(ids, c.id)
+	}
+	expectIDs := []string{"SIZE", "XYZI", "nTRN", "nGRP", "nTRN", "nSHP", "RGBA"}
+	if !reflect.DeepEqual(ids, expectIDs) {
+		t.Fatalf("expected chunks %v but got %v", expectIDs, ids)
+	}
+	if size := ints(chunks[0].content); !reflect.DeepEqual(size, []int32{2, 3, 4}) {
+		t.Fatalf("expected size [2 3 4] but got %v", size)
+	}
+	if xyzi := chunks[1].content; !bytes.Equal(xyzi, []byte{1, 0, 0, 0, 1, 2, 3, 5}) {
+		t.Fatalf("expected one voxel but got %v", xyzi)
+	}
+	rgba := chunks[6].content
+	if len(rgba) != 1024 {
+		t.Fatalf("expected 256 colors but got %v bytes", len(rgba))
+	}
+	if !bytes.Equal(rgba[16:20], []byte{1, 2, 3, 4}) {
+		t.Fatalf("expected color index 5 in the 5th entry but got %v", rgba[16:20])
+	}
+}
+
+func TestWriteInvalidModels(t *testing.T) {
+	t.Parallel()
+	models := map[string]vox.Model{
+		"empty size":    {Size: [3]int32{0, 1, 1}},
+		"too large":     {Size: [3]int32{1, 257, 1}},
+		"voxel outside": {Size: [3]int32{1, 1, 1}, Voxels: []vox.Voxel{{X: 1, Color: 1}}},
+		"color index 0": {Size: [3]int32{1, 1, 1}, Voxels: []vox.Voxel{{}}},
+	}
+	for name, m := range models {
+		m := m
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := vox.Write(&bytes.Buffer{}, vox.File{Models: []vox.Model{m}})
+			if !errors.Is(err, vox.ErrInvalidModel) {
+				t.Fatalf("expected %v but got %v", vox.ErrInvalidModel, err)
+			}
+		})
+	}
+}
+
+// fakeWorld holds blocks in chunks of size 4 and tracks which are loaded.
+type fakeWorld struct {
+	world.FnModule
+	blocks map[chunk.VoxelCoordinate]chunk.BlockType
+	loaded map[chunk.ChunkCoordinate]bool
+	loads  int
+}
+
+func newFakeWorld(t *testing.T) *fakeWorld {
+	w := &fakeWorld{
+		blocks: map[chunk.VoxelCoordinate]chunk.BlockType{},
+		loaded: map[chunk.ChunkCoordinate]bool{},
+	}
+	w.FnLoadChunk = func(pos chunk.ChunkCoordinate) {
+		if w.loaded[pos] {
+			t.Fatalf("loaded chunk %v twice", pos)
+		}
+		w.loaded[pos] = true
+		w.loads++
+	}
+	w.FnUnloadChunk = func(pos chunk.ChunkCoordinate) {
+		if !w.loaded[pos] {
+			t.Fatalf("unloaded chunk %v that isn't loaded", pos)
+		}
+		delete(w.loaded, pos)
+	}
+	w.FnIsVoxelLoaded = func(vc chunk.VoxelCoordinate) bool {
+		return w.loaded[chunk.VoxelCoordToChunkCoord(vc, 4)]
+	}
+	w.FnGetBlockType = func(vc chunk.VoxelCoordinate) chunk.BlockType {
+		if !w.FnIsVoxelLoaded(vc) {
+			t.Fatalf("read voxel %v that isn't loaded", vc)
+		}
+		return w.blocks[vc]
+	}
+	w.FnSetBlocks = func(edits []world.BlockEdit) {
+		for _, edit := range edits {
+			if !w.FnIsVoxelLoaded(edit.VoxPos) {
+				t.Fatalf("edited voxel %v that isn't loaded", edit.VoxPos)
+			}
+			w.blocks[edit.VoxPos] = edit.BlockType
+		}
+	}
+	return w
+}
+
+var testSettings = &settings.FnRepository{
+	FnGetChunkSize: func() uint32 { return 4 },
+}
+
+func TestExportSplitsLargeBoxes(t *testing.T) {
+	t.Parallel()
+	w := newFakeWorld(t)
+	alreadyLoaded := chunk.ChunkCoordinate{X: 0, Y: 0, Z: 0}
+	w.loaded[alreadyLoaded] = true
+	w.blocks[chunk.VoxelCoordinate{X: -10, Y: 0, Z: 1}] = chunk.BlockTypeStone
+	w.blocks[chunk.VoxelCoordinate{X: 300, Y: 1, Z: 0}] = chunk.BlockTypeLeaf
+	// outside of the box
+	w.blocks[chunk.VoxelCoordinate{X: 300, Y: 2, Z: 0}] = chunk.BlockTypeLeaf
+	box := vox.Box{
+		Min: chunk.VoxelCoordinate{X: -10, Y: 0, Z: 0},
+		Max: chunk.VoxelCoordinate{X: 300, Y: 1, Z: 1},
+	}
+	var buf bytes.Buffer
+
+	err := vox.Export(&buf, w, testSettings, box, vox.DefaultBlockColors())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.loaded, map[chunk.ChunkCoordinate]bool{alreadyLoaded: true}) {
+		t.Fatalf("expected only chunks that were loaded before to stay loaded, but got %v", w.loaded)
+	}
+	// chunks -3 to 75 along X, except the one that was loaded
+	if w.loads != 78 {
+		t.Fatalf("expected to load 78 chunks but loaded %v", w.loads)
+	}
+	var sizes [][]int32
+	var xyzis [][]byte
+	for _, c := range readMain(t, buf.Bytes()) {
+		switch c.id {
+		case "SIZE":
+			sizes = append(sizes, ints(c.content))
+		case "XYZI":
+			xyzis = append(xyzis, c.content)
+		}
+	}
+	expectSizes := [][]int32{{256, 2, 2}, {55, 2, 2}}
+	if !reflect.DeepEqual(sizes, expectSizes) {
+		t.Fatalf("expected models of size %v but got %v", expectSizes, sizes)
+	}
+	stone := byte(6)
+	leaf := byte(14)
+	// the world's Z axis is .vox's negative Y axis
+	expectXYZIs := [][]byte{
+		{1, 0, 0, 0, 0, 0, 0, stone},
+		{1, 0, 0, 0, 54, 1, 1, leaf},
+	}
+	if !reflect.DeepEqual(xyzis, expectXYZIs) {
+		t.Fatalf("expected voxels %v but got %v", expectXYZIs, xyzis)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid box", func(t *testing.T) {
+		t.Parallel()
+		box := vox.Box{Min: chunk.VoxelCoordinate{Y: 1}}
+		err := vox.Export(&bytes.Buffer{}, newFakeWorld(t), testSettings, box, vox.DefaultBlockColors())
+		if !errors.Is(err, vox.ErrInvalidBox) {
+			t.Fatalf("expected %v but got %v", vox.ErrInvalidBox, err)
+		}
+	})
+
+	t.Run("block type without color", func(t *testing.T) {
+		t.Parallel()
+		w := newFakeWorld(t)
+		w.blocks[chunk.VoxelCoordinate{X: 5}] = chunk.BlockTypeSand
+		box := vox.Box{Max: chunk.VoxelCoordinate{X: 8}}
+		colors := vox.BlockColors{chunk.BlockTypeDirt: {A: 255}}
+		err := vox.Export(&bytes.Buffer{}, w, testSettings, box, colors)
+		if !errors.Is(err, vox.ErrNoColor) {
+			t.Fatalf("expected %v but got %v", vox.ErrNoColor, err)
+		}
+		if len(w.loaded) != 0 {
+			t.Fatalf("expected chunks to be unloaded after an error, but %v weren't", w.loaded)
+		}
+	})
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	t.Parallel()
+	from := newFakeWorld(t)
+	placed := map[chunk.VoxelCoordinate]chunk.BlockType{
+		{X: 0, Y: 0, Z: 0}:   chunk.BlockTypeStone,
+		{X: 1, Y: 2, Z: 3}:   chunk.BlockTypeLeaf,
+		{X: 299, Y: 1, Z: 2}: chunk.BlockTypeClay,
+	}
+	for vc, bt := range placed {
+		from.blocks[vc] = bt
+	}
+	box := vox.Box{Max: chunk.VoxelCoordinate{X: 299, Y: 2, Z: 3}}
+	var buf bytes.Buffer
+	if err := vox.Export(&buf, from, testSettings, box, vox.DefaultBlockColors()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := vox.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := newFakeWorld(t)
+	alreadyLoaded := chunk.ChunkCoordinate{X: -3, Y: 2, Z: 2}
+	to.loaded[alreadyLoaded] = true
+	origin := chunk.VoxelCoordinate{X: -10, Y: 8, Z: 9}
+	err = vox.Import(f, to, testSettings, origin, vox.DefaultBlockColors())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[chunk.VoxelCoordinate]chunk.BlockType{}
+	for vc, bt := range placed {
+		expect[chunk.VoxelCoordinate{X: vc.X + origin.X, Y: vc.Y + origin.Y, Z: vc.Z + origin.Z}] = bt
+	}
+	if !reflect.DeepEqual(to.blocks, expect) {
+		t.Fatalf("expected blocks %v but got %v", expect, to.blocks)
+	}
+	if !reflect.DeepEqual(to.loaded, map[chunk.ChunkCoordinate]bool{alreadyLoaded: true}) {
+		t.Fatalf("expected only chunks that were loaded before to stay loaded, but got %v", to.loaded)
+	}
+	if to.loads != 2 {
+		t.Fatalf("expected to load 2 chunks but loaded %v", to.loads)
+	}
+}
+
+func TestImportMatchesNearestColor(t *testing.T) {
+	t.Parallel()
+	w := newFakeWorld(t)
+	f := vox.File{
+		Models: []vox.Model{{
+			Size:   [3]int32{1, 1, 1},
+			Voxels: []vox.Voxel{{Color: 3}},
+		}},
+	}
+	f.Palette[3] = color.RGBA{R: 250, G: 10, B: 10, A: 255}
+	colors := vox.BlockColors{
+		chunk.BlockTypeDirt:  {R: 200, A: 255},
+		chunk.BlockTypeStone: {B: 200, A: 255},
+	}
+
+	err := vox.Import(f, w, testSettings, chunk.VoxelCoordinate{}, colors)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bt := w.blocks[chunk.VoxelCoordinate{}]; bt != chunk.BlockTypeDirt {
+		t.Fatalf("expected %v but got %v", chunk.BlockTypeDirt, bt)
+	}
+	err = vox.Import(f, w, testSettings, chunk.VoxelCoordinate{}, vox.BlockColors{})
+	if !errors.Is(err, vox.ErrNoColor) {
+		t.Fatalf("expected %v but got %v", vox.ErrNoColor, err)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	t.Parallel()
+	valid := vox.File{
+		Models: []vox.Model{{
+			Size:   [3]int32{2, 2, 2},
+			Voxels: []vox.Voxel{{X: 1, Y: 1, Z: 1, Color: 1}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := vox.Write(&buf, valid); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	withMain := func(children ...[]byte) []byte {
+		var b bytes.Buffer
+		b.WriteString("VOX ")
+		binary.Write(&b, binary.LittleEndian, int32(150))
+		b.WriteString("MAIN")
+		size := 0
+		for _, c := range children {
+			size += len(c)
+		}
+		binary.Write(&b, binary.LittleEndian, [2]int32{0, int32(size)})
+		for _, c := range children {
+			b.Write(c)
+		}
+		return b.Bytes()
+	}
+	rawChunkBytes := func(id string, values ...int32) []byte {
+		var b bytes.Buffer
+		b.WriteString(id)
+		binary.Write(&b, binary.LittleEndian, [2]int32{int32(4 * len(values)), 0})
+		binary.Write(&b, binary.LittleEndian, values)
+		return b.Bytes()
+	}
+	palette := rawChunkBytes("RGBA", make([]int32, 256)...)
+	voxel := func(x, y, z, c byte) int32 {
+		return int32(binary.LittleEndian.Uint32([]byte{x, y, z, c}))
+	}
+	cases := map[string][]byte{
+		"empty":          {},
+		"bad magic":      append([]byte("XOV "), data[4:]...),
+		"truncated":      data[:len(data)-10],
+		"no models":      withMain(palette),
+		"XYZI only":      withMain(rawChunkBytes("XYZI", 0), palette),
+		"SIZE only":      withMain(rawChunkBytes("SIZE", 1, 1, 1), palette),
+		"size too large": withMain(rawChunkBytes("SIZE", 1, 257, 1), rawChunkBytes("XYZI", 0), palette),
+		"outside size":   withMain(rawChunkBytes("SIZE", 1, 1, 1), rawChunkBytes("XYZI", 1, voxel(0, 1, 0, 1)), palette),
+		"voxel count":    withMain(rawChunkBytes("SIZE", 1, 1, 1), rawChunkBytes("XYZI", 2, voxel(0, 0, 0, 1)), palette),
+	}
+	if _, err := vox.Read(bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected a valid file to be read, but got %v", err)
+	}
+	for name, data := range cases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := vox.Read(bytes.NewReader(data))
+			if !errors.Is(err, vox.ErrMalformed) {
+				t.Fatalf("expected %v but got %v", vox.ErrMalformed, err)
+			}
+		})
+	}
+}
+
+func TestReadWithoutPaletteUsesDefaultPalette(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	b.WriteString("VOX ")
+	binary.Write(&b, binary.LittleEndian, int32(150))
+	b.WriteString("MAIN")
+	binary.Write(&b, binary.LittleEndian, [2]int32{0, 24 + 20})
+	b.WriteString("SIZE")
+	binary.Write(&b, binary.LittleEndian, []int32{12, 0, 1, 1, 1})
+	b.WriteString("XYZI")
+	binary.Write(&b, binary.LittleEndian, []int32{8, 0, 1})
+	b.Write([]byte{0, 0, 0, 216})
+
+	f, err := vox.Read(&b)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voxels := f.Models[0].Voxels; !reflect.DeepEqual(voxels, []vox.Voxel{{Color: 216}}) {
+		t.Fatalf("expected one voxel of color 216 but got %v", voxels)
+	}
+	expect := map[int]color.RGBA{
+		0:   {},
+		1:   {R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		2:   {R: 0xff, G: 0xff, B: 0xcc, A: 0xff},
+		7:   {R: 0xff, G: 0xcc, B: 0xff, A: 0xff},
+		215: {R: 0x00, G: 0x00, B: 0x33, A: 0xff},
+		216: {R: 0xee, A: 0xff},
+		226: {G: 0xee, A: 0xff},
+		236: {B: 0xee, A: 0xff},
+		246: {R: 0xee, G: 0xee, B: 0xee, A: 0xff},
+		255: {R: 0x11, G: 0x11, B: 0x11, A: 0xff},
+	}
+	for i, c := range expect {
+		if f.Palette[i] != c {
+			t.Fatalf("expected color %v of the default palette to be %v but got %v", i, c, f.Palette[i])
+		}
+	}
+}
+
+// TestReadHugeSizes isn't parallel, so that only its own allocations count.
+func TestReadHugeSizes(t *testing.T) {
+	huge := int32(0x7fffffff)
+	var mainSize bytes.Buffer
+	mainSize.WriteString("VOX ")
+	binary.Write(&mainSize, binary.LittleEndian, int32(150))
+	mainSize.WriteString("MAIN")
+	binary.Write(&mainSize, binary.LittleEndian, [2]int32{huge, 0})
+	var voxelCount bytes.Buffer
+	voxelCount.WriteString("VOX ")
+	binary.Write(&voxelCount, binary.LittleEndian, int32(150))
+	voxelCount.WriteString("MAIN")
+	binary.Write(&voxelCount, binary.LittleEndian, [2]int32{0, 24 + 16})
+	voxelCount.WriteString("SIZE")
+	binary.Write(&voxelCount, binary.LittleEndian, []int32{12, 0, 1, 1, 1})
+	voxelCount.WriteString("XYZI")
+	binary.Write(&voxelCount, binary.LittleEndian, []int32{4, 0, huge})
+	cases := map[string][]byte{
+		"chunk size":  mainSize.Bytes(),
+		"voxel count": voxelCount.Bytes(),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+
+			_, err := vox.Read(bytes.NewReader(data))
+
+			runtime.ReadMemStats(&after)
+			if !errors.Is(err, vox.ErrMalformed) {
+				t.Fatalf("expected %v but got %v", vox.ErrMalformed, err)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Fatalf("expected a malformed file to be rejected without allocating its sizes, but %v bytes were allocated", allocated)
+			}
+		})
+	}
+}
+
+func TestReadBlockColors(t *testing.T) {
+	t.Parallel()
+	table := "# comment\n\nstone 1 2 3\n  leaf 4 5 6  \n"
+
+	colors, err := vox.ReadBlockColors(strings.NewReader(table))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := vox.BlockColors{
+		chunk.BlockTypeStone: {R: 1, G: 2, B: 3, A: 255},
+		chunk.BlockTypeLeaf:  {R: 4, G: 5, B: 6, A: 255},
+	}
+	if !reflect.DeepEqual(colors, expect) {
+		t.Fatalf("expected %v but got %v", expect, colors)
+	}
+	for _, table := range []string{"stone 1 2", "rock 1 2 3", "air 1 2 3", "stone 1 2 256"} {
+		if _, err := vox.ReadBlockColors(strings.NewReader(table)); !errors.Is(err, vox.ErrColorTable) {
+			t.Fatalf("expected %v for %q but got %v", vox.ErrColorTable, table, err)
+		}
+	}
+}